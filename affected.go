@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Placeholders in test commands: the affected targets and the -run filter
+const (
+	targetsPlaceholder = "{targets}"
+	runPlaceholder     = "{run}"
+)
+
+// defaultTestCommands are used for languages without a configured
+//
+//	git config differing.test.<ext> '<command>'
+//
+// Go's targets are package directories; every other language gets the
+// changed files with its extension.
+var defaultTestCommands = map[string]string{
+	"go": "go test -json -run {run} {targets}",
+}
+
+// AffectedTests lists what would be tested for one language
+type AffectedTests struct {
+	Language string   `json:"language"`
+	Command  string   `json:"command"`
+	Targets  []string `json:"targets"`
+}
+
+// TestEvent is one line of the NDJSON stream from POST /api/run-tests.
+// Output from commands that emit go test -json events is parsed into
+// per-test results; anything else is passed through as output.
+type TestEvent struct {
+	Type     string  `json:"type"` // start, output, result, or exit
+	Language string  `json:"language"`
+	Command  string  `json:"command,omitempty"`
+	Package  string  `json:"package,omitempty"`
+	Test     string  `json:"test,omitempty"`
+	Action   string  `json:"action,omitempty"` // pass, fail, or skip
+	Elapsed  float64 `json:"elapsed,omitempty"`
+	Text     string  `json:"text,omitempty"`
+	ExitCode *int    `json:"exitCode,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// testCommands returns the default commands overlaid with configured ones
+func testCommands() map[string]string {
+	commands := make(map[string]string)
+	for ext, command := range defaultTestCommands {
+		commands[ext] = command
+	}
+	output, err := runGit("config", "--get-regexp", `^differing\.test\.`)
+	if err != nil {
+		return commands
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		key, command, _ := strings.Cut(line, " ")
+		if ext := strings.TrimPrefix(key, "differing.test."); ext != "" && command != "" {
+			commands[ext] = command
+		}
+	}
+	return commands
+}
+
+// affectedTests maps the files a diff changes to test targets for each
+// language with a test command
+func affectedTests(files []FileInfo) []AffectedTests {
+	commands := testCommands()
+	targets := make(map[string]map[string]bool)
+	add := func(ext, target string) {
+		if targets[ext] == nil {
+			targets[ext] = make(map[string]bool)
+		}
+		targets[ext][target] = true
+	}
+	for _, f := range files {
+		if f.Submodule {
+			continue
+		}
+		base := path.Base(f.Path)
+		ext := strings.TrimPrefix(path.Ext(f.Path), ".")
+		switch {
+		case base == "go.mod" || base == "go.sum":
+			// Dependency changes can break any package in the module
+			add("go", "./"+path.Join(path.Dir(f.Path), "..."))
+		case ext == "go":
+			// A package whose last file was deleted has nothing to test
+			dir := path.Dir(f.Path)
+			if info, err := os.Stat(filepath.Join(gitRoot, filepath.FromSlash(dir))); err != nil || !info.IsDir() {
+				continue
+			}
+			if dir != "." {
+				dir = "./" + dir
+			}
+			add("go", dir)
+		case ext != "" && commands[ext] != "" && f.Status != "deleted":
+			add(ext, f.Path)
+		}
+	}
+
+	var affected []AffectedTests
+	for ext, set := range targets {
+		if commands[ext] == "" {
+			continue
+		}
+		list := make([]string, 0, len(set))
+		for t := range set {
+			list = append(list, t)
+		}
+		sort.Strings(list)
+		affected = append(affected, AffectedTests{Language: ext, Command: commands[ext], Targets: list})
+	}
+	sort.Slice(affected, func(i, j int) bool { return affected[i].Language < affected[j].Language })
+	return affected
+}
+
+// affectedFromRequest resolves the diff named by the request and returns
+// its affected tests, writing an error response on failure
+func affectedFromRequest(c *gin.Context, diffID, mode string) ([]AffectedTests, bool) {
+	spec, err := resolveDiff(diffID, mode)
+	switch {
+	case errors.Is(err, errUnknownRevision):
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return nil, false
+	case err != nil:
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return nil, false
+	}
+	files, err := listDiffFiles(c.Request.Context(), spec, DiffOptions{}, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to get diff files", err)
+		return nil, false
+	}
+	return affectedTests(files), true
+}
+
+// getAffectedTests lists the test targets a diff affects
+func getAffectedTests(c *gin.Context) {
+	affected, ok := affectedFromRequest(c, c.Param("id"), c.Query("mode"))
+	if !ok {
+		return
+	}
+	if affected == nil {
+		affected = []AffectedTests{}
+	}
+	c.JSON(http.StatusOK, affected)
+}
+
+// testCommandScript fills in a test command's placeholders, quoting
+// every value for the shell
+func testCommandScript(command string, targets []string, run string) string {
+	quoted := make([]string, len(targets))
+	for i, t := range targets {
+		quoted[i] = shellQuote(t)
+	}
+	script := strings.ReplaceAll(command, targetsPlaceholder, strings.Join(quoted, " "))
+	return strings.ReplaceAll(script, runPlaceholder, shellQuote(run))
+}
+
+// goTestEvent is the subset of go test -json output that is forwarded
+type goTestEvent struct {
+	Action  string  `json:"Action"`
+	Package string  `json:"Package"`
+	Test    string  `json:"Test"`
+	Elapsed float64 `json:"Elapsed"`
+	Output  string  `json:"Output"`
+}
+
+// testEventFromLine converts a line of test output to an event, parsing
+// go test -json events and passing other lines through. ok is false for
+// go test events that carry nothing worth forwarding.
+func testEventFromLine(language, line string) (TestEvent, bool) {
+	var ev goTestEvent
+	if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &ev) != nil || ev.Action == "" {
+		return TestEvent{Type: "output", Language: language, Text: line}, true
+	}
+	switch ev.Action {
+	case "output":
+		return TestEvent{Type: "output", Language: language, Package: ev.Package, Test: ev.Test, Text: strings.TrimSuffix(ev.Output, "\n")}, true
+	case "pass", "fail", "skip":
+		return TestEvent{Type: "result", Language: language, Package: ev.Package, Test: ev.Test, Action: ev.Action, Elapsed: ev.Elapsed}, true
+	}
+	return TestEvent{}, false
+}
+
+// runTests runs the tests affected by a diff, streaming NDJSON TestEvents.
+// The run pattern filters Go tests by name like go test -run.
+func runTests(c *gin.Context) {
+	var req struct {
+		DiffID    string   `json:"diffId"`
+		Mode      string   `json:"mode"`
+		Run       string   `json:"run"`
+		Languages []string `json:"languages"` // empty runs all
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	if req.DiffID == "" {
+		req.DiffID = "working"
+	}
+	if _, err := regexp.Compile(req.Run); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid run pattern", err)
+		return
+	}
+	affected, ok := affectedFromRequest(c, req.DiffID, req.Mode)
+	if !ok {
+		return
+	}
+	if len(req.Languages) > 0 {
+		var selected []AffectedTests
+		for _, a := range affected {
+			for _, lang := range req.Languages {
+				if a.Language == lang {
+					selected = append(selected, a)
+				}
+			}
+		}
+		affected = selected
+	}
+	if len(affected) == 0 {
+		respondError(c, http.StatusNotFound, "No affected tests", nil)
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	emit := func(event TestEvent) {
+		enc.Encode(event)
+		c.Writer.Flush()
+	}
+
+	for _, a := range affected {
+		script := testCommandScript(a.Command, a.Targets, req.Run)
+		emit(TestEvent{Type: "start", Language: a.Language, Command: script})
+		exitCode, err := runShell(c, script, func(line string) {
+			if event, ok := testEventFromLine(a.Language, line); ok {
+				emit(event)
+			}
+		})
+		event := TestEvent{Type: "exit", Language: a.Language, ExitCode: &exitCode}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		emit(event)
+		if c.Request.Context().Err() != nil {
+			return
+		}
+	}
+}
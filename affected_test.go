@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAffectedTests(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	oldRoot := gitRoot
+	defer func() { gitRoot = oldRoot }()
+	gitRoot = repoDir
+	os.MkdirAll(filepath.Join(repoDir, "pkg", "a"), 0755)
+	runGit("config", "differing.test.ts", "vitest run {targets}")
+
+	affected := affectedTests([]FileInfo{
+		{Path: "pkg/a/a.go", Status: "modified"},
+		{Path: "pkg/a/a_test.go", Status: "added"},
+		{Path: "gone/b.go", Status: "deleted"},
+		{Path: "tools/go.mod", Status: "modified"},
+		{Path: "web/app.ts", Status: "modified"},
+		{Path: "web/old.ts", Status: "deleted"},
+		{Path: "README.md", Status: "modified"},
+	})
+	if len(affected) != 2 {
+		t.Fatalf("affectedTests() = %+v", affected)
+	}
+	if got := strings.Join(affected[0].Targets, " "); affected[0].Language != "go" || got != "./pkg/a ./tools/..." {
+		t.Errorf("go targets = %q", got)
+	}
+	if got := strings.Join(affected[1].Targets, " "); affected[1].Language != "ts" || got != "web/app.ts" {
+		t.Errorf("ts targets = %q", got)
+	}
+
+	if got := testCommandScript("go test -run {run} {targets}", []string{"./a b"}, "Test'X"); got != `go test -run 'Test'\''X' './a b'` {
+		t.Errorf("testCommandScript() = %s", got)
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	oldRoot := gitRoot
+	defer func() { gitRoot = oldRoot }()
+	gitRoot = repoDir
+
+	// Stand in for go test -json
+	runGit("config", "differing.test.go", `echo '{"Action":"run","Test":"TestHello"}'; echo '{"Action":"pass","Package":"p","Test":"TestHello","Elapsed":0.5}'; echo built {targets} {run}`)
+
+	r := gin.New()
+	r.POST("/api/run-tests", runTests)
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/run-tests", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(`{"run":"("}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid run pattern = %d, want 400", w.Code)
+	}
+	// Working changes only touch test2.ts, which has no test command
+	if w := post(`{}`); w.Code != http.StatusNotFound {
+		t.Errorf("no affected tests = %d, want 404", w.Code)
+	}
+
+	w := post(`{"diffId":"HEAD~1","mode":"commit","run":"Hello"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("run-tests = %d: %s", w.Code, w.Body.String())
+	}
+	var events []TestEvent
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var event TestEvent
+		json.Unmarshal(scanner.Bytes(), &event)
+		events = append(events, event)
+	}
+	if len(events) != 4 {
+		t.Fatalf("events = %+v", events)
+	}
+	if events[1].Type != "result" || events[1].Action != "pass" || events[1].Test != "TestHello" {
+		t.Errorf("result event = %+v", events[1])
+	}
+	if events[2].Type != "output" || events[2].Text != "built . Hello" {
+		t.Errorf("output event = %+v", events[2])
+	}
+	if events[3].Type != "exit" || *events[3].ExitCode != 0 {
+		t.Errorf("exit event = %+v", events[3])
+	}
+}
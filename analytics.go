@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FileChurn summarizes how often a file changed over a period
+type FileChurn struct {
+	Path      string `json:"path"`
+	Commits   int    `json:"commits"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Authors   int    `json:"authors"`
+	TopAuthor string `json:"topAuthor"`
+	// Concentration is the share of commits by the top author; near 1
+	// means one person holds most of the knowledge of the file
+	Concentration float64 `json:"concentration"`
+}
+
+// FileRisk scores a file in a diff by its size and churn
+type FileRisk struct {
+	Path    string `json:"path"`
+	Lines   int    `json:"lines"`
+	Commits int    `json:"commits"`
+	// Score is between 0 and 1, highest for files that are both large
+	// and frequently changed
+	Score float64 `json:"score"`
+}
+
+// defaultChurnSince is the history window when none is requested
+const defaultChurnSince = "90 days ago"
+
+// largeFileLines is the size at which a file counts as fully large for
+// risk scoring
+const largeFileLines = 1000
+
+// fileChurn computes per-file churn for non-merge commits since a date
+// git understands, such as "90 days ago" or 2024-01-01
+func fileChurn(since string) (map[string]*FileChurn, error) {
+	output, err := runGit("-c", "core.quotePath=false", "log", "--since="+since, "--no-merges", "--no-renames", "--format=%x00%aN", "--numstat")
+	if err != nil {
+		return nil, err
+	}
+	churn := make(map[string]*FileChurn)
+	authors := make(map[string]map[string]int)
+	var author string
+	for _, line := range strings.Split(string(output), "\n") {
+		if name, ok := strings.CutPrefix(line, "\x00"); ok {
+			author = name
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		path := fields[2]
+		fc := churn[path]
+		if fc == nil {
+			fc = &FileChurn{Path: path}
+			churn[path] = fc
+			authors[path] = make(map[string]int)
+		}
+		fc.Commits++
+		// Binary files report "-" for both counts
+		added, _ := strconv.Atoi(fields[0])
+		deleted, _ := strconv.Atoi(fields[1])
+		fc.Additions += added
+		fc.Deletions += deleted
+		authors[path][author]++
+	}
+	for path, fc := range churn {
+		fc.Authors = len(authors[path])
+		top := 0
+		for name, n := range authors[path] {
+			if n > top || (n == top && name < fc.TopAuthor) {
+				top, fc.TopAuthor = n, name
+			}
+		}
+		fc.Concentration = float64(top) / float64(fc.Commits)
+	}
+	return churn, nil
+}
+
+// churnSince reads and validates the since= query parameter
+func churnSince(c *gin.Context) (string, bool) {
+	since := c.DefaultQuery("since", defaultChurnSince)
+	if since == "" || strings.HasPrefix(since, "-") {
+		respondError(c, http.StatusBadRequest, "Invalid since date", nil)
+		return "", false
+	}
+	return since, true
+}
+
+// getChurn lists the most frequently changed files
+func getChurn(c *gin.Context) {
+	since, ok := churnSince(c)
+	if !ok {
+		return
+	}
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, "limit must be a positive number", nil)
+			return
+		}
+		limit = n
+	}
+	churn, err := fileChurn(since)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read history", err)
+		return
+	}
+	files := make([]FileChurn, 0, len(churn))
+	for _, fc := range churn {
+		files = append(files, *fc)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Commits != files[j].Commits {
+			return files[i].Commits > files[j].Commits
+		}
+		return files[i].Path < files[j].Path
+	})
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{"since": since, "files": files})
+}
+
+// riskScore combines size and churn, each scaled to [0, 1], with a
+// geometric mean so a file must be both large and busy to score high
+func riskScore(lines, commits, maxCommits int) float64 {
+	if maxCommits == 0 {
+		return 0
+	}
+	size := math.Min(1, float64(lines)/largeFileLines)
+	busy := float64(commits) / float64(maxCommits)
+	return math.Round(math.Sqrt(size*busy)*1000) / 1000
+}
+
+// getDiffRisk scores each file in a diff, riskiest first. Churn is
+// measured against the busiest file in the repository over the period.
+func getDiffRisk(c *gin.Context) {
+	since, ok := churnSince(c)
+	if !ok {
+		return
+	}
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+	files, err := listDiffFiles(c.Request.Context(), spec, DiffOptions{}, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to get diff files", err)
+		return
+	}
+	churn, err := fileChurn(since)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read history", err)
+		return
+	}
+	maxCommits := 0
+	for _, fc := range churn {
+		maxCommits = max(maxCommits, fc.Commits)
+	}
+
+	risks := []FileRisk{}
+	for _, f := range files {
+		if f.Status == "deleted" || f.Submodule {
+			continue
+		}
+		risk := FileRisk{Path: f.Path}
+		if fc := churn[f.Path]; fc != nil {
+			risk.Commits = fc.Commits
+		}
+		if data, _, err := newSideContent(spec, f.Path); err == nil && !isBinary(data) {
+			risk.Lines = bytes.Count(data, []byte("\n"))
+			if len(data) > 0 && data[len(data)-1] != '\n' {
+				risk.Lines++
+			}
+		}
+		risk.Score = riskScore(risk.Lines, risk.Commits, maxCommits)
+		risks = append(risks, risk)
+	}
+	sort.SliceStable(risks, func(i, j int) bool { return risks[i].Score > risks[j].Score })
+	c.JSON(http.StatusOK, risks)
+}
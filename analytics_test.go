@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRiskScore(t *testing.T) {
+	if got := riskScore(2000, 10, 10); got != 1 {
+		t.Errorf("large, busiest file = %v, want 1", got)
+	}
+	if got := riskScore(2000, 0, 10); got != 0 {
+		t.Errorf("file never changed = %v, want 0", got)
+	}
+	if got := riskScore(250, 10, 10); got != 0.5 {
+		t.Errorf("quarter-size busiest file = %v, want 0.5", got)
+	}
+}
+
+func TestChurnAndRisk(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/analytics/churn", getChurn)
+	r.GET("/api/diffs/:id/risk", getDiffRisk)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/analytics/churn?since=1.year.ago", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("churn = %d: %s", w.Code, w.Body.String())
+	}
+	var churn struct {
+		Files []FileChurn `json:"files"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &churn)
+	if len(churn.Files) != 2 {
+		t.Fatalf("churn files = %+v", churn.Files)
+	}
+	top := churn.Files[0]
+	if top.Path != "test1.go" || top.Commits != 2 || top.Authors != 1 || top.Concentration != 1 {
+		t.Errorf("top file = %+v", top)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/analytics/churn?since=--all", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("option as since = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/working/risk", nil))
+	var risks []FileRisk
+	json.Unmarshal(w.Body.Bytes(), &risks)
+	if len(risks) != 1 || risks[0].Path != "test2.ts" || risks[0].Lines != 3 || risks[0].Commits != 1 {
+		t.Fatalf("risks = %+v", risks)
+	}
+	if want := riskScore(3, 1, 2); risks[0].Score != want {
+		t.Errorf("score = %v, want %v", risks[0].Score, want)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Archive layouts for getDiffArchive
+const (
+	// archiveNew holds each changed file's new contents at its path
+	archiveNew = "new"
+	// archivePair holds before/<path> and after/<path> for each file
+	archivePair = "pair"
+)
+
+// gitArchive copies paths at rev into zw under prefix using git archive.
+// The paths are taken literally, so names with * or : match only
+// themselves.
+func gitArchive(zw *zip.Writer, rev, prefix string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	args := []string{"archive", "--format=zip", "--prefix=" + prefix, rev, "--"}
+	for _, p := range paths {
+		args = append(args, ":(literal)"+p)
+	}
+	output, err := runGit(args...)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(output), int64(len(output)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if err := zw.Copy(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// worktreeArchive copies paths from the working tree into zw under
+// prefix. Symbolic links are stored as links, with their target as
+// content, as git archive stores them, rather than followed.
+func worktreeArchive(zw *zip.Writer, prefix string, paths []string) error {
+	for _, path := range paths {
+		target, ok, err := workingLink(path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			header := &zip.FileHeader{Name: prefix + path, Method: zip.Store}
+			header.SetMode(os.ModeSymlink | 0777)
+			w, err := zw.CreateHeader(header)
+			if err == nil {
+				_, err = io.WriteString(w, target)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		file, err := secureRoot.Open(path)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		header.Name = prefix + path
+		header.Method = zip.Deflate
+		w, err := zw.CreateHeader(header)
+		if err == nil {
+			_, err = io.Copy(w, file)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getDiffArchive returns a zip of the files a diff changes, either their
+// new contents (?layout=new, the default) or before/after pairs
+// (?layout=pair). The usual path=, glob=, and exclude= filters apply.
+func getDiffArchive(c *gin.Context) {
+	layout := c.DefaultQuery("layout", archiveNew)
+	if layout != archiveNew && layout != archivePair {
+		respondError(c, http.StatusBadRequest, "layout must be new or pair", nil)
+		return
+	}
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+	files, err := listDiffFiles(c.Request.Context(), spec, DiffOptions{}, pathspecsFromQuery(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to get diff files", err)
+		return
+	}
+
+	var oldPaths, newPaths []string
+	for _, f := range files {
+		if f.Submodule {
+			continue
+		}
+		if f.Status != "added" {
+			oldPaths = append(oldPaths, f.Path)
+		}
+		if f.Status != "deleted" {
+			newPaths = append(newPaths, f.Path)
+		}
+	}
+
+	// Build the archive in memory so a git failure can still be reported
+	// as an error rather than a truncated download
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	newPrefix := ""
+	if layout == archivePair {
+		newPrefix = "after/"
+		if spec.Base != "" {
+			err = gitArchive(zw, spec.Base, "before/", oldPaths)
+		}
+	}
+	if err == nil {
+		if spec.Head != "" {
+			err = gitArchive(zw, spec.Head, newPrefix, newPaths)
+		} else if spec.Index {
+			// The index has no tree until one is written for it
+			var tree []byte
+			if tree, err = runGitContext(c.Request.Context(), "write-tree"); err == nil {
+				err = gitArchive(zw, strings.TrimSpace(string(tree)), newPrefix, newPaths)
+			}
+		} else {
+			err = worktreeArchive(zw, newPrefix, newPaths)
+		}
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to build archive", err)
+		return
+	}
+
+	name := "working"
+	if spec.Index {
+		name = "staged"
+	} else if spec.Head != "" {
+		name = spec.Head[:12]
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="differing-%s-%s.zip"`, name, time.Now().Format("20060102")))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDiffArchive(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/diffs/:id/archive.zip", getDiffArchive)
+	fetch := func(url string) map[string]string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s = %d: %s", url, w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		if err != nil {
+			t.Fatalf("invalid zip: %v", err)
+		}
+		contents := make(map[string]string)
+		for _, f := range zr.File {
+			rc, _ := f.Open()
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			contents[f.Name] = string(data)
+		}
+		return contents
+	}
+
+	// Working changes come from the working tree
+	contents := fetch("/api/diffs/working/archive.zip")
+	if len(contents) != 1 || contents["test2.ts"] == "" {
+		t.Errorf("working archive = %v", contents)
+	}
+
+	// Pairs omit the before side of added files
+	contents = fetch("/api/diffs/HEAD~2..HEAD/archive.zip?layout=pair")
+	if _, ok := contents["before/test1.go"]; !ok {
+		t.Error("pair archive should include before/test1.go")
+	}
+	if _, ok := contents["before/test2.ts"]; ok {
+		t.Error("pair archive should not include a before side for an added file")
+	}
+	if contents["after/test1.go"] == contents["before/test1.go"] {
+		t.Error("before and after of test1.go should differ")
+	}
+	if _, ok := contents["after/test2.ts"]; !ok {
+		t.Error("pair archive should include after/test2.ts")
+	}
+
+	// A changed file named like a glob brings only itself
+	os.WriteFile("a*.txt", []byte("one\n"), 0644)
+	os.WriteFile("ab.txt", []byte("one\n"), 0644)
+	exec.Command("git", "add", "a*.txt", "ab.txt").Run()
+	exec.Command("git", "commit", "-m", "Add glob-like name").Run()
+	os.WriteFile("a*.txt", []byte("two\n"), 0644)
+	exec.Command("git", "commit", "-am", "Change glob-like name").Run()
+	contents = fetch("/api/diffs/HEAD/archive.zip?mode=commit")
+	if _, ok := contents["ab.txt"]; ok || contents["a*.txt"] != "two\n" {
+		t.Errorf("glob-like archive = %v", contents)
+	}
+
+	// Links are archived as links, even ones pointing out of the
+	// repository
+	if runtime.GOOS != "windows" {
+		os.Symlink("a*.txt", "link")
+		exec.Command("git", "add", "link").Run()
+		exec.Command("git", "commit", "-m", "Add link").Run()
+		os.Remove("link")
+		os.Symlink("../outside", "link")
+		contents = fetch("/api/diffs/working/archive.zip")
+		if contents["link"] != "../outside" {
+			t.Errorf("link archived as %q, want its target", contents["link"])
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/working/archive.zip?layout=tar", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bad layout status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// fileAttrs holds the linguist attributes that mark files to collapse in review
+type fileAttrs struct {
+	Generated bool
+	Vendored  bool
+}
+
+func (a fileAttrs) collapsed() bool {
+	return a.Generated || a.Vendored
+}
+
+// lookupAttrs resolves linguist-generated and linguist-vendored for each
+// path from .gitattributes. Paths with neither attribute are omitted.
+func lookupAttrs(paths []string) (map[string]fileAttrs, error) {
+	attrs := make(map[string]fileAttrs)
+	if len(paths) == 0 {
+		return attrs, nil
+	}
+
+	input := strings.Join(paths, "\x00") + "\x00"
+	output, err := runGitInput([]byte(input), "check-attr", "-z", "--stdin", "linguist-generated", "linguist-vendored")
+	if err != nil {
+		return nil, err
+	}
+
+	// Output is a sequence of "<path>\0<attribute>\0<value>\0" triples
+	fields := strings.Split(string(output), "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		path, attr, value := fields[i], fields[i+1], fields[i+2]
+		if value != "set" && value != "true" {
+			continue
+		}
+		a := attrs[path]
+		switch attr {
+		case "linguist-generated":
+			a.Generated = true
+		case "linguist-vendored":
+			a.Vendored = true
+		}
+		attrs[path] = a
+	}
+	return attrs, nil
+}
+
+// attributesKey fingerprints the attribute files check-attr reads for the
+// repository: each .gitattributes in the working tree, tracked or not,
+// and info/attributes in the git directory. Cached results that depend on
+// attributes are keyed on it.
+func attributesKey() string {
+	h := sha256.New()
+	output, _ := runGit("ls-files", "-z", "--cached", "--others", "--exclude-standard", "--", ":(glob)**/.gitattributes")
+	for _, path := range strings.Split(string(output), "\x00") {
+		if path == "" {
+			continue
+		}
+		data, _ := secureRoot.ReadFile(path)
+		fmt.Fprintf(h, "%s\x00%d\x00", path, len(data))
+		h.Write(data)
+	}
+	if info, err := runGit("rev-parse", "--path-format=absolute", "--git-path", "info/attributes"); err == nil {
+		data, _ := os.ReadFile(strings.TrimSpace(string(info)))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// numstatEntry is one file's line counts from git diff --numstat -z;
+// binary files count none
+type numstatEntry struct {
+	Path                 string
+	Additions, Deletions int
+}
+
+// parseNumstat parses git diff --numstat -z output. Entries are
+// "added\tdeleted\tpath\0", or for renames and copies
+// "added\tdeleted\t\0old\0new\0", reported under the new path. Paths are
+// never quoted, so they match what check-attr is given.
+func parseNumstat(output string) []numstatEntry {
+	var entries []numstatEntry
+	fields := strings.Split(output, "\x00")
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		e := numstatEntry{Path: parts[2]}
+		// Binary files show "-", which counts as 0
+		e.Additions, _ = strconv.Atoi(parts[0])
+		e.Deletions, _ = strconv.Atoi(parts[1])
+		if e.Path == "" && i+2 < len(fields) {
+			e.Path = fields[i+2]
+			i += 2
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// numstatPaths extracts the file paths from git diff --numstat -z output
+func numstatPaths(output string) []string {
+	var paths []string
+	for _, e := range parseNumstat(output) {
+		paths = append(paths, e.Path)
+	}
+	return paths
+}
+
+// headlineDiffStat totals git diff --numstat -z output for display, leaving
+// generated and vendored files out of the addition and deletion counts.
+func headlineDiffStat(output string) (additions, deletions, filesCount int) {
+	attrs, err := lookupAttrs(numstatPaths(output))
+	if err != nil {
+		slog.Warn("git check-attr failed", "error", err)
+	}
+	skip := make(map[string]bool)
+	for path, a := range attrs {
+		if a.collapsed() {
+			skip[path] = true
+		}
+	}
+	return parseDiffStat(output, skip)
+}
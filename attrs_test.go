@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinguistAttributes(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	attributes := "*.ts linguist-generated=true\nthird_party/** linguist-vendored\n"
+	if err := os.WriteFile(filepath.Join(repoDir, ".gitattributes"), []byte(attributes), 0644); err != nil {
+		t.Fatalf("Failed to write .gitattributes: %v", err)
+	}
+
+	attrs, err := lookupAttrs([]string{"test1.go", "test2.ts", "third_party/lib.c"})
+	if err != nil {
+		t.Fatalf("lookupAttrs() failed: %v", err)
+	}
+	if attrs["test1.go"].collapsed() {
+		t.Error("test1.go should not be collapsed")
+	}
+	if !attrs["test2.ts"].Generated {
+		t.Error("test2.ts should be generated")
+	}
+	if !attrs["third_party/lib.c"].Vendored {
+		t.Error("third_party/lib.c should be vendored")
+	}
+
+	// The generated file is left out under its new name after a rename
+	numstat := "3\t1\ttest1.go\x0010\t2\t\x00old.ts\x00test2.ts\x00"
+	additions, deletions, files := headlineDiffStat(numstat)
+	if additions != 3 || deletions != 1 || files != 2 {
+		t.Errorf("headlineDiffStat() = +%d -%d %d files, want +3 -1 2 files", additions, deletions, files)
+	}
+
+	spec, err := resolveDiff("working", modeCumulative)
+	if err != nil {
+		t.Fatalf("resolveDiff() failed: %v", err)
+	}
+	list, err := listDiffFiles(context.Background(), spec, DiffOptions{}, nil)
+	if err != nil {
+		t.Fatalf("listDiffFiles() failed: %v", err)
+	}
+	if len(list) != 1 || !list[0].Generated {
+		t.Errorf("working files = %+v, want test2.ts marked generated", list)
+	}
+}
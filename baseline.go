@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// baselineRef records what was last reviewed, so the mark outlives the
+// server and is never pushed
+const baselineRef = "refs/differing/baseline"
+
+// baselineDiffID names the diff from the baseline to the working tree
+const baselineDiffID = "baseline"
+
+// Baseline is the state marked as reviewed
+type Baseline struct {
+	// Commit holds the reviewed files. Head is the commit they were on:
+	// the ref that was marked, or HEAD when the working tree was.
+	Commit  string    `json:"commit"`
+	Head    string    `json:"head,omitempty"`
+	Label   string    `json:"label"`
+	Created time.Time `json:"created"`
+}
+
+// BaselineRequest is the body of PUT /api/baseline. Ref marks a commit as
+// reviewed; without one the working tree as it is now is marked.
+type BaselineRequest struct {
+	Ref string `json:"ref,omitempty"`
+}
+
+// readBaseline returns the baseline, or nil if none has been marked
+func readBaseline() (*Baseline, error) {
+	sha, err := resolveRev(baselineRef)
+	if err != nil {
+		return nil, nil
+	}
+	output, err := runGit("log", "-1", "--format=%P%x00%ct%x00%s", sha)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(strings.TrimSpace(string(output)), "\x00", 3)
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("unexpected baseline commit %s", sha)
+	}
+	created, _ := strconv.ParseInt(parts[1], 10, 64)
+	return &Baseline{Commit: sha, Head: parts[0], Label: parts[2], Created: time.Unix(created, 0)}, nil
+}
+
+// baselineDiffInfo returns the "Since last review" entry for the diff
+// list, or nil when there is no baseline
+func baselineDiffInfo() *DiffInfo {
+	baseline, err := readBaseline()
+	if err != nil || baseline == nil {
+		return nil
+	}
+	return &DiffInfo{ID: baselineDiffID, Message: "Since last review", Timestamp: baseline.Created}
+}
+
+// fillBaselineStat sets the baseline entry's diffstat against the
+// working tree
+func fillBaselineStat(info *DiffInfo) {
+	output, _ := runGit("diff", baselineRef, "--numstat", "-z")
+	info.Additions, info.Deletions, info.FilesCount = headlineDiffStat(string(output))
+}
+
+func getBaseline(c *gin.Context) {
+	baseline, err := readBaseline()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read baseline", err)
+		return
+	}
+	if baseline == nil {
+		respondError(c, http.StatusNotFound, "No baseline has been marked", nil)
+		return
+	}
+	c.JSON(http.StatusOK, baseline)
+}
+
+// putBaseline marks a commit, or the working tree, as reviewed. The
+// baseline diff then shows only what changed since.
+func putBaseline(c *gin.Context) {
+	var req BaselineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	var tree, parent, label string
+	if req.Ref != "" {
+		sha, err := resolveRev(req.Ref)
+		if err != nil {
+			respondError(c, http.StatusNotFound, err.Error(), err)
+			return
+		}
+		tree, parent, label = sha+"^{tree}", sha, "Reviewed up to "+req.Ref
+	} else {
+		var err error
+		if tree, err = workingTreeObject(); err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to read the working tree", err)
+			return
+		}
+		parent, _ = resolveRev("HEAD")
+		label = "Reviewed the working tree"
+	}
+
+	args := []string{"commit-tree", tree, "-m", label}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	output, err := runGitContext(c.Request.Context(), args...)
+	if err == nil {
+		_, err = runGitContext(c.Request.Context(), "update-ref", baselineRef, strings.TrimSpace(string(output)))
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to record baseline", err)
+		return
+	}
+	baseline, err := readBaseline()
+	if err != nil || baseline == nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read baseline", err)
+		return
+	}
+	c.JSON(http.StatusOK, baseline)
+}
+
+func deleteBaseline(c *gin.Context) {
+	if _, err := runGitContext(c.Request.Context(), "update-ref", "-d", baselineRef); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to clear baseline", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBaseline(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/baseline", getBaseline)
+	r.PUT("/api/baseline", putBaseline)
+	r.DELETE("/api/baseline", deleteBaseline)
+	r.GET("/api/diffs", getDiffs)
+	r.GET("/api/diffs/:id/files", getDiffFiles)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/baseline", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("baseline before marking = %d, want 404", w.Code)
+	}
+
+	// Marking the working tree, with test2.ts modified, leaves nothing to
+	// review until something else changes
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/baseline", strings.NewReader(`{}`)))
+	var baseline Baseline
+	json.Unmarshal(w.Body.Bytes(), &baseline)
+	if w.Code != http.StatusOK || baseline.Head != currentHead() {
+		t.Fatalf("mark working tree = %d: %s", w.Code, w.Body)
+	}
+	os.WriteFile("test1.go", []byte("package main\n\nfunc hello() {}\n"), 0644)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/baseline/files", nil))
+	var files []FileInfo
+	json.Unmarshal(w.Body.Bytes(), &files)
+	if w.Code != http.StatusOK || len(files) != 1 || files[0].Path != "test1.go" {
+		t.Errorf("changes since baseline = %d %+v", w.Code, files)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs", nil))
+	var diffs []DiffInfo
+	json.Unmarshal(w.Body.Bytes(), &diffs)
+	if len(diffs) < 2 || diffs[1].ID != baselineDiffID || diffs[1].Message != "Since last review" || diffs[1].FilesCount != 1 {
+		t.Errorf("diff list = %+v", diffs)
+	}
+
+	// Marking a ref compares the working tree to that commit
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/baseline", strings.NewReader(`{"ref":"HEAD~1"}`)))
+	json.Unmarshal(w.Body.Bytes(), &baseline)
+	if parent, _ := resolveRev("HEAD~1"); w.Code != http.StatusOK || baseline.Head != parent || !strings.Contains(baseline.Label, "HEAD~1") {
+		t.Fatalf("mark ref = %d: %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/baseline/files", nil))
+	files = nil
+	json.Unmarshal(w.Body.Bytes(), &files)
+	if len(files) != 2 {
+		t.Errorf("changes since HEAD~1 = %+v", files)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/baseline", strings.NewReader(`{"ref":"nope"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown ref = %d, want 404", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/baseline", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("clear = %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/baseline/files", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("cleared baseline diff = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LineAnnotation names the commit that last touched a line
+type LineAnnotation struct {
+	Line   int    `json:"line"`
+	Commit string `json:"commit"`
+	Author string `json:"author"`
+	// Time is the author time in Unix seconds; clients render the age
+	Time int64 `json:"time"`
+}
+
+// blameGroupHeader starts each group in git blame --incremental output:
+// the commit, its original and final line numbers, and the line count
+var blameGroupHeader = regexp.MustCompile(`^([0-9a-f]{40}) \d+ (\d+) (\d+)$`)
+
+// parseIncrementalBlame parses git blame --incremental output into one
+// annotation per line, ordered by line. Lines blamed on the uncommitted
+// working tree are left out.
+func parseIncrementalBlame(output []byte) []LineAnnotation {
+	type commitInfo struct {
+		author string
+		time   int64
+	}
+	commits := make(map[string]*commitInfo)
+	byLine := make(map[int]LineAnnotation)
+	maxLine := 0
+
+	var current *commitInfo
+	var sha string
+	var start, count int
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := blameGroupHeader.FindStringSubmatch(line); m != nil {
+			sha = m[1]
+			start, _ = strconv.Atoi(m[2])
+			count, _ = strconv.Atoi(m[3])
+			if commits[sha] == nil {
+				commits[sha] = &commitInfo{}
+			}
+			current = commits[sha]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			current.author = value
+		case "author-time":
+			current.time, _ = strconv.ParseInt(value, 10, 64)
+		case "filename":
+			// The filename line ends the group
+			if strings.Trim(sha, "0") != "" {
+				for l := start; l < start+count; l++ {
+					byLine[l] = LineAnnotation{Line: l, Commit: sha}
+				}
+				maxLine = max(maxLine, start+count-1)
+			}
+			current = nil
+		}
+	}
+
+	annotations := make([]LineAnnotation, 0, len(byLine))
+	for l := 1; l <= maxLine; l++ {
+		a, ok := byLine[l]
+		if !ok {
+			continue
+		}
+		info := commits[a.Commit]
+		a.Author, a.Time = info.author, info.time
+		annotations = append(annotations, a)
+	}
+	return annotations
+}
+
+// unchangedLineAnnotations blames the new side of a file in a diff and
+// returns annotations for the lines the diff leaves unchanged
+func unchangedLineAnnotations(spec diffSpec, path string) ([]LineAnnotation, error) {
+	args := []string{"blame", "--incremental"}
+	var contents []byte
+	if spec.Head != "" {
+		args = append(args, spec.Head)
+	} else if spec.Index {
+		// Blame the staged content as if it were in the working tree
+		sha, _, found, err := blobInfo("", path)
+		if err != nil || !found {
+			return nil, err
+		}
+		if contents, err = readBlob(sha); err != nil {
+			return nil, err
+		}
+		args = append(args, "--contents", "-")
+	}
+	output, err := runGitInput(contents, append(args, "--", path)...)
+	if err != nil {
+		return nil, err
+	}
+	added, err := addedLines(spec, ":(literal)"+path)
+	if err != nil {
+		return nil, err
+	}
+	changed := added[path]
+	var unchanged []LineAnnotation
+	for _, a := range parseIncrementalBlame(output) {
+		if !changed[a.Line] {
+			unchanged = append(unchanged, a)
+		}
+	}
+	return unchanged, nil
+}
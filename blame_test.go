@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseIncrementalBlame(t *testing.T) {
+	a := strings.Repeat("a", 40)
+	zero := strings.Repeat("0", 40)
+	output := a + " 1 2 2\n" +
+		"author Ada\nauthor-time 1700000000\nsummary First\nfilename f.go\n" +
+		zero + " 3 1 1\nauthor Not Committed Yet\nfilename f.go\n" +
+		a + " 4 4 1\nfilename f.go\n"
+
+	got := parseIncrementalBlame([]byte(output))
+	want := []LineAnnotation{
+		{Line: 2, Commit: a, Author: "Ada", Time: 1700000000},
+		{Line: 3, Commit: a, Author: "Ada", Time: 1700000000},
+		{Line: 4, Commit: a, Author: "Ada", Time: 1700000000},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseIncrementalBlame() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("annotation %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFileDiffAnnotations(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+
+	// "Update hello function" rewrites lines 3-5; lines 1-2 date from the
+	// initial commit
+	initial, _ := resolveRev("HEAD~2")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/HEAD~1/test1.go?mode=commit&annotations=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var diff FileDiff
+	if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(diff.Annotations) != 2 {
+		t.Fatalf("annotations = %+v, want lines 1 and 2", diff.Annotations)
+	}
+	for i, a := range diff.Annotations {
+		if a.Line != i+1 || a.Commit != initial || a.Author == "" || a.Time == 0 {
+			t.Errorf("annotation %d = %+v", i, a)
+		}
+	}
+
+	// The working tree side is blamed as it stands on disk
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/test2.ts?annotations=true", nil))
+	diff = FileDiff{}
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	for _, a := range diff.Annotations {
+		if a.Line == 2 {
+			t.Errorf("uncommitted line 2 was annotated: %+v", a)
+		}
+	}
+}
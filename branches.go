@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Branch is a local branch as listed by GET /api/branches
+type Branch struct {
+	Name     string `json:"name"`
+	Commit   string `json:"commit"`
+	Current  bool   `json:"current"`
+	Upstream string `json:"upstream,omitempty"`
+	// Merged is true when the branch is contained in HEAD, so deleting
+	// it loses nothing
+	Merged bool `json:"merged"`
+}
+
+// validBranchName reports whether name is acceptable to git as a new
+// branch name and cannot be mistaken for an option
+func validBranchName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "-") {
+		return false
+	}
+	_, err := runGit("check-ref-format", "--branch", name)
+	return err == nil
+}
+
+// listBranches returns the local branches
+func listBranches() ([]Branch, error) {
+	output, err := runGit("for-each-ref", "--format=%(refname:short)%00%(objectname)%00%(HEAD)%00%(upstream:short)", "refs/heads")
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]bool)
+	if output, err := runGit("for-each-ref", "--merged=HEAD", "--format=%(refname:short)", "refs/heads"); err == nil {
+		for _, name := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			merged[name] = true
+		}
+	}
+	branches := []Branch{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 4 {
+			continue
+		}
+		branches = append(branches, Branch{
+			Name:     fields[0],
+			Commit:   fields[1],
+			Current:  fields[2] == "*",
+			Upstream: fields[3],
+			Merged:   merged[fields[0]],
+		})
+	}
+	return branches, nil
+}
+
+func getBranches(c *gin.Context) {
+	branches, err := listBranches()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list branches", err)
+		return
+	}
+	c.JSON(http.StatusOK, branches)
+}
+
+// setUpstream points branch at an upstream ref, which must exist
+func setUpstream(c *gin.Context, branch, upstream string) bool {
+	if _, err := resolveRev(upstream); err != nil {
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return false
+	}
+	if _, err := runGitContext(c.Request.Context(), "branch", "--set-upstream-to="+upstream, "--", branch); err != nil {
+		respondError(c, http.StatusBadRequest, "Failed to set upstream", err)
+		return false
+	}
+	return true
+}
+
+// createBranch creates a branch at any commit, HEAD by default
+func createBranch(c *gin.Context) {
+	var req struct {
+		Name     string `json:"name"`
+		Start    string `json:"start"`
+		Upstream string `json:"upstream"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !validBranchName(req.Name) {
+		respondError(c, http.StatusBadRequest, "Invalid branch name", nil)
+		return
+	}
+	if req.Start == "" {
+		req.Start = "HEAD"
+	}
+	start, err := resolveRev(req.Start)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "branch", req.Name, start); err != nil {
+		respondError(c, http.StatusConflict, "Failed to create branch", err)
+		return
+	}
+	if req.Upstream != "" && !setUpstream(c, req.Name, req.Upstream) {
+		return
+	}
+	c.JSON(http.StatusCreated, Branch{Name: req.Name, Commit: start, Upstream: req.Upstream, Merged: revisionMerged(start)})
+}
+
+// revisionMerged reports whether sha is contained in HEAD
+func revisionMerged(sha string) bool {
+	_, err := runGit("merge-base", "--is-ancestor", sha, "HEAD")
+	return err == nil
+}
+
+// deleteBranch deletes a branch. Unless force=true, git refuses branches
+// that are not merged, which is reported as a conflict.
+func deleteBranch(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("name"), "/")
+	if name == "" || strings.HasPrefix(name, "-") {
+		respondError(c, http.StatusBadRequest, "Invalid branch name", nil)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "rev-parse", "--verify", "--quiet", "refs/heads/"+name); err != nil {
+		respondError(c, http.StatusNotFound, "No such branch: "+name, nil)
+		return
+	}
+	flag := "-d"
+	if c.Query("force") == "true" {
+		flag = "-D"
+	}
+	if _, err := runGitContext(c.Request.Context(), "branch", flag, "--", name); err != nil {
+		respondError(c, http.StatusConflict, "Failed to delete branch", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// renameBranch renames the current branch. Git carries its upstream
+// across; a new upstream may be set at the same time.
+func renameBranch(c *gin.Context) {
+	var req struct {
+		Name     string `json:"name"`
+		Upstream string `json:"upstream"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !validBranchName(req.Name) {
+		respondError(c, http.StatusBadRequest, "Invalid branch name", nil)
+		return
+	}
+	if currentBranch() == "" {
+		respondError(c, http.StatusConflict, "HEAD is detached; there is no current branch to rename", nil)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "branch", "-m", req.Name); err != nil {
+		respondError(c, http.StatusConflict, "Failed to rename branch", err)
+		return
+	}
+	if req.Upstream != "" && !setUpstream(c, req.Name, req.Upstream) {
+		return
+	}
+	branches, err := listBranches()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list branches", err)
+		return
+	}
+	for _, b := range branches {
+		if b.Current {
+			c.JSON(http.StatusOK, b)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, Branch{Name: req.Name, Current: true})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBranchEndpoints(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	runGit("branch", "-M", "main")
+
+	r := gin.New()
+	r.GET("/api/branches", getBranches)
+	r.POST("/api/branches", createBranch)
+	r.POST("/api/branches/rename", renameBranch)
+	r.DELETE("/api/branches/*name", deleteBranch)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, bad := range []string{`{"name":"-f"}`, `{"name":"a..b"}`, `{"name":""}`} {
+		if w := do(http.MethodPost, "/api/branches", bad); w.Code != http.StatusBadRequest {
+			t.Errorf("create %s = %d, want 400", bad, w.Code)
+		}
+	}
+	if w := do(http.MethodPost, "/api/branches", `{"name":"old/work","start":"HEAD~1"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/branches", `{"name":"old/work"}`); w.Code != http.StatusConflict {
+		t.Errorf("duplicate create = %d, want 409", w.Code)
+	}
+
+	// An unmerged branch needs force to delete
+	runGit("checkout", "-q", "-b", "side")
+	runGit("commit", "-q", "--allow-empty", "-m", "Side commit")
+	runGit("checkout", "-q", "main")
+
+	w := do(http.MethodGet, "/api/branches", "")
+	var branches []Branch
+	if err := json.Unmarshal(w.Body.Bytes(), &branches); err != nil {
+		t.Fatalf("Failed to decode branches: %v", err)
+	}
+	byName := make(map[string]Branch)
+	for _, b := range branches {
+		byName[b.Name] = b
+	}
+	if !byName["main"].Current || !byName["old/work"].Merged || byName["side"].Merged {
+		t.Errorf("branches = %+v", branches)
+	}
+
+	if w := do(http.MethodDelete, "/api/branches/side", ""); w.Code != http.StatusConflict {
+		t.Errorf("delete unmerged = %d, want 409", w.Code)
+	}
+	if w := do(http.MethodDelete, "/api/branches/side?force=true", ""); w.Code != http.StatusNoContent {
+		t.Errorf("force delete = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodDelete, "/api/branches/old/work", ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete merged = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodDelete, "/api/branches/nope", ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete missing = %d, want 404", w.Code)
+	}
+
+	// Renaming keeps the upstream
+	runGit("remote", "add", "origin", repoDir)
+	runGit("update-ref", "refs/remotes/origin/main", "HEAD")
+	runGit("branch", "--set-upstream-to=origin/main")
+	w = do(http.MethodPost, "/api/branches/rename", `{"name":"trunk"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rename = %d: %s", w.Code, w.Body.String())
+	}
+	var renamed Branch
+	json.Unmarshal(w.Body.Bytes(), &renamed)
+	if renamed.Name != "trunk" || !renamed.Current || renamed.Upstream != "origin/main" {
+		t.Errorf("renamed branch = %+v", renamed)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bundleRemotePrefix is where branches from an imported bundle are stored,
+// like a remote named "bundle"
+const bundleRemotePrefix = "refs/remotes/bundle/"
+
+// getBundle returns a git bundle of ?range=, either A..B or a single ref
+// for its whole history. Bundles carry refs, so the tip must be a branch
+// or tag name rather than a bare SHA.
+func getBundle(c *gin.Context) {
+	rangeSpec := c.Query("range")
+	if rangeSpec == "" {
+		respondError(c, http.StatusBadRequest, "range is required", nil)
+		return
+	}
+	// Validate each end so nothing can be read as an option, but pass the
+	// names through so the bundle records the refs
+	from, to, isRange := strings.Cut(rangeSpec, "..")
+	ends := []string{rangeSpec}
+	if isRange {
+		ends = []string{from, strings.TrimPrefix(to, ".")}
+	}
+	for _, end := range ends {
+		if _, err := resolveRev(end); err != nil {
+			respondError(c, http.StatusNotFound, err.Error(), err)
+			return
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "differing-*.bundle")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create bundle", err)
+		return
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if _, err := runGitContext(c.Request.Context(), "bundle", "create", "--quiet", tmp.Name(), rangeSpec); err != nil {
+		respondError(c, http.StatusBadRequest, "Failed to create bundle", err)
+		return
+	}
+	name := strings.NewReplacer("/", "-", ".", "-").Replace(rangeSpec)
+	c.FileAttachment(tmp.Name(), "differing-"+name+".bundle")
+}
+
+// postBundle imports a bundle sent as the request body. Its branches are
+// fetched into refs/remotes/bundle/ and its tags into refs/tags/. Tags that
+// already exist locally with another value are left alone and reported as
+// rejected rather than failing the import.
+func postBundle(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil || len(data) == 0 {
+		respondError(c, http.StatusBadRequest, "request body must be a git bundle", nil)
+		return
+	}
+	tmp, err := os.CreateTemp("", "differing-*.bundle")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to store bundle", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to store bundle", err)
+		return
+	}
+
+	// verify checks the prerequisite commits are present locally
+	if _, err := runGitContext(c.Request.Context(), "bundle", "verify", "--quiet", tmp.Name()); err != nil {
+		respondError(c, http.StatusBadRequest, "Bundle cannot be imported", err)
+		return
+	}
+	heads, err := runGitContext(c.Request.Context(), "bundle", "list-heads", tmp.Name())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read bundle", err)
+		return
+	}
+	local, err := localTags(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list tags", err)
+		return
+	}
+
+	// One clashing tag would fail a fetch of them all, so only tags that
+	// are new here are fetched
+	refs, rejected := []string{}, []string{}
+	refspecs := []string{"+refs/heads/*:" + bundleRemotePrefix + "*"}
+	for _, line := range strings.Split(strings.TrimSpace(string(heads)), "\n") {
+		sha, ref, ok := strings.Cut(line, " ")
+		switch {
+		case !ok:
+		case strings.HasPrefix(ref, "refs/heads/"):
+			refs = append(refs, bundleRemotePrefix+strings.TrimPrefix(ref, "refs/heads/"))
+		case strings.HasPrefix(ref, "refs/tags/"):
+			existing, found := local[ref]
+			switch {
+			case !found:
+				refspecs = append(refspecs, ref+":"+ref)
+				refs = append(refs, ref)
+			case existing == sha:
+				refs = append(refs, ref)
+			default:
+				rejected = append(rejected, ref)
+			}
+		}
+	}
+	args := append([]string{"fetch", "--quiet", "--no-write-fetch-head", tmp.Name()}, refspecs...)
+	if _, err := runGitContext(c.Request.Context(), args...); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to import bundle", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"refs": refs, "rejected": rejected})
+}
+
+// localTags maps each tag in the repository to the object it points to
+func localTags(ctx context.Context) (map[string]string, error) {
+	output, err := runGitContext(ctx, "for-each-ref", "--format=%(objectname) %(refname)", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if sha, ref, ok := strings.Cut(line, " "); ok {
+			tags[ref] = sha
+		}
+	}
+	return tags, nil
+}
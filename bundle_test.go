@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	runGit("branch", "-M", "main")
+
+	r := gin.New()
+	r.GET("/api/bundle", getBundle)
+	r.POST("/api/bundle", postBundle)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/bundle?range=HEAD~1..main", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET bundle = %d: %s", w.Code, w.Body.String())
+	}
+	bundle := w.Body.Bytes()
+
+	for _, bad := range []string{"--all", "HEAD~1..nope"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/bundle?range="+bad, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("range %q = %d, want 404", bad, w.Code)
+		}
+	}
+
+	// Import into a clone that lacks the last commit
+	cloneDir := t.TempDir()
+	if output, err := exec.Command("git", "clone", "--quiet", repoDir, cloneDir).CombinedOutput(); err != nil {
+		t.Fatalf("clone failed: %v\n%s", err, output)
+	}
+	if err := os.Chdir(cloneDir); err != nil {
+		t.Fatal(err)
+	}
+	runGit("reset", "--hard", "HEAD~1")
+	runGit("update-ref", "-d", "refs/remotes/origin/main")
+	runGit("tag", "clash")
+	runGit("reflog", "expire", "--expire=now", "--all")
+	runGit("gc", "--prune=now", "--quiet")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/bundle", bytes.NewReader(bundle)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST bundle = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Refs []string `json:"refs"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Refs) != 1 || resp.Refs[0] != "refs/remotes/bundle/main" {
+		t.Errorf("imported refs = %v", resp.Refs)
+	}
+	if subject, _ := runGit("log", "-1", "--format=%s", "refs/remotes/bundle/main"); string(subject) != "Add TypeScript file\n" {
+		t.Errorf("imported tip = %q", subject)
+	}
+
+	// A tag that already exists here with another value is reported, and
+	// does not stop the rest of the bundle being imported
+	tagged := filepath.Join(t.TempDir(), "tagged.bundle")
+	for _, args := range [][]string{
+		{"tag", "v1", "main"},
+		{"tag", "-a", "-m", "Clashing tag", "clash", "main"},
+		{"bundle", "create", "--quiet", tagged, "main", "v1", "clash", "^main~1"},
+	} {
+		if output, err := exec.Command("git", append([]string{"-C", repoDir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+	tagBundle, err := os.ReadFile(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clashBefore, _ := runGit("rev-parse", "refs/tags/clash")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/bundle", bytes.NewReader(tagBundle)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST bundle with clashing tag = %d: %s", w.Code, w.Body.String())
+	}
+	var tagResp struct {
+		Refs     []string `json:"refs"`
+		Rejected []string `json:"rejected"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &tagResp)
+	if !reflect.DeepEqual(tagResp.Refs, []string{"refs/remotes/bundle/main", "refs/tags/v1"}) {
+		t.Errorf("imported refs = %v", tagResp.Refs)
+	}
+	if !reflect.DeepEqual(tagResp.Rejected, []string{"refs/tags/clash"}) {
+		t.Errorf("rejected refs = %v, want [refs/tags/clash]", tagResp.Rejected)
+	}
+	if _, err := runGit("rev-parse", "--verify", "refs/tags/v1"); err != nil {
+		t.Errorf("new tag was not imported: %v", err)
+	}
+	if clashAfter, _ := runGit("rev-parse", "refs/tags/clash"); !bytes.Equal(clashAfter, clashBefore) {
+		t.Error("clashing tag was overwritten")
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/bundle", bytes.NewReader([]byte("garbage"))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid bundle = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// maxCachedFileLists bounds how many diffs' file lists are cached; the
+// cache of them starts over once it is full
+const maxCachedFileLists = 256
+
+// commitCache memoizes git output that is fully determined by commit SHAs:
+// each commit's metadata and diffstat, and the files changed between two
+// commits. Commit objects are immutable, but diffstats and file lists
+// leave out or mark the files .gitattributes calls generated or vendored,
+// so those entries are kept only while the attributes are unchanged. The
+// log listing is keyed by the HEAD and filter it was computed from and is
+// recomputed only when either changes.
+type commitCache struct {
+	mu      sync.Mutex
+	attrs   string
+	commits map[string]DiffInfo
+	files   map[string][]FileInfo
+	logKey  string
+	logIDs  []string
+}
+
+var cache = newCommitCache()
+
+func newCommitCache() *commitCache {
+	return &commitCache{commits: make(map[string]DiffInfo), files: make(map[string][]FileInfo)}
+}
+
+// useAttributes drops the entries computed under attributes other than
+// those attributesKey fingerprints as key
+func (cc *commitCache) useAttributes(key string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if key != cc.attrs {
+		cc.attrs = key
+		cc.commits = make(map[string]DiffInfo)
+		cc.files = make(map[string][]FileInfo)
+	}
+}
+
+// commit returns the cached metadata and diffstat for a commit
+func (cc *commitCache) commit(sha string) (DiffInfo, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	info, ok := cc.commits[sha]
+	return info, ok
+}
+
+func (cc *commitCache) putCommit(info DiffInfo) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.commits[info.ID] = info
+}
+
+// fileList returns a copy of the cached files changed by the diff key
+// identifies
+func (cc *commitCache) fileList(key string) ([]FileInfo, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	files, ok := cc.files[key]
+	return slices.Clone(files), ok
+}
+
+func (cc *commitCache) putFileList(key string, files []FileInfo) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if len(cc.files) >= maxCachedFileLists {
+		cc.files = make(map[string][]FileInfo)
+	}
+	cc.files[key] = slices.Clone(files)
+}
+
+// log returns the commit IDs listed for key, if that listing is cached.
+// The key is HEAD plus any filter applied to the listing.
+func (cc *commitCache) log(key string) ([]string, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if key == "" || key != cc.logKey {
+		return nil, false
+	}
+	return cc.logIDs, true
+}
+
+func (cc *commitCache) putLog(key string, ids []string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.logKey = key
+	cc.logIDs = ids
+}
+
+// reset drops everything cached, for when history itself changes, as
+// after deepening a shallow clone
+func (cc *commitCache) reset() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.commits = make(map[string]DiffInfo)
+	cc.files = make(map[string][]FileInfo)
+	cc.logKey = ""
+	cc.logIDs = nil
+}
+
+// currentHead returns the SHA HEAD points at, or "" for an unborn branch
+func currentHead() string {
+	output, err := runGit("rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
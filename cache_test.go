@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCommitCacheKeyedByHead(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	oldCache := cache
+	cache = newCommitCache()
+	defer func() { cache = oldCache }()
+
+	commits, err := loadCommits(context.Background(), logFilter{})
+	if err != nil {
+		t.Fatalf("loadCommits(context.Background(), logFilter{}) failed: %v", err)
+	}
+	if len(commits) != 3 {
+		t.Fatalf("loadCommits(context.Background(), logFilter{}) returned %d commits, want 3", len(commits))
+	}
+	for _, info := range commits {
+		if _, ok := cache.commit(info.ID); !ok {
+			t.Errorf("commit %s not cached", info.ID)
+		}
+	}
+
+	head := currentHead()
+	if head != commits[0].ID {
+		t.Errorf("currentHead() = %s, want %s", head, commits[0].ID)
+	}
+	cache.putLog(head, []string{commits[0].ID})
+	if ids, ok := cache.log(head); !ok || len(ids) != 1 {
+		t.Errorf("cache.log(head) = %v, %v", ids, ok)
+	}
+	if _, ok := cache.log(commits[1].ID); ok {
+		t.Error("log cached for a different HEAD should miss")
+	}
+}
+
+func TestCommitCacheFollowsAttributes(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+	oldCache := cache
+	cache = newCommitCache()
+	defer func() { cache = oldCache }()
+
+	spec, err := resolveDiff("HEAD", modeCommit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := listDiffFiles(context.Background(), spec, DiffOptions{}, nil)
+	if err != nil || len(files) == 0 || files[0].Generated {
+		t.Fatalf("files = %+v, %v", files, err)
+	}
+	if len(cache.files) != 1 {
+		t.Error("file list of a commit not cached")
+	}
+
+	// Marking the file generated shows in the cached commit's file list
+	os.WriteFile(".gitattributes", []byte(files[0].Path+" linguist-generated\n"), 0644)
+	files, err = listDiffFiles(context.Background(), spec, DiffOptions{}, nil)
+	if err != nil || !files[0].Generated {
+		t.Errorf("files after marking generated = %+v, %v", files, err)
+	}
+
+	// Relative dates are fixed when the filter is read
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/diffs?since=2+weeks+ago", nil)
+	if filter, err := logFilterFromQuery(c); err != nil || !strings.HasPrefix(filter.Since, "@") {
+		t.Errorf("since = %q, %v; want an absolute time", filter.Since, err)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// filesPlaceholder in a check command is replaced with the changed files
+const filesPlaceholder = "{files}"
+
+// check is a project command configured with
+//
+//	git config differing.check.<name> '<command>'
+//
+// for example differing.check.gofmt 'gofmt -l {files}'. Commands run
+// through the shell from the repository root, against the working tree.
+type check struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+}
+
+// CheckDiagnostic is a file:line[:column]: message report from a check,
+// limited to files in the diff
+type CheckDiagnostic struct {
+	Path    string `json:"path"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// CheckEvent is one line of the NDJSON stream returned by runChecks
+type CheckEvent struct {
+	Type       string           `json:"type"` // start, output, diagnostic, skip, exit
+	Check      string           `json:"check"`
+	Command    string           `json:"command,omitempty"`
+	Text       string           `json:"text,omitempty"`
+	Diagnostic *CheckDiagnostic `json:"diagnostic,omitempty"`
+	ExitCode   *int             `json:"exitCode,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+var diagnosticLine = regexp.MustCompile(`^([^:\s][^:]*):(\d+)(?::(\d+))?:\s*(.*)$`)
+
+// loadChecks returns the configured checks in config file order
+func loadChecks() []check {
+	output, err := runGit("config", "--get-regexp", `^differing\.check\.`)
+	if err != nil {
+		// git config exits 1 when nothing matches
+		return nil
+	}
+	var checks []check
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		key, command, _ := strings.Cut(line, " ")
+		if name := strings.TrimPrefix(key, "differing.check."); name != "" && command != "" {
+			checks = append(checks, check{Name: name, Command: command})
+		}
+	}
+	return checks
+}
+
+// parseDiagnostic extracts a diagnostic from a line of check output,
+// returning nil unless it refers to one of files
+func parseDiagnostic(line string, files map[string]bool) *CheckDiagnostic {
+	m := diagnosticLine.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return nil
+	}
+	path := filepath.ToSlash(filepath.Clean(m[1]))
+	if filepath.IsAbs(m[1]) {
+		rel, err := filepath.Rel(gitRoot, m[1])
+		if err != nil {
+			return nil
+		}
+		path = filepath.ToSlash(rel)
+	}
+	if !files[path] {
+		return nil
+	}
+	lineNumber, _ := strconv.Atoi(m[2])
+	column, _ := strconv.Atoi(m[3])
+	return &CheckDiagnostic{Path: path, Line: lineNumber, Column: column, Message: m[4]}
+}
+
+// shellQuote quotes s as one argument in a script for shellCommand
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return cmdQuote(s)
+	}
+	return posixQuote(s)
+}
+
+// posixQuote quotes s for a POSIX shell, which git runs editor commands
+// through even on Windows
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// cmdMetachars are the characters cmd.exe treats specially on a command
+// line, escaped with ^ to pass them through
+var cmdMetachars = strings.NewReplacer(
+	"(", "^(", ")", "^)", "%", "^%", "!", "^!", "^", "^^",
+	`"`, `^"`, "<", "^<", ">", "^>", "&", "^&", "|", "^|",
+)
+
+// cmdQuote quotes s for cmd.exe: first as one argument the way programs
+// split their command line, with quotes and the backslashes before them
+// escaped, then with every character cmd interprets, the quotes included,
+// escaped so it hands the argument on unchanged
+func cmdQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	backslashes := 0
+	for _, r := range s {
+		switch r {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			b.WriteString(strings.Repeat(`\`, 2*backslashes+1))
+		default:
+			b.WriteString(strings.Repeat(`\`, backslashes))
+		}
+		backslashes = 0
+		b.WriteRune(r)
+	}
+	b.WriteString(strings.Repeat(`\`, 2*backslashes))
+	b.WriteByte('"')
+	return cmdMetachars.Replace(b.String())
+}
+
+// shellCommand returns a command running script through the platform
+// shell, killed when ctx is done
+func shellCommand(ctx context.Context, script string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/S", "/C", script)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", script)
+	}
+	// Scripts that run git themselves should see the same settings, as
+	// toolCommand gives every other program
+	cmd.Env = subprocessEnv()
+	hideConsole(cmd)
+	setShellCommandLine(cmd, script)
+	return cmd
+}
+
+// getChecks lists the configured checks
+func getChecks(c *gin.Context) {
+	checks := loadChecks()
+	if checks == nil {
+		checks = []check{}
+	}
+	c.JSON(http.StatusOK, checks)
+}
+
+// runChecks runs checks against the files changed by a diff, streaming
+// their combined output as NDJSON CheckEvents
+func runChecks(c *gin.Context) {
+	var req struct {
+		DiffID string   `json:"diffId"`
+		Mode   string   `json:"mode"`
+		Checks []string `json:"checks"` // empty runs all
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	if req.DiffID == "" {
+		req.DiffID = "working"
+	}
+	spec, err := resolveDiff(req.DiffID, req.Mode)
+	switch {
+	case errors.Is(err, errUnknownRevision):
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	case err != nil:
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	var checks []check
+	for _, ch := range loadChecks() {
+		if len(req.Checks) == 0 || slices.Contains(req.Checks, ch.Name) {
+			checks = append(checks, ch)
+		}
+	}
+	if len(checks) == 0 {
+		respondError(c, http.StatusNotFound, "No matching checks configured", nil)
+		return
+	}
+
+	changed, err := listDiffFiles(c.Request.Context(), spec, DiffOptions{}, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to get diff files", err)
+		return
+	}
+	files := make(map[string]bool)
+	var quoted []string
+	for _, f := range changed {
+		if f.Status != "deleted" && !f.Submodule {
+			files[f.Path] = true
+			quoted = append(quoted, shellQuote(f.Path))
+		}
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	emit := func(event CheckEvent) {
+		enc.Encode(event)
+		c.Writer.Flush()
+	}
+
+	for _, ch := range checks {
+		if strings.Contains(ch.Command, filesPlaceholder) && len(quoted) == 0 {
+			emit(CheckEvent{Type: "skip", Check: ch.Name, Text: "no changed files"})
+			continue
+		}
+		script := strings.ReplaceAll(ch.Command, filesPlaceholder, strings.Join(quoted, " "))
+		emit(CheckEvent{Type: "start", Check: ch.Name, Command: ch.Command})
+
+		exitCode, err := runShell(c, script, func(line string) {
+			emit(CheckEvent{Type: "output", Check: ch.Name, Text: line})
+			if d := parseDiagnostic(line, files); d != nil {
+				emit(CheckEvent{Type: "diagnostic", Check: ch.Name, Diagnostic: d})
+			}
+		})
+		event := CheckEvent{Type: "exit", Check: ch.Name, ExitCode: &exitCode}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		emit(event)
+		if c.Request.Context().Err() != nil {
+			return
+		}
+	}
+}
+
+// runShell runs script from the repository root, passing each line of its
+// combined output to onLine, and returns its exit code. The command is
+// killed if the client goes away.
+func runShell(c *gin.Context, script string, onLine func(string)) (int, error) {
+	cmd := shellCommand(c.Request.Context(), script)
+	cmd.Dir = gitRoot
+	return streamCommand(cmd, onLine)
+}
+
+// streamCommand runs cmd, passing each line of its combined output to
+// onLine, and returns its exit code
+func streamCommand(cmd *exec.Cmd, onLine func(string)) (int, error) {
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return -1, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		done <- err
+	}()
+
+	scanner := bufio.NewScanner(pr)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		onLine(scanner.Text())
+	}
+	// Drain anything left after an over-long line so Wait can finish
+	io.Copy(io.Discard, pr)
+
+	err := <-done
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
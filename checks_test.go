@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseDiagnostic(t *testing.T) {
+	files := map[string]bool{"main.go": true, "frontend/src/App.tsx": true}
+	tests := []struct {
+		line string
+		want *CheckDiagnostic
+	}{
+		{"main.go:12:5: undefined: foo", &CheckDiagnostic{Path: "main.go", Line: 12, Column: 5, Message: "undefined: foo"}},
+		{"./frontend/src/App.tsx:3: missing semicolon", &CheckDiagnostic{Path: "frontend/src/App.tsx", Line: 3, Message: "missing semicolon"}},
+		{"other.go:1:1: not in the diff", nil},
+		{"ok  \tdiffering\t0.5s", nil},
+	}
+	for _, tt := range tests {
+		got := parseDiagnostic(tt.line, files)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("parseDiagnostic(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got := posixQuote("it's here"); got != `'it'\''s here'` {
+		t.Errorf("posixQuote() = %s", got)
+	}
+	tests := []struct{ in, want string }{
+		{`a b`, `^"a b^"`},
+		{`say "hi" & go`, `^"say \^"hi\^" ^& go^"`},
+		{`C:\dir\`, `^"C:\dir\\^"`},
+		{`100% (done)`, `^"100^% ^(done^)^"`},
+	}
+	for _, tt := range tests {
+		if got := cmdQuote(tt.in); got != tt.want {
+			t.Errorf("cmdQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRunChecks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("check commands in this test use a POSIX shell")
+	}
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	oldRoot := gitRoot
+	gitRoot = repoDir
+	defer func() { gitRoot = oldRoot }()
+
+	runGit("config", "differing.check.lint", `for f in {files}; do echo "$f:1:2: bad style"; done; exit 3`)
+	runGit("config", "differing.check.unused", "echo never runs")
+
+	r := gin.New()
+	r.POST("/api/checks/run", runChecks)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/checks/run", strings.NewReader(`{"checks": ["lint"]}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+
+	var events []CheckEvent
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var event CheckEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("bad event %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	if got := strings.Join(types, ","); got != "start,output,diagnostic,exit" {
+		t.Fatalf("event types = %s", got)
+	}
+	if d := events[2].Diagnostic; d == nil || d.Path != "test2.ts" || d.Line != 1 || d.Column != 2 {
+		t.Errorf("diagnostic = %+v", d)
+	}
+	if code := events[3].ExitCode; code == nil || *code != 3 {
+		t.Errorf("exit code = %v, want 3", code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/checks/run", strings.NewReader(`{"checks": ["missing"]}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown check status = %d, want 404", w.Code)
+	}
+}
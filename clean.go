@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CleanPreview lists the untracked files and directories git clean would
+// remove. Token must be sent back to POST /api/clean to remove them.
+type CleanPreview struct {
+	// Paths end in / for whole directories
+	Paths []string `json:"paths"`
+	Token string   `json:"token"`
+}
+
+// CleanRequest is the body of POST /api/clean
+type CleanRequest struct {
+	// Ignored includes files .gitignore excludes, like build output
+	Ignored bool `json:"ignored"`
+	// Paths limits cleaning to these files and directories
+	Paths []string `json:"paths"`
+	// Token is from the preview made with the same options
+	Token string `json:"token"`
+}
+
+// cleanArgs builds a git clean command over paths, which are taken
+// literally rather than as globs
+func cleanArgs(mode string, ignored bool, paths []string) []string {
+	args := []string{"-c", "core.quotePath=false", "clean", mode, "-d"}
+	if ignored {
+		args = append(args, "-x")
+	}
+	args = append(args, "--")
+	for _, p := range paths {
+		args = append(args, ":(literal)"+p)
+	}
+	return args
+}
+
+// previewClean runs git clean in dry-run mode and returns what it would
+// remove, with a token identifying exactly that list
+func previewClean(ignored bool, paths []string) (CleanPreview, error) {
+	output, err := runGit(cleanArgs("-n", ignored, paths)...)
+	if err != nil {
+		return CleanPreview{}, err
+	}
+	preview := CleanPreview{Paths: []string{}}
+	for _, line := range strings.Split(string(output), "\n") {
+		if p, ok := strings.CutPrefix(line, "Would remove "); ok {
+			preview.Paths = append(preview.Paths, unquotePath(p))
+		}
+	}
+	// The options are part of the token so a preview of tracked-only
+	// debris cannot confirm a clean that includes ignored files
+	h := sha256.New()
+	if ignored {
+		h.Write([]byte("ignored\x00"))
+	}
+	for _, p := range preview.Paths {
+		h.Write([]byte(p + "\x00"))
+	}
+	preview.Token = hex.EncodeToString(h.Sum(nil))
+	return preview, nil
+}
+
+// getCleanPreview lists what POST /api/clean would remove. ?ignored=true
+// includes ignored files and each ?path= limits the preview to it.
+func getCleanPreview(c *gin.Context) {
+	preview, err := previewClean(c.Query("ignored") == "true", c.QueryArray("path"))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to preview clean", err)
+		return
+	}
+	c.JSON(http.StatusOK, preview)
+}
+
+// postClean removes untracked files after checking the request's token
+// still matches a fresh preview, so nothing appears in the list that the
+// user has not seen
+func postClean(c *gin.Context) {
+	var req CleanRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		respondError(c, http.StatusBadRequest, "A preview token is required; get one from /api/clean/preview", err)
+		return
+	}
+	preview, err := previewClean(req.Ignored, req.Paths)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to preview clean", err)
+		return
+	}
+	if preview.Token != req.Token {
+		respondError(c, http.StatusConflict, "The files to remove have changed since the preview", nil)
+		return
+	}
+	if len(preview.Paths) > 0 {
+		// Removing the previewed paths themselves keeps anything created
+		// since the check out of reach
+		if _, err := runGitContext(c.Request.Context(), cleanArgs("-f", req.Ignored, preview.Paths)...); err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to clean", err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"removed": preview.Paths})
+}
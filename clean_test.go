@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClean(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	os.WriteFile(".gitignore", []byte("*.log\n"), 0644)
+	runGit("add", ".gitignore")
+	os.WriteFile("scratch.txt", []byte("x"), 0644)
+	os.WriteFile("build.log", []byte("x"), 0644)
+	os.MkdirAll(filepath.Join("out", "deep"), 0755)
+	os.WriteFile(filepath.Join("out", "deep", "a.o"), []byte("x"), 0644)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/clean/preview", getCleanPreview)
+	r.POST("/api/clean", postClean)
+
+	preview := func(query string) CleanPreview {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/clean/preview"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("preview = %d: %s", w.Code, w.Body)
+		}
+		var p CleanPreview
+		json.Unmarshal(w.Body.Bytes(), &p)
+		return p
+	}
+	clean := func(req CleanRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		httpReq := httptest.NewRequest(http.MethodPost, "/api/clean", strings.NewReader(string(body)))
+		httpReq.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, httpReq)
+		return w
+	}
+
+	p := preview("")
+	if strings.Join(p.Paths, ",") != "out/,scratch.txt" || p.Token == "" {
+		t.Errorf("preview = %+v, want out/ and scratch.txt", p)
+	}
+	if withIgnored := preview("?ignored=true"); len(withIgnored.Paths) != 3 || withIgnored.Token == p.Token {
+		t.Errorf("preview with ignored = %+v", withIgnored)
+	}
+	if limited := preview("?path=out"); strings.Join(limited.Paths, ",") != "out/" {
+		t.Errorf("preview of out = %v", limited.Paths)
+	}
+
+	if w := clean(CleanRequest{}); w.Code != http.StatusBadRequest {
+		t.Errorf("clean without a token = %d, want 400", w.Code)
+	}
+	// A file created after the preview invalidates its token
+	os.WriteFile("late.txt", []byte("x"), 0644)
+	if w := clean(CleanRequest{Token: p.Token}); w.Code != http.StatusConflict {
+		t.Errorf("clean with a stale token = %d, want 409", w.Code)
+	}
+
+	p = preview("?path=out")
+	if w := clean(CleanRequest{Paths: []string{"out"}, Token: p.Token}); w.Code != http.StatusOK {
+		t.Fatalf("clean = %d: %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat("out"); !os.IsNotExist(err) {
+		t.Error("out/ was not removed")
+	}
+	for _, kept := range []string{"scratch.txt", "late.txt", "build.log"} {
+		if _, err := os.Stat(kept); err != nil {
+			t.Errorf("%s outside the cleaned path was removed", kept)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cloneDepth is how much history serve --clone fetches; more can be
+// fetched from the UI with /api/deepen
+const cloneDepth = 50
+
+// readOnly is set when serving a managed clone, whose working tree is
+// replaced on every fetch and so must not be edited
+var readOnly bool
+
+// readOnlyAllowed are the mutating endpoints that stay available in
+// read-only mode: they touch neither the working tree nor history
+var readOnlyAllowed = map[string]bool{
+	"/api/shutdown":     true,
+	"/api/deepen":       true,
+	"/api/lint-message": true,
+}
+
+// cloneDir returns where serve --clone keeps its clone of url at ref,
+// under the user's cache directory
+func cloneDir(url, ref string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(url + "\x00" + ref))
+	name := strings.TrimSuffix(filepath.Base(strings.TrimRight(url, "/")), ".git")
+	return filepath.Join(dir, "differing", "clones", name+"-"+hex.EncodeToString(sum[:6])), nil
+}
+
+// prepareClone makes a shallow clone of url at ref (the remote's default
+// branch when empty), or updates the clone made by an earlier run, and
+// returns its directory
+func prepareClone(url, ref string) (string, error) {
+	if strings.HasPrefix(url, "-") || strings.HasPrefix(ref, "-") {
+		return "", errors.New("clone URL and ref must not start with -")
+	}
+	dir, err := cloneDir(url, ref)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		fmt.Printf("Updating %s in %s\n", url, dir)
+		if err := updateClone(dir, ref); err != nil {
+			return "", err
+		}
+		return dir, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	fmt.Printf("Cloning %s into %s\n", url, dir)
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	args := []string{"clone", "--depth", strconv.Itoa(cloneDepth), "--single-branch", "--no-tags"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	if _, err := runGit(append(args, "--", url, dir)...); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("clone failed: %s", gitStderr(err))
+	}
+	return dir, nil
+}
+
+// updateClone fetches ref (or the cloned branch) into the clone in dir and
+// moves its working tree to the result
+func updateClone(dir, ref string) error {
+	sha, err := fetchClone(dir, ref)
+	if err != nil {
+		return err
+	}
+	return resetClone(dir, sha)
+}
+
+// fetchClone fetches ref (or the cloned branch) into the clone in dir,
+// returning the commit fetched. Only objects and FETCH_HEAD are written,
+// so requests reading the repository are not disturbed.
+func fetchClone(dir, ref string) (string, error) {
+	args := []string{"-C", dir, "fetch", "--depth", strconv.Itoa(cloneDepth), "--no-tags", "origin"}
+	if ref != "" {
+		args = append(args, ref)
+	}
+	if _, err := runGit(args...); err != nil {
+		return "", fmt.Errorf("fetch failed: %s", gitStderr(err))
+	}
+	output, err := runGit("-C", dir, "rev-parse", "--verify", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("fetch failed: %s", gitStderr(err))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// resetClone moves the clone in dir, branch and working tree, to sha
+func resetClone(dir, sha string) error {
+	if _, err := runGit("-C", dir, "reset", "--hard", "--quiet", sha); err != nil {
+		return fmt.Errorf("reset failed: %s", gitStderr(err))
+	}
+	return nil
+}
+
+// fetchPeriodically keeps the served clone up to date. Fetching, which
+// can be slow, happens alongside requests; only the reset of the working
+// tree waits until no request is using the repository.
+func fetchPeriodically(dir, ref string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	for range time.Tick(interval) {
+		sha, err := fetchClone(dir, ref)
+		if err != nil {
+			slog.Warn("failed to update clone", "error", err)
+			continue
+		}
+		repoMu.Lock()
+		before := currentHead()
+		if before != sha {
+			err = resetClone(dir, sha)
+		}
+		after := currentHead()
+		repoMu.Unlock()
+		switch {
+		case err != nil:
+			slog.Warn("failed to update clone", "error", err)
+		case before != after:
+			slog.Info("clone updated", "head", after)
+		}
+	}
+}
+
+// rejectWrites refuses requests that could change the repository while
+// it is served read-only
+func rejectWrites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if readOnly && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead && !readOnlyAllowed[c.Request.URL.Path] {
+			respondError(c, http.StatusForbidden, "Repository is served read-only", nil)
+			return
+		}
+		c.Next()
+	}
+}
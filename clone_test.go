@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPrepareClone(t *testing.T) {
+	srcDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	url := "file://" + srcDir
+	dir, err := prepareClone(url, "")
+	if err != nil {
+		t.Fatalf("prepareClone() failed: %v", err)
+	}
+	head := func(dir string) string {
+		output, _ := runGit("-C", dir, "rev-parse", "HEAD")
+		return strings.TrimSpace(string(output))
+	}
+	if head(dir) != head(srcDir) {
+		t.Fatalf("clone HEAD %s, source %s", head(dir), head(srcDir))
+	}
+
+	runGit("-C", srcDir, "commit", "-q", "--allow-empty", "-m", "Upstream change")
+	again, err := prepareClone(url, "")
+	if err != nil || again != dir {
+		t.Fatalf("second prepareClone() = %s, %v; want the existing %s", again, err, dir)
+	}
+	if head(dir) != head(srcDir) {
+		t.Errorf("clone was not updated to the new upstream commit")
+	}
+
+	if _, err := prepareClone("--upload-pack=evil", ""); err == nil {
+		t.Error("prepareClone() accepted an option as the URL")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("clone directory missing: %v", err)
+	}
+}
+
+func TestRejectWrites(t *testing.T) {
+	defer func() { readOnly = false }()
+	readOnly = true
+
+	r := gin.New()
+	r.Use(rejectWrites())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/api/diffs", ok)
+	r.POST("/api/file-save/working/a", ok)
+	r.POST("/api/shutdown", ok)
+
+	for _, tt := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/diffs", http.StatusOK},
+		{http.MethodPost, "/api/file-save/working/a", http.StatusForbidden},
+		{http.MethodPost, "/api/shutdown", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CommitDetails is everything about one commit, as returned by
+// GET /api/commits/:commit
+type CommitDetails struct {
+	SHA     string   `json:"sha"`
+	Tree    string   `json:"tree"`
+	Parents []string `json:"parents"`
+	// Author wrote the change; Committer last applied it, which differs
+	// after a rebase, cherry-pick, or git am
+	Author    Person `json:"author"`
+	Committer Person `json:"committer"`
+	Subject   string `json:"subject"`
+	// Body is the message after the subject line, trailers included
+	Body      string         `json:"body"`
+	Signature *SignatureInfo `json:"signature,omitempty"`
+	// Refs are the branches and tags pointing at the commit
+	Refs     []string  `json:"refs"`
+	Trailers []Trailer `json:"trailers"`
+	// Links are issue references in the message matched by differing.link rules
+	Links        []MessageLink       `json:"links,omitempty"`
+	Conventional *ConventionalCommit `json:"conventional,omitempty"`
+}
+
+// Person is a commit's author or committer, or a person named in a trailer
+type Person struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	// Date is only set for authors and committers
+	Date *time.Time `json:"date,omitempty"`
+}
+
+// Trailer is one "Key: value" line from the end of a commit message
+type Trailer struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Person is set when the value has the "Name <email>" form used by
+	// Signed-off-by, Co-authored-by, and the like
+	Person *Person `json:"person,omitempty"`
+}
+
+// commitDetailsFormat requests the fields of CommitDetails; the message
+// comes last as it may span lines
+const commitDetailsFormat = "%H%x00%T%x00%P%x00%an%x00%ae%x00%aI%x00%cn%x00%ce%x00%cI%x00" + signatureFormat + "%x00%B"
+
+// commitDetails reads everything about the commit sha
+func commitDetails(sha string) (*CommitDetails, error) {
+	output, err := runGit("show", "-s", "--format="+commitDetailsFormat, sha)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.SplitN(string(output), "\x00", 13)
+	for len(fields) < 13 {
+		fields = append(fields, "")
+	}
+	d := &CommitDetails{
+		SHA:       fields[0],
+		Tree:      fields[1],
+		Parents:   strings.Fields(fields[2]),
+		Author:    person(fields[3], fields[4], fields[5]),
+		Committer: person(fields[6], fields[7], fields[8]),
+		Signature: parseSignature(fields[9], fields[10], fields[11]),
+	}
+	message := strings.TrimRight(fields[12], "\n")
+	subject, body, _ := strings.Cut(message, "\n")
+	d.Subject = subject
+	d.Body = strings.TrimLeft(body, "\n")
+	d.Links = findLinks(linkRules(), message)
+	d.Conventional = parseConventional(subject)
+
+	if d.Trailers, err = parseTrailers(message); err != nil {
+		return nil, err
+	}
+	if d.Refs, err = refsPointingAt(sha); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func person(name, email, date string) Person {
+	p := Person{Name: name, Email: email}
+	if t, err := time.Parse(time.RFC3339, date); err == nil {
+		p.Date = &t
+	}
+	return p
+}
+
+// parseTrailers returns the trailers at the end of message, as git
+// interpret-trailers finds them
+func parseTrailers(message string) ([]Trailer, error) {
+	output, err := runGitInput([]byte(message+"\n"), "interpret-trailers", "--parse", "--unfold")
+	if err != nil {
+		return nil, err
+	}
+	trailers := []Trailer{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		t := Trailer{Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)}
+		t.Person = parsePerson(t.Value)
+		trailers = append(trailers, t)
+	}
+	return trailers, nil
+}
+
+// parsePerson parses "Name <email>", returning nil for other values
+func parsePerson(value string) *Person {
+	name, rest, ok := strings.Cut(value, "<")
+	if !ok || !strings.HasSuffix(rest, ">") {
+		return nil
+	}
+	email := strings.TrimSuffix(rest, ">")
+	if !strings.Contains(email, "@") {
+		return nil
+	}
+	return &Person{Name: strings.TrimSpace(name), Email: email}
+}
+
+// trailerKey matches the keys git accepts for trailers, like Co-authored-by
+var trailerKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
+// appendTrailers adds trailers to the end of message with git
+// interpret-trailers, which starts the trailer block where one is needed
+// and skips a trailer the message already has
+func appendTrailers(message string, trailers []Trailer) (string, error) {
+	if len(trailers) == 0 {
+		return message, nil
+	}
+	args := []string{"interpret-trailers", "--where", "end", "--if-exists", "addIfDifferent"}
+	for _, t := range trailers {
+		if !trailerKey.MatchString(t.Key) {
+			return "", fmt.Errorf("invalid trailer key %q", t.Key)
+		}
+		value := strings.TrimSpace(t.Value)
+		if value == "" || strings.ContainsAny(value, "\r\n") {
+			return "", fmt.Errorf("invalid value for trailer %s", t.Key)
+		}
+		args = append(args, "--trailer", t.Key+": "+value)
+	}
+	output, err := runGitInput([]byte(strings.TrimRight(message, "\n")+"\n"), args...)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+// refsPointingAt lists the branches, remote branches, and tags at sha
+func refsPointingAt(sha string) ([]string, error) {
+	output, err := runGit("for-each-ref", "--points-at", sha, "--format=%(refname:short)", "refs/heads", "refs/remotes", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	refs := []string{}
+	for _, ref := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+func getCommit(c *gin.Context) {
+	sha, err := resolveRev(c.Param("commit"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	}
+	details, err := commitDetails(sha)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read commit", err)
+		return
+	}
+	c.JSON(http.StatusOK, details)
+}
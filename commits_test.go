@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetCommit(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot = repoDir
+
+	message := "feat: add greeting\n\nExplain the change\nover two lines.\n\nCo-authored-by: Pat Doe <pat@example.com>\nFixes: #12\n"
+	cmd := exec.Command("git", "-c", "user.name=Committer", "-c", "user.email=committer@example.com",
+		"commit", "-q", "--allow-empty", "--author=Author <author@example.com>", "-m", message)
+	cmd.Env = append(os.Environ(), "GIT_COMMITTER_NAME=Committer", "GIT_COMMITTER_EMAIL=committer@example.com")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("commit: %v\n%s", err, output)
+	}
+	if output, err := exec.Command("git", "tag", "-a", "-m", "release", "v1").CombinedOutput(); err != nil {
+		t.Fatalf("tag: %v\n%s", err, output)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/commits/:commit", getCommit)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/commits/HEAD", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var d CommitDetails
+	if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.SHA) != 40 || len(d.Parents) != 1 || len(d.Tree) != 40 {
+		t.Errorf("sha/parents/tree = %q/%v/%q", d.SHA, d.Parents, d.Tree)
+	}
+	if d.Author.Name != "Author" || d.Committer.Name != "Committer" || d.Author.Date == nil {
+		t.Errorf("author/committer = %+v/%+v", d.Author, d.Committer)
+	}
+	if d.Subject != "feat: add greeting" {
+		t.Errorf("subject = %q", d.Subject)
+	}
+	if want := "Explain the change\nover two lines.\n\nCo-authored-by: Pat Doe <pat@example.com>\nFixes: #12"; d.Body != want {
+		t.Errorf("body = %q, want %q", d.Body, want)
+	}
+	if d.Conventional == nil || d.Conventional.Type != "feat" {
+		t.Errorf("conventional = %+v", d.Conventional)
+	}
+	if len(d.Trailers) != 2 {
+		t.Fatalf("trailers = %+v", d.Trailers)
+	}
+	if tr := d.Trailers[0]; tr.Key != "Co-authored-by" || tr.Person == nil || tr.Person.Email != "pat@example.com" || tr.Person.Name != "Pat Doe" {
+		t.Errorf("co-author trailer = %+v", tr)
+	}
+	if tr := d.Trailers[1]; tr.Key != "Fixes" || tr.Value != "#12" || tr.Person != nil {
+		t.Errorf("fixes trailer = %+v", tr)
+	}
+	if len(d.Refs) != 2 || d.Refs[1] != "v1" {
+		t.Errorf("refs = %v, want the branch and v1", d.Refs)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/commits/no-such-commit", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown commit status = %d", w.Code)
+	}
+}
+
+func TestAppendTrailers(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		trailers []Trailer
+		want     string
+	}{
+		{"none", "Subject", nil, "Subject"},
+		{"starts a trailer block", "Subject\n\nBody.", []Trailer{{Key: "Co-authored-by", Value: "Pat <pat@example.com>"}},
+			"Subject\n\nBody.\n\nCo-authored-by: Pat <pat@example.com>\n"},
+		{"joins an existing block", "Subject\n\nSigned-off-by: A <a@example.com>\n", []Trailer{{Key: "Fixes", Value: "#3"}},
+			"Subject\n\nSigned-off-by: A <a@example.com>\nFixes: #3\n"},
+		{"skips a duplicate", "Subject\n\nFixes: #3", []Trailer{{Key: "Fixes", Value: "#3"}},
+			"Subject\n\nFixes: #3\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := appendTrailers(tt.message, tt.trailers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, bad := range []Trailer{{Key: "Bad key", Value: "x"}, {Key: "Fixes", Value: "a\nb"}, {Key: "Fixes", Value: " "}} {
+		if _, err := appendTrailers("Subject", []Trailer{bad}); err == nil {
+			t.Errorf("trailer %+v accepted", bad)
+		}
+	}
+}
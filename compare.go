@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FileComparison is a diff between two files that need not share a path
+// or revision. Path and the rest of FileDiff describe the new side, which
+// for compare-content is the posted text.
+type FileComparison struct {
+	OldPath string `json:"oldPath"`
+	OldRef  string `json:"oldRef,omitempty"`
+	NewRef  string `json:"newRef,omitempty"`
+	FileDiff
+	Additions int `json:"additions"`
+	Deletions int `json:"deletions"`
+}
+
+// parseFileRef splits "path@ref" into its parts. The ref follows the
+// first @ that neither starts a reflog suffix such as @{1} nor starts a
+// path component such as pkg/@scope, so refs like HEAD@{1} keep their @;
+// without one the working tree file is meant.
+func parseFileRef(s string) (path, ref string) {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '@' && s[i-1] != '/' && !strings.HasPrefix(s[i:], "@{") {
+			return repoPath(s[:i]), s[i+1:]
+		}
+	}
+	return repoPath(s), ""
+}
+
+// readFileVersion returns path's content at rev, or in the working tree
+// when rev is empty. Content over the size limit is not read, and
+// tooLarge is set instead.
+func readFileVersion(path, rev string, force bool) (data []byte, exists, tooLarge bool, err error) {
+	if path == "" || isAbsPath(path) {
+		return nil, false, false, fmt.Errorf("invalid file path: %s", path)
+	}
+	if rev != "" {
+		sha, err := resolveRev(rev)
+		if err != nil {
+			return nil, false, false, err
+		}
+		blob, size, found, err := blobInfo(sha, path)
+		if err != nil || !found {
+			return nil, false, false, err
+		}
+		if exceedsLimit(size, force) {
+			return nil, true, true, nil
+		}
+		data, err = readBlob(blob)
+		return data, true, false, err
+	}
+
+	info, err := secureRoot.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, false, nil
+	}
+	if err != nil {
+		return nil, false, false, err
+	}
+	if info.IsDir() {
+		return nil, false, false, nil
+	}
+	if exceedsLimit(info.Size(), force) {
+		return nil, true, true, nil
+	}
+	data, err = secureRoot.ReadFile(path)
+	return data, err == nil, false, err
+}
+
+// getCompareFiles diffs a=<path@ref> against b=<path@ref>, such as a copied
+// implementation against the file it came from
+func getCompareFiles(c *gin.Context) {
+	oldPath, oldRef := parseFileRef(c.Query("a"))
+	newPath, newRef := parseFileRef(c.Query("b"))
+	if oldPath == "" || newPath == "" {
+		respondError(c, http.StatusBadRequest, "Both a and b are required", nil)
+		return
+	}
+	force := c.Query("force") == "true"
+
+	f := staticFile{FileInfo: FileInfo{Path: newPath}}
+	var oldTooLarge, newTooLarge bool
+	var err error
+	for _, side := range []struct {
+		path, ref string
+		data      *[]byte
+		tooLarge  *bool
+	}{{oldPath, oldRef, &f.old, &oldTooLarge}, {newPath, newRef, &f.new, &newTooLarge}} {
+		var exists bool
+		*side.data, exists, *side.tooLarge, err = readFileVersion(side.path, side.ref, force)
+		switch {
+		case errors.Is(err, errUnknownRevision) || err == nil && !exists:
+			msg := fmt.Sprintf("%s not found", side.path)
+			if side.ref != "" {
+				msg = fmt.Sprintf("%s not found at %s", side.path, side.ref)
+			}
+			respondError(c, http.StatusNotFound, msg, err)
+			return
+		case err != nil:
+			respondError(c, http.StatusInternalServerError, "Failed to read file", err)
+			return
+		}
+	}
+	f.oldExists, f.newExists = true, true
+
+	result := FileComparison{OldPath: oldPath, OldRef: oldRef, NewRef: newRef}
+	result.FileDiff = f.fileDiff(force, c.Query("intraline") == "true")
+	if oldTooLarge || newTooLarge {
+		result.FileDiff = FileDiff{Path: newPath, OldExists: true, NewExists: true, TooLarge: true}
+	} else if !result.Binary && !result.TooLarge {
+		result.Additions, result.Deletions = lineStats(string(f.old), string(f.new))
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// CompareContentRequest is the body of POST /api/compare-content; Ref
+// names the revision to compare against, or the working tree when empty
+type CompareContentRequest struct {
+	Content string `json:"content"`
+	Ref     string `json:"ref,omitempty"`
+}
+
+// postCompareContent diffs the file at a revision or in the working tree
+// against posted text, such as a suggestion to check before applying it.
+// The posted text is the new side; a file that does not exist yet is
+// compared as empty.
+func postCompareContent(c *gin.Context) {
+	filePath := filePathParam(c)
+	var req CompareContentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	force := c.Query("force") == "true"
+
+	old, exists, tooLarge, err := readFileVersion(filePath, req.Ref, force)
+	switch {
+	case errors.Is(err, errUnknownRevision):
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	case err != nil:
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	result := FileComparison{OldPath: filePath, OldRef: req.Ref}
+	if tooLarge {
+		result.FileDiff = FileDiff{Path: filePath, OldExists: true, NewExists: true, TooLarge: true}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	f := staticFile{FileInfo: FileInfo{Path: filePath}, old: old, new: []byte(req.Content), oldExists: exists, newExists: true}
+	result.FileDiff = f.fileDiff(force, c.Query("intraline") == "true")
+	if !result.Binary && !result.TooLarge {
+		result.Additions, result.Deletions = lineStats(string(f.old), string(f.new))
+	}
+	c.JSON(http.StatusOK, result)
+}
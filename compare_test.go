@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseFileRef(t *testing.T) {
+	tests := []struct {
+		in, path, ref string
+	}{
+		{"a.go", "a.go", ""},
+		{"a.go@HEAD~1", "a.go", "HEAD~1"},
+		{"pkg/@scope/x.js@main", "pkg/@scope/x.js", "main"},
+		{"@file", "@file", ""},
+		{"a.go@HEAD@{1}", "a.go", "HEAD@{1}"},
+		{"a.go@@{2}", "a.go", "@{2}"},
+		{"a.go@{2}", "a.go@{2}", ""},
+	}
+	for _, tt := range tests {
+		if path, ref := parseFileRef(tt.in); path != tt.path || ref != tt.ref {
+			t.Errorf("parseFileRef(%q) = %q, %q, want %q, %q", tt.in, path, ref, tt.path, tt.ref)
+		}
+	}
+}
+
+func TestCompareFiles(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	// An untracked copy of test1.go with one line changed
+	os.WriteFile("copy.go", []byte("package main\n\nfunc hello() string {\n\treturn \"hi\"\n}\n"), 0644)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/compare-files", getCompareFiles)
+	compare := func(a, b string) (int, FileComparison) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		query := url.Values{"a": {a}, "b": {b}}.Encode()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/compare-files?"+query, nil))
+		var result FileComparison
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result
+	}
+
+	code, result := compare("test1.go", "copy.go")
+	if code != http.StatusOK {
+		t.Fatalf("compare = %d", code)
+	}
+	if result.OldPath != "test1.go" || result.Path != "copy.go" || result.Additions != 1 || result.Deletions != 1 {
+		t.Errorf("compare = %+v, want one line changed", result)
+	}
+
+	// The first commit's test1.go has no return statement
+	_, result = compare("test1.go@HEAD~2", "copy.go")
+	if result.OldRef != "HEAD~2" || result.Additions != 3 || result.Deletions != 1 {
+		t.Errorf("compare against HEAD~2 = +%d -%d", result.Additions, result.Deletions)
+	}
+	if result.OldContent != "package main\n\nfunc hello() {}\n" {
+		t.Errorf("old content = %q", result.OldContent)
+	}
+
+	if code, _ := compare("missing.go", "copy.go"); code != http.StatusNotFound {
+		t.Errorf("missing file = %d, want 404", code)
+	}
+	if code, _ := compare("test1.go@nosuchref", "copy.go"); code != http.StatusNotFound {
+		t.Errorf("unknown ref = %d, want 404", code)
+	}
+	if code, _ := compare("", "copy.go"); code != http.StatusBadRequest {
+		t.Errorf("missing a = %d, want 400", code)
+	}
+}
+
+func TestCompareContent(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/compare-content/*filepath", postCompareContent)
+	compare := func(path string, req CompareContentRequest) (int, FileComparison) {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		httpReq := httptest.NewRequest(http.MethodPost, "/api/compare-content/"+path, strings.NewReader(string(body)))
+		httpReq.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, httpReq)
+		var result FileComparison
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result
+	}
+
+	// The working tree test2.ts returns 'world'
+	suggestion := "export function world() {\n  return 'planet';\n}\n"
+	code, result := compare("test2.ts", CompareContentRequest{Content: suggestion})
+	if code != http.StatusOK {
+		t.Fatalf("compare = %d", code)
+	}
+	if result.NewContent != suggestion || result.Additions != 1 || result.Deletions != 1 || !result.OldExists {
+		t.Errorf("compare = %+v, want one line changed", result)
+	}
+
+	// The committed test2.ts is a one-line stub
+	_, result = compare("test2.ts", CompareContentRequest{Content: suggestion, Ref: "HEAD"})
+	if result.OldContent != "export function world() {}\n" || result.Additions != 3 || result.Deletions != 1 {
+		t.Errorf("compare against HEAD = %+v", result)
+	}
+
+	if _, result = compare("new.ts", CompareContentRequest{Content: "x\n"}); result.OldExists || result.Additions != 1 {
+		t.Errorf("compare new file = %+v, want it added", result)
+	}
+	if code, _ := compare("test2.ts", CompareContentRequest{Content: "x", Ref: "nosuchref"}); code != http.StatusNotFound {
+		t.Errorf("unknown ref = %d, want 404", code)
+	}
+}
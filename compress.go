@@ -0,0 +1,150 @@
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	gzipWriters  = sync.Pool{New: func() any { w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression); return w }}
+	flateWriters = sync.Pool{New: func() any { w, _ := flate.NewWriter(io.Discard, flate.DefaultCompression); return w }}
+)
+
+// acceptedEncoding picks gzip or deflate from an Accept-Encoding header,
+// preferring gzip. It returns "" if neither is acceptable.
+func acceptedEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.ReplaceAll(strings.TrimSpace(params), " ", "") == "q=0" {
+			continue
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	default:
+		return ""
+	}
+}
+
+// compressWriter compresses the response body on the fly. Whether to
+// compress is decided at the first write, so handlers that already set a
+// Content-Encoding (such as precompressed assets) pass through untouched.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	decided  bool
+	w        io.WriteCloser
+}
+
+// alreadyCompressed reports whether a content type is stored compressed,
+// so compressing it again would only cost CPU
+func alreadyCompressed(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.TrimSpace(mediaType) {
+	case "application/zip", "application/gzip", "application/x-bzip2", "application/zstd":
+		return true
+	case "image/svg+xml":
+		return false
+	}
+	return strings.HasPrefix(mediaType, "image/") || strings.HasPrefix(mediaType, "video/")
+}
+
+func (cw *compressWriter) decide() {
+	cw.decided = true
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return
+	}
+	// Byte ranges refer to the uncompressed representation
+	status := cw.Status()
+	if status == http.StatusNoContent || status == http.StatusNotModified ||
+		status == http.StatusPartialContent || status < 200 {
+		return
+	}
+	if alreadyCompressed(h.Get("Content-Type")) {
+		return
+	}
+
+	h.Set("Content-Encoding", cw.encoding)
+	h.Add("Vary", "Accept-Encoding")
+	h.Del("Content-Length")
+	// Compression changes the bytes, so a strong validator must be weakened
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		h.Set("ETag", "W/"+etag)
+	}
+
+	switch cw.encoding {
+	case "gzip":
+		gz := gzipWriters.Get().(*gzip.Writer)
+		gz.Reset(cw.ResponseWriter)
+		cw.w = gz
+	case "deflate":
+		fl := flateWriters.Get().(*flate.Writer)
+		fl.Reset(cw.ResponseWriter)
+		cw.w = fl
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.w == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.w.Write(b)
+}
+
+func (cw *compressWriter) WriteString(s string) (int, error) {
+	return cw.Write([]byte(s))
+}
+
+func (cw *compressWriter) Flush() {
+	if f, ok := cw.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	cw.ResponseWriter.Flush()
+}
+
+// close flushes any buffered compressed data and returns the compressor to its pool
+func (cw *compressWriter) close() {
+	if cw.w == nil {
+		return
+	}
+	cw.w.Close()
+	switch w := cw.w.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(w)
+	case *flate.Writer:
+		flateWriters.Put(w)
+	}
+	cw.w = nil
+}
+
+// compressResponses is middleware that gzip- or deflate-encodes responses
+// for clients that accept it.
+func compressResponses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := acceptedEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: c.Writer, encoding: encoding}
+		c.Writer = cw
+		defer cw.close()
+		c.Next()
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                     "",
+		"gzip, deflate, br":    "gzip",
+		"deflate":              "deflate",
+		"gzip;q=0, deflate":    "deflate",
+		"br":                   "",
+		"GZIP":                 "gzip",
+		"identity, gzip;q=0.5": "gzip",
+	}
+	for header, want := range tests {
+		if got := acceptedEncoding(header); got != want {
+			t.Errorf("acceptedEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestAlreadyCompressed(t *testing.T) {
+	tests := map[string]bool{
+		"application/zip":                 true,
+		"image/png":                       true,
+		"image/svg+xml":                   false,
+		"application/json; charset=utf-8": false,
+		"text/html":                       false,
+	}
+	for contentType, want := range tests {
+		if got := alreadyCompressed(contentType); got != want {
+			t.Errorf("alreadyCompressed(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
+
+func TestCompressResponses(t *testing.T) {
+	body := strings.Repeat("differing ", 1000)
+
+	r := gin.New()
+	r.Use(compressResponses())
+	r.GET("/text", func(c *gin.Context) { c.String(http.StatusOK, body) })
+	r.GET("/precompressed", func(c *gin.Context) {
+		c.Header("Content-Encoding", "gzip")
+		c.Data(http.StatusOK, "text/plain", []byte("already gzipped"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/text", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", w.Header().Get("Content-Encoding"))
+	}
+	if w.Body.Len() >= len(body) {
+		t.Errorf("compressed body is %d bytes, original %d", w.Body.Len(), len(body))
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() failed: %v", err)
+	}
+	decoded, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("reading gzip body failed: %v", err)
+	}
+	if string(decoded) != body {
+		t.Error("decompressed body does not match original")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/precompressed", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "already gzipped" {
+		t.Errorf("precompressed body was re-encoded: %q", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/text", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+		t.Error("response should be uncompressed without Accept-Encoding")
+	}
+}
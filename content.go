@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFileSize is the largest file (in bytes) getFileDiff will return
+// content for unless the client asks to load it anyway. Zero disables the limit.
+var maxFileSize int64 = 10 << 20
+
+const (
+	encodingUTF8   = "utf-8"
+	encodingLatin1 = "iso-8859-1"
+
+	// binarySniffLen matches the prefix git inspects when deciding whether a blob is binary
+	binarySniffLen = 8000
+)
+
+// isBinary reports whether data looks binary, using git's heuristic of a
+// NUL byte within the first few kilobytes.
+func isBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// decodeContent converts file bytes to a UTF-8 string for JSON transport.
+// Content that is not valid UTF-8 is treated as ISO-8859-1, which maps every
+// byte to a code point and so always round-trips.
+func decodeContent(data []byte) (text, encoding string) {
+	if utf8.Valid(data) {
+		return string(data), encodingUTF8
+	}
+	var b strings.Builder
+	b.Grow(len(data) * 2)
+	for _, c := range data {
+		b.WriteRune(rune(c))
+	}
+	return b.String(), encodingLatin1
+}
+
+// encodeContent converts edited text back to the file's original encoding
+func encodeContent(text, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", encodingUTF8:
+		return []byte(text), nil
+	case encodingLatin1:
+		out := make([]byte, 0, len(text))
+		for _, r := range text {
+			if r > 0xff {
+				return nil, fmt.Errorf("character %q cannot be represented in %s", r, encoding)
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+}
+
+// exceedsLimit reports whether a file of the given size should be withheld
+func exceedsLimit(size int64, force bool) bool {
+	return !force && maxFileSize > 0 && size > maxFileSize
+}
+
+// contentHash returns a hex SHA-256 of data, used to version working tree files
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// contentETag derives a strong ETag from the version identifiers of
+// everything that went into a response
+func contentETag(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// notModified sets the ETag header and, if the client already holds that
+// version, responds with 304 Not Modified and returns true. Responses are
+// marked no-cache so browsers always revalidate rather than reuse stale diffs.
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	for _, candidate := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
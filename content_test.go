@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDecodeContent(t *testing.T) {
+	text, encoding := decodeContent([]byte("héllo"))
+	if text != "héllo" || encoding != encodingUTF8 {
+		t.Errorf("decodeContent(utf-8) = %q, %q", text, encoding)
+	}
+
+	latin1 := []byte{'c', 'a', 'f', 0xe9}
+	text, encoding = decodeContent(latin1)
+	if text != "café" || encoding != encodingLatin1 {
+		t.Errorf("decodeContent(latin-1) = %q, %q", text, encoding)
+	}
+
+	back, err := encodeContent(text, encoding)
+	if err != nil {
+		t.Fatalf("encodeContent() failed: %v", err)
+	}
+	if string(back) != string(latin1) {
+		t.Errorf("encodeContent() = %v, want %v", back, latin1)
+	}
+
+	if _, err := encodeContent("日本", encodingLatin1); err == nil {
+		t.Error("encodeContent() should reject characters outside latin-1")
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	if isBinary([]byte("plain text\n")) {
+		t.Error("plain text detected as binary")
+	}
+	if !isBinary([]byte{0x89, 'P', 'N', 'G', 0x00, 0x01}) {
+		t.Error("NUL-containing data not detected as binary")
+	}
+}
+
+func TestExceedsLimit(t *testing.T) {
+	old := maxFileSize
+	defer func() { maxFileSize = old }()
+
+	maxFileSize = 100
+	if !exceedsLimit(101, false) {
+		t.Error("101 bytes should exceed a 100 byte limit")
+	}
+	if exceedsLimit(101, true) {
+		t.Error("force should bypass the limit")
+	}
+	maxFileSize = 0
+	if exceedsLimit(1<<40, false) {
+		t.Error("zero limit should disable the check")
+	}
+}
+
+func TestGetFileDiffETag(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/test2.ts", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("response should include an ETag")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/file-diff/working/test2.ts", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status with matching If-None-Match = %d, want 304", w.Code)
+	}
+
+	// Editing the working copy must change the ETag
+	if err := os.WriteFile(filepath.Join(repoDir, "test2.ts"), []byte("changed\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("status after edit = %d, want 200", w.Code)
+	}
+}
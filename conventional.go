@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ConventionalCommit holds the fields of a subject line following the
+// Conventional Commits format, "type(scope)!: description"
+type ConventionalCommit struct {
+	Type        string `json:"type"`
+	Scope       string `json:"scope,omitempty"`
+	Breaking    bool   `json:"breaking,omitempty"`
+	Description string `json:"description"`
+}
+
+var conventionalSubject = regexp.MustCompile(`^([A-Za-z][\w-]*)(?:\(([^()]*)\))?(!)?: (.+)$`)
+
+// parseConventional parses a commit subject, returning nil if it does not
+// follow the format
+func parseConventional(subject string) *ConventionalCommit {
+	m := conventionalSubject.FindStringSubmatch(strings.TrimSpace(subject))
+	if m == nil {
+		return nil
+	}
+	return &ConventionalCommit{
+		Type:        strings.ToLower(m[1]),
+		Scope:       m[2],
+		Breaking:    m[3] == "!",
+		Description: m[4],
+	}
+}
+
+// DiffGroup is a run of diffs sharing a grouping key
+type DiffGroup struct {
+	Key   string     `json:"key"`
+	Diffs []DiffInfo `json:"diffs"`
+}
+
+// Grouping keys for entries that have no conventional type
+const (
+	groupWorking = "working"
+	groupOther   = "other"
+)
+
+// groupDiffs groups diffs by the given field, keeping groups in the order
+// their first member appears. Only "type" is supported.
+func groupDiffs(diffs []DiffInfo, by string) ([]DiffGroup, error) {
+	if by != "type" {
+		return nil, fmt.Errorf("unknown groupBy %q", by)
+	}
+	var groups []DiffGroup
+	index := make(map[string]int)
+	for _, diff := range diffs {
+		key := groupOther
+		switch {
+		case diff.ID == "working":
+			key = groupWorking
+		case diff.Conventional != nil:
+			key = diff.Conventional.Type
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, DiffGroup{Key: key})
+		}
+		groups[i].Diffs = append(groups[i].Diffs, diff)
+	}
+	return groups, nil
+}
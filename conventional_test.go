@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestParseConventional(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    *ConventionalCommit
+	}{
+		{"feat: add notes API", &ConventionalCommit{Type: "feat", Description: "add notes API"}},
+		{"fix(frontend): escape paths", &ConventionalCommit{Type: "fix", Scope: "frontend", Description: "escape paths"}},
+		{"refactor(git)!: drop blobSize", &ConventionalCommit{Type: "refactor", Scope: "git", Breaking: true, Description: "drop blobSize"}},
+		{"Feat!: shout", &ConventionalCommit{Type: "feat", Breaking: true, Description: "shout"}},
+		{"Update hello function", nil},
+		{"fix:missing space", nil},
+		{"WIP: (half) done: really", &ConventionalCommit{Type: "wip", Description: "(half) done: really"}},
+	}
+	for _, tt := range tests {
+		got := parseConventional(tt.subject)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("parseConventional(%q) = %+v, want %+v", tt.subject, got, tt.want)
+		}
+	}
+}
+
+func TestGroupDiffs(t *testing.T) {
+	diffs := []DiffInfo{
+		{ID: "working"},
+		{ID: "a", Conventional: &ConventionalCommit{Type: "fix"}},
+		{ID: "b"},
+		{ID: "c", Conventional: &ConventionalCommit{Type: "feat"}},
+		{ID: "d", Conventional: &ConventionalCommit{Type: "fix"}},
+	}
+	groups, err := groupDiffs(diffs, "type")
+	if err != nil {
+		t.Fatalf("groupDiffs() error: %v", err)
+	}
+	want := map[string][]string{"working": {"working"}, "fix": {"a", "d"}, "other": {"b"}, "feat": {"c"}}
+	order := []string{"working", "fix", "other", "feat"}
+	if len(groups) != len(order) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(order))
+	}
+	for i, group := range groups {
+		if group.Key != order[i] {
+			t.Errorf("group %d key = %q, want %q", i, group.Key, order[i])
+		}
+		if len(group.Diffs) != len(want[group.Key]) {
+			t.Errorf("group %q has %d diffs, want %d", group.Key, len(group.Diffs), len(want[group.Key]))
+			continue
+		}
+		for j, diff := range group.Diffs {
+			if diff.ID != want[group.Key][j] {
+				t.Errorf("group %q diff %d = %q, want %q", group.Key, j, diff.ID, want[group.Key][j])
+			}
+		}
+	}
+
+	if _, err := groupDiffs(diffs, "author"); err == nil {
+		t.Error("groupDiffs() should reject unsupported fields")
+	}
+}
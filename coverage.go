@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// coverageProfile maps each source file in a coverage report to whether
+// each of its instrumented lines ran
+type coverageProfile map[string]map[int]bool
+
+// FileCoverage lists the covered and uncovered new-side lines of a file
+type FileCoverage struct {
+	Path      string `json:"path,omitempty"`
+	Covered   []int  `json:"covered"`
+	Uncovered []int  `json:"uncovered"`
+}
+
+// uploadedCoverage is the profile most recently sent to POST /api/coverage.
+// It takes precedence over the differing.coverage config path.
+var uploadedCoverage struct {
+	mu      sync.Mutex
+	profile coverageProfile
+}
+
+// parseCoverage parses a Go coverprofile, lcov tracefile, or Cobertura XML
+// report, detecting the format from the content
+func parseCoverage(data []byte) (coverageProfile, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("mode:")):
+		return parseGoCoverage(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return parseCobertura(trimmed)
+	case bytes.Contains(trimmed, []byte("SF:")):
+		return parseLcov(trimmed)
+	}
+	return nil, errors.New("unrecognized coverage format; expected a Go coverprofile, lcov, or Cobertura XML")
+}
+
+// mark records a line's coverage; a line covered by any block counts as covered
+func (p coverageProfile) mark(path string, line int, covered bool) {
+	lines := p[path]
+	if lines == nil {
+		lines = make(map[int]bool)
+		p[path] = lines
+	}
+	lines[line] = lines[line] || covered
+}
+
+var goCoverageBlock = regexp.MustCompile(`^(.+):(\d+)\.\d+,(\d+)\.\d+ \d+ (\d+)$`)
+
+func parseGoCoverage(data []byte) (coverageProfile, error) {
+	profile := make(coverageProfile)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		m := goCoverageBlock.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("invalid coverprofile line %q", line)
+		}
+		start, _ := strconv.Atoi(m[2])
+		end, _ := strconv.Atoi(m[3])
+		count, _ := strconv.Atoi(m[4])
+		for l := start; l <= end; l++ {
+			profile.mark(m[1], l, count > 0)
+		}
+	}
+	return profile, scanner.Err()
+}
+
+func parseLcov(data []byte) (coverageProfile, error) {
+	profile := make(coverageProfile)
+	var file string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "SF:"):
+			file = strings.TrimPrefix(line, "SF:")
+		case strings.HasPrefix(line, "DA:") && file != "":
+			fields := strings.Split(strings.TrimPrefix(line, "DA:"), ",")
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("invalid lcov line %q", line)
+			}
+			number, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid lcov line %q", line)
+			}
+			hits, _ := strconv.Atoi(fields[1])
+			profile.mark(file, number, hits > 0)
+		case line == "end_of_record":
+			file = ""
+		}
+	}
+	return profile, scanner.Err()
+}
+
+func parseCobertura(data []byte) (coverageProfile, error) {
+	var report struct {
+		Classes []struct {
+			Filename string `xml:"filename,attr"`
+			Lines    []struct {
+				Number int `xml:"number,attr"`
+				Hits   int `xml:"hits,attr"`
+			} `xml:"lines>line"`
+		} `xml:"packages>package>classes>class"`
+	}
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid Cobertura XML: %w", err)
+	}
+	profile := make(coverageProfile)
+	for _, class := range report.Classes {
+		for _, line := range class.Lines {
+			profile.mark(class.Filename, line.Number, line.Hits > 0)
+		}
+	}
+	return profile, nil
+}
+
+// lines returns the coverage for a repository path. Reports name files by
+// import path, absolute path, or relative to a source root, so a report
+// path matches when either is a suffix of the other.
+func (p coverageProfile) lines(path string) map[int]bool {
+	if lines, ok := p[path]; ok {
+		return lines
+	}
+	for name, lines := range p {
+		name = filepath.ToSlash(name)
+		if strings.HasSuffix(name, "/"+path) || strings.HasSuffix(path, "/"+name) {
+			return lines
+		}
+	}
+	return nil
+}
+
+// fileCoverage splits the instrumented lines of path into covered and
+// uncovered, restricted to only when it is non-nil
+func (p coverageProfile) fileCoverage(path string, only map[int]bool) FileCoverage {
+	fc := FileCoverage{Path: path, Covered: []int{}, Uncovered: []int{}}
+	for line, covered := range p.lines(path) {
+		if only != nil && !only[line] {
+			continue
+		}
+		if covered {
+			fc.Covered = append(fc.Covered, line)
+		} else {
+			fc.Uncovered = append(fc.Uncovered, line)
+		}
+	}
+	slices.Sort(fc.Covered)
+	slices.Sort(fc.Uncovered)
+	return fc
+}
+
+// loadCoverage returns the uploaded profile, or parses the file configured
+// with `git config differing.coverage <path>`. It returns nil, nil when no
+// coverage is available.
+func loadCoverage() (coverageProfile, error) {
+	uploadedCoverage.mu.Lock()
+	profile := uploadedCoverage.profile
+	uploadedCoverage.mu.Unlock()
+	if profile != nil {
+		return profile, nil
+	}
+
+	output, err := runGit("config", "--path", "--get", "differing.coverage")
+	if err != nil {
+		return nil, nil
+	}
+	path := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(gitRoot, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseCoverage(data)
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// hunkRange is the new side of a diff hunk: count lines from start. A
+// hunk that only deletes has a count of zero and starts at the line
+// before the deletion.
+type hunkRange struct {
+	start, count int
+}
+
+// newSideHunks returns the hunks of each file in a diff, limited to
+// pathspecs if any are given. Deleted files are left out.
+func newSideHunks(spec diffSpec, pathspecs ...string) (map[string][]hunkRange, error) {
+	// Coverage describes the newer tree, however the diff is shown
+	spec.Reverse = false
+	args := append([]string{"-c", "core.quotePath=false", "diff", "--no-color", "--no-ext-diff", "-U0", "--no-prefix"}, spec.revArgs()...)
+	if len(pathspecs) > 0 {
+		args = append(append(args, "--"), pathspecs...)
+	}
+	output, err := runGit(args...)
+	if err != nil {
+		return nil, err
+	}
+	hunks := make(map[string][]hunkRange)
+	var path string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if p, ok := strings.CutPrefix(line, "+++ "); ok {
+			path = ""
+			if p != "/dev/null" {
+				path = p
+				hunks[path] = nil
+			}
+			continue
+		}
+		m := hunkHeader.FindStringSubmatch(line)
+		if m == nil || path == "" {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		hunks[path] = append(hunks[path], hunkRange{start, count})
+	}
+	return hunks, scanner.Err()
+}
+
+// addedLines returns the new-side line numbers each file in a diff adds,
+// limited to pathspecs if any are given
+func addedLines(spec diffSpec, pathspecs ...string) (map[string]map[int]bool, error) {
+	hunks, err := newSideHunks(spec, pathspecs...)
+	if err != nil {
+		return nil, err
+	}
+	added := make(map[string]map[int]bool, len(hunks))
+	for path, ranges := range hunks {
+		lines := make(map[int]bool)
+		for _, h := range ranges {
+			for l := h.start; l < h.start+h.count; l++ {
+				lines[l] = true
+			}
+		}
+		added[path] = lines
+	}
+	return added, nil
+}
+
+// putCoverage stores an uploaded coverage report, sent as the request body
+func putCoverage(c *gin.Context) {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Failed to read request body", nil)
+		return
+	}
+	profile, err := parseCoverage(data)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	uploadedCoverage.mu.Lock()
+	uploadedCoverage.profile = profile
+	uploadedCoverage.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{"files": len(profile)})
+}
+
+// deleteCoverage discards the uploaded report, reverting to the configured path
+func deleteCoverage(c *gin.Context) {
+	uploadedCoverage.mu.Lock()
+	uploadedCoverage.profile = nil
+	uploadedCoverage.mu.Unlock()
+	c.Status(http.StatusNoContent)
+}
+
+// getDiffCoverage summarizes coverage of the lines a diff adds, listing
+// new lines that no test ran
+func getDiffCoverage(c *gin.Context) {
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+	profile, err := loadCoverage()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to load coverage", err)
+		return
+	}
+	if profile == nil {
+		respondError(c, http.StatusNotFound, "No coverage profile; upload one or set differing.coverage", nil)
+		return
+	}
+	added, err := addedLines(spec)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to diff", err)
+		return
+	}
+
+	paths := make([]string, 0, len(added))
+	for path := range added {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	files := []FileCoverage{}
+	covered, uncovered := 0, 0
+	for _, path := range paths {
+		fc := profile.fileCoverage(path, added[path])
+		if len(fc.Covered) == 0 && len(fc.Uncovered) == 0 {
+			continue
+		}
+		covered += len(fc.Covered)
+		uncovered += len(fc.Uncovered)
+		files = append(files, fc)
+	}
+	c.JSON(http.StatusOK, gin.H{"files": files, "covered": covered, "uncovered": uncovered})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseCoverage(t *testing.T) {
+	goProfile := "mode: set\n" +
+		"example.com/mod/pkg/a.go:3.14,5.2 1 1\n" +
+		"example.com/mod/pkg/a.go:5.2,7.3 1 0\n"
+	lcov := "TN:\nSF:/home/me/repo/pkg/a.go\nDA:3,1\nDA:6,0\nend_of_record\n"
+	cobertura := `<?xml version="1.0"?>
+<coverage><packages><package name="pkg"><classes>
+<class name="a" filename="pkg/a.go"><lines>
+<line number="3" hits="2"/><line number="6" hits="0"/>
+</lines></class></classes></package></packages></coverage>`
+
+	for name, data := range map[string]string{"go": goProfile, "lcov": lcov, "cobertura": cobertura} {
+		profile, err := parseCoverage([]byte(data))
+		if err != nil {
+			t.Errorf("%s: parseCoverage() error: %v", name, err)
+			continue
+		}
+		fc := profile.fileCoverage("pkg/a.go", nil)
+		if !slices.Contains(fc.Covered, 3) || !slices.Contains(fc.Uncovered, 6) {
+			t.Errorf("%s: coverage = %+v, want line 3 covered and 6 uncovered", name, fc)
+		}
+	}
+
+	// Line 5 ends one block that ran and starts one that did not
+	profile, _ := parseCoverage([]byte(goProfile))
+	if fc := profile.fileCoverage("pkg/a.go", nil); slices.Contains(fc.Uncovered, 5) {
+		t.Error("a line covered by any block should count as covered")
+	}
+
+	if _, err := parseCoverage([]byte("hello")); err == nil {
+		t.Error("parseCoverage() should reject unknown formats")
+	}
+}
+
+func TestDiffCoverage(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	oldRoot := gitRoot
+	gitRoot = repoDir
+	defer func() { gitRoot = oldRoot }()
+	defer func() { uploadedCoverage.profile = nil }()
+
+	// The second commit rewrites lines 3-5 of test1.go
+	added, err := addedLines(diffSpec{Base: "HEAD~2", Head: "HEAD~1"})
+	if err != nil {
+		t.Fatalf("addedLines() error: %v", err)
+	}
+	if lines := added["test1.go"]; len(lines) != 3 || !lines[3] || !lines[5] {
+		t.Errorf("added lines = %v, want 3-5", lines)
+	}
+
+	r := gin.New()
+	r.PUT("/api/coverage", putCoverage)
+	r.GET("/api/diffs/:id/coverage", getDiffCoverage)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/HEAD~2..HEAD~1/coverage", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status without coverage = %d, want 404", w.Code)
+	}
+
+	// A configured path is used when nothing has been uploaded
+	profile := "mode: set\ndiffering/test1.go:3.25,4.16 1 1\ndiffering/test1.go:1.1,1.10 1 0\n"
+	if err := os.WriteFile(filepath.Join(repoDir, "cover.out"), []byte(profile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit("config", "differing.coverage", "cover.out")
+
+	var summary struct {
+		Files     []FileCoverage `json:"files"`
+		Covered   int            `json:"covered"`
+		Uncovered int            `json:"uncovered"`
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/HEAD~2..HEAD~1/coverage", nil))
+	json.Unmarshal(w.Body.Bytes(), &summary)
+	if summary.Covered != 2 || summary.Uncovered != 0 {
+		t.Errorf("configured summary = %+v", summary)
+	}
+
+	w = httptest.NewRecorder()
+	upload := "mode: set\ndiffering/test1.go:3.25,5.2 1 0\n"
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/coverage", strings.NewReader(upload)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload status = %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/HEAD~2..HEAD~1/coverage", nil))
+	json.Unmarshal(w.Body.Bytes(), &summary)
+	if summary.Uncovered != 3 || len(summary.Files) != 1 || !slices.Equal(summary.Files[0].Uncovered, []int{3, 4, 5}) {
+		t.Errorf("uploaded summary = %+v, want lines 3-5 uncovered", summary)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// daemonStartTimeout is how long differing start waits for the
+// background server to register itself
+const daemonStartTimeout = 10 * time.Second
+
+// Instance is a running differing server recorded in the registry
+type Instance struct {
+	Repo    string    `json:"repo"`
+	URL     string    `json:"url"`
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+var (
+	instancesMu sync.Mutex
+	// instancesPath is where running servers are recorded; empty disables
+	// the registry
+	instancesPath = defaultInstancesPath()
+	// selfInstance is this process's registry entry while it is serving
+	selfInstance *Instance
+)
+
+// stateDir returns differing's directory under $XDG_STATE_HOME, which
+// defaults to ~/.local/state
+func stateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "differing")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "state", "differing")
+}
+
+func defaultInstancesPath() string {
+	dir := stateDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "instances.json")
+}
+
+// readInstances returns the registry keyed by repository root
+func readInstances() map[string]Instance {
+	instances := make(map[string]Instance)
+	if instancesPath == "" {
+		return instances
+	}
+	data, err := os.ReadFile(instancesPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("failed to read instance registry", "path", instancesPath, "error", err)
+		}
+		return instances
+	}
+	if err := json.Unmarshal(data, &instances); err != nil {
+		slog.Warn("failed to parse instance registry", "path", instancesPath, "error", err)
+	}
+	return instances
+}
+
+// updateInstances applies fn to the registry and writes it back
+// atomically via a temp file and rename
+func updateInstances(fn func(map[string]Instance)) error {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+	if instancesPath == "" {
+		return errors.New("no state directory available")
+	}
+	instances := readInstances()
+	fn(instances)
+	if err := os.MkdirAll(filepath.Dir(instancesPath), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(instances, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", instancesPath, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, instancesPath)
+}
+
+// registerSelf records this server as the instance for repo
+func registerSelf(repo, url string) {
+	selfInstance = &Instance{Repo: repo, URL: url, PID: os.Getpid(), Started: time.Now()}
+	inst := *selfInstance
+	if err := updateInstances(func(m map[string]Instance) { m[repo] = inst }); err != nil {
+		slog.Warn("failed to register instance", "error", err)
+	}
+}
+
+// unregisterSelf removes this server's entry, leaving it alone if another
+// process has since taken the repository over
+func unregisterSelf() {
+	if selfInstance == nil {
+		return
+	}
+	inst := *selfInstance
+	err := updateInstances(func(m map[string]Instance) {
+		if m[inst.Repo].PID == inst.PID {
+			delete(m, inst.Repo)
+		}
+	})
+	if err != nil {
+		slog.Warn("failed to unregister instance", "error", err)
+	}
+}
+
+// reregisterSelf moves this server's entry after switching repositories
+func reregisterSelf(repo string) {
+	if selfInstance == nil {
+		return
+	}
+	url := selfInstance.URL
+	unregisterSelf()
+	registerSelf(repo, url)
+}
+
+// instanceAlive reports whether inst is still serving its repository
+func instanceAlive(inst Instance) bool {
+	client := http.Client{Timeout: time.Second}
+	resp, err := client.Get(inst.URL + "/api/repo-info")
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	var info struct {
+		Path string `json:"path"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&info) != nil {
+		return false
+	}
+	return info.Path == inst.Repo
+}
+
+// liveInstance returns the running server for repo, if there is one
+func liveInstance(repo string) (Instance, bool) {
+	inst, ok := readInstances()[repo]
+	if !ok || !instanceAlive(inst) {
+		return Instance{}, false
+	}
+	return inst, true
+}
+
+// daemonLogPath returns where a background server for repo writes its log
+func daemonLogPath(repo string) string {
+	sum := sha256.Sum256([]byte(repo))
+	return filepath.Join(stateDir(), "logs", hex.EncodeToString(sum[:6])+".log")
+}
+
+// startDaemon runs a server for repo in the background with args and
+// waits for it to register. Unless a port was chosen, the server picks a
+// free one so several repositories can run at once.
+func startDaemon(repo string, args []string, portSet bool) error {
+	if inst, ok := liveInstance(repo); ok {
+		fmt.Printf("differing is already running for %s at %s\n", repo, inst.URL)
+		return nil
+	}
+	if stateDir() == "" {
+		return errors.New("no state directory available")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if !portSet {
+		args = append([]string{"-port", "0"}, args...)
+	}
+
+	logPath := daemonLogPath(repo)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, args...)
+	cmd.Dir = repo
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	deadline := time.After(daemonStartTimeout)
+	for {
+		if inst, ok := liveInstance(repo); ok && inst.PID == cmd.Process.Pid {
+			fmt.Printf("differing started for %s at %s (log: %s)\n", repo, inst.URL, logPath)
+			return nil
+		}
+		select {
+		case err := <-exited:
+			return fmt.Errorf("server exited during startup (%v); see %s", err, logPath)
+		case <-deadline:
+			return fmt.Errorf("server did not start within %s; see %s", daemonStartTimeout, logPath)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// stopDaemon asks the server for repo to shut down and waits for it to go
+func stopDaemon(repo string) error {
+	inst, ok := liveInstance(repo)
+	if !ok {
+		return fmt.Errorf("differing is not running for %s", repo)
+	}
+	resp, err := http.Post(inst.URL+"/api/shutdown", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	deadline := time.Now().Add(shutdownGrace + 2*time.Second)
+	for instanceAlive(inst) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server at %s did not stop", inst.URL)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	fmt.Printf("differing stopped for %s\n", repo)
+	return nil
+}
+
+// printStatus lists running servers, dropping registry entries for ones
+// that have gone away without unregistering
+func printStatus() error {
+	instances := readInstances()
+	repos := make([]string, 0, len(instances))
+	for repo := range instances {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+
+	var dead []Instance
+	for _, repo := range repos {
+		inst := instances[repo]
+		if !instanceAlive(inst) {
+			dead = append(dead, inst)
+			continue
+		}
+		fmt.Printf("%s\t%s\tpid %d\tsince %s\n", inst.URL, inst.Repo, inst.PID, inst.Started.Format(time.DateTime))
+	}
+	if len(dead) > 0 {
+		err := updateInstances(func(m map[string]Instance) {
+			for _, inst := range dead {
+				if m[inst.Repo].PID == inst.PID {
+					delete(m, inst.Repo)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(repos) == len(dead) {
+		fmt.Println("no differing servers running")
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		args    []string
+		command string
+		rest    int
+	}{
+		{nil, "", 0},
+		{[]string{"-port", "1"}, "", 2},
+		{[]string{"start", "-port", "1"}, "start", 2},
+		{[]string{"status"}, "status", 0},
+	}
+	for _, tt := range tests {
+		command, rest := splitCommand(tt.args)
+		if command != tt.command || len(rest) != tt.rest {
+			t.Errorf("splitCommand(%q) = %q, %q", tt.args, command, rest)
+		}
+	}
+}
+
+func TestInstanceRegistry(t *testing.T) {
+	oldPath, oldSelf := instancesPath, selfInstance
+	defer func() { instancesPath, selfInstance = oldPath, oldSelf }()
+	instancesPath = filepath.Join(t.TempDir(), "instances.json")
+
+	repo := "/tmp/some-repo"
+	r := gin.New()
+	r.GET("/api/repo-info", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"path": repo})
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	registerSelf(repo, srv.URL)
+	inst, ok := liveInstance(repo)
+	if !ok || inst.URL != srv.URL {
+		t.Fatalf("liveInstance() = %+v, %v", inst, ok)
+	}
+	if _, ok := liveInstance("/tmp/other-repo"); ok {
+		t.Error("found an instance for an unregistered repository")
+	}
+
+	// A server that has moved on to another repository no longer counts
+	reregisterSelf("/tmp/other-repo")
+	if _, ok := readInstances()[repo]; ok {
+		t.Error("old repository still registered after switching")
+	}
+	if _, ok := liveInstance("/tmp/other-repo"); ok {
+		t.Error("instance serving a different repository reported alive")
+	}
+
+	unregisterSelf()
+	if len(readInstances()) != 0 {
+		t.Errorf("registry not empty after unregistering: %v", readInstances())
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Location is a place in a diff that can be linked to: a commit (or the
+// working changes), optionally a file in it, and optionally a line
+type Location struct {
+	Commit string `json:"commit"`
+	Path   string `json:"path,omitempty"`
+	Line   int    `json:"line,omitempty"`
+}
+
+// openFlag is the -open flag. Given alone it opens the browser at the
+// start page; -open=<commit>[:<path>[:<line>]] opens it at that location.
+type openFlag struct {
+	set      bool
+	location string
+}
+
+func (f *openFlag) String() string { return f.location }
+
+// IsBoolFlag lets -open be given without a value, so a location must be
+// attached with "="
+func (f *openFlag) IsBoolFlag() bool { return true }
+
+func (f *openFlag) Set(v string) error {
+	switch v {
+	case "true":
+		*f = openFlag{set: true}
+	case "false":
+		*f = openFlag{}
+	default:
+		*f = openFlag{set: true, location: v}
+	}
+	return nil
+}
+
+// parseLocation parses the -open argument, <commit>[:<path>[:<line>]].
+// The commit may be any revision or "working".
+func parseLocation(arg string) (Location, error) {
+	commit, rest, _ := strings.Cut(arg, ":")
+	loc := Location{Commit: commit, Path: rest}
+	if i := strings.LastIndexByte(rest, ':'); i >= 0 {
+		if line, err := strconv.Atoi(rest[i+1:]); err == nil {
+			if line < 1 {
+				return loc, fmt.Errorf("invalid line %d", line)
+			}
+			loc.Path, loc.Line = rest[:i], line
+		}
+	}
+	if loc.Commit == "" {
+		return loc, fmt.Errorf("location %q has no commit", arg)
+	}
+	return loc, nil
+}
+
+// resolveLocation replaces the commit with its SHA and checks the path is
+// changed by that commit's diff
+func resolveLocation(ctx context.Context, loc Location) (Location, error) {
+	if loc.Commit != "working" {
+		sha, err := resolveRev(loc.Commit)
+		if err != nil {
+			return loc, err
+		}
+		loc.Commit = sha
+	}
+	if loc.Path == "" {
+		return loc, nil
+	}
+	spec, err := resolveDiff(loc.Commit, modeCumulative)
+	if err != nil {
+		return loc, err
+	}
+	files, err := listDiffFiles(ctx, spec, DiffOptions{}, []string{":(literal)" + loc.Path})
+	if err != nil {
+		return loc, err
+	}
+	if len(files) == 0 {
+		return loc, fmt.Errorf("%w: %s is not changed in %s", errUnknownRevision, loc.Path, loc.Commit)
+	}
+	return loc, nil
+}
+
+// URL returns the frontend path for the location, /c/<commit>/f/<path>#L<line>
+func (loc Location) URL() string {
+	u := "/c/" + url.PathEscape(loc.Commit)
+	if loc.Path != "" {
+		segments := strings.Split(loc.Path, "/")
+		for i, s := range segments {
+			segments[i] = url.PathEscape(s)
+		}
+		u += "/f/" + strings.Join(segments, "/")
+		if loc.Line > 0 {
+			u += "#L" + strconv.Itoa(loc.Line)
+		}
+	}
+	return u
+}
+
+// getLocation resolves ?commit=&path=&line= from a deep link so the
+// frontend can restore the linked view
+func getLocation(c *gin.Context) {
+	loc := Location{Commit: c.Query("commit"), Path: strings.TrimPrefix(c.Query("path"), "/")}
+	if line := c.Query("line"); line != "" {
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 1 {
+			respondError(c, http.StatusBadRequest, "invalid line "+line, nil)
+			return
+		}
+		loc.Line = n
+	}
+	if loc.Commit == "" {
+		respondError(c, http.StatusBadRequest, "commit is required", nil)
+		return
+	}
+	resolved, err := resolveLocation(c.Request.Context(), loc)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"location": resolved, "url": resolved.URL()})
+}
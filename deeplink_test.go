@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestParseLocation(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want Location
+	}{
+		{"abc123", Location{Commit: "abc123"}},
+		{"HEAD~1:test1.go", Location{Commit: "HEAD~1", Path: "test1.go"}},
+		{"working:src/app.ts:42", Location{Commit: "working", Path: "src/app.ts", Line: 42}},
+		{"HEAD:notes:v2.txt", Location{Commit: "HEAD", Path: "notes:v2.txt"}},
+	}
+	for _, tt := range tests {
+		got, err := parseLocation(tt.arg)
+		if err != nil || got != tt.want {
+			t.Errorf("parseLocation(%q) = %+v, %v; want %+v", tt.arg, got, err, tt.want)
+		}
+	}
+	for _, arg := range []string{"", ":file.go", "HEAD:file.go:0"} {
+		if _, err := parseLocation(arg); err == nil {
+			t.Errorf("parseLocation(%q) should fail", arg)
+		}
+	}
+}
+
+func TestOpenFlag(t *testing.T) {
+	tests := []struct {
+		args []string
+		want openFlag
+	}{
+		{nil, openFlag{}},
+		{[]string{"-open"}, openFlag{set: true}},
+		{[]string{"-open=HEAD~1:test1.go:3"}, openFlag{set: true, location: "HEAD~1:test1.go:3"}},
+		{[]string{"-open=false"}, openFlag{}},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("differing", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		var open openFlag
+		fs.Var(&open, "open", "")
+		if err := fs.Parse(tt.args); err != nil || open != tt.want {
+			t.Errorf("%v: open = %+v, %v; want %+v", tt.args, open, err, tt.want)
+		}
+	}
+}
+
+func TestLocationURL(t *testing.T) {
+	loc := Location{Commit: "abc", Path: "dir/a file#1.go", Line: 7}
+	if got, want := loc.URL(), "/c/abc/f/dir/a%20file%231.go#L7"; got != want {
+		t.Errorf("URL() = %q, want %q", got, want)
+	}
+	if got := (Location{Commit: "working"}).URL(); got != "/c/working" {
+		t.Errorf("URL() = %q", got)
+	}
+}
+
+func TestResolveLocation(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	loc, err := resolveLocation(context.Background(), Location{Commit: "HEAD", Path: "test2.ts", Line: 1})
+	if err != nil {
+		t.Fatalf("resolveLocation() error: %v", err)
+	}
+	if sha, _ := resolveRev("HEAD"); loc.Commit != sha {
+		t.Errorf("commit = %q, want %q", loc.Commit, sha)
+	}
+
+	if _, err := resolveLocation(context.Background(), Location{Commit: "HEAD", Path: "missing.go"}); err == nil {
+		t.Error("resolveLocation() should reject files outside the diff")
+	}
+	if _, err := resolveLocation(context.Background(), Location{Commit: "nope"}); err == nil {
+		t.Error("resolveLocation() should reject unknown commits")
+	}
+}
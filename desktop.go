@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// desktopPort is where the desktop companion listens unless -port is given
+	desktopPort = "3843"
+	// desktopPollInterval is how often running servers are checked for new
+	// working changes
+	desktopPollInterval = 5 * time.Second
+)
+
+// appBrowsers are browsers that can open a page as a standalone app
+// window with --app, tried in order
+var appBrowsers = []string{"google-chrome", "chromium", "chromium-browser", "microsoft-edge", "brave-browser"}
+
+// DesktopInstance is a running server as listed by the desktop companion
+type DesktopInstance struct {
+	Instance
+	// Changes summarizes the repository's working changes
+	Changes WorkingSummary `json:"changes"`
+}
+
+// WorkingSummary is the size of a repository's working changes
+type WorkingSummary struct {
+	Files     int `json:"files"`
+	Additions int `json:"additions"`
+	Deletions int `json:"deletions"`
+}
+
+func (s WorkingSummary) String() string {
+	if s.Files == 1 {
+		return fmt.Sprintf("1 file changed (+%d -%d)", s.Additions, s.Deletions)
+	}
+	return fmt.Sprintf("%d files changed (+%d -%d)", s.Files, s.Additions, s.Deletions)
+}
+
+// workingSummary asks a running server for its working changes
+func workingSummary(inst Instance) (WorkingSummary, error) {
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(inst.URL + "/api/diffs/working/files")
+	if err != nil {
+		return WorkingSummary{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return WorkingSummary{}, fmt.Errorf("%s returned %s", inst.URL, resp.Status)
+	}
+	var files []FileInfo
+	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		return WorkingSummary{}, err
+	}
+	s := WorkingSummary{Files: len(files)}
+	for _, f := range files {
+		s.Additions += f.Additions
+		s.Deletions += f.Deletions
+	}
+	return s, nil
+}
+
+// desktop is the companion that tracks every running server
+type desktop struct {
+	mu        sync.Mutex
+	instances []DesktopInstance
+}
+
+// poll refreshes the list of running servers, notifying about any whose
+// working changes differ from the last poll. Servers seen for the first
+// time are recorded without a notification.
+func (d *desktop) poll(notify bool) {
+	registry := readInstances()
+	repos := make([]string, 0, len(registry))
+	for repo := range registry {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+
+	d.mu.Lock()
+	previous := make(map[string]WorkingSummary, len(d.instances))
+	for _, inst := range d.instances {
+		previous[inst.Repo] = inst.Changes
+	}
+	d.mu.Unlock()
+
+	var current []DesktopInstance
+	for _, repo := range repos {
+		inst := registry[repo]
+		changes, err := workingSummary(inst)
+		if err != nil {
+			// Not running any more, or not yet answering
+			continue
+		}
+		current = append(current, DesktopInstance{Instance: inst, Changes: changes})
+		if old, seen := previous[repo]; notify && seen && old != changes {
+			if err := notifyDesktop("differing", repo+": "+changes.String()); err != nil {
+				slog.Debug("desktop notification failed", "error", err)
+			}
+		}
+	}
+
+	d.mu.Lock()
+	d.instances = current
+	d.mu.Unlock()
+}
+
+func (d *desktop) getInstances(c *gin.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	instances := d.instances
+	if instances == nil {
+		instances = []DesktopInstance{}
+	}
+	c.JSON(http.StatusOK, instances)
+}
+
+// desktopPage lists the running servers, refreshing itself as they come
+// and go
+const desktopPage = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>differing</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 1.5em; color: #222; }
+li { margin: 0.6em 0; list-style: none; }
+a { font-weight: 600; }
+.changes, .empty { color: #666; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>differing</h1>
+<ul id="instances"></ul>
+<script>
+async function refresh() {
+  const list = document.getElementById('instances');
+  const instances = await fetch('/instances').then((r) => r.json()).catch(() => []);
+  list.replaceChildren(...instances.map((inst) => {
+    const li = document.createElement('li');
+    const a = document.createElement('a');
+    a.href = inst.url;
+    a.target = '_blank';
+    a.textContent = inst.repo;
+    const changes = document.createElement('div');
+    changes.className = 'changes';
+    changes.textContent = inst.changes.files + ' files changed (+' + inst.changes.additions + ' -' + inst.changes.deletions + ')';
+    li.append(a, changes);
+    return li;
+  }));
+  if (instances.length === 0) {
+    const li = document.createElement('li');
+    li.className = 'empty';
+    li.textContent = 'No repositories are being served. Run differing start in one.';
+    list.append(li);
+  }
+}
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
+
+// runDesktop serves the desktop companion on addr:port and opens it as an
+// app window when a suitable browser is installed. It polls every running
+// server and raises desktop notifications as their working changes change.
+func runDesktop(addr, port string, portSet bool) error {
+	if !portSet {
+		port = desktopPort
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(addr, port))
+	if err != nil {
+		return err
+	}
+	url := "http://" + ln.Addr().String()
+
+	d := &desktop{}
+	d.poll(false)
+	go func() {
+		ticker := time.NewTicker(desktopPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			d.poll(true)
+		}
+	}()
+
+	r := gin.New()
+	r.Use(server.track(), requestLogger(), gin.Recovery())
+	r.GET("/", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(desktopPage))
+	})
+	r.GET("/instances", d.getInstances)
+	r.POST("/shutdown", postShutdown)
+
+	fmt.Printf("differing desktop running on %s\n", url)
+	go openAppWindow(url)
+	return server.serve(&http.Server{Handler: r}, ln, 0)
+}
+
+// openAppWindow opens url in a standalone browser window, falling back to
+// an ordinary browser tab
+func openAppWindow(url string) {
+	for _, name := range appBrowsers {
+		if path, err := exec.LookPath(name); err == nil {
+			time.Sleep(500 * time.Millisecond) // Give server time to start
+			if err := toolCommand(path, "--app="+url).Start(); err == nil {
+				return
+			}
+		}
+	}
+	openBrowser(url)
+}
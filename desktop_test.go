@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDesktopPoll(t *testing.T) {
+	oldPath := instancesPath
+	defer func() { instancesPath = oldPath }()
+	instancesPath = filepath.Join(t.TempDir(), "instances.json")
+
+	files := []FileInfo{{Path: "a.go", Additions: 3, Deletions: 1}, {Path: "b.go", Additions: 2}}
+	r := gin.New()
+	r.GET("/api/diffs/working/files", func(c *gin.Context) { c.JSON(http.StatusOK, files) })
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	updateInstances(func(m map[string]Instance) {
+		m["/repo"] = Instance{Repo: "/repo", URL: srv.URL}
+		m["/gone"] = Instance{Repo: "/gone", URL: "http://127.0.0.1:1"}
+	})
+
+	d := &desktop{}
+	d.poll(false)
+
+	r2 := gin.New()
+	r2.GET("/instances", d.getInstances)
+	w := httptest.NewRecorder()
+	r2.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/instances", nil))
+	var instances []DesktopInstance
+	json.Unmarshal(w.Body.Bytes(), &instances)
+	if len(instances) != 1 || instances[0].Repo != "/repo" {
+		t.Fatalf("instances = %+v", instances)
+	}
+	want := WorkingSummary{Files: 2, Additions: 5, Deletions: 1}
+	if instances[0].Changes != want {
+		t.Errorf("changes = %+v, want %+v", instances[0].Changes, want)
+	}
+	if got := want.String(); got != "2 files changed (+5 -1)" {
+		t.Errorf("String() = %q", got)
+	}
+}
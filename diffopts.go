@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DiffOptions controls how git computes diffs on the server
+type DiffOptions struct {
+	Algorithm       string `json:"algorithm,omitempty"` // myers, minimal, patience, histogram
+	Context         *int   `json:"context,omitempty"`   // lines of context; nil uses git's default
+	FunctionContext bool   `json:"functionContext,omitempty"`
+	Whitespace      string `json:"whitespace,omitempty"` // ignore-all, ignore-change, ignore-eol
+}
+
+var diffAlgorithms = map[string]bool{
+	"myers":     true,
+	"minimal":   true,
+	"patience":  true,
+	"histogram": true,
+}
+
+// whitespaceFlags maps whitespace modes to git diff flags
+var whitespaceFlags = map[string]string{
+	"ignore-all":    "--ignore-all-space",
+	"ignore-change": "--ignore-space-change",
+	"ignore-eol":    "--ignore-space-at-eol",
+}
+
+// validate rejects options git would not accept
+func (o DiffOptions) validate() error {
+	if o.Algorithm != "" && !diffAlgorithms[o.Algorithm] {
+		return fmt.Errorf("unknown diff algorithm %q (want myers, minimal, patience, or histogram)", o.Algorithm)
+	}
+	if o.Context != nil && *o.Context < 0 {
+		return fmt.Errorf("context must not be negative")
+	}
+	if _, ok := whitespaceFlags[o.Whitespace]; o.Whitespace != "" && !ok {
+		return fmt.Errorf("unknown whitespace mode %q (want ignore-all, ignore-change, or ignore-eol)", o.Whitespace)
+	}
+	return nil
+}
+
+// args returns the git diff flags for these options
+func (o DiffOptions) args() []string {
+	var args []string
+	if o.Algorithm != "" {
+		args = append(args, "--diff-algorithm="+o.Algorithm)
+	}
+	if o.Context != nil {
+		args = append(args, "-U"+strconv.Itoa(*o.Context))
+	}
+	if o.FunctionContext {
+		args = append(args, "--function-context")
+	}
+	if o.Whitespace != "" {
+		args = append(args, whitespaceFlags[o.Whitespace])
+	}
+	return args
+}
+
+// diffOptionsFromQuery starts from the saved preferences and applies any
+// algorithm=, context=, functionContext=, and whitespace= query parameters
+// on top.
+func diffOptionsFromQuery(c *gin.Context) (DiffOptions, error) {
+	opts := loadPreferences().Diff
+	if algorithm, ok := c.GetQuery("algorithm"); ok {
+		opts.Algorithm = algorithm
+	}
+	if context, ok := c.GetQuery("context"); ok {
+		n, err := strconv.Atoi(context)
+		if err != nil {
+			return opts, fmt.Errorf("invalid context %q", context)
+		}
+		opts.Context = &n
+	}
+	if fc, ok := c.GetQuery("functionContext"); ok {
+		opts.FunctionContext = fc == "true"
+	}
+	if whitespace, ok := c.GetQuery("whitespace"); ok {
+		opts.Whitespace = whitespace
+	}
+	return opts, opts.validate()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDiffOptionsArgs(t *testing.T) {
+	zero := 0
+	opts := DiffOptions{Algorithm: "histogram", Context: &zero, FunctionContext: true}
+	if err := opts.validate(); err != nil {
+		t.Fatalf("validate() failed: %v", err)
+	}
+	got := strings.Join(opts.args(), " ")
+	want := "--diff-algorithm=histogram -U0 --function-context"
+	if got != want {
+		t.Errorf("args() = %q, want %q", got, want)
+	}
+
+	if err := (DiffOptions{Algorithm: "quantum"}).validate(); err == nil {
+		t.Error("validate() should reject unknown algorithms")
+	}
+	if len((DiffOptions{}).args()) != 0 {
+		t.Error("default options should add no flags")
+	}
+}
+
+func TestPreferencesPersistDiffOptions(t *testing.T) {
+	oldPath := prefsPath
+	prefsPath = filepath.Join(t.TempDir(), "differing", "preferences.json")
+	defer func() { prefsPath = oldPath }()
+
+	r := gin.New()
+	r.PUT("/api/preferences", putPreferences)
+	r.GET("/opts", func(c *gin.Context) {
+		opts, err := diffOptionsFromQuery(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusOK, strings.Join(opts.args(), " "))
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/preferences", strings.NewReader(`{"diff":{"algorithm":"patience","context":5}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT preferences = %d %s", w.Code, w.Body.String())
+	}
+
+	if prefs := loadPreferences(); prefs.Diff.Algorithm != "patience" {
+		t.Errorf("saved algorithm = %q, want patience", prefs.Diff.Algorithm)
+	}
+
+	// Saved preferences are the defaults; query parameters override them
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/opts?context=1", nil))
+	if got := w.Body.String(); got != "--diff-algorithm=patience -U1" {
+		t.Errorf("merged options = %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/preferences", strings.NewReader(`{"diff":{"algorithm":"bogus"}}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid algorithm status = %d, want 400", w.Code)
+	}
+}
+
+func TestWhitespaceOption(t *testing.T) {
+	opts := DiffOptions{Whitespace: "ignore-change"}
+	if got := strings.Join(opts.args(), " "); got != "--ignore-space-change" {
+		t.Errorf("args() = %q", got)
+	}
+	if err := (DiffOptions{Whitespace: "collapse"}).validate(); err == nil {
+		t.Error("validate() should reject unknown whitespace modes")
+	}
+}
+
+func TestPreferencesValidate(t *testing.T) {
+	valid := Preferences{
+		View:        ViewPreferences{Layout: "unified", TabWidth: 4, Wrap: true, Theme: "dark"},
+		DefaultBase: "origin/main",
+	}
+	if err := valid.validate(); err != nil {
+		t.Errorf("validate() = %v for valid preferences", err)
+	}
+
+	invalid := []Preferences{
+		{View: ViewPreferences{Layout: "stacked"}},
+		{View: ViewPreferences{Theme: "neon"}},
+		{View: ViewPreferences{TabWidth: 100}},
+		{DefaultBase: "--output=x"},
+		{Diff: DiffOptions{Whitespace: "bogus"}},
+	}
+	for _, prefs := range invalid {
+		if err := prefs.validate(); err == nil {
+			t.Errorf("validate() accepted %+v", prefs)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errUnknownRevision is wrapped by resolveDiff when a diff ID does not name a commit
+var errUnknownRevision = errors.New("unknown revision")
+
+// diffSpec identifies the two sides of a diff as resolved commit SHAs
+type diffSpec struct {
+	Base string // old side; "" when there is none, as for a root commit
+	Head string // new side; "" for the working tree or index
+	// Index is set when the new side is the index rather than the working
+	// tree, as for git diff --cached
+	Index bool
+	// Reverse shows Head as the old side and Base as the new, as git
+	// diff -R does
+	Reverse bool
+}
+
+// Diff modes select what a single commit ID is compared against
+const (
+	// modeCumulative compares a commit's parent to the working tree, showing
+	// the commit together with everything after it
+	modeCumulative = ""
+	// modeCommit compares a commit's parent to the commit itself
+	modeCommit = "commit"
+)
+
+// resolveDiff turns a diff ID into the revisions it compares:
+//
+//   - "working" compares HEAD to the working tree
+//   - "staged" compares HEAD to the index
+//   - "baseline" compares what was last marked as reviewed to the working
+//     tree
+//   - "snapshot:<id>" and "timeline:<id>" compare a saved snapshot or a
+//     timeline entry to the working tree
+//   - "proposal:<id>" compares the working tree a proposal was made
+//     against to the same tree with the proposal applied
+//   - "tool:<id>" compares the local and remote files of a difftool or
+//     mergetool session
+//   - a commit compares its parent to the working tree, or to the commit
+//     itself in modeCommit
+//   - "A..B" compares A to B, and "A...B" compares their merge base to B;
+//     either end may be omitted and defaults to HEAD, as in git
+func resolveDiff(diffID, mode string) (diffSpec, error) {
+	if mode != modeCumulative && mode != modeCommit {
+		return diffSpec{}, fmt.Errorf("unknown diff mode %q", mode)
+	}
+
+	if diffID == "working" {
+		base, _ := resolveRev("HEAD")
+		return diffSpec{Base: base}, nil
+	}
+
+	if diffID == "staged" {
+		base, _ := resolveRev("HEAD")
+		return diffSpec{Base: base, Index: true}, nil
+	}
+
+	if diffID == baselineDiffID {
+		sha, err := resolveRev(baselineRef)
+		if err != nil {
+			return diffSpec{}, fmt.Errorf("%w: no baseline has been marked", errUnknownRevision)
+		}
+		return diffSpec{Base: sha}, nil
+	}
+
+	if id, ok := strings.CutPrefix(diffID, snapshotDiffPrefix); ok {
+		sha, err := resolveSnapshot(snapshotRefPrefix, id)
+		if err != nil {
+			return diffSpec{}, err
+		}
+		return diffSpec{Base: sha}, nil
+	}
+
+	if id, ok := strings.CutPrefix(diffID, timelineDiffPrefix); ok {
+		sha, err := resolveSnapshot(timelineRefPrefix, id)
+		if err != nil {
+			return diffSpec{}, err
+		}
+		return diffSpec{Base: sha}, nil
+	}
+
+	if id, ok := strings.CutPrefix(diffID, proposalDiffPrefix); ok {
+		p, found := lookupProposal(id)
+		if !found {
+			return diffSpec{}, fmt.Errorf("%w: no proposal %s", errUnknownRevision, id)
+		}
+		return diffSpec{Base: p.Base, Head: p.Commit}, nil
+	}
+
+	if id, ok := strings.CutPrefix(diffID, toolDiffPrefix); ok {
+		s, found := lookupToolSession(id)
+		if !found {
+			return diffSpec{}, fmt.Errorf("%w: no tool session %s", errUnknownRevision, id)
+		}
+		return diffSpec{Base: s.Local, Head: s.Remote}, nil
+	}
+
+	if from, to, ok := strings.Cut(diffID, "..."); ok {
+		fromSHA, toSHA, err := resolveRange(from, to)
+		if err != nil {
+			return diffSpec{}, err
+		}
+		output, err := runGit("merge-base", fromSHA, toSHA)
+		if err != nil {
+			return diffSpec{}, fmt.Errorf("%w: %s has no merge base", errUnknownRevision, diffID)
+		}
+		return diffSpec{Base: strings.TrimSpace(string(output)), Head: toSHA}, nil
+	}
+
+	if from, to, ok := strings.Cut(diffID, ".."); ok {
+		fromSHA, toSHA, err := resolveRange(from, to)
+		if err != nil {
+			return diffSpec{}, err
+		}
+		return diffSpec{Base: fromSHA, Head: toSHA}, nil
+	}
+
+	sha, err := resolveRev(diffID)
+	if err != nil {
+		return diffSpec{}, err
+	}
+	base, _ := resolveRev(sha + "^")
+	if mode == modeCommit {
+		return diffSpec{Base: base, Head: sha}, nil
+	}
+	return diffSpec{Base: base}, nil
+}
+
+// diffFromRequest resolves the :id route parameter using the mode= query
+// parameter, reversed when reverse=true, writing an error response and
+// returning false on failure
+func diffFromRequest(c *gin.Context) (diffSpec, bool) {
+	spec, err := resolveDiff(c.Param("id"), c.Query("mode"))
+	spec.Reverse = c.Query("reverse") == "true"
+	switch {
+	case errors.Is(err, errUnknownRevision):
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return spec, false
+	case err != nil:
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return spec, false
+	}
+	return spec, true
+}
+
+func resolveRange(from, to string) (fromSHA, toSHA string, err error) {
+	if from == "" {
+		from = "HEAD"
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+	if fromSHA, err = resolveRev(from); err != nil {
+		return "", "", err
+	}
+	if toSHA, err = resolveRev(to); err != nil {
+		return "", "", err
+	}
+	return fromSHA, toSHA, nil
+}
+
+// resolveRangeArg validates an A..B or A...B range for passing to git,
+// returning it with both ends resolved to SHAs
+func resolveRangeArg(rangeSpec string) (string, error) {
+	sep := ".."
+	if strings.Contains(rangeSpec, "...") {
+		sep = "..."
+	}
+	from, to, ok := strings.Cut(rangeSpec, sep)
+	if !ok {
+		return "", errors.New("range must be of the form A..B or A...B")
+	}
+	fromSHA, toSHA, err := resolveRange(from, to)
+	if err != nil {
+		return "", err
+	}
+	return fromSHA + sep + toSHA, nil
+}
+
+// resolveRev returns the commit SHA rev names. Revisions starting with "-"
+// are rejected so they can never be parsed as git options.
+func resolveRev(rev string) (string, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return "", fmt.Errorf("%w: %q", errUnknownRevision, rev)
+	}
+	output, err := runGit("rev-parse", "--verify", "--quiet", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", errUnknownRevision, rev)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// baseOrEmptyTree returns the old side for git diff, using the empty tree
+// when there is no base commit
+func (d diffSpec) baseOrEmptyTree() string {
+	if d.Base == "" {
+		return emptyTreeSHA
+	}
+	return d.Base
+}
+
+// newSideInGit reports whether the new side is read from git, via
+// blobInfo(d.Head, path), rather than from the working tree. blobInfo
+// reads the index when Head is empty.
+func (d diffSpec) newSideInGit() bool {
+	return d.Head != "" || d.Index
+}
+
+// revArgs returns the revision arguments for git diff
+func (d diffSpec) revArgs() []string {
+	args := []string{d.baseOrEmptyTree()}
+	if d.Index {
+		args = append([]string{"--cached"}, args...)
+	} else if d.Head != "" {
+		args = append(args, d.Head)
+	}
+	if d.Reverse {
+		args = append(args, "-R")
+	}
+	return args
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResolveDiff(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	head, _ := resolveRev("HEAD")
+	root, _ := resolveRev("HEAD~2")
+
+	spec, err := resolveDiff("working", modeCumulative)
+	if err != nil || spec.Base != head || spec.Head != "" {
+		t.Errorf("resolveDiff(working) = %+v, %v", spec, err)
+	}
+
+	spec, err = resolveDiff(root, modeCumulative)
+	if err != nil || spec.Base != "" || spec.Head != "" {
+		t.Errorf("resolveDiff(root commit) = %+v, %v", spec, err)
+	}
+	if got := spec.revArgs(); len(got) != 1 || got[0] != emptyTreeSHA {
+		t.Errorf("root commit revArgs() = %v", got)
+	}
+
+	spec, err = resolveDiff("HEAD~2..HEAD", modeCumulative)
+	if err != nil || spec.Base != root || spec.Head != head {
+		t.Errorf("resolveDiff(range) = %+v, %v", spec, err)
+	}
+
+	spec, err = resolveDiff("HEAD~2..", modeCumulative)
+	if err != nil || spec.Head != head {
+		t.Errorf("resolveDiff(open range) = %+v, %v", spec, err)
+	}
+
+	spec, err = resolveDiff("HEAD...HEAD~1", modeCumulative)
+	if err != nil || spec.Base == "" {
+		t.Errorf("resolveDiff(three-dot) = %+v, %v", spec, err)
+	}
+
+	for _, bad := range []string{"nope", "--output=/tmp/x", "HEAD..--all", "nope..HEAD"} {
+		if _, err := resolveDiff(bad, modeCumulative); !errors.Is(err, errUnknownRevision) {
+			t.Errorf("resolveDiff(%q) error = %v, want errUnknownRevision", bad, err)
+		}
+	}
+}
+
+func TestRangeFileDiffReadsBothSidesFromGit(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+	r.GET("/api/diffs/:id/files", getDiffFiles)
+
+	// test2.ts is modified in the working tree, but the range ends at HEAD
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/HEAD~1..HEAD/test2.ts", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var diff FileDiff
+	if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if diff.OldExists || !diff.NewExists {
+		t.Errorf("exists = %v/%v, want false/true", diff.OldExists, diff.NewExists)
+	}
+	if diff.NewContent != "export function world() {}\n" {
+		t.Errorf("NewContent = %q, want the committed version", diff.NewContent)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/HEAD~2..HEAD~1/files", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "test1.go") || strings.Contains(w.Body.String(), "test2.ts") {
+		t.Errorf("range files = %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/bogus..HEAD/files", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown revision status = %d, want 404", w.Code)
+	}
+}
+
+func TestCommitModeDiffsOnlyThatCommit(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	second, _ := resolveRev("HEAD~1")
+	spec, err := resolveDiff(second, modeCommit)
+	if err != nil {
+		t.Fatalf("resolveDiff(commit mode) failed: %v", err)
+	}
+	if spec.Head != second {
+		t.Errorf("commit mode Head = %q, want %q", spec.Head, second)
+	}
+
+	// Cumulative mode includes the later commit and working changes to test2.ts
+	files, err := listDiffFiles(context.Background(), spec, DiffOptions{}, nil)
+	if err != nil {
+		t.Fatalf("listDiffFiles() failed: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "test1.go" {
+		t.Errorf("commit mode files = %+v, want only test1.go", files)
+	}
+
+	if _, err := resolveDiff(second, "sideways"); err == nil || errors.Is(err, errUnknownRevision) {
+		t.Errorf("unknown mode error = %v", err)
+	}
+}
+
+func TestReverseDiffSwapsSides(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+	r.GET("/api/file-patch/:id/*filepath", getFilePatch)
+	r.GET("/api/diffs/:id/files", getDiffFiles)
+	get := func(url string) []byte {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s = %d: %s", url, w.Code, w.Body.String())
+		}
+		return w.Body.Bytes()
+	}
+
+	// test2.ts was added by HEAD, so reversed it is deleted
+	var diff FileDiff
+	json.Unmarshal(get("/api/file-diff/HEAD~1..HEAD/test2.ts?reverse=true"), &diff)
+	if !diff.OldExists || diff.NewExists || diff.OldContent != "export function world() {}\n" || diff.NewContent != "" {
+		t.Errorf("reversed diff = %+v, want the committed file on the old side", diff)
+	}
+
+	// The working tree copy moves to the old side
+	json.Unmarshal(get("/api/file-diff/working/test2.ts?reverse=true"), &diff)
+	if !strings.Contains(diff.OldContent, "return 'world'") || diff.NewContent != "export function world() {}\n" {
+		t.Errorf("reversed working diff = %+v", diff)
+	}
+
+	var files []FileInfo
+	json.Unmarshal(get("/api/diffs/HEAD~1..HEAD/files?reverse=true"), &files)
+	if len(files) != 1 || files[0].Status != "deleted" || files[0].Additions != 0 || files[0].Deletions != 1 {
+		t.Errorf("reversed files = %+v, want test2.ts deleted", files)
+	}
+
+	var patch struct{ Patch string }
+	json.Unmarshal(get("/api/file-patch/HEAD~1..HEAD/test2.ts?reverse=true"), &patch)
+	if !strings.Contains(patch.Patch, "deleted file mode") {
+		t.Errorf("reversed patch = %q", patch.Patch)
+	}
+}
+
+func TestStagedDiffReadsTheIndex(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	// Stage test2.ts, then edit it again, and leave test1.go unstaged
+	runGit("add", "test2.ts")
+	os.WriteFile("test2.ts", []byte("export function world() {\n  return 'planet';\n}\n"), 0644)
+	os.WriteFile("test1.go", []byte("package main\n"), 0644)
+
+	spec, err := resolveDiff("staged", modeCumulative)
+	if err != nil || !spec.Index || spec.Head != "" {
+		t.Fatalf("resolveDiff(staged) = %+v, %v", spec, err)
+	}
+
+	r := gin.New()
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+	r.GET("/api/diffs/:id/files", getDiffFiles)
+	r.GET("/api/raw/:id/*filepath", getRawFile)
+	get := func(url string) []byte {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s = %d: %s", url, w.Code, w.Body.String())
+		}
+		return w.Body.Bytes()
+	}
+
+	var files []FileInfo
+	json.Unmarshal(get("/api/diffs/staged/files"), &files)
+	if len(files) != 1 || files[0].Path != "test2.ts" || files[0].Additions != 3 {
+		t.Errorf("staged files = %+v, want only test2.ts", files)
+	}
+
+	staged := "export function world() {\n  return 'world';\n}\n"
+	var diff FileDiff
+	json.Unmarshal(get("/api/file-diff/staged/test2.ts"), &diff)
+	if diff.OldContent != "export function world() {}\n" || diff.NewContent != staged {
+		t.Errorf("staged diff = %+v, want the index on the new side", diff)
+	}
+	if raw := string(get("/api/raw/staged/test2.ts")); raw != staged {
+		t.Errorf("staged raw = %q", raw)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DiffListEvent is one line of the NDJSON stream from
+// GET /api/diffs?stream=true. Every entry is sent as a "diff" event as
+// soon as its metadata is known; entries whose diffstat still has to be
+// computed are marked Pending and completed by a later "stats" event.
+type DiffListEvent struct {
+	Type    string    `json:"type"` // diff, stats, or done
+	Diff    *DiffInfo `json:"diff,omitempty"`
+	Pending bool      `json:"pending,omitempty"`
+	// ID, FilesCount, Additions, and Deletions are set on stats events
+	ID         string `json:"id,omitempty"`
+	FilesCount int    `json:"filesCount,omitempty"`
+	Additions  int    `json:"additions,omitempty"`
+	Deletions  int    `json:"deletions,omitempty"`
+}
+
+// statsEvent reports the diffstat computed for an entry
+func statsEvent(info DiffInfo) DiffListEvent {
+	return DiffListEvent{
+		Type:       "stats",
+		ID:         info.ID,
+		FilesCount: info.FilesCount,
+		Additions:  info.Additions,
+		Deletions:  info.Deletions,
+	}
+}
+
+// streamDiffs is the streaming form of getDiffs. The whole list renders
+// after a single git log, however slow the per-commit diffstats are.
+// groupBy is not supported, since groups need every entry's stats.
+func streamDiffs(c *gin.Context, filter logFilter, head string) {
+	if c.Query("groupBy") != "" {
+		respondError(c, http.StatusBadRequest, "groupBy cannot be combined with stream", nil)
+		return
+	}
+
+	var working, baseline *DiffInfo
+	if filter.Rev == "" || filter.Rev == head {
+		info := workingDiffInfo()
+		working = &info
+		baseline = baselineDiffInfo()
+	}
+	commits, pending, err := logCommits(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to get git log", err)
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	emit := func(event DiffListEvent) {
+		enc.Encode(event)
+		c.Writer.Flush()
+	}
+
+	if working != nil {
+		emit(DiffListEvent{Type: "diff", Diff: working, Pending: true})
+	}
+	if baseline != nil {
+		emit(DiffListEvent{Type: "diff", Diff: baseline, Pending: true})
+	}
+	// Proposals and tool sessions are few and their stats cheap, so they
+	// come complete
+	if working != nil {
+		for _, info := range append(proposalDiffInfos(), toolDiffInfos()...) {
+			emit(DiffListEvent{Type: "diff", Diff: &info})
+		}
+	}
+	isPending := make(map[int]bool, len(pending))
+	for _, i := range pending {
+		isPending[i] = true
+	}
+	rules := linkRules()
+	for i := range commits {
+		info := commits[i]
+		info.Links = findLinks(rules, info.Message)
+		emit(DiffListEvent{Type: "diff", Diff: &info, Pending: isPending[i]})
+	}
+
+	if working != nil {
+		fillWorkingStat(c.Request.Context(), working)
+		emit(statsEvent(*working))
+	}
+	if baseline != nil {
+		fillBaselineStat(baseline)
+		emit(statsEvent(*baseline))
+	}
+	// Stats events arrive in whatever order the diffstats finish
+	var emitMu sync.Mutex
+	forEachParallel(len(pending), commitStatParallelism, func(j int) {
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		i := pending[j]
+		fillCommitStat(c.Request.Context(), &commits[i])
+		cache.putCommit(commits[i])
+		emitMu.Lock()
+		emit(statsEvent(commits[i]))
+		emitMu.Unlock()
+	})
+	if c.Request.Context().Err() != nil {
+		return
+	}
+
+	// Only a listing whose stats are all cached can be served from the
+	// log cache, so it is recorded once the stream completes
+	if head != "" {
+		ids := make([]string, len(commits))
+		for i, info := range commits {
+			ids[i] = info.ID
+		}
+		cache.putLog(head+filter.key(), ids)
+	}
+	emit(DiffListEvent{Type: "done"})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamDiffs(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	cache.reset()
+	defer cache.reset()
+
+	r := gin.New()
+	r.GET("/api/diffs", getDiffs)
+	stream := func() []DiffListEvent {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs?stream=true", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("stream = %d: %s", w.Code, w.Body.String())
+		}
+		var events []DiffListEvent
+		scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+		for scanner.Scan() {
+			var ev DiffListEvent
+			if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+				t.Fatalf("bad event %q: %v", scanner.Text(), err)
+			}
+			events = append(events, ev)
+		}
+		return events
+	}
+
+	events := stream()
+	var diffs, stats int
+	for _, ev := range events {
+		switch ev.Type {
+		case "diff":
+			diffs++
+			if stats > 0 {
+				t.Errorf("diff event for %s after stats began", ev.Diff.ID)
+			}
+		case "stats":
+			stats++
+		}
+	}
+	if diffs != 4 || stats != 4 || events[len(events)-1].Type != "done" {
+		t.Fatalf("got %d diffs and %d stats: %+v", diffs, stats, events)
+	}
+	if events[0].Diff.ID != "working" || !events[0].Pending {
+		t.Errorf("first event = %+v, want pending working entry", events[0])
+	}
+
+	// The streamed stats match the blocking listing
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs", nil))
+	var listed []DiffInfo
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	want := make(map[string]DiffInfo)
+	for _, d := range listed {
+		want[d.ID] = d
+	}
+	for _, ev := range events {
+		if ev.Type == "stats" {
+			d := want[ev.ID]
+			if ev.Additions != d.Additions || ev.Deletions != d.Deletions || ev.FilesCount != d.FilesCount {
+				t.Errorf("stats for %s = %+v, listing has %+v", ev.ID, ev, d)
+			}
+		}
+	}
+
+	// Once cached, commits arrive complete and only the working entry is
+	// left pending
+	events = stream()
+	stats = 0
+	for _, ev := range events {
+		if ev.Type == "stats" {
+			stats++
+		}
+		if ev.Type == "diff" && ev.Pending && ev.Diff.ID != "working" {
+			t.Errorf("cached commit %s sent as pending", ev.Diff.ID)
+		}
+	}
+	if stats != 1 {
+		t.Errorf("second stream had %d stats events, want 1", stats)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DirDiff summarizes a diff's changes under one directory
+type DirDiff struct {
+	// Path is the directory, with no trailing slash; "" is the repository root
+	Path       string     `json:"path"`
+	FilesCount int        `json:"filesCount"`
+	Additions  int        `json:"additions"`
+	Deletions  int        `json:"deletions"`
+	Files      []FileInfo `json:"files"`
+	// Patch is the concatenated diff of every file, only returned when
+	// requested with ?patch=true. Truncated is set instead when more than
+	// maxDiffLines lines changed.
+	Patch     string `json:"patch,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// dirPathspecs limits a diff to dir, leaving out the repository's
+// differing.exclude patterns when withExcludes is set
+func dirPathspecs(dir string, withExcludes bool) []string {
+	spec := ":(literal)" + dir
+	if dir == "" {
+		spec = "."
+	}
+	specs := []string{spec}
+	if withExcludes {
+		for _, e := range defaultExcludes() {
+			specs = append(specs, ":(exclude,glob)"+e)
+		}
+	}
+	return specs
+}
+
+// getDirDiff returns aggregate stats and the changed files under a
+// directory, so a whole subtree can be reviewed at once
+func getDirDiff(c *gin.Context) {
+	dir := strings.Trim(repoPath(c.Param("dirpath")), "/")
+	if escapesRepo(dir) {
+		respondError(c, http.StatusForbidden, "directory outside repository: "+dir, nil)
+		return
+	}
+
+	opts, err := diffOptionsFromQuery(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+
+	pathspecs := dirPathspecs(dir, c.Query("defaultExcludes") != "false")
+	files, err := listDiffFiles(c.Request.Context(), spec, opts, pathspecs)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to get diff files", err)
+		return
+	}
+
+	result := DirDiff{Path: dir, FilesCount: len(files), Files: files}
+	if result.Files == nil {
+		result.Files = []FileInfo{}
+	}
+	for _, f := range files {
+		result.Additions += f.Additions
+		result.Deletions += f.Deletions
+	}
+
+	if c.Query("patch") == "true" && len(files) > 0 {
+		if result.Additions+result.Deletions > maxDiffLines {
+			result.Truncated = true
+		} else {
+			args := append([]string{"diff", "--no-color"}, opts.args()...)
+			args = append(append(args, spec.revArgs()...), "--")
+			output, err := runGitContext(c.Request.Context(), append(args, pathspecs...)...)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, "Failed to compute patch", err)
+				return
+			}
+			result.Patch = string(output)
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDirDiff(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	os.MkdirAll(filepath.Join("internal", "auth"), 0755)
+	os.MkdirAll(filepath.Join("internal", "authz"), 0755)
+	os.WriteFile(filepath.Join("internal", "auth", "a.go"), []byte("package auth\n"), 0644)
+	os.WriteFile(filepath.Join("internal", "auth", "b.go"), []byte("package auth\n"), 0644)
+	os.WriteFile(filepath.Join("internal", "authz", "c.go"), []byte("package authz\n"), 0644)
+	runGit("add", ".")
+	runGit("commit", "-m", "Add auth")
+	os.WriteFile(filepath.Join("internal", "auth", "a.go"), []byte("package auth\n\nfunc A() {}\n"), 0644)
+	os.WriteFile(filepath.Join("internal", "authz", "c.go"), []byte("package authz\n\nfunc C() {}\n"), 0644)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/dir-diff/:id/*dirpath", getDirDiff)
+
+	get := func(url string) (int, DirDiff) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		var d DirDiff
+		json.Unmarshal(w.Body.Bytes(), &d)
+		return w.Code, d
+	}
+
+	code, d := get("/api/dir-diff/working/internal/auth/")
+	if code != http.StatusOK {
+		t.Fatalf("dir-diff = %d", code)
+	}
+	if d.Path != "internal/auth" || d.FilesCount != 1 || d.Additions != 2 || d.Deletions != 0 || d.Patch != "" {
+		t.Errorf("dir-diff = %+v, want only internal/auth/a.go", d)
+	}
+
+	_, d = get("/api/dir-diff/HEAD/internal?mode=commit&patch=true")
+	if d.FilesCount != 3 || d.Additions != 3 {
+		t.Errorf("commit dir-diff = %+v, want 3 added files", d)
+	}
+	if strings.Count(d.Patch, "diff --git") != 3 {
+		t.Errorf("patch = %q, want all three files", d.Patch)
+	}
+
+	if _, d = get("/api/dir-diff/working/"); d.FilesCount != 2 || d.Path != "" {
+		t.Errorf("root dir-diff = %+v, want both changed files", d)
+	}
+	if _, d = get("/api/dir-diff/working/docs"); d.FilesCount != 0 || d.Files == nil {
+		t.Errorf("unchanged dir-diff = %+v, want an empty file list", d)
+	}
+	if code, _ := get("/api/dir-diff/working/../etc"); code != http.StatusForbidden {
+		t.Errorf("dir-diff outside repo = %d, want 403", code)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sources of an editor selection
+const (
+	editorSourceEditor    = "editor"
+	editorSourceDiffering = "differing"
+)
+
+// EditorGoto is the body of POST /api/editor/goto. Path may be absolute,
+// as editors know files, or relative to the repository. Diff defaults to
+// the working changes.
+type EditorGoto struct {
+	Diff   string `json:"diff,omitempty"`
+	Path   string `json:"path"`
+	Line   int    `json:"line,omitempty"`
+	Source string `json:"source,omitempty"`
+}
+
+// EditorState is the selection shared between differing and an editor.
+// Seq increases with every change, so a client can wait for the next one.
+//
+// URL is differing's deep link, /c/<diff>/f/<path>#L<line>. VSCode and
+// JetBrains open the file in those editors, as
+// vscode://file/<absolute path>:<line> and
+// jetbrains://idea/navigate/reference?project=<name>&path=<path>:<line>,
+// taking the repository's directory name as the project's.
+type EditorState struct {
+	Seq int `json:"seq"`
+	Location
+	// InDiff is false when the file has no changes in the diff
+	InDiff    bool      `json:"inDiff"`
+	Source    string    `json:"source,omitempty"`
+	Updated   time.Time `json:"updated,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	VSCode    string    `json:"vscode,omitempty"`
+	JetBrains string    `json:"jetbrains,omitempty"`
+}
+
+// editor holds the current selection. changed is closed and replaced on
+// every update to wake waiting clients.
+var editor = struct {
+	sync.Mutex
+	state   EditorState
+	repo    string
+	changed chan struct{}
+}{changed: make(chan struct{})}
+
+// editorURLs sets the links that open state's location in differing and
+// in the editors
+func editorURLs(state *EditorState) {
+	state.URL = state.Location.URL()
+	abs := filepath.ToSlash(filepath.Join(gitRoot, filepath.FromSlash(state.Path)))
+	line := ""
+	if state.Line > 0 {
+		line = ":" + strconv.Itoa(state.Line)
+	}
+	if !strings.HasPrefix(abs, "/") {
+		abs = "/" + abs // Windows drive paths
+	}
+	state.VSCode = "vscode://file" + (&url.URL{Path: abs}).EscapedPath() + line
+	state.JetBrains = "jetbrains://idea/navigate/reference?project=" + url.QueryEscape(filepath.Base(gitRoot)) +
+		"&path=" + url.QueryEscape(state.Path+line)
+}
+
+// editorPath converts a path from an editor to a repository path
+func editorPath(p string) (string, error) {
+	if isAbsPath(p) {
+		rel, err := filepath.Rel(gitRoot, filepath.Clean(p))
+		if err != nil {
+			return "", errors.New("file path outside repository: " + p)
+		}
+		p = rel
+	}
+	p = repoPath(p)
+	if p == "" || p == "." || escapesRepo(p) {
+		return "", errors.New("file path outside repository: " + p)
+	}
+	return p, nil
+}
+
+// postEditorGoto selects a file, and optionally a line, for differing and
+// any editor following along. The editor calls it when the user moves to
+// a file; differing's frontend when the reviewer does.
+func postEditorGoto(c *gin.Context) {
+	var req EditorGoto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	path, err := editorPath(req.Path)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if req.Line < 0 {
+		respondError(c, http.StatusBadRequest, "invalid line "+strconv.Itoa(req.Line), nil)
+		return
+	}
+	source := req.Source
+	if source == "" {
+		source = editorSourceEditor
+	}
+	if source != editorSourceEditor && source != editorSourceDiffering {
+		respondError(c, http.StatusBadRequest, "source must be editor or differing", nil)
+		return
+	}
+	diff := req.Diff
+	if diff == "" {
+		diff = "working"
+	}
+
+	state := EditorState{Location: Location{Commit: diff, Path: path, Line: req.Line}, Source: source, Updated: time.Now()}
+	resolved, err := resolveLocation(c.Request.Context(), state.Location)
+	if err != nil {
+		// Any file can be selected in an editor; only an unknown diff is
+		// an error
+		if _, diffErr := resolveDiff(diff, modeCumulative); diffErr != nil {
+			respondError(c, http.StatusNotFound, diffErr.Error(), diffErr)
+			return
+		}
+	} else {
+		state.Location, state.InDiff = resolved, true
+	}
+	editorURLs(&state)
+
+	editor.Lock()
+	if editor.repo == gitRoot {
+		state.Seq = editor.state.Seq + 1
+	} else {
+		state.Seq = 1
+	}
+	editor.state, editor.repo = state, gitRoot
+	close(editor.changed)
+	editor.changed = make(chan struct{})
+	editor.Unlock()
+	c.JSON(http.StatusOK, state)
+}
+
+// getEditorState returns the current selection. With ?since=<seq> it
+// waits up to ?wait= milliseconds for a newer one, for clients mirroring
+// the selection. It is outside the repository hold, as proposals are.
+func getEditorState(c *gin.Context) {
+	since := -1
+	if s := c.Query("since"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "since must be a sequence number", nil)
+			return
+		}
+		since = n
+	}
+	repoMu.RLock()
+	repo := gitRoot
+	repoMu.RUnlock()
+
+	editor.Lock()
+	state, changed := editor.state, editor.changed
+	if editor.repo != repo {
+		state = EditorState{}
+	}
+	editor.Unlock()
+	if state.Seq <= since {
+		if !waitForDone(c, changed) {
+			return
+		}
+		editor.Lock()
+		if editor.repo == repo {
+			state = editor.state
+		}
+		editor.Unlock()
+	}
+	c.JSON(http.StatusOK, state)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEditorSelection(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/editor/state", getEditorState)
+	r.POST("/api/editor/goto", postEditorGoto)
+
+	get := func(query string) EditorState {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/editor/state"+query, nil))
+		var state EditorState
+		json.Unmarshal(w.Body.Bytes(), &state)
+		return state
+	}
+	before := get("").Seq
+
+	// A mirroring client waiting for the next selection hears of it
+	next := make(chan EditorState)
+	go func() {
+		next <- get("?since=" + strconv.Itoa(before) + "&wait=10000")
+	}()
+
+	// Editors pass absolute paths
+	body := `{"path":"` + filepath.ToSlash(filepath.Join(gitRoot, "test2.ts")) + `","line":1}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/editor/goto", strings.NewReader(body)))
+	var state EditorState
+	json.Unmarshal(w.Body.Bytes(), &state)
+	if w.Code != http.StatusOK || state.Path != "test2.ts" || !state.InDiff || state.Source != editorSourceEditor {
+		t.Fatalf("goto = %d: %s", w.Code, w.Body)
+	}
+	if state.URL != "/c/working/f/test2.ts#L1" || !strings.HasSuffix(state.VSCode, "/test2.ts:1") || !strings.Contains(state.JetBrains, "path=test2.ts%3A1") {
+		t.Errorf("links = %q %q %q", state.URL, state.VSCode, state.JetBrains)
+	}
+	if got := <-next; got.Seq != state.Seq || got.Path != "test2.ts" {
+		t.Errorf("waiting client got %+v", got)
+	}
+
+	// Files without changes can be selected too
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/editor/goto", strings.NewReader(`{"path":"test1.go","source":"differing"}`)))
+	json.Unmarshal(w.Body.Bytes(), &state)
+	if w.Code != http.StatusOK || state.InDiff || state.Source != editorSourceDiffering {
+		t.Errorf("unchanged file = %d: %s", w.Code, w.Body)
+	}
+
+	for _, bad := range []string{`{"path":"../x"}`, `{"path":"/etc/passwd"}`, `{"path":"test1.go","source":"vim"}`} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/editor/goto", strings.NewReader(bad)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", bad, w.Code)
+		}
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/editor/goto", strings.NewReader(`{"diff":"nope","path":"test1.go"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown diff = %d, want 404", w.Code)
+	}
+}
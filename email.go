@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mboxSeparator starts each message in git format-patch --stdout output
+var mboxSeparator = regexp.MustCompile(`(?m)^From [0-9a-f]{40} Mon Sep 17 00:00:00 2001$`)
+
+// emailAddress is a loose check that a recipient is an address rather
+// than something git send-email could read as an option
+var emailAddress = regexp.MustCompile(`^[^-\s][^\s]*@[^\s]+$|^[^-<][^<>]*<[^\s<>]+@[^\s<>]+>$`)
+
+// Placeholders format-patch leaves in a cover letter for an editor to
+// replace
+const (
+	coverSubjectPlaceholder = "*** SUBJECT HERE ***"
+	coverBlurbPlaceholder   = "*** BLURB HERE ***"
+)
+
+// EmailPatch is one message of a format-patch series
+type EmailPatch struct {
+	Subject string `json:"subject"`
+	Content string `json:"content"`
+}
+
+// rangeFromRequest validates the range= query parameter, writing an error
+// response and returning false on failure
+func rangeFromRequest(c *gin.Context, rangeSpec string) (string, bool) {
+	resolved, err := resolveRangeArg(rangeSpec)
+	switch {
+	case errors.Is(err, errUnknownRevision):
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return "", false
+	case err != nil:
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return "", false
+	}
+	return resolved, true
+}
+
+// splitMbox splits format-patch --stdout output into its messages
+func splitMbox(mbox string) []EmailPatch {
+	starts := mboxSeparator.FindAllStringIndex(mbox, -1)
+	var patches []EmailPatch
+	for i, start := range starts {
+		end := len(mbox)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		content := mbox[start[0]:end]
+		var subject string
+		for _, line := range strings.Split(content, "\n") {
+			if s, ok := strings.CutPrefix(line, "Subject: "); ok {
+				subject = s
+				break
+			}
+			if line == "" {
+				break
+			}
+		}
+		patches = append(patches, EmailPatch{Subject: subject, Content: content})
+	}
+	return patches
+}
+
+// fillCoverLetter replaces the placeholders in a cover letter written by
+// format-patch with subject and body. A subject that is not ASCII is
+// encoded for the mail header it goes in.
+func fillCoverLetter(letter, subject, body string) (string, error) {
+	if !strings.Contains(letter, coverSubjectPlaceholder) || !strings.Contains(letter, coverBlurbPlaceholder) {
+		return "", errors.New("cover letter has no placeholders to fill")
+	}
+	letter = strings.Replace(letter, coverSubjectPlaceholder, mime.QEncoding.Encode("utf-8", subject), 1)
+	return strings.Replace(letter, coverBlurbPlaceholder, strings.TrimSpace(body), 1), nil
+}
+
+// writeSeries writes a commit range to dir as patch files with a cover
+// letter made from subject and body, returning the files in order
+func writeSeries(dir, resolved, subject, body string) ([]string, error) {
+	output, err := runGit("format-patch", "--cover-letter", "--output-directory="+dir, resolved)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			if !filepath.IsAbs(line) {
+				line = filepath.Join(gitRoot, line)
+			}
+			files = append(files, line)
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no patches in range")
+	}
+	letter, err := os.ReadFile(files[0])
+	if err != nil {
+		return nil, err
+	}
+	filled, err := fillCoverLetter(string(letter), subject, body)
+	if err != nil {
+		return nil, err
+	}
+	return files, os.WriteFile(files[0], []byte(filled), 0644)
+}
+
+// getFormatPatch renders a commit range as an email patch series. Pass
+// coverLetter=true to include a cover letter and format=mbox for the raw
+// mailbox instead of JSON.
+func getFormatPatch(c *gin.Context) {
+	resolved, ok := rangeFromRequest(c, c.Query("range"))
+	if !ok {
+		return
+	}
+	args := []string{"format-patch", "--stdout", "--no-color"}
+	if c.Query("coverLetter") == "true" {
+		args = append(args, "--cover-letter")
+	}
+	output, err := runGitContext(c.Request.Context(), append(args, resolved)...)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to format patches", err)
+		return
+	}
+	if c.Query("format") == "mbox" {
+		c.Data(http.StatusOK, "application/mbox", output)
+		return
+	}
+	patches := splitMbox(string(output))
+	if patches == nil {
+		patches = []EmailPatch{}
+	}
+	c.JSON(http.StatusOK, patches)
+}
+
+// postSendEmail mails a commit range with git send-email, which uses the
+// sendemail.* settings (SMTP server, identity) from git config. A cover
+// letter needs its subject and body in the request, there being no editor
+// to write them in.
+func postSendEmail(c *gin.Context) {
+	var req struct {
+		Range        string   `json:"range"`
+		To           []string `json:"to"`
+		Cc           []string `json:"cc"`
+		CoverLetter  bool     `json:"coverLetter"`
+		CoverSubject string   `json:"coverSubject"`
+		CoverBody    string   `json:"coverBody"`
+		DryRun       bool     `json:"dryRun"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	if len(req.To) == 0 {
+		respondError(c, http.StatusBadRequest, "at least one recipient is required", nil)
+		return
+	}
+	for _, addr := range append(append([]string{}, req.To...), req.Cc...) {
+		if !emailAddress.MatchString(addr) {
+			respondError(c, http.StatusBadRequest, "invalid address: "+addr, nil)
+			return
+		}
+	}
+	if req.CoverLetter {
+		subject := strings.TrimSpace(req.CoverSubject)
+		if subject == "" || strings.ContainsAny(subject, "\r\n") || strings.TrimSpace(req.CoverBody) == "" {
+			respondError(c, http.StatusBadRequest, "a cover letter needs a one-line coverSubject and a coverBody", nil)
+			return
+		}
+	}
+	resolved, ok := rangeFromRequest(c, req.Range)
+	if !ok {
+		return
+	}
+
+	args := []string{"send-email", "--confirm=never", "--quiet", "--8bit-encoding=UTF-8"}
+	for _, addr := range req.To {
+		args = append(args, "--to="+addr)
+	}
+	for _, addr := range req.Cc {
+		args = append(args, "--cc="+addr)
+	}
+	if req.DryRun {
+		args = append(args, "--dry-run")
+	}
+	series := []string{resolved}
+	if req.CoverLetter {
+		dir, err := os.MkdirTemp("", "differing-series-*")
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to format patches", err)
+			return
+		}
+		defer os.RemoveAll(dir)
+		if series, err = writeSeries(dir, resolved, strings.TrimSpace(req.CoverSubject), req.CoverBody); err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to format patches", err)
+			return
+		}
+	}
+	output, err := runGitContext(c.Request.Context(), append(args, series...)...)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, "Failed to send patches", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"output": string(output), "dryRun": req.DryRun})
+}
+
+// postApplyMailbox applies a received patch series, sent as the request
+// body in mbox format, with git am. A series that does not apply cleanly
+// is aborted so the repository is left as it was; an am, rebase or merge
+// already stopped partway is refused rather than disturbed.
+func postApplyMailbox(c *gin.Context) {
+	mbox, err := c.GetRawData()
+	if err != nil || len(mbox) == 0 {
+		respondError(c, http.StatusBadRequest, "request body must be an mbox patch series", nil)
+		return
+	}
+	if rebaseInProgress() || mergeInProgress() {
+		respondError(c, http.StatusConflict, "An am, rebase or merge is already in progress", nil)
+		return
+	}
+	var secrets []SecretFinding
+	if secretsMode() != secretsOff {
+		if secrets, err = scanPatch(mbox, "b/"); err != nil {
+			respondError(c, http.StatusBadRequest, "Failed to scan patch series", err)
+			return
+		}
+	}
+	if !secretsAllowed(c, secrets) {
+		return
+	}
+	// am moves the branch once per patch, so the reflog's last entry is
+	// not where it started
+	before := currentHead()
+	if _, err := runGitEnvContext(c.Request.Context(), nil, mbox, "am", "--3way", "--keep-cr"); err != nil {
+		// Nothing was in progress before, so whatever is now is ours
+		if rebaseInProgress() {
+			runGitContext(c.Request.Context(), "am", "--abort")
+		}
+		respondError(c, http.StatusConflict, "Patch series did not apply", err)
+		return
+	}
+	recordHistory("am", before)
+	head := currentHead()
+	emitEvent(eventCommitCreated, map[string]string{"commit": head, "action": "am"})
+	response := gin.H{"head": head}
+	if len(secrets) > 0 {
+		response["secrets"] = secrets
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEmailPatchWorkflow(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/format-patch", getFormatPatch)
+	r.POST("/api/send-email", postSendEmail)
+	r.POST("/api/am", postApplyMailbox)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/format-patch?range=HEAD~2..HEAD&coverLetter=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("format-patch = %d: %s", w.Code, w.Body.String())
+	}
+	var patches []EmailPatch
+	json.Unmarshal(w.Body.Bytes(), &patches)
+	if len(patches) != 3 {
+		t.Fatalf("got %d messages, want a cover letter and 2 patches", len(patches))
+	}
+	if !strings.Contains(patches[0].Subject, "0/2") || !strings.Contains(patches[2].Subject, "Add TypeScript file") {
+		t.Errorf("subjects = %q, %q", patches[0].Subject, patches[2].Subject)
+	}
+
+	// Round trip the last commit through git am
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/format-patch?range=HEAD~1..HEAD&format=mbox", nil))
+	mbox := w.Body.Bytes()
+	runGit("stash")
+	runGit("reset", "--hard", "HEAD~1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/am", bytes.NewReader(mbox)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("am = %d: %s", w.Code, w.Body.String())
+	}
+	if subject, _ := runGit("log", "-1", "--format=%s"); !strings.Contains(string(subject), "Add TypeScript file") {
+		t.Errorf("HEAD after am = %q", subject)
+	}
+
+	// A series that fails to apply is aborted
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/am", strings.NewReader("not a patch\n")))
+	if w.Code != http.StatusConflict {
+		t.Errorf("reapplying = %d, want 409", w.Code)
+	}
+	if _, err := os.Stat(".git/rebase-apply"); !os.IsNotExist(err) {
+		t.Error("a failed am should be aborted")
+	}
+
+	for _, body := range []string{
+		`{"range": "HEAD~1..HEAD", "to": ["--sendmail-cmd=evil"]}`,
+		`{"range": "HEAD~1..HEAD"}`,
+		`{"range": "HEAD", "to": ["dev@example.com"]}`,
+		`{"range": "HEAD~1..HEAD", "to": ["dev@example.com"], "coverLetter": true}`,
+		`{"range": "HEAD~1..HEAD", "to": ["dev@example.com"], "coverLetter": true, "coverSubject": "Two\nlines", "coverBody": "Why"}`,
+	} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/send-email", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("send-email %s = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestWriteSeries(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	files, err := writeSeries(t.TempDir(), "HEAD~2..HEAD", "Greet in TypeScript too", "The hello function gains a twin.")
+	if err != nil {
+		t.Fatalf("writeSeries() failed: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("files = %v, want a cover letter and 2 patches", files)
+	}
+	letter, _ := os.ReadFile(files[0])
+	if strings.Contains(string(letter), "***") || !strings.Contains(string(letter), "[PATCH 0/2] Greet in TypeScript too") ||
+		!strings.Contains(string(letter), "The hello function gains a twin.") {
+		t.Errorf("cover letter was not filled in:\n%s", letter)
+	}
+
+	filled, _ := fillCoverLetter("Subject: [PATCH 0/1] "+coverSubjectPlaceholder+"\n\n"+coverBlurbPlaceholder+"\n", "Grüße", "Body")
+	if !strings.Contains(filled, "=?utf-8?q?Gr=C3=BC=C3=9Fe?=") {
+		t.Errorf("non-ASCII subject was not encoded: %q", filled)
+	}
+}
+
+func TestApplyMailboxDuringAm(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	// Leave an am of the user's own stopped on a patch that no longer applies
+	mbox, _ := runGit("format-patch", "--stdout", "HEAD~1..HEAD")
+	runGit("stash")
+	if _, err := runGitInput(mbox, "am"); err == nil {
+		t.Fatal("reapplying the last commit succeeded")
+	}
+
+	r := gin.New()
+	r.POST("/api/am", postApplyMailbox)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/am", bytes.NewReader(mbox)))
+	if w.Code != http.StatusConflict {
+		t.Errorf("am during another am = %d, want 409", w.Code)
+	}
+	if _, err := os.Stat(".git/rebase-apply/applying"); err != nil {
+		t.Error("the user's am was aborted")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes let clients tell failures apart without parsing messages
+const (
+	codeBadRequest       = "bad_request"
+	codeForbidden        = "forbidden"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeTooLarge         = "too_large"
+	codeInternal         = "internal"
+	codeUpstream         = "upstream_failed"
+	codeUnavailable      = "unavailable"
+	codeUnknownRevision  = "unknown_revision"
+	codePermissionDenied = "permission_denied"
+	// codePushed refuses to rewrite commits remote branches contain
+	// unless the request passes force=true
+	codePushed = "pushed"
+	// codeSecrets refuses changes with likely credentials when
+	// differing.secrets is block, unless the request passes allowSecrets=true
+	codeSecrets = "secrets"
+	// codeLint refuses a commit message that breaks the differing.lint rules
+	codeLint = "lint"
+	// codeGitFailed is git reporting an error; codeGitCrashed is git killed
+	// by a signal, and codeGitMissing is git not starting at all
+	codeGitFailed  = "git_failed"
+	codeGitCrashed = "git_crashed"
+	codeGitMissing = "git_unavailable"
+)
+
+// APIError is the body of every error response
+type APIError struct {
+	// Code classifies the failure; see the code constants
+	Code string `json:"code"`
+	// Message says what the request was doing, for people
+	Message string `json:"error"`
+	// Details is the underlying error: git's stderr, or the Go error
+	Details string `json:"details,omitempty"`
+	// Git is set when a git command failed
+	Git *GitFailure `json:"git,omitempty"`
+	// Conflicts lists conflicted paths when a merge or rebase stopped
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Remaining lists the paths a commit split has not committed yet
+	Remaining []string `json:"remaining,omitempty"`
+	// PushedTo lists the remote branches containing commits a history
+	// rewrite was refused for
+	PushedTo []string `json:"pushedTo,omitempty"`
+	// Secrets lists the likely credentials a change was refused for
+	Secrets []SecretFinding `json:"secrets,omitempty"`
+	// Issues lists the problems a commit message was refused for
+	Issues []LintIssue `json:"issues,omitempty"`
+}
+
+// GitFailure describes a git command that exited unsuccessfully
+type GitFailure struct {
+	Args []string `json:"args"`
+	// ExitCode is -1 when git was killed or never started
+	ExitCode int    `json:"exitCode"`
+	Stderr   string `json:"stderr"`
+}
+
+// unknownRevisionMessages are git's ways of saying a name is not a commit
+var unknownRevisionMessages = []string{
+	"unknown revision",
+	"bad revision",
+	"not a valid object name",
+	"invalid object name",
+	"bad object",
+	"not a commit",
+	"needed a single revision",
+}
+
+// ExitCode returns git's exit status, or -1 when it was killed or did not
+// start
+func (e *gitError) ExitCode() int {
+	var exitErr *exec.ExitError
+	if errors.As(e.Err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// newAPIError builds the error body for a response with the given status.
+// err may be nil when there is no underlying error.
+func newAPIError(status int, message string, err error) APIError {
+	apiErr := APIError{Code: statusCode(status), Message: message}
+	if err == nil {
+		return apiErr
+	}
+	// Handlers often pass an error's own text as the message
+	if details := gitStderr(err); details != message {
+		apiErr.Details = details
+	}
+
+	var gerr *gitError
+	if errors.As(err, &gerr) {
+		apiErr.Git = &GitFailure{Args: gerr.Args, ExitCode: gerr.ExitCode(), Stderr: gerr.Stderr}
+	}
+	switch {
+	case errors.Is(err, errUnknownRevision):
+		apiErr.Code = codeUnknownRevision
+	case errors.Is(err, fs.ErrPermission):
+		apiErr.Code = codePermissionDenied
+	case gerr != nil:
+		// A plain git failure says less than a status like 409 already does
+		if code := gitFailureCode(gerr); code != codeGitFailed || apiErr.Code == codeInternal {
+			apiErr.Code = code
+		}
+	}
+	return apiErr
+}
+
+// gitFailureCode classifies why a git command failed
+func gitFailureCode(gerr *gitError) string {
+	var exitErr *exec.ExitError
+	if !errors.As(gerr.Err, &exitErr) {
+		return codeGitMissing
+	}
+	if gerr.ExitCode() < 0 {
+		return codeGitCrashed
+	}
+	stderr := strings.ToLower(gerr.Stderr)
+	for _, msg := range unknownRevisionMessages {
+		if strings.Contains(stderr, msg) {
+			return codeUnknownRevision
+		}
+	}
+	if strings.Contains(stderr, "permission denied") {
+		return codePermissionDenied
+	}
+	return codeGitFailed
+}
+
+// statusCode is the error code for a status when nothing more specific
+// is known
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return codeBadRequest
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return codeConflict
+	case http.StatusRequestEntityTooLarge:
+		return codeTooLarge
+	case http.StatusBadGateway:
+		return codeUpstream
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	default:
+		return codeInternal
+	}
+}
+
+// respondError sends an error response and stops the handler chain
+func respondError(c *gin.Context, status int, message string, err error) {
+	c.AbortWithStatusJSON(status, newAPIError(status, message, err))
+}
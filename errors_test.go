@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewAPIError(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	_, badRev := runGit("log", "no-such-branch")
+	_, badArgs := runGit("log", "--no-such-option")
+
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		code   string
+	}{
+		{"status only", http.StatusNotFound, nil, codeNotFound},
+		{"unknown revision sentinel", http.StatusNotFound, fmt.Errorf("%w: nope", errUnknownRevision), codeUnknownRevision},
+		{"git unknown revision", http.StatusInternalServerError, badRev, codeUnknownRevision},
+		{"git failure", http.StatusInternalServerError, badArgs, codeGitFailed},
+		{"git failure with a telling status", http.StatusConflict, badArgs, codeConflict},
+		{"git missing", http.StatusInternalServerError, &gitError{Args: []string{"status"}, Err: errors.New("executable file not found")}, codeGitMissing},
+		{"permission denied", http.StatusInternalServerError, &fs.PathError{Op: "open", Path: "x", Err: fs.ErrPermission}, codePermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := newAPIError(tt.status, "Failed", tt.err)
+			if apiErr.Code != tt.code {
+				t.Errorf("code = %q, want %q (details %q)", apiErr.Code, tt.code, apiErr.Details)
+			}
+		})
+	}
+
+	apiErr := newAPIError(http.StatusInternalServerError, "Failed to get log", badRev)
+	if apiErr.Git == nil || apiErr.Git.ExitCode != 128 || apiErr.Git.Stderr == "" || apiErr.Git.Args[0] != "log" {
+		t.Errorf("git failure = %+v", apiErr.Git)
+	}
+	if apiErr.Details != apiErr.Git.Stderr {
+		t.Errorf("details = %q, want git's stderr", apiErr.Details)
+	}
+
+	// An error's own text passed as the message is not repeated
+	plain := errors.New("bad input")
+	if apiErr := newAPIError(http.StatusBadRequest, plain.Error(), plain); apiErr.Details != "" {
+		t.Errorf("details = %q, want none", apiErr.Details)
+	}
+}
+
+func TestRespondError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/fail", func(c *gin.Context) {
+		respondError(c, http.StatusBadRequest, "Invalid request", nil)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["code"] != codeBadRequest || body["error"] != "Invalid request" {
+		t.Errorf("body = %v", body)
+	}
+	if _, ok := body["git"]; ok {
+		t.Errorf("body = %v, want no git failure", body)
+	}
+}
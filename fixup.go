@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hasStagedChanges reports whether the index differs from HEAD
+func hasStagedChanges() bool {
+	_, err := runGit("diff", "--cached", "--quiet")
+	return err != nil
+}
+
+// unpushedRange returns the oldest commit on the current branch that no
+// remote-tracking branch contains, or "" if everything has been pushed,
+// along with its parent ("" if it is the root)
+func unpushedRange() (oldest, base string, err error) {
+	output, err := runGit("rev-list", "--reverse", "HEAD", "--not", "--remotes")
+	if err != nil {
+		return "", "", err
+	}
+	commits := strings.Fields(string(output))
+	if len(commits) == 0 {
+		return "", "", nil
+	}
+	base, _ = resolveRev(commits[0] + "^")
+	return commits[0], base, nil
+}
+
+// createFixup commits the staged changes as a fixup! commit for :id,
+// to be folded into it by a later autosquash
+func createFixup(c *gin.Context) {
+	var opts CommitOptions
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid request", err)
+			return
+		}
+	}
+	sha, err := resolveRev(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "merge-base", "--is-ancestor", sha, "HEAD"); err != nil {
+		respondError(c, http.StatusConflict, "Commit is not on the current branch", nil)
+		return
+	}
+	if !hasStagedChanges() {
+		respondError(c, http.StatusBadRequest, "No staged changes to commit", nil)
+		return
+	}
+	secrets, ok := checkStagedSecrets(c)
+	if !ok {
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), opts.gitArgs("commit", "--quiet", "--no-edit", "--fixup="+sha)...); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create fixup commit", err)
+		return
+	}
+	recordHistory("fixup", previousHead())
+	head := currentHead()
+	emitEvent(eventCommitCreated, map[string]string{"commit": head, "action": "fixup"})
+	response := gin.H{"head": head}
+	if len(secrets) > 0 {
+		response["secrets"] = secrets
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// autosquash folds fixup! and squash! commits into their targets across
+// the commits that have not been pushed
+func autosquash(c *gin.Context) {
+	oldest, base, err := unpushedRange()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list commits", err)
+		return
+	}
+	if oldest == "" {
+		respondError(c, http.StatusBadRequest, "All commits have been pushed", nil)
+		return
+	}
+	pushedTo, err := checkRewritable(oldest, forceRewrite(c))
+	if err != nil {
+		writeRewriteError(c, err)
+		return
+	}
+	// Accept the todo list git generates with the fixups moved into place
+	if err := runRebase("true", base, false, "--autosquash"); err != nil {
+		writeRewriteError(c, err)
+		return
+	}
+	recordHistory("autosquash", previousHead())
+	emitEvent(eventHistoryRewritten, map[string]string{"action": "autosquash"})
+	c.JSON(http.StatusOK, gin.H{"head": currentHead(), "pushedTo": pushedTo})
+}
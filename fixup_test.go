@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFixupAndAutosquash(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	r := gin.New()
+	r.POST("/api/commit/:id/fixup", createFixup)
+	r.POST("/api/autosquash", autosquash)
+
+	post := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w
+	}
+
+	if w := post("/api/commit/HEAD~1/fixup"); w.Code != http.StatusBadRequest {
+		t.Errorf("fixup with nothing staged = %d, want 400", w.Code)
+	}
+
+	// Fix up the middle commit with a change to its file
+	if err := os.WriteFile(filepath.Join(repoDir, "test1.go"), []byte("package main\n\n// fixed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit("add", "test1.go")
+	if w := post("/api/commit/HEAD~1/fixup"); w.Code != http.StatusOK {
+		t.Fatalf("fixup = %d: %s", w.Code, w.Body.String())
+	}
+	subject, _ := runGit("log", "-1", "--format=%s")
+	if got := strings.TrimSpace(string(subject)); got != "fixup! Update hello function" {
+		t.Errorf("fixup subject = %q", got)
+	}
+
+	// The working tree still has test2.ts modified
+	if w := post("/api/autosquash"); w.Code != http.StatusConflict {
+		t.Errorf("autosquash with dirty worktree = %d, want 409", w.Code)
+	}
+	runGit("checkout", "--", ".")
+
+	if w := post("/api/autosquash"); w.Code != http.StatusOK {
+		t.Fatalf("autosquash = %d: %s", w.Code, w.Body.String())
+	}
+	output, _ := runGit("log", "--format=%s")
+	if got := strings.TrimSpace(string(output)); got != "Add TypeScript file\nUpdate hello function\nInitial commit" {
+		t.Errorf("log after autosquash = %q", got)
+	}
+	content, _ := runGit("show", "HEAD~1:test1.go")
+	if !strings.Contains(string(content), "// fixed") {
+		t.Errorf("fixup was not folded into its target: %q", content)
+	}
+
+	runGit("update-ref", "refs/remotes/origin/main", "HEAD")
+	if w := post("/api/autosquash"); w.Code != http.StatusBadRequest {
+		t.Errorf("autosquash with everything pushed = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hashedAsset matches bundle names that include a content hash
+// (see frontend/build.js); these never change and can be cached forever.
+var hashedAsset = regexp.MustCompile(`\.[0-9a-f]{16}\.(js|css)(\.map)?$`)
+
+func init() {
+	// Types missing from Go's built-in table that the frontend build emits
+	mime.AddExtensionType(".ttf", "font/ttf")
+	mime.AddExtensionType(".map", "application/json")
+}
+
+// frontendHandler serves the embedded frontend build, falling back to
+// index.html for client-side routes.
+type frontendHandler struct {
+	fsys  fs.FS
+	files http.Handler
+	etags map[string]string
+}
+
+// newFrontendHandler hashes every embedded file up front so unhashed
+// assets like index.html and the Monaco workers can be revalidated by ETag.
+func newFrontendHandler(fsys fs.FS) (*frontendHandler, error) {
+	h := &frontendHandler{
+		fsys:  fsys,
+		files: http.FileServerFS(fsys),
+		etags: make(map[string]string),
+	}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		sum := sha256.New()
+		if _, err := io.Copy(sum, f); err != nil {
+			return err
+		}
+		h.etags[name] = `"` + hex.EncodeToString(sum.Sum(nil)[:16]) + `"`
+		return nil
+	})
+	return h, err
+}
+
+// resolve maps a request path to an embedded file, using index.html for
+// anything that isn't a file so client-side routes work on reload
+func (h *frontendHandler) resolve(urlPath string) string {
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		return "index.html"
+	}
+	if info, err := fs.Stat(h.fsys, name); err != nil || info.IsDir() {
+		return "index.html"
+	}
+	return name
+}
+
+func (h *frontendHandler) serve(c *gin.Context) {
+	name := h.resolve(c.Request.URL.Path)
+
+	if hashedAsset.MatchString(name) {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+
+	// Prefer the gzip file generated at build time when the client accepts it
+	if acceptedEncoding(c.GetHeader("Accept-Encoding")) == "gzip" {
+		if f, err := h.fsys.Open(name + ".gz"); err == nil {
+			defer f.Close()
+			if rs, ok := f.(io.ReadSeeker); ok {
+				c.Header("Content-Encoding", "gzip")
+				c.Header("Vary", "Accept-Encoding")
+				if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+					c.Header("Content-Type", ctype)
+				}
+				c.Header("ETag", h.etags[name+".gz"])
+				http.ServeContent(c.Writer, c.Request, name, time.Time{}, rs)
+				return
+			}
+		}
+	}
+
+	if etag, ok := h.etags[name]; ok {
+		c.Header("ETag", etag)
+	}
+
+	// FileServer serves directories via their index.html and redirects
+	// explicit /index.html requests, so address the root for it
+	req := c.Request.Clone(c.Request.Context())
+	req.URL.Path = "/" + name
+	if name == "index.html" {
+		req.URL.Path = "/"
+	}
+	h.files.ServeHTTP(c.Writer, req)
+}
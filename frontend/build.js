@@ -115,6 +115,30 @@ function generateHTML(bundleFilename) {
   console.log('✓ Generated index.html');
 }
 
+// Write .gz siblings for text assets so the server can send them
+// precompressed instead of compressing on every request
+function precompressAssets() {
+  const zlib = require('zlib');
+  const compressible = /\.(js|css|html|map|ttf|svg|json)$/;
+  let count = 0;
+
+  const walk = (dir) => {
+    for (const entry of fs.readdirSync(dir, { withFileTypes: true })) {
+      const fullPath = path.join(dir, entry.name);
+      if (entry.isDirectory()) {
+        walk(fullPath);
+      } else if (compressible.test(entry.name)) {
+        const data = fs.readFileSync(fullPath);
+        fs.writeFileSync(`${fullPath}.gz`, zlib.gzipSync(data, { level: zlib.constants.Z_BEST_COMPRESSION }));
+        count++;
+      }
+    }
+  };
+  walk(outDir);
+
+  console.log(`✓ Precompressed ${count} assets`);
+}
+
 // Run TypeScript type checking
 function typecheck() {
   console.log('Running TypeScript type checking...');
@@ -152,6 +176,11 @@ async function build() {
     // Generate HTML
     generateHTML(bundleFilename);
 
+    // Precompress assets for serving
+    if (!isDev) {
+      precompressAssets();
+    }
+
     console.log('\n✅ Build complete!');
     console.log(`Output directory: ${outDir}`);
   } catch (error) {
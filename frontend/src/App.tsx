@@ -1,9 +1,9 @@
 import React, { useState, useEffect, useRef, useCallback } from 'react';
 import { DiffInfo, FileInfo, FileDiff, Comment } from './types';
-import { DiffAPI } from './api';
+import { DiffAPI, deepLinkPath, parseDeepLink } from './api';
 import DiffChooser from './components/DiffChooser';
 import FileChooser from './components/FileChooser';
-import DiffEditor, { ViewMode } from './components/DiffEditor';
+import DiffEditor, { ViewMode, isEditable } from './components/DiffEditor';
 import FloatingCommentPanel from './components/FloatingCommentPanel';
 
 export interface DiffEditorHandle {
@@ -41,6 +41,8 @@ const App: React.FC = () => {
   const diffEditorRef = useRef<DiffEditorHandle>(null);
   const historyDropdownRef = useRef<HTMLDivElement>(null);
   const modeRef = useRef<ViewMode>(mode);
+  // Selection requested by the URL at load; cleared once applied
+  const deepLink = useRef(parseDeepLink(window.location.pathname, window.location.hash));
 
   // Keep modeRef in sync
   useEffect(() => {
@@ -124,6 +126,13 @@ const App: React.FC = () => {
     }
   }, [allComments, repoPath]);
 
+  // Keep the URL in sync with the selection so it can be shared
+  useEffect(() => {
+    if (selectedDiff && !deepLink.current) {
+      window.history.replaceState(null, '', deepLinkPath(selectedDiff, selectedFile));
+    }
+  }, [selectedDiff, selectedFile]);
+
   // Load files when diff is selected
   useEffect(() => {
     if (selectedDiff) {
@@ -160,14 +169,20 @@ const App: React.FC = () => {
       setError(null);
       const diffsData = await DiffAPI.getDiffs();
       setDiffs(diffsData);
-      // Auto-select: working changes if non-empty, otherwise first commit
-      if (diffsData.length > 0) {
+      // A deep link picks the diff; otherwise auto-select working changes
+      // if non-empty, otherwise the first commit
+      if (deepLink.current) {
+        setSelectedDiff(deepLink.current.diffId);
+      } else if (diffsData.length > 0) {
         const workingChanges = diffsData.find(d => d.id === 'working');
         if (workingChanges && workingChanges.filesCount > 0) {
           setSelectedDiff('working');
         } else if (diffsData.length > 1) {
           // Select first commit (skip working changes entry)
           setSelectedDiff(diffsData[1].id);
+        } else if (!workingChanges) {
+          // A standalone comparison has only its own entry
+          setSelectedDiff(diffsData[0].id);
         }
       }
     } catch (err) {
@@ -184,8 +199,12 @@ const App: React.FC = () => {
       const filesData = await DiffAPI.getDiffFiles(diffId);
       const files = filesData || []; // Handle null response
       setFiles(files);
-      // Auto-select first file
-      if (files.length > 0) {
+      // Select the deep-linked file once, otherwise the first file
+      const linked = deepLink.current?.path;
+      deepLink.current = null;
+      if (linked && files.some(f => f.path === linked)) {
+        setSelectedFile(linked);
+      } else if (files.length > 0) {
         setSelectedFile(files[0].path);
       }
     } catch (err) {
@@ -199,7 +218,10 @@ const App: React.FC = () => {
     try {
       setLoading(true);
       setError(null);
-      const diffData = await DiffAPI.getFileDiff(diffId, filePath);
+      let diffData = await DiffAPI.getFileDiff(diffId, filePath);
+      if (diffData.tooLarge && window.confirm(`${filePath} is very large. Load it anyway?`)) {
+        diffData = await DiffAPI.getFileDiff(diffId, filePath, true);
+      }
       setFileDiff(diffData);
     } catch (err) {
       setError(`Failed to load file diff: ${err}`);
@@ -212,10 +234,12 @@ const App: React.FC = () => {
 
   const handleContentChange = async (content: string) => {
     if (!selectedDiff || !selectedFile) return;
-    
+    // Never save the empty stand-in for content that was not loaded
+    if (!fileDiff || !isEditable(fileDiff)) return;
+
     try {
       setSaveStatus('saving');
-      await DiffAPI.saveFile(selectedDiff, selectedFile, content);
+      await DiffAPI.saveFile(selectedDiff, selectedFile, content, fileDiff?.newEncoding);
       setSaveStatus('saved');
       setTimeout(() => setSaveStatus('idle'), 2000);
     } catch (err) {
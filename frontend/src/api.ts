@@ -1,13 +1,147 @@
-import { DiffInfo, FileInfo, FileDiff } from './types';
+import { CheckEvent, CommitDetails, CommitOptions, TrailerInput, DiffCoverage, DiffInfo, DiffListEvent, HunkPage, DiffGroup, FileInfo, HookResult, LintIssue, Plugin, PluginArgs, PluginEvent, ProgressUpdate, EmailPatch, SendEmailRequest, ReviewProgress, FileDiff, TreeNode, Preferences, SubmoduleInfo, SplitState, RebaseRequest, RebaseEvent, MergeRequest, Branch, Remote, SymbolOutline, Diagnostic, AffectedTests, TestEvent, FileChurn, FileRisk, FileOwners, UndoResult, CleanPreview, IgnoreFile, IgnoreMatch, DirDiff, FileComparison, SuggestionRequest, SuggestionResult, IndexFile, SecretScan, WhitespaceFix, DiffStats, Stack, Interdiff, Snapshot, Baseline, Proposal, ToolSession, ToolFile, EditorState, HighlightedFile, NestedRepo } from './types';
 
 // Use relative API calls when served from same origin, or full URL for dev mode
-const API_BASE = window.location.port === '3000' ? 'http://localhost:8080/api' : '/api';
+const API_BASE = window.location.port === '3000' ? 'http://localhost:8080/api/v1' : '/api/v1';
+
+// RewriteResult is the new HEAD after a history rewrite, with the remote
+// branches that still have the old commits when force was needed
+export interface RewriteResult {
+  head: string;
+  pushedTo: string[];
+  // rebasing is set by editCommit while the rebase is stopped for amending
+  rebasing?: boolean;
+}
+
+export interface CommitNote {
+  commit: string;
+  ref: string;
+  note: string;
+}
+
+export interface RecentRepo {
+  path: string;
+  lastOpened: string;
+}
 
 export interface RepoInfo {
   path: string;
+  shallow: boolean;
+  partial: boolean;
+  // readOnly is set when serving a managed clone; edits are rejected
+  readOnly: boolean;
+  name: string;
+  branch?: string; // absent when HEAD is detached
+  head?: string;
+  upstream?: string;
+  ahead: number;
+  behind: number;
+  dirty: boolean;
+  staged: number;
+  unstaged: number;
+  untracked: number;
+  conflicted: number;
+  stashes: number;
+  remotes: Remote[];
+  operation?: 'merge' | 'rebase' | 'am' | 'cherry-pick' | 'revert' | 'bisect' | 'split';
+}
+
+// FileFilters narrow file lists using git pathspecs; each entry may repeat
+export interface FileFilters {
+  path?: string[];
+  glob?: string[];
+  exclude?: string[];
+  defaultExcludes?: boolean;
+  // reverse swaps the sides, as git diff -R does
+  reverse?: boolean;
+}
+
+function filterQuery(filters?: FileFilters): string {
+  if (!filters) return '';
+  const params = new URLSearchParams();
+  filters.path?.forEach((p) => params.append('path', p));
+  filters.glob?.forEach((g) => params.append('glob', g));
+  filters.exclude?.forEach((e) => params.append('exclude', e));
+  if (filters.defaultExcludes === false) params.set('defaultExcludes', 'false');
+  if (filters.reverse) params.set('reverse', 'true');
+  const query = params.toString();
+  return query ? `?${query}` : '';
+}
+
+// CommitFilters narrow the commit list; dates are anything git log
+// accepts, such as "1 week ago" or 2024-01-31. ref lists another branch's
+// history without checking it out.
+export interface CommitFilters {
+  ref?: string;
+  author?: string[];
+  path?: string[];
+  since?: string;
+  until?: string;
+}
+
+function commitFilterQuery(filters?: CommitFilters): string {
+  if (!filters) return '';
+  const params = new URLSearchParams();
+  if (filters.ref) params.set('ref', filters.ref);
+  filters.author?.forEach((a) => params.append('author', a));
+  filters.path?.forEach((p) => params.append('path', p));
+  if (filters.since) params.set('since', filters.since);
+  if (filters.until) params.set('until', filters.until);
+  const query = params.toString();
+  return query ? `?${query}` : '';
+}
+
+// DeepLink is the diff, file, and line encoded in /c/<id>/f/<path>#L<line>
+export interface DeepLink {
+  diffId: string;
+  path?: string;
+  line?: number;
+}
+
+export function parseDeepLink(pathname: string, hash: string): DeepLink | null {
+  const match = pathname.match(/^\/c\/([^/]+)(?:\/f\/(.+))?$/);
+  if (!match) return null;
+  const line = hash.match(/^#L(\d+)$/);
+  return {
+    diffId: decodeURIComponent(match[1]),
+    path: match[2]?.split('/').map(decodeURIComponent).join('/'),
+    line: line ? Number(line[1]) : undefined,
+  };
+}
+
+export function deepLinkPath(diffId: string, path?: string | null): string {
+  let url = `/c/${encodeURIComponent(diffId)}`;
+  if (path) {
+    url += `/f/${path.split('/').map(encodeURIComponent).join('/')}`;
+  }
+  return url;
+}
+
+// readNDJSON calls onEvent for each line of a streamed NDJSON response
+async function readNDJSON<T>(response: Response, onEvent: (event: T) => void): Promise<void> {
+  if (!response.body) return;
+  const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+  let buffered = '';
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) break;
+    buffered += value;
+    const lines = buffered.split('\n');
+    buffered = lines.pop() ?? '';
+    for (const line of lines) {
+      if (line) onEvent(JSON.parse(line));
+    }
+  }
 }
 
 export class DiffAPI {
+  // shutdown stops the server, as the quit button does
+  static async shutdown(): Promise<void> {
+    const response = await fetch(`${API_BASE}/shutdown`, { method: 'POST' });
+    if (!response.ok) {
+      throw new Error('Failed to shut down');
+    }
+  }
+
   static async getRepoInfo(): Promise<RepoInfo> {
     const response = await fetch(`${API_BASE}/repo-info`);
     if (!response.ok) {
@@ -16,40 +150,905 @@ export class DiffAPI {
     return response.json();
   }
 
-  static async getDiffs(): Promise<DiffInfo[]> {
-    const response = await fetch(`${API_BASE}/diffs`);
+  static async formatPatch(range: string, coverLetter = false): Promise<EmailPatch[]> {
+    const query = `range=${encodeURIComponent(range)}${coverLetter ? '&coverLetter=true' : ''}`;
+    const response = await fetch(`${API_BASE}/format-patch?${query}`);
+    if (!response.ok) {
+      throw new Error('Failed to format patches');
+    }
+    return response.json();
+  }
+
+  static async sendEmail(request: SendEmailRequest): Promise<{ output: string; dryRun: boolean }> {
+    const response = await fetch(`${API_BASE}/send-email`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(request),
+    });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.details || body?.error || 'Failed to send patches');
+    }
+    return response.json();
+  }
+
+  static async applyMailbox(mbox: string): Promise<{ head: string }> {
+    const response = await fetch(`${API_BASE}/am`, { method: 'POST', body: mbox });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.details || body?.error || 'Failed to apply patches');
+    }
+    return response.json();
+  }
+
+  static async squashCommit(commit: string, force = false): Promise<RewriteResult> {
+    return DiffAPI.rewriteCommit(commit, 'squash', force);
+  }
+
+  static async dropCommit(commit: string, force = false): Promise<RewriteResult> {
+    return DiffAPI.rewriteCommit(commit, 'drop', force);
+  }
+
+  // editCommit stops a rebase at commit; amend it, then continue the rebase
+  static async editCommit(commit: string, force = false): Promise<RewriteResult> {
+    return DiffAPI.rewriteCommit(commit, 'edit', force);
+  }
+
+  static async getStack(base?: string): Promise<Stack> {
+    const query = base ? `?base=${encodeURIComponent(base)}` : '';
+    const response = await fetch(`${API_BASE}/stack${query}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch stack');
+    }
+    return response.json();
+  }
+
+  // getInterdiff compares two versions of a branch, such as before and after a force-push
+  static async getInterdiff(oldRef: string, newRef: string, base?: string): Promise<Interdiff> {
+    const params = new URLSearchParams({ old: oldRef, new: newRef });
+    if (base) params.set('base', base);
+    const response = await fetch(`${API_BASE}/interdiff?${params}`);
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.error ?? 'Failed to compare branch versions');
+    }
+    return response.json();
+  }
+
+  static async getSnapshots(): Promise<Snapshot[]> {
+    const response = await fetch(`${API_BASE}/snapshots`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch snapshots');
+    }
+    return response.json();
+  }
+
+  // takeSnapshot saves the working tree; diff against it with snapshotDiffId
+  static async takeSnapshot(label: string): Promise<Snapshot> {
+    return DiffAPI.postAction('snapshots', { label });
+  }
+
+  static async deleteSnapshot(id: string): Promise<void> {
+    const response = await fetch(`${API_BASE}/snapshots/${encodeURIComponent(id)}`, { method: 'DELETE' });
+    if (!response.ok) {
+      throw new Error('Failed to delete snapshot');
+    }
+  }
+
+  static snapshotDiffId(id: string): string {
+    return `snapshot:${id}`;
+  }
+
+  // getTimeline lists automatic snapshots, recorded when the server runs with -timeline
+  static async getTimeline(): Promise<Snapshot[]> {
+    const response = await fetch(`${API_BASE}/timeline`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch timeline');
+    }
+    return response.json();
+  }
+
+  static timelineDiffId(id: string): string {
+    return `timeline:${id}`;
+  }
+
+  // getBaseline returns what was last marked as reviewed, or null if nothing has been
+  static async getBaseline(): Promise<Baseline | null> {
+    const response = await fetch(`${API_BASE}/baseline`);
+    if (response.status === 404) {
+      return null;
+    }
+    if (!response.ok) {
+      throw new Error('Failed to fetch baseline');
+    }
+    return response.json();
+  }
+
+  // markReviewed sets the baseline to ref, or to the working tree as it is now;
+  // the "baseline" diff then shows what changed since
+  static async markReviewed(ref?: string): Promise<Baseline> {
+    const response = await fetch(`${API_BASE}/baseline`, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(ref ? { ref } : {}),
+    });
+    if (!response.ok) {
+      const error = await response.json().catch(() => null);
+      throw new Error(error?.details || error?.error || 'Failed to mark as reviewed');
+    }
+    return response.json();
+  }
+
+  static async getProposals(): Promise<Proposal[]> {
+    const response = await fetch(`${API_BASE}/proposals`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch proposals');
+    }
+    return response.json();
+  }
+
+  // approveProposal writes a pending proposal's files into the working tree
+  static async approveProposal(id: string): Promise<Proposal> {
+    return DiffAPI.postAction(`proposals/${encodeURIComponent(id)}/approve`);
+  }
+
+  static async rejectProposal(id: string, reason?: string): Promise<Proposal> {
+    return DiffAPI.postAction(`proposals/${encodeURIComponent(id)}/reject`, { reason });
+  }
+
+  static proposalDiffId(id: string): string {
+    return `proposal:${id}`;
+  }
+
+  static async getToolSessions(): Promise<ToolSession[]> {
+    const response = await fetch(`${API_BASE}/tool-sessions`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch tool sessions');
+    }
+    return response.json();
+  }
+
+  // finishToolSession lets the waiting git difftool or mergetool exit; a
+  // mergetool's merged file is replaced with result, which it requires unless
+  // failed, and failed exits unsuccessfully
+  static async finishToolSession(id: string, options: { failed?: boolean; result?: ToolFile } = {}): Promise<ToolSession> {
+    return DiffAPI.postAction(`tool-sessions/${encodeURIComponent(id)}/done`, options);
+  }
+
+  static toolDiffId(id: string): string {
+    return `tool:${id}`;
+  }
+
+  // getEditorState returns the selection shared with editors; given since, it
+  // waits up to wait milliseconds for a newer one
+  static async getEditorState(since?: number, wait = 30000): Promise<EditorState> {
+    const params = new URLSearchParams();
+    if (since !== undefined) {
+      params.set('since', String(since));
+      params.set('wait', String(wait));
+    }
+    const response = await fetch(`${API_BASE}/editor/state?${params}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch editor state');
+    }
+    return response.json();
+  }
+
+  // editorGoto tells editors following along which file the reviewer is looking at
+  static async editorGoto(diff: string, path: string, line?: number): Promise<EditorState> {
+    return DiffAPI.postAction('editor/goto', { diff, path, line, source: 'differing' });
+  }
+
+  static async clearBaseline(): Promise<void> {
+    const response = await fetch(`${API_BASE}/baseline`, { method: 'DELETE' });
+    if (!response.ok) {
+      throw new Error('Failed to clear baseline');
+    }
+  }
+
+  // reorderStack replays every commit of the stack in the given order, oldest first
+  static async reorderStack(order: string[], force = false): Promise<RewriteResult> {
+    return DiffAPI.postAction(`stack/reorder${force ? '?force=true' : ''}`, { order });
+  }
+
+  static async createFixup(commit: string, options?: CommitOptions): Promise<{ head: string }> {
+    return DiffAPI.postAction(`commit/${encodeURIComponent(commit)}/fixup`, options);
+  }
+
+  static async autosquash(force = false): Promise<RewriteResult> {
+    const response = await fetch(`${API_BASE}/autosquash${force ? '?force=true' : ''}`, { method: 'POST' });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.details || body?.error || 'Failed to autosquash');
+    }
+    return response.json();
+  }
+
+  static async startSplit(commit: string, force = false): Promise<SplitState> {
+    return DiffAPI.postAction(`commits/${encodeURIComponent(commit)}/split${force ? '?force=true' : ''}`);
+  }
+
+  static async commitSplitPart(message: string, paths?: string[], trailers?: TrailerInput[], options?: CommitOptions): Promise<SplitState> {
+    return DiffAPI.postAction('split/commit', { message, paths, trailers, ...options });
+  }
+
+  static async continueSplit(): Promise<{ head: string }> {
+    return DiffAPI.postAction('split/continue');
+  }
+
+  static async abortSplit(): Promise<{ head: string }> {
+    return DiffAPI.postAction('split/abort');
+  }
+
+  static async undo(): Promise<UndoResult> {
+    return DiffAPI.postAction('undo');
+  }
+
+  // getStagedSecrets scans the staged changes for likely credentials before committing
+  static async getStagedSecrets(): Promise<SecretScan> {
+    const response = await fetch(`${API_BASE}/secrets/staged`);
+    if (!response.ok) {
+      throw new Error('Failed to scan staged changes');
+    }
+    return response.json();
+  }
+
+  static async previewClean(ignored = false, paths: string[] = []): Promise<CleanPreview> {
+    const params = new URLSearchParams();
+    if (ignored) params.set('ignored', 'true');
+    paths.forEach((p) => params.append('path', p));
+    const response = await fetch(`${API_BASE}/clean/preview?${params}`);
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.details || body?.error || 'Failed to preview clean');
+    }
+    return response.json();
+  }
+
+  static async clean(token: string, ignored = false, paths: string[] = []): Promise<{ removed: string[] }> {
+    return DiffAPI.postAction('clean', { token, ignored, paths });
+  }
+
+  static async getIgnore(file: 'gitignore' | 'exclude' = 'gitignore'): Promise<IgnoreFile> {
+    const response = await fetch(`${API_BASE}/ignore?file=${file}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch ignore file');
+    }
+    return response.json();
+  }
+
+  // getNestedRepos lists repositories inside the working tree that are not
+  // submodules; switchRepo with a root serves one on its own
+  static async getNestedRepos(): Promise<NestedRepo[]> {
+    const response = await fetch(`${API_BASE}/nested-repos`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch nested repositories');
+    }
+    return response.json();
+  }
+
+  static async addIgnorePatterns(patterns: string[], file: 'gitignore' | 'exclude' = 'gitignore'): Promise<IgnoreFile> {
+    return DiffAPI.postAction('ignore', { file, patterns });
+  }
+
+  // checkIgnore explains why a file is missing from the diff
+  static async checkIgnore(filePath: string): Promise<IgnoreMatch> {
+    const response = await fetch(`${API_BASE}/check-ignore/${filePath.split('/').map(encodeURIComponent).join('/')}`);
+    if (!response.ok) {
+      throw new Error('Failed to check ignore rules');
+    }
+    return response.json();
+  }
+
+  private static async postAction<T>(path: string, body?: unknown): Promise<T> {
+    const response = await fetch(`${API_BASE}/${path}`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (!response.ok) {
+      const error = await response.json().catch(() => null);
+      throw new Error(error?.details || error?.error || 'Request failed');
+    }
+    return response.json();
+  }
+
+  private static async rewriteCommit(commit: string, action: string, force: boolean): Promise<RewriteResult> {
+    const query = force ? '?force=true' : '';
+    const response = await fetch(`${API_BASE}/commits/${encodeURIComponent(commit)}/${action}${query}`, { method: 'POST' });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.details || body?.error || `Failed to ${action} commit`);
+    }
+    return response.json();
+  }
+
+  static bundleURL(range: string): string {
+    return `${API_BASE}/bundle?range=${encodeURIComponent(range)}`;
+  }
+
+  static async importBundle(bundle: Blob): Promise<{ refs: string[]; rejected: string[] }> {
+    const response = await fetch(`${API_BASE}/bundle`, { method: 'POST', body: bundle });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.details || body?.error || 'Failed to import bundle');
+    }
+    return response.json();
+  }
+
+  static async getRecentRepos(): Promise<RecentRepo[]> {
+    const response = await fetch(`${API_BASE}/recent-repos`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch recent repositories');
+    }
+    return response.json();
+  }
+
+  static async switchRepo(path: string): Promise<RepoInfo> {
+    const response = await fetch(`${API_BASE}/repo/switch`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ path }),
+    });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.details || body?.error || 'Failed to switch repository');
+    }
+    return response.json();
+  }
+
+  static async deepenHistory(depth?: number): Promise<{ shallow: boolean }> {
+    const response = await fetch(`${API_BASE}/deepen`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ depth }),
+    });
+    if (!response.ok) {
+      throw new Error('Failed to deepen history');
+    }
+    return response.json();
+  }
+
+  static async getDiffs(filters?: CommitFilters): Promise<DiffInfo[]> {
+    const response = await fetch(`${API_BASE}/diffs${commitFilterQuery(filters)}`);
     if (!response.ok) {
       throw new Error('Failed to fetch diffs');
     }
     return response.json();
   }
 
-  static async getDiffFiles(diffId: string): Promise<FileInfo[]> {
-    const response = await fetch(`${API_BASE}/diffs/${diffId}/files`);
+  // streamDiffs lists commits as soon as git log returns, calling onEvent
+  // again with each entry's stats as they are computed
+  static async streamDiffs(onEvent: (event: DiffListEvent) => void, filters?: CommitFilters): Promise<void> {
+    const query = commitFilterQuery(filters);
+    const response = await fetch(`${API_BASE}/diffs${query ? `${query}&` : '?'}stream=true`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch diffs');
+    }
+    await readNDJSON(response, onEvent);
+  }
+
+  static async getDiffsByType(): Promise<DiffGroup[]> {
+    const response = await fetch(`${API_BASE}/diffs?groupBy=type`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch diffs');
+    }
+    return response.json();
+  }
+
+  static async getDiffFiles(diffId: string, filters?: FileFilters): Promise<FileInfo[]> {
+    const response = await fetch(`${API_BASE}/diffs/${encodeURIComponent(diffId)}/files${filterQuery(filters)}`);
     if (!response.ok) {
       throw new Error('Failed to fetch diff files');
     }
     return response.json();
   }
 
-  static async getFileDiff(diffId: string, filePath: string): Promise<FileDiff> {
-    const response = await fetch(`${API_BASE}/file-diff/${diffId}/${filePath}`);
+  static async getDiffTree(diffId: string, filters?: FileFilters): Promise<TreeNode> {
+    const response = await fetch(`${API_BASE}/diffs/${encodeURIComponent(diffId)}/tree${filterQuery(filters)}`);
     if (!response.ok) {
-      throw new Error('Failed to fetch file diff');
+      throw new Error('Failed to fetch diff tree');
     }
     return response.json();
   }
 
-  static async saveFile(diffId: string, filePath: string, content: string): Promise<void> {
-    const response = await fetch(`${API_BASE}/file-save/${diffId}/${filePath}`, {
+  static rawURL(diffId: string, filePath: string, side: 'old' | 'new' = 'new', download = false): string {
+    const query = `side=${side}${download ? '&download=true' : ''}`;
+    return `${API_BASE}/raw/${encodeURIComponent(diffId)}/${filePath}?${query}`;
+  }
+
+  // imageDiffURL is a heatmap PNG of the pixels a changed image differs in
+  static imageDiffURL(diffId: string, filePath: string): string {
+    return `${API_BASE}/image-diff/${encodeURIComponent(diffId)}/${filePath}`;
+  }
+
+  static archiveURL(diffId: string, layout: 'new' | 'pair' = 'new'): string {
+    return `${API_BASE}/diffs/${encodeURIComponent(diffId)}/archive.zip?layout=${layout}`;
+  }
+
+  static async getSubmodule(diffId: string, path: string): Promise<SubmoduleInfo> {
+    const response = await fetch(`${API_BASE}/diffs/${encodeURIComponent(diffId)}/submodule?path=${encodeURIComponent(path)}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch submodule');
+    }
+    return response.json();
+  }
+
+  static async getSubmoduleFileDiff(diffId: string, path: string, file: string): Promise<FileDiff> {
+    const query = `path=${encodeURIComponent(path)}&file=${encodeURIComponent(file)}`;
+    const response = await fetch(`${API_BASE}/diffs/${encodeURIComponent(diffId)}/submodule/file?${query}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch submodule file diff');
+    }
+    return response.json();
+  }
+
+  static async getSymbols(diffId: string, filePath: string): Promise<SymbolOutline> {
+    const response = await fetch(`${API_BASE}/symbols/${encodeURIComponent(diffId)}/${filePath}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch symbols');
+    }
+    return response.json();
+  }
+
+  // getHighlight returns server-side highlighting tokens; an empty source means
+  // the server has no highlighter for the file and the client should highlight it
+  static async getHighlight(diffId: string, filePath: string, side: 'old' | 'new' = 'new'): Promise<HighlightedFile> {
+    const response = await fetch(`${API_BASE}/highlight/${encodeURIComponent(diffId)}/${filePath}?side=${side}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch highlighting');
+    }
+    return response.json();
+  }
+
+  // getDiagnostics resolves to null when no language server is configured
+  static async getDiagnostics(filePath: string): Promise<{ diagnostics: Diagnostic[]; pending: boolean } | null> {
+    const response = await fetch(`${API_BASE}/diagnostics/${filePath}`);
+    if (response.status === 404) {
+      return null;
+    }
+    if (!response.ok) {
+      throw new Error('Failed to fetch diagnostics');
+    }
+    return response.json();
+  }
+
+  static async getFileDiff(diffId: string, filePath: string, force = false, annotations = false, reverse = false, whitespaceCheck = false, prettify = false, table = false, tableKey = ''): Promise<FileDiff> {
+    const params = new URLSearchParams();
+    if (force) params.set('force', 'true');
+    if (annotations) params.set('annotations', 'true');
+    if (reverse) params.set('reverse', 'true');
+    if (whitespaceCheck) params.set('whitespaceCheck', 'true');
+    if (prettify) params.set('prettify', 'true');
+    if (table) params.set('table', 'true');
+    if (tableKey) params.set('key', tableKey);
+    const query = params.toString() ? `?${params}` : '';
+    const response = await fetch(`${API_BASE}/file-diff/${encodeURIComponent(diffId)}/${filePath}${query}`);
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      const details = body?.details ? `: ${body.details}` : '';
+      throw new Error(`${body?.error ?? 'Failed to fetch file diff'}${details}`);
+    }
+    return response.json();
+  }
+
+  // getDirDiff summarizes everything changed under a directory
+  static async getDirDiff(diffId: string, dirPath: string, patch = false): Promise<DirDiff> {
+    const query = patch ? '?patch=true' : '';
+    const response = await fetch(`${API_BASE}/dir-diff/${encodeURIComponent(diffId)}/${dirPath}${query}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch directory diff');
+    }
+    return response.json();
+  }
+
+  // compareFiles diffs two files given as path or path@ref
+  static async compareFiles(a: string, b: string, force = false): Promise<FileComparison> {
+    const params = new URLSearchParams({ a, b });
+    if (force) params.set('force', 'true');
+    const response = await fetch(`${API_BASE}/compare-files?${params}`);
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.error ?? 'Failed to compare files');
+    }
+    return response.json();
+  }
+
+  // compareContent diffs a file, at ref or in the working tree, against pasted text
+  static async compareContent(filePath: string, content: string, ref = ''): Promise<FileComparison> {
+    return DiffAPI.postAction(`compare-content/${filePath}`, { content, ref: ref || undefined });
+  }
+
+  // applySuggestion replaces a line range, failing with a conflict if it no longer holds original
+  static async applySuggestion(filePath: string, suggestion: SuggestionRequest): Promise<SuggestionResult> {
+    return DiffAPI.postAction(`apply-suggestion/${filePath}`, suggestion);
+  }
+
+  // fixWhitespace cleans trailing whitespace and the final newline on the lines a working tree diff adds
+  static async fixWhitespace(filePath: string, diffId = 'working'): Promise<WhitespaceFix> {
+    return DiffAPI.postAction(`fix-whitespace/${filePath}?id=${encodeURIComponent(diffId)}`);
+  }
+
+  static async getIndexFile(filePath: string): Promise<IndexFile> {
+    const response = await fetch(`${API_BASE}/index/${filePath}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch staged file');
+    }
+    return response.json();
+  }
+
+  // stageContent writes content straight to the index, leaving the working tree alone
+  static async stageContent(filePath: string, content: string, encoding?: string): Promise<IndexFile> {
+    const response = await fetch(`${API_BASE}/index/${filePath}`, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ content, encoding }),
+    });
+    if (!response.ok) {
+      const error = await response.json().catch(() => null);
+      throw new Error(error?.details || error?.error || 'Failed to stage content');
+    }
+    return response.json();
+  }
+
+  // getFileHunks continues a truncated diff from a page's nextOffset
+  static async getFileHunks(diffId: string, filePath: string, offset: number, reverse = false): Promise<HunkPage> {
+    const query = reverse ? '&reverse=true' : '';
+    const response = await fetch(`${API_BASE}/file-hunks/${encodeURIComponent(diffId)}/${filePath}?offset=${offset}${query}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch hunks');
+    }
+    return response.json();
+  }
+
+  static async saveFile(diffId: string, filePath: string, content: string, encoding?: string): Promise<void> {
+    const response = await fetch(`${API_BASE}/file-save/${encodeURIComponent(diffId)}/${filePath}`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
       },
-      body: JSON.stringify({ content }),
+      body: JSON.stringify({ content, encoding }),
     });
     if (!response.ok) {
       throw new Error('Failed to save file');
     }
   }
+
+  static async getProgress(diffId: string): Promise<ReviewProgress> {
+    const response = await fetch(`${API_BASE}/diffs/${encodeURIComponent(diffId)}/progress`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch review progress');
+    }
+    return response.json();
+  }
+
+  static async updateProgress(diffId: string, update: ProgressUpdate): Promise<ReviewProgress> {
+    const response = await fetch(`${API_BASE}/diffs/${encodeURIComponent(diffId)}/progress`, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(update),
+    });
+    if (!response.ok) {
+      throw new Error('Failed to save review progress');
+    }
+    return response.json();
+  }
+
+  static async uploadCoverage(report: string): Promise<void> {
+    const response = await fetch(`${API_BASE}/coverage`, { method: 'PUT', body: report });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.error || 'Failed to upload coverage');
+    }
+  }
+
+  static async getDiffCoverage(diffId: string): Promise<DiffCoverage> {
+    const response = await fetch(`${API_BASE}/diffs/${encodeURIComponent(diffId)}/coverage`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch coverage');
+    }
+    return response.json();
+  }
+
+  // runChecks calls onEvent for each line of the streamed check output
+  static async runChecks(diffId: string, onEvent: (event: CheckEvent) => void, checks?: string[]): Promise<void> {
+    const response = await fetch(`${API_BASE}/checks/run`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ diffId, checks }),
+    });
+    if (!response.ok) {
+      throw new Error('Failed to run checks');
+    }
+    await readNDJSON(response, onEvent);
+  }
+
+  // rebase replays commits remote branches already contain only with force
+  static async rebase(request: RebaseRequest, onEvent: (event: RebaseEvent) => void, force = false): Promise<void> {
+    const response = await fetch(`${API_BASE}/rebase${force ? '?force=true' : ''}`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(request),
+    });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.error || 'Failed to start rebase');
+    }
+    await readNDJSON(response, onEvent);
+  }
+
+  static async getRebase(): Promise<{ inProgress: boolean; conflicts: string[] }> {
+    const response = await fetch(`${API_BASE}/rebase`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch rebase state');
+    }
+    return response.json();
+  }
+
+  static async continueRebase(): Promise<{ head: string }> {
+    return DiffAPI.postAction('rebase/continue');
+  }
+
+  static async abortRebase(): Promise<{ head: string }> {
+    return DiffAPI.postAction('rebase/abort');
+  }
+
+  // merge rejects with an error carrying the conflict set when it stops
+  static async merge(request: MergeRequest): Promise<{ head: string }> {
+    const response = await fetch(`${API_BASE}/merge`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(request),
+    });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw Object.assign(new Error(body?.details || body?.error || 'Failed to merge'), { conflicts: body?.conflicts as string[] | undefined });
+    }
+    return response.json();
+  }
+
+  // continueMerge commits a stopped merge once its conflicts are resolved
+  static async continueMerge(options?: CommitOptions): Promise<{ head: string }> {
+    return DiffAPI.postAction('merge/continue', options);
+  }
+
+  static async abortMerge(): Promise<{ head: string }> {
+    return DiffAPI.postAction('merge/abort');
+  }
+
+  static async getCommit(commit: string): Promise<CommitDetails> {
+    const response = await fetch(`${API_BASE}/commits/${encodeURIComponent(commit)}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch commit');
+    }
+    return response.json();
+  }
+
+  static async getBranches(): Promise<Branch[]> {
+    const response = await fetch(`${API_BASE}/branches`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch branches');
+    }
+    return response.json();
+  }
+
+  static async createBranch(name: string, start?: string, upstream?: string): Promise<Branch> {
+    return DiffAPI.postAction('branches', { name, start, upstream });
+  }
+
+  static async renameBranch(name: string, upstream?: string): Promise<Branch> {
+    return DiffAPI.postAction('branches/rename', { name, upstream });
+  }
+
+  static async deleteBranch(name: string, force = false): Promise<void> {
+    const query = force ? '?force=true' : '';
+    const response = await fetch(`${API_BASE}/branches/${name.split('/').map(encodeURIComponent).join('/')}${query}`, { method: 'DELETE' });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.details || body?.error || 'Failed to delete branch');
+    }
+  }
+
+  static async getRemotes(): Promise<Remote[]> {
+    const response = await fetch(`${API_BASE}/remotes`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch remotes');
+    }
+    return response.json();
+  }
+
+  static async addRemote(name: string, url: string): Promise<Remote> {
+    return DiffAPI.postAction('remotes', { name, url });
+  }
+
+  static async removeRemote(name: string): Promise<void> {
+    const response = await fetch(`${API_BASE}/remotes/${encodeURIComponent(name)}`, { method: 'DELETE' });
+    if (!response.ok) {
+      throw new Error('Failed to remove remote');
+    }
+  }
+
+  static async setUpstream(upstream: string | null): Promise<void> {
+    const response = await fetch(`${API_BASE}/upstream`, upstream === null ? { method: 'DELETE' } : {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ upstream }),
+    });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.details || body?.error || 'Failed to set upstream');
+    }
+  }
+
+  static async getChurn(since?: string, limit?: number): Promise<{ since: string; files: FileChurn[] }> {
+    const params = new URLSearchParams();
+    if (since) params.set('since', since);
+    if (limit) params.set('limit', String(limit));
+    const response = await fetch(`${API_BASE}/analytics/churn?${params}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch churn');
+    }
+    return response.json();
+  }
+
+  static async getDiffRisk(diffId: string, since?: string): Promise<FileRisk[]> {
+    const query = since ? `?since=${encodeURIComponent(since)}` : '';
+    const response = await fetch(`${API_BASE}/diffs/${encodeURIComponent(diffId)}/risk${query}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch risk scores');
+    }
+    return response.json();
+  }
+
+  static async getDiffStats(diffId: string): Promise<DiffStats> {
+    const response = await fetch(`${API_BASE}/diffs/${encodeURIComponent(diffId)}/stats`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch diff stats');
+    }
+    return response.json();
+  }
+
+  static async getOwners(filePath: string): Promise<FileOwners> {
+    const response = await fetch(`${API_BASE}/owners/${filePath}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch owners');
+    }
+    return response.json();
+  }
+
+  static async getDiffOwners(diffId: string): Promise<FileOwners[]> {
+    const response = await fetch(`${API_BASE}/diffs/${encodeURIComponent(diffId)}/owners`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch owners');
+    }
+    return response.json();
+  }
+
+  static async getAffectedTests(diffId: string): Promise<AffectedTests[]> {
+    const response = await fetch(`${API_BASE}/diffs/${encodeURIComponent(diffId)}/affected-tests`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch affected tests');
+    }
+    return response.json();
+  }
+
+  static async runTests(diffId: string, onEvent: (event: TestEvent) => void, run?: string, languages?: string[]): Promise<void> {
+    const response = await fetch(`${API_BASE}/run-tests`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ diffId, run, languages }),
+    });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.error || 'Failed to run tests');
+    }
+    await readNDJSON(response, onEvent);
+  }
+
+  static async getPlugins(): Promise<Plugin[]> {
+    const response = await fetch(`${API_BASE}/plugins`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch plugins');
+    }
+    return response.json();
+  }
+
+  static async runPlugin(name: string, args: PluginArgs, onEvent: (event: PluginEvent) => void): Promise<void> {
+    const response = await fetch(`${API_BASE}/plugins/${encodeURIComponent(name)}/run`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(args),
+    });
+    if (!response.ok) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.error || 'Failed to run plugin');
+    }
+    await readNDJSON(response, onEvent);
+  }
+
+  static async runPreCommit(): Promise<HookResult> {
+    const response = await fetch(`${API_BASE}/hooks/pre-commit`, { method: 'POST' });
+    if (!response.ok) {
+      throw new Error('Failed to run pre-commit hook');
+    }
+    return response.json();
+  }
+
+  static async getCommitTemplate(): Promise<string> {
+    const response = await fetch(`${API_BASE}/commit-template`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch commit template');
+    }
+    const body = await response.json();
+    return body.template;
+  }
+
+  static async lintMessage(message: string): Promise<{ valid: boolean; issues: LintIssue[] }> {
+    const response = await fetch(`${API_BASE}/lint-message`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ message }),
+    });
+    if (!response.ok) {
+      throw new Error('Failed to lint message');
+    }
+    return response.json();
+  }
+
+  static async getPreferences(): Promise<Preferences> {
+    const response = await fetch(`${API_BASE}/preferences`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch preferences');
+    }
+    return response.json();
+  }
+
+  static async savePreferences(prefs: Preferences): Promise<Preferences> {
+    const response = await fetch(`${API_BASE}/preferences`, {
+      method: 'PUT',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify(prefs),
+    });
+    if (!response.ok) {
+      throw new Error('Failed to save preferences');
+    }
+    return response.json();
+  }
+
+  static async getNote(commit: string, ref?: string): Promise<CommitNote> {
+    const query = ref ? `?ref=${encodeURIComponent(ref)}` : '';
+    const response = await fetch(`${API_BASE}/notes/${encodeURIComponent(commit)}${query}`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch note');
+    }
+    return response.json();
+  }
+
+  static async saveNote(commit: string, note: string, ref?: string): Promise<CommitNote> {
+    const query = ref ? `?ref=${encodeURIComponent(ref)}` : '';
+    const response = await fetch(`${API_BASE}/notes/${encodeURIComponent(commit)}${query}`, {
+      method: 'PUT',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ note }),
+    });
+    if (!response.ok) {
+      throw new Error('Failed to save note');
+    }
+    return response.json();
+  }
+
+  static async approveCommit(commit: string, ref?: string): Promise<CommitNote> {
+    const query = ref ? `?ref=${encodeURIComponent(ref)}` : '';
+    const response = await fetch(`${API_BASE}/notes/${encodeURIComponent(commit)}/approve${query}`, {
+      method: 'POST',
+    });
+    if (!response.ok) {
+      throw new Error('Failed to approve commit');
+    }
+    return response.json();
+  }
 }
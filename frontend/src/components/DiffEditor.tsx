@@ -26,6 +26,14 @@ function getLanguageFromPath(path: string): string {
   return extensionToLanguageMap.get(extension) || "plaintext";
 }
 
+// isEditable reports whether fileDiff's new side holds the file's real
+// content. Files too large to load or binary, and truncated diffs carrying
+// hunks instead, come with empty content in its place, and saving that
+// would overwrite the file, so they are shown read-only.
+export function isEditable(fileDiff: FileDiff): boolean {
+  return !fileDiff.tooLarge && !fileDiff.binary && !fileDiff.truncated;
+}
+
 interface DiffEditorProps {
   fileDiff: FileDiff;
   comments: Comment[];
@@ -76,7 +84,7 @@ const DiffEditor = forwardRef<DiffEditorHandle, DiffEditorProps>(({
     modeRef.current = mode;
     if (editorRef.current) {
       const modifiedEditor = editorRef.current.getModifiedEditor();
-      modifiedEditor.updateOptions({ readOnly: mode === 'comment' });
+      modifiedEditor.updateOptions({ readOnly: mode === 'comment' || !isEditable(fileDiff) });
 
       // Clear hover decorations when switching to edit mode
       if (mode === 'edit' && hoverDecorationsRef.current.length > 0) {
@@ -198,7 +206,7 @@ const DiffEditor = forwardRef<DiffEditorHandle, DiffEditorProps>(({
     // Start in read-only mode (comment mode is default)
     const diffEditor = monaco.editor.createDiffEditor(containerRef.current, {
       theme: 'vs',
-      readOnly: modeRef.current === 'comment',
+      readOnly: modeRef.current === 'comment' || !isEditable(fileDiff),
       originalEditable: false,
       automaticLayout: true,
       renderSideBySide: true,
@@ -335,6 +343,7 @@ const DiffEditor = forwardRef<DiffEditorHandle, DiffEditorProps>(({
     addKeybindings(modifiedEditor);
     addKeybindings(originalEditor);
     modifiedEditor.onDidChangeModelContent(() => {
+      if (!isEditable(fileDiff)) return;
       const content = modifiedEditor.getValue();
       onContentChange(content);
     });
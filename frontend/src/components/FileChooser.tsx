@@ -15,6 +15,12 @@ const getStatusSymbol = (status: string) => {
       return '-';
     case 'modified':
       return '~';
+    case 'typechange':
+      return 'T';
+    case 'unmerged':
+      return 'U';
+    case 'unknown':
+      return '?';
     default:
       return '';
   }
@@ -69,6 +75,8 @@ const FileChooser: React.FC<FileChooserProps> = ({ files, selectedFile, onSelect
             {getStatusSymbol(file.status)} {file.path}
             {file.status !== 'deleted' && file.additions > 0 && ` (+${file.additions})`}
             {file.status !== 'added' && file.deletions > 0 && ` (-${file.deletions})`}
+            {file.generated && ' [generated]'}
+            {file.vendored && ' [vendored]'}
           </option>
         ))}
       </select>
@@ -6,19 +6,463 @@ export interface DiffInfo {
   filesCount: number;
   additions: number;
   deletions: number;
+  signature?: SignatureInfo;
+  boundary?: boolean;
+  links?: MessageLink[];
+  conventional?: ConventionalCommit;
+}
+
+// DiffListEvent is one line of the streamed commit list; pending entries
+// are completed by a later stats event with the same id
+export interface DiffListEvent {
+  type: 'diff' | 'stats' | 'done';
+  diff?: DiffInfo;
+  pending?: boolean;
+  id?: string;
+  filesCount?: number;
+  additions?: number;
+  deletions?: number;
+}
+
+export interface SignatureInfo {
+  status: 'good' | 'untrusted' | 'bad' | 'expired' | 'expiredKey' | 'revoked' | 'unverifiable';
+  signer?: string;
+  key?: string;
 }
 
 export interface FileInfo {
   path: string;
-  status: 'added' | 'modified' | 'deleted';
+  status: 'added' | 'modified' | 'deleted' | 'typechange' | 'unmerged' | 'unknown';
+  submodule?: boolean;
+  // oldPath is set for renames and copies
+  oldPath?: string;
+  // a symlink's content is its target
+  symlink?: boolean;
+  generated?: boolean;
+  vendored?: boolean;
+  additions: number;
+  deletions: number;
+}
+
+export interface TreeNode {
+  name: string;
+  path: string;
+  type: 'dir' | 'file';
+  file?: FileInfo;
+  children?: TreeNode[];
+  filesCount: number;
   additions: number;
   deletions: number;
 }
 
+export interface Hunk {
+  oldStart: number;
+  oldLines: number;
+  newStart: number;
+  newLines: number;
+  header?: string;
+  lines: string[];
+}
+
+// HunkPage offsets count hunk lines from the start of the file's diff
+export interface HunkPage {
+  hunks: Hunk[];
+  totalLines: number;
+  nextOffset?: number;
+}
+
 export interface FileDiff {
   path: string;
   oldContent: string;
   newContent: string;
+  submodule?: SubmoduleChange;
+  oldExists: boolean;
+  newExists: boolean;
+  tooLarge?: boolean;
+  binary?: boolean;
+  image?: ImageDiff;
+  // truncated diffs carry the first page of hunks instead of content
+  truncated?: boolean;
+  hunks?: HunkPage;
+  oldEncoding?: string;
+  newEncoding?: string;
+  // prettified content is reformatted for reading and is not saved back
+  minified?: boolean;
+  prettified?: boolean;
+  intraline?: IntralineChange[];
+  whitespace?: WhitespaceIssue[];
+  structural?: StructuralChange[];
+  structuralError?: string;
+  table?: TableDiff;
+  tableError?: string;
+  cells?: CellDiff[];
+  oldLfs?: LFSPointer;
+  newLfs?: LFSPointer;
+  coverage?: FileCoverage;
+  annotations?: LineAnnotation[];
+}
+
+// Columns count UTF-16 code units, matching JavaScript string indexes
+export interface Diagnostic {
+  line: number;
+  column: number;
+  endLine: number;
+  endColumn: number;
+  severity: 'error' | 'warning' | 'information' | 'hint';
+  message: string;
+  source?: string;
+}
+
+export interface CodeSymbol {
+  name: string;
+  kind: string;
+  line: number;
+  end?: number;
+  changed: boolean;
+}
+
+// Lines are 1-based and inclusive
+export interface LineRange {
+  start: number;
+  end: number;
+}
+
+export interface SymbolOutline {
+  path: string;
+  symbols: CodeSymbol[];
+  changed: LineRange[];
+  source: 'go' | 'ctags' | '';
+}
+
+// time is the author time in Unix seconds
+export interface LineAnnotation {
+  line: number;
+  commit: string;
+  author: string;
+  time: number;
+}
+
+export interface CellDiff {
+  oldIndex: number;
+  newIndex: number;
+  cellType: string;
+  status: 'added' | 'removed' | 'modified';
+  oldSource?: string;
+  newSource?: string;
+  oldOutputs?: string;
+  newOutputs?: string;
+}
+
+export interface ImageInfo {
+  format: string;
+  width: number;
+  height: number;
+  size: number;
+}
+
+// The heatmap at DiffAPI.imageDiffURL reports the changed pixels in its
+// X-Changed-Pixels and X-Changed-Percent headers
+export interface ImageDiff {
+  old?: ImageInfo;
+  new?: ImageInfo;
+  sizeDelta: number;
+}
+
+// Row indexes count data rows from 0 and are -1 where the row is absent
+export interface TableDiff {
+  key: string[];
+  columns: string[];
+  addedColumns?: string[];
+  removedColumns?: string[];
+  rows: RowChange[];
+  unchanged: number;
+}
+
+export interface RowChange {
+  key: string;
+  status: 'added' | 'removed' | 'modified';
+  oldIndex: number;
+  newIndex: number;
+  old?: string[];
+  new?: string[];
+  cells?: CellChange[];
+}
+
+export interface CellChange {
+  column: string;
+  old: string;
+  new: string;
+}
+
+export interface StructuralChange {
+  path: string;
+  kind: 'added' | 'removed' | 'modified';
+  old?: unknown;
+  new?: unknown;
+}
+
+// Columns are 1-based; end is exclusive
+export interface Span {
+  start: number;
+  end: number;
+}
+
+export interface IntralineChange {
+  oldLine: number;
+  newLine: number;
+  old: Span[];
+  new: Span[];
+}
+
+export interface SubmoduleChange {
+  oldCommit: string;
+  newCommit: string;
+}
+
+export interface ConventionalCommit {
+  type: string;
+  scope?: string;
+  breaking?: boolean;
+  description: string;
+}
+
+export interface CheckDiagnostic {
+  path: string;
+  line: number;
+  column?: number;
+  message: string;
+}
+
+export interface CheckEvent {
+  type: 'start' | 'output' | 'diagnostic' | 'skip' | 'exit';
+  check: string;
+  command?: string;
+  text?: string;
+  diagnostic?: CheckDiagnostic;
+  exitCode?: number;
+  error?: string;
+}
+
+export interface Contributor {
+  name: string;
+  email: string;
+  commits: number;
+}
+
+export interface FileOwners {
+  path: string;
+  owners: string[];
+  rule?: string;
+  contributors: Contributor[];
+}
+
+export interface FileChurn {
+  path: string;
+  commits: number;
+  additions: number;
+  deletions: number;
+  authors: number;
+  topAuthor: string;
+  concentration: number;
+}
+
+// score is between 0 and 1
+export interface FileRisk {
+  path: string;
+  lines: number;
+  commits: number;
+  score: number;
+}
+
+export interface StatGroup {
+  name: string;
+  files: number;
+  additions: number;
+  deletions: number;
+}
+
+// DiffStats breaks a diff down by language, extension, and kind of file
+export interface DiffStats {
+  files: number;
+  additions: number;
+  deletions: number;
+  languages: StatGroup[];
+  extensions: StatGroup[];
+  kinds: StatGroup[]; // test, code, and generated
+  largest: FileInfo[];
+}
+
+export interface AffectedTests {
+  language: string;
+  command: string;
+  targets: string[];
+}
+
+export interface TestEvent {
+  type: 'start' | 'output' | 'result' | 'exit';
+  language: string;
+  command?: string;
+  package?: string;
+  test?: string;
+  action?: 'pass' | 'fail' | 'skip';
+  elapsed?: number;
+  text?: string;
+  exitCode?: number;
+  error?: string;
+}
+
+export interface EmailPatch {
+  subject: string;
+  content: string;
+}
+
+export interface SendEmailRequest {
+  range: string;
+  to: string[];
+  cc?: string[];
+  coverLetter?: boolean;
+  coverSubject?: string; // required with coverLetter
+  coverBody?: string; // required with coverLetter
+  dryRun?: boolean;
+}
+
+export interface RebaseRequest {
+  upstream: string;
+  onto?: string;
+  autostash?: boolean;
+}
+
+export interface Remote {
+  name: string;
+  fetchUrl: string;
+  pushUrl: string;
+}
+
+export interface Branch {
+  name: string;
+  commit: string;
+  current: boolean;
+  upstream?: string;
+  merged: boolean;
+}
+
+// CommitOptions are accepted by every endpoint that makes a commit
+export interface CommitOptions {
+  noVerify?: boolean; // skip the pre-commit and commit-msg hooks
+  sign?: boolean; // sign with the configured user.signingKey
+}
+
+export interface MergeRequest extends CommitOptions {
+  source: string;
+  noFF?: boolean;
+  squash?: boolean;
+  message?: string;
+  trailers?: TrailerInput[]; // appended to message, which they require
+}
+
+export interface RebaseEvent {
+  type: 'output' | 'conflict' | 'done' | 'error';
+  text?: string;
+  conflicts?: string[];
+  head?: string;
+  error?: string;
+}
+
+export interface SplitState {
+  commit: string;
+  message: string;
+  remaining: string[];
+  secrets?: SecretFinding[];
+}
+
+export interface ReviewProgress {
+  viewed: string[];
+  totalFiles: number;
+  comments: number;
+  timeSpent: number;
+  lastFile?: string;
+  updated: string;
+}
+
+// ProgressUpdate counts are increments added to the stored totals
+export interface ProgressUpdate {
+  viewed?: string[];
+  unviewed?: string[];
+  comments?: number;
+  timeSpent?: number;
+  lastFile?: string;
+}
+
+export interface Plugin {
+  name: string;
+  command: string;
+  placeholders: ('file' | 'commit' | 'range')[];
+}
+
+export interface PluginArgs {
+  file?: string;
+  commit?: string;
+  range?: string;
+}
+
+export interface PluginEvent {
+  type: 'start' | 'output' | 'exit';
+  plugin: string;
+  text?: string;
+  exitCode?: number;
+  error?: string;
+}
+
+export interface HookResult {
+  runner: 'hook' | 'pre-commit' | 'none';
+  passed: boolean;
+  exitCode: number;
+  output: string;
+  hooks?: { name: string; status: 'Passed' | 'Failed' | 'Skipped' }[];
+}
+
+export interface LintIssue {
+  line: number;
+  rule: string;
+  message: string;
+}
+
+export interface DiffGroup {
+  key: string;
+  diffs: DiffInfo[];
+}
+
+// MessageLink offsets index the commit message string directly
+export interface MessageLink {
+  start: number;
+  end: number;
+  url: string;
+}
+
+export interface FileCoverage {
+  path?: string;
+  covered: number[];
+  uncovered: number[];
+}
+
+export interface DiffCoverage {
+  files: FileCoverage[];
+  covered: number;
+  uncovered: number;
+}
+
+export interface LFSPointer {
+  oid: string;
+  size: number;
+}
+
+export interface SubmoduleInfo {
+  path: string;
+  oldCommit: string;
+  newCommit: string;
+  checkedOut: boolean;
+  commits?: DiffInfo[];
+  files?: FileInfo[];
 }
 
 export interface Comment {
@@ -34,3 +478,303 @@ export interface Comment {
   filePath: string;      // File this comment belongs to
   diffId: string;        // Diff this comment belongs to
 }
+
+export interface DiffOptions {
+  algorithm?: 'myers' | 'minimal' | 'patience' | 'histogram';
+  context?: number;
+  functionContext?: boolean;
+  whitespace?: 'ignore-all' | 'ignore-change' | 'ignore-eol';
+}
+
+export interface ViewPreferences {
+  layout?: 'split' | 'unified';
+  tabWidth?: number;
+  wrap?: boolean;
+  theme?: 'light' | 'dark' | 'system';
+}
+
+export interface Preferences {
+  diff: DiffOptions;
+  view: ViewPreferences;
+  defaultBase?: string;
+}
+
+// ApiError is the body of every error response
+export interface ApiError {
+  code: string; // e.g. not_found, unknown_revision, git_failed, permission_denied
+  error: string;
+  details?: string;
+  git?: { args: string[]; exitCode: number; stderr: string };
+  conflicts?: string[];
+  remaining?: string[];
+  pushedTo?: string[]; // remote branches holding commits a rewrite was refused for
+  issues?: LintIssue[]; // lint problems a commit message was refused for
+}
+
+export interface Person {
+  name: string;
+  email: string;
+  date?: string; // only for authors and committers
+}
+
+// Trailer is one "Key: value" line from the end of a commit message
+export interface Trailer {
+  key: string;
+  value: string;
+  person?: Person; // for "Name <email>" values
+}
+
+// TrailerInput is a trailer to append to a new commit message, such as
+// { key: 'Co-authored-by', value: 'Name <email>' }
+export type TrailerInput = Pick<Trailer, 'key' | 'value'>;
+
+export interface CommitDetails {
+  sha: string;
+  tree: string;
+  parents: string[];
+  author: Person;
+  committer: Person;
+  subject: string;
+  body: string;
+  signature?: SignatureInfo;
+  refs: string[];
+  trailers: Trailer[];
+  links?: MessageLink[];
+  conventional?: ConventionalCommit;
+}
+
+// UndoResult describes the action POST /api/undo reverted
+export interface UndoResult {
+  action: string; // save, drop, squash, autosquash, fixup, split, rebase, merge, or am
+  path?: string;
+  head?: string;
+  remaining: number;
+}
+
+// CleanPreview lists the untracked paths git clean would remove; directories end in /
+export interface CleanPreview {
+  paths: string[];
+  token: string;
+}
+
+// IgnoreFile is the patterns in .gitignore or .git/info/exclude
+export interface IgnoreFile {
+  file: 'gitignore' | 'exclude';
+  path: string;
+  patterns: string[];
+}
+
+// IgnoreMatch names the last ignore rule matching a path, if any
+export interface IgnoreMatch {
+  path: string;
+  ignored: boolean;
+  tracked: boolean;
+  source?: string;
+  line?: number;
+  pattern?: string;
+}
+
+// DirDiff aggregates a diff's changes under one directory; patch is only
+// present when requested
+export interface DirDiff {
+  path: string;
+  filesCount: number;
+  additions: number;
+  deletions: number;
+  files: FileInfo[];
+  patch?: string;
+  truncated?: boolean;
+}
+
+// FileComparison diffs two files that may differ in path and revision;
+// path and the other FileDiff fields describe the new side
+export interface FileComparison extends FileDiff {
+  oldPath: string;
+  oldRef?: string;
+  newRef?: string;
+  additions: number;
+  deletions: number;
+}
+
+// SuggestionRequest replaces 1-based lines startLine..endLine (inclusive)
+// with replacement; endLine = startLine - 1 inserts
+export interface SuggestionRequest {
+  startLine: number;
+  endLine: number;
+  replacement: string;
+  original: string;
+  version?: string;
+}
+
+export interface SuggestionResult {
+  path: string;
+  startLine: number;
+  endLine: number;
+  version: string;
+}
+
+// IndexFile is a file's staged content; tooLarge and binary replace content
+export interface IndexFile {
+  path: string;
+  exists: boolean;
+  mode?: string;
+  sha?: string;
+  content: string;
+  encoding?: string;
+  tooLarge?: boolean;
+  binary?: boolean;
+  secrets?: SecretFinding[];
+}
+
+// SecretFinding is a likely credential on an added line; match is masked
+export interface SecretFinding {
+  path: string;
+  line: number;
+  rule: string;
+  match: string;
+}
+
+export interface SecretScan {
+  mode: 'off' | 'warn' | 'block';
+  findings: SecretFinding[];
+}
+
+// WhitespaceIssue is a whitespace problem introduced on an added line
+export interface WhitespaceIssue {
+  line: number;
+  kind: 'trailing-whitespace' | 'missing-final-newline' | 'mixed-indentation';
+}
+
+export interface WhitespaceFix {
+  path: string;
+  lines: number[];
+  version: string;
+}
+
+// StackCommit is a commit of the unpushed stack with its review state.
+// previous is its version before the last rebase; diff previous..id to see
+// what the rebase changed.
+export interface StackCommit extends DiffInfo {
+  status: 'unreviewed' | 'in-progress' | 'reviewed' | 'approved';
+  viewed: number;
+  approvedBy?: string[];
+  previous?: string;
+  rewritten?: boolean;
+}
+
+export interface Stack {
+  branch?: string;
+  base: string;
+  commits: StackCommit[];
+  previousHead?: string;
+  dropped?: string[];
+  truncated?: boolean;
+}
+
+// InterdiffCommit pairs a commit of the old series with its counterpart in
+// the new; diff holds range-diff's diff of the two patches when changed
+export interface InterdiffCommit {
+  oldIndex?: number;
+  oldCommit?: string;
+  newIndex?: number;
+  newCommit?: string;
+  status: 'unchanged' | 'changed' | 'removed' | 'added';
+  subject: string;
+  diff?: string;
+}
+
+export interface Interdiff {
+  old: string;
+  new: string;
+  base?: string;
+  commits: InterdiffCommit[];
+}
+
+// Snapshot is a saved copy of the working tree; diff against it with the
+// diff ID snapshot:<id>
+export interface Snapshot {
+  id: string;
+  label: string;
+  commit: string;
+  head?: string;
+  created: string;
+}
+
+// Baseline is what was last marked as reviewed; the "baseline" diff
+// compares it to the working tree
+export interface Baseline {
+  commit: string;
+  head?: string;
+  label: string;
+  created: string;
+}
+
+// Proposal is a set of file changes an agent is waiting to have approved;
+// diff it with the ID proposal:<id>
+export interface Proposal {
+  id: string;
+  title: string;
+  status: 'pending' | 'approved' | 'rejected';
+  files: string[];
+  base: string;
+  commit: string;
+  created: string;
+  decided?: string;
+  reason?: string;
+  secrets?: SecretFinding[];
+}
+
+export interface ToolFile {
+  content: string;
+  encoding?: string;
+}
+
+// ToolSession is a file pair sent by git difftool or mergetool, whose
+// process waits until the session is finished; diff it with the ID tool:<id>
+export interface ToolSession {
+  id: string;
+  name: string;
+  merge: boolean;
+  status: 'pending' | 'done' | 'failed';
+  local: string;
+  remote: string;
+  base?: string;
+  merged?: string;
+  created: string;
+  result?: ToolFile;
+}
+
+// EditorState is the file selected in differing or an editor extension;
+// url opens it in differing, vscode and jetbrains in those editors
+export interface EditorState {
+  seq: number;
+  commit: string;
+  path?: string;
+  line?: number;
+  inDiff: boolean;
+  source?: 'editor' | 'differing';
+  updated?: string;
+  url?: string;
+  vscode?: string;
+  jetbrains?: string;
+}
+
+export interface HighlightToken {
+  text: string;
+  class?: 'keyword' | 'type' | 'function' | 'builtin' | 'constant' | 'string' | 'number' | 'comment' | 'operator' | 'punctuation';
+}
+
+// HighlightedFile holds one token list per line of the file
+export interface HighlightedFile {
+  path: string;
+  side: 'old' | 'new';
+  lines: HighlightToken[][];
+  source: 'go' | 'chroma' | '';
+}
+
+// root is absolute, for switching to the nested repository
+export interface NestedRepo {
+  path: string;
+  root: string;
+  trackedByParent?: boolean;
+}
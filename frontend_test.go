@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestFrontend(t *testing.T) *gin.Engine {
+	t.Helper()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("console.log('app')"))
+	zw.Close()
+
+	fsys := fstest.MapFS{
+		"index.html":                    {Data: []byte("<html>app</html>")},
+		"bundle.0123456789abcdef.js":    {Data: []byte("console.log('app')")},
+		"bundle.0123456789abcdef.js.gz": {Data: gz.Bytes()},
+		"editor.worker.js":              {Data: []byte("self.onmessage = null")},
+		"monaco/min/codicon.ttf":        {Data: []byte("font")},
+	}
+	frontend, err := newFrontendHandler(fsys)
+	if err != nil {
+		t.Fatalf("newFrontendHandler() failed: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/", frontend.serve)
+	r.NoRoute(frontend.serve)
+	return r
+}
+
+func TestFrontendHandler(t *testing.T) {
+	r := newTestFrontend(t)
+
+	get := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "app") {
+		t.Fatalf("GET / = %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("index.html Cache-Control = %q", w.Header().Get("Cache-Control"))
+	}
+
+	// Client-side routes fall back to index.html
+	w = get("/some/client/route", nil)
+	if !strings.Contains(w.Body.String(), "<html>") {
+		t.Errorf("SPA fallback body = %q", w.Body.String())
+	}
+
+	w = get("/bundle.0123456789abcdef.js", nil)
+	if !strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+		t.Errorf("hashed asset Cache-Control = %q", w.Header().Get("Cache-Control"))
+	}
+	if !strings.Contains(w.Header().Get("Content-Type"), "javascript") {
+		t.Errorf("Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+
+	w = get("/bundle.0123456789abcdef.js", map[string]string{"Accept-Encoding": "gzip"})
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("precompressed asset Content-Encoding = %q", w.Header().Get("Content-Encoding"))
+	}
+
+	w = get("/monaco/min/codicon.ttf", nil)
+	if w.Header().Get("Content-Type") != "font/ttf" {
+		t.Errorf("ttf Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+
+	w = get("/editor.worker.js", map[string]string{"Range": "bytes=0-3"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "self" {
+		t.Errorf("range request = %d %q", w.Code, w.Body.String())
+	}
+
+	etag := get("/editor.worker.js", nil).Header().Get("ETag")
+	w = get("/editor.worker.js", map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %d, want 304", w.Code)
+	}
+}
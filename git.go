@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emptyTreeSHA is the object name of git's empty tree, used as the base
+// when diffing a root commit
+const emptyTreeSHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+var (
+	// gitPath is the git executable every git command runs; -git-path
+	// overrides it
+	gitPath = findGit()
+	// gitExtraEnv holds the -git-env and -git-config settings added to the
+	// environment of every subprocess
+	gitExtraEnv []string
+)
+
+// envList is a repeatable flag collecting its values in order
+type envList []string
+
+func (l *envList) String() string { return strings.Join(*l, ",") }
+
+func (l *envList) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("%q is not of the form name=value", v)
+	}
+	*l = append(*l, v)
+	return nil
+}
+
+// configureGit applies the -git-path, -git-env, and -git-config flags.
+// Config settings are passed as GIT_CONFIG_COUNT/KEY_n/VALUE_n, numbered
+// after any the environment already carries so neither set is lost.
+func configureGit(path string, env, config []string) error {
+	if path != "" {
+		resolved, err := exec.LookPath(path)
+		if err != nil {
+			return fmt.Errorf("git executable %s: %w", path, err)
+		}
+		gitPath = resolved
+	}
+	extra := append([]string(nil), env...)
+	if len(config) > 0 {
+		n, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+		for _, kv := range config {
+			key, value, _ := strings.Cut(kv, "=")
+			extra = append(extra, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", n, key), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", n, value))
+			n++
+		}
+		extra = append(extra, fmt.Sprintf("GIT_CONFIG_COUNT=%d", n))
+	}
+	gitExtraEnv = extra
+	return nil
+}
+
+// subprocessEnv returns the environment for a subprocess: differing's own,
+// which passes through variables like GIT_SSH_COMMAND, plus the configured
+// extras and env. It is nil, meaning inherit, when there is nothing to add.
+func subprocessEnv(env ...string) []string {
+	if len(gitExtraEnv) == 0 && len(env) == 0 {
+		return nil
+	}
+	return append(append(os.Environ(), gitExtraEnv...), env...)
+}
+
+// gitCommand builds the command for running git with args. Every git
+// subprocess is created here so they all see the same executable and
+// environment.
+func gitCommand(args ...string) *exec.Cmd {
+	return toolCommand(gitPath, args...)
+}
+
+// toolCommand builds the command for running a program other than git,
+// such as chroma, ctags or a hook, with the environment git gets and
+// without a console window flashing up on Windows
+func toolCommand(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Env = subprocessEnv()
+	hideConsole(cmd)
+	return cmd
+}
+
+// findGit locates git on PATH. Windows installs are often missing from the
+// PATH a GUI-launched process sees, so there `where git` and the default
+// install locations are tried too.
+func findGit() string {
+	if path, err := exec.LookPath("git"); err == nil {
+		return path
+	}
+	if runtime.GOOS != "windows" {
+		return "git"
+	}
+	if output, err := toolCommand("where", "git").Output(); err == nil {
+		if first, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n"); first != "" {
+			return strings.TrimSpace(first)
+		}
+	}
+	for _, dir := range []string{os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)"), os.Getenv("LocalAppData") + `\Programs`} {
+		path := dir + `\Git\cmd\git.exe`
+		if _, err := os.Stat(path); dir != "" && err == nil {
+			return path
+		}
+	}
+	return "git"
+}
+
+// gitError is returned by runGit when git exits unsuccessfully. It keeps
+// git's stderr so handlers can pass it on to the client.
+type gitError struct {
+	Args   []string
+	Stderr string
+	Err    error
+}
+
+func (e *gitError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("git %s: %s", strings.Join(e.Args, " "), e.Stderr)
+	}
+	return fmt.Sprintf("git %s: %v", strings.Join(e.Args, " "), e.Err)
+}
+
+func (e *gitError) Unwrap() error { return e.Err }
+
+// runGit runs git with the given arguments and returns its stdout. On
+// failure the error is a *gitError carrying the trimmed stderr. Calls
+// wait for a free slot when too many git processes are already running.
+func runGit(args ...string) ([]byte, error) {
+	return runGitInput(nil, args...)
+}
+
+// runGitInput is runGit with input supplied on stdin
+func runGitInput(input []byte, args ...string) ([]byte, error) {
+	return runGitEnv(nil, input, args...)
+}
+
+// runGitEnv is runGitInput with extra environment variables, such as
+// GIT_SEQUENCE_EDITOR for scripted rebases
+func runGitEnv(env []string, input []byte, args ...string) ([]byte, error) {
+	return runGitEnvContext(context.Background(), env, input, args...)
+}
+
+// runGitContext is runGit on behalf of the request ctx belongs to, whose
+// ID is logged with the command
+func runGitContext(ctx context.Context, args ...string) ([]byte, error) {
+	return runGitEnvContext(ctx, nil, nil, args...)
+}
+
+// runGitEnvContext is runGitEnv on behalf of the request ctx belongs to
+func runGitEnvContext(ctx context.Context, env []string, input []byte, args ...string) ([]byte, error) {
+	release := acquireGit()
+	defer release()
+	start := time.Now()
+	cmd := gitCommand(args...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	if env != nil {
+		cmd.Env = subprocessEnv(env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	duration := time.Since(start)
+	if err != nil {
+		gerr := &gitError{Args: args, Stderr: strings.TrimSpace(stderr.String()), Err: err}
+		slog.DebugContext(ctx, "git", "args", args, "duration", duration, "error", gerr.Stderr)
+		return output, gerr
+	}
+	slog.DebugContext(ctx, "git", "args", args, "duration", duration, "bytes", len(output))
+	return output, nil
+}
+
+// gitStderr returns git's stderr from err, or err's message for other errors
+func gitStderr(err error) string {
+	var gerr *gitError
+	if errors.As(err, &gerr) && gerr.Stderr != "" {
+		return gerr.Stderr
+	}
+	return err.Error()
+}
+
+// revisionExists reports whether rev resolves to a commit
+func revisionExists(rev string) bool {
+	_, err := runGit("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	return err == nil
+}
+
+// blobInfo returns the object name and size of the blob at rev:path, or
+// in the index when rev is empty. found is false when the path does not
+// exist in that revision.
+func blobInfo(rev, path string) (sha string, size int64, found bool, err error) {
+	output, err := runGitInput([]byte(rev+":"+path+"\n"), "cat-file", "--batch-check")
+	if err != nil {
+		return "", 0, false, err
+	}
+	// Format: "<sha> <type> <size>", or "<spec> missing" for absent paths
+	fields := strings.Fields(string(output))
+	if len(fields) == 3 && fields[1] == "blob" {
+		if _, err := fmt.Sscan(fields[2], &size); err != nil {
+			return "", 0, false, fmt.Errorf("unexpected cat-file output %q: %w", output, err)
+		}
+		return fields[0], size, true, nil
+	}
+	if len(fields) >= 2 && fields[len(fields)-1] == "missing" {
+		return "", 0, false, nil
+	}
+	// Trees and other non-blob objects have no file content to show
+	return "", 0, false, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBlobInfoDistinguishesAbsentFromErrors(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	sha, size, found, err := blobInfo("HEAD", "test1.go")
+	if err != nil || !found || size == 0 || len(sha) != 40 {
+		t.Errorf("blobInfo(HEAD, test1.go) = %q, %d, %v, %v", sha, size, found, err)
+	}
+
+	// test2.ts was added in the last commit, so it is absent in its parent
+	_, _, found, err = blobInfo("HEAD^", "test2.ts")
+	if err != nil {
+		t.Errorf("blobInfo() for absent path returned error: %v", err)
+	}
+	if found {
+		t.Error("blobInfo() should report test2.ts as absent in HEAD^")
+	}
+
+	if revisionExists("no-such-ref") {
+		t.Error("revisionExists(no-such-ref) = true")
+	}
+	if !revisionExists("HEAD~2") {
+		t.Error("revisionExists(HEAD~2) = false")
+	}
+	if revisionExists("HEAD~2^") {
+		t.Error("root commit should have no parent")
+	}
+}
+
+func TestRunGitCapturesStderr(t *testing.T) {
+	_, err := runGit("rev-parse", "--verify", "definitely-not-a-ref")
+	if err == nil {
+		t.Fatal("runGit() expected error")
+	}
+	if stderr := gitStderr(err); !strings.Contains(stderr, "fatal") {
+		t.Errorf("gitStderr() = %q, want git's fatal message", stderr)
+	}
+}
+
+func TestListDiffFilesPathspecs(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	// The second commit plus the working tree touches both files
+	head, err := runGit("rev-parse", "HEAD~1")
+	if err != nil {
+		t.Fatalf("rev-parse failed: %v", err)
+	}
+	spec, err := resolveDiff(strings.TrimSpace(string(head)), modeCumulative)
+	if err != nil {
+		t.Fatalf("resolveDiff() failed: %v", err)
+	}
+
+	paths := func(files []FileInfo) string {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Path)
+		}
+		return strings.Join(names, ",")
+	}
+
+	files, err := listDiffFiles(context.Background(), spec, DiffOptions{}, nil)
+	if err != nil {
+		t.Fatalf("listDiffFiles() failed: %v", err)
+	}
+	if got := paths(files); got != "test1.go,test2.ts" {
+		t.Errorf("unfiltered files = %s", got)
+	}
+
+	files, err = listDiffFiles(context.Background(), spec, DiffOptions{}, []string{":(glob)*.go"})
+	if err != nil {
+		t.Fatalf("listDiffFiles(glob) failed: %v", err)
+	}
+	if got := paths(files); got != "test1.go" {
+		t.Errorf("glob-filtered files = %s", got)
+	}
+
+	files, err = listDiffFiles(context.Background(), spec, DiffOptions{}, []string{":(exclude,glob)*.go"})
+	if err != nil {
+		t.Fatalf("listDiffFiles(exclude) failed: %v", err)
+	}
+	if got := paths(files); got != "test2.ts" {
+		t.Errorf("exclude-filtered files = %s", got)
+	}
+
+	if _, err := runGit("config", "--add", "differing.exclude", "*.ts"); err != nil {
+		t.Fatalf("git config failed: %v", err)
+	}
+	if got := defaultExcludes(); len(got) != 1 || got[0] != "*.ts" {
+		t.Errorf("defaultExcludes() = %v", got)
+	}
+}
+
+func TestConfigureGit(t *testing.T) {
+	oldPath, oldEnv := gitPath, gitExtraEnv
+	defer func() { gitPath, gitExtraEnv = oldPath, oldEnv }()
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "differing.inherited")
+	t.Setenv("GIT_CONFIG_VALUE_0", "kept")
+
+	if err := configureGit("no-such-git-binary", nil, nil); err == nil {
+		t.Error("configureGit() accepted a missing executable")
+	}
+	if err := configureGit("git", []string{"DIFFERING_TEST_ENV=set"}, []string{"differing.flagged=a=b"}); err != nil {
+		t.Fatalf("configureGit() failed: %v", err)
+	}
+
+	for key, want := range map[string]string{"differing.inherited": "kept", "differing.flagged": "a=b"} {
+		output, err := runGit("config", "--get", key)
+		if got := strings.TrimSpace(string(output)); err != nil || got != want {
+			t.Errorf("git config %s = %q, %v; want %q", key, got, err, want)
+		}
+	}
+	output, err := shellCommand(context.Background(), "echo $DIFFERING_TEST_ENV").Output()
+	if err != nil || strings.TrimSpace(string(output)) != "set" {
+		t.Errorf("shell saw DIFFERING_TEST_ENV=%q, %v", output, err)
+	}
+
+	var l envList
+	if err := l.Set("novalue"); err == nil {
+		t.Error("envList accepted a value without =")
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/scanner"
+	"go/token"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Token classes returned by the highlighter. Text outside any token, such
+// as whitespace and plain identifiers, has no class.
+const (
+	classKeyword     = "keyword"
+	classType        = "type"
+	classFunction    = "function"
+	classBuiltin     = "builtin"
+	classConstant    = "constant"
+	classString      = "string"
+	classNumber      = "number"
+	classComment     = "comment"
+	classOperator    = "operator"
+	classPunctuation = "punctuation"
+)
+
+// HighlightToken is a run of text on one line and its class
+type HighlightToken struct {
+	Text  string `json:"text"`
+	Class string `json:"class,omitempty"`
+}
+
+// HighlightedFile is the response from GET /api/highlight/:id/*filepath.
+// Lines holds each line's tokens, which join to the line's text without
+// its newline.
+type HighlightedFile struct {
+	Path  string             `json:"path"`
+	Side  string             `json:"side"`
+	Lines [][]HighlightToken `json:"lines"`
+	// Source names the highlighter used: go, chroma, or "" when none
+	// applies and the client should highlight the file itself
+	Source string `json:"source"`
+}
+
+// chromaAvailable reports whether the chroma command is installed
+var chromaAvailable = sync.OnceValue(func() bool {
+	_, err := exec.LookPath("chroma")
+	return err == nil
+})
+
+// goPredeclared classes Go's predeclared identifiers
+var goPredeclared = map[string]string{
+	"any": classType, "bool": classType, "byte": classType, "comparable": classType,
+	"complex64": classType, "complex128": classType, "error": classType,
+	"float32": classType, "float64": classType, "int": classType, "int8": classType,
+	"int16": classType, "int32": classType, "int64": classType, "rune": classType,
+	"string": classType, "uint": classType, "uint8": classType, "uint16": classType,
+	"uint32": classType, "uint64": classType, "uintptr": classType,
+
+	"true": classConstant, "false": classConstant, "iota": classConstant, "nil": classConstant,
+
+	"append": classBuiltin, "cap": classBuiltin, "clear": classBuiltin, "close": classBuiltin,
+	"complex": classBuiltin, "copy": classBuiltin, "delete": classBuiltin, "imag": classBuiltin,
+	"len": classBuiltin, "make": classBuiltin, "max": classBuiltin, "min": classBuiltin,
+	"new": classBuiltin, "panic": classBuiltin, "print": classBuiltin, "println": classBuiltin,
+	"real": classBuiltin, "recover": classBuiltin,
+}
+
+// goTokens highlights Go source with go/scanner. Source that does not
+// scan cleanly is still highlighted as far as the scanner gets.
+func goTokens(src []byte) []HighlightToken {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, src, func(token.Position, string) {}, scanner.ScanComments)
+
+	var tokens []HighlightToken
+	offset := 0
+	lastIdent := -1
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		// Semicolons inserted at line ends are not in the source
+		if tok == token.SEMICOLON && lit != ";" {
+			continue
+		}
+		start := file.Offset(pos)
+		end := start + len(tok.String())
+		if lit != "" {
+			end = start + len(lit)
+		}
+		// The scanner drops carriage returns from raw strings and
+		// comments, so find where they end in the source
+		rest := src[start:]
+		switch {
+		case tok == token.STRING && bytes.HasPrefix(rest, []byte("`")):
+			if i := bytes.IndexByte(rest[1:], '`'); i >= 0 {
+				end = start + i + 2
+			}
+		case tok == token.COMMENT && bytes.HasPrefix(rest, []byte("/*")):
+			if i := bytes.Index(rest, []byte("*/")); i >= 0 {
+				end = start + i + 2
+			}
+		case tok == token.COMMENT:
+			end = start + len(rest)
+			if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+				end = start + i
+			}
+		}
+		if start < offset || end > len(src) {
+			continue
+		}
+		text := string(src[start:end])
+
+		class := ""
+		switch {
+		case tok.IsKeyword():
+			class = classKeyword
+		case tok == token.IDENT:
+			class = goPredeclared[text]
+		case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			class = classNumber
+		case tok == token.CHAR || tok == token.STRING:
+			class = classString
+		case tok == token.COMMENT:
+			class = classComment
+		case tok == token.LPAREN && lastIdent >= 0 && tokens[lastIdent].Class == "":
+			tokens[lastIdent].Class = classFunction
+			class = classPunctuation
+		case strings.Contains("()[]{},;.:", text):
+			class = classPunctuation
+		case tok.IsOperator():
+			class = classOperator
+		}
+
+		if start > offset {
+			tokens = append(tokens, HighlightToken{Text: string(src[offset:start])})
+		}
+		lastIdent = -1
+		if tok == token.IDENT {
+			lastIdent = len(tokens)
+		}
+		tokens = append(tokens, HighlightToken{Text: text, Class: class})
+		offset = end
+	}
+	if offset < len(src) {
+		tokens = append(tokens, HighlightToken{Text: string(src[offset:])})
+	}
+	return tokens
+}
+
+// chromaClass maps a chroma token type, such as KeywordDeclaration or
+// LiteralStringDouble, to a highlight class
+func chromaClass(typ string) string {
+	switch {
+	case typ == "KeywordType":
+		return classType
+	case typ == "KeywordConstant":
+		return classConstant
+	case strings.HasPrefix(typ, "Keyword"):
+		return classKeyword
+	case strings.HasPrefix(typ, "NameFunction"):
+		return classFunction
+	case strings.HasPrefix(typ, "NameBuiltin"):
+		return classBuiltin
+	case typ == "NameClass" || typ == "NameNamespace":
+		return classType
+	case strings.HasPrefix(typ, "NameConstant"):
+		return classConstant
+	case strings.HasPrefix(typ, "LiteralString"):
+		return classString
+	case strings.HasPrefix(typ, "LiteralNumber"):
+		return classNumber
+	case strings.HasPrefix(typ, "Comment"):
+		return classComment
+	case strings.HasPrefix(typ, "Operator"):
+		return classOperator
+	case typ == "Punctuation":
+		return classPunctuation
+	}
+	return ""
+}
+
+// chromaTokens runs the chroma command over src, written to a temporary
+// file named like path so chroma picks the right lexer
+func chromaTokens(path string, src []byte) ([]HighlightToken, error) {
+	dir, err := os.MkdirTemp("", "differing-chroma-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(tmp, src, 0600); err != nil {
+		return nil, err
+	}
+	output, err := toolCommand("chroma", "--json", tmp).Output()
+	if err != nil {
+		return nil, err
+	}
+	var raw []struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, err
+	}
+	tokens := make([]HighlightToken, len(raw))
+	for i, t := range raw {
+		tokens[i] = HighlightToken{Text: t.Value, Class: chromaClass(t.Type)}
+	}
+	return tokens, nil
+}
+
+// tokenLines splits tokens at newlines into the lines of a file of count
+// lines, merging neighbours of the same class. Highlighters that add a
+// final newline do not add a line.
+func tokenLines(tokens []HighlightToken, count int) [][]HighlightToken {
+	lines := [][]HighlightToken{{}}
+	for _, t := range tokens {
+		for i, part := range strings.Split(t.Text, "\n") {
+			if i > 0 {
+				lines = append(lines, []HighlightToken{})
+			}
+			if part == "" {
+				continue
+			}
+			line := &lines[len(lines)-1]
+			if n := len(*line); n > 0 && (*line)[n-1].Class == t.Class {
+				(*line)[n-1].Text += part
+			} else {
+				*line = append(*line, HighlightToken{Text: part, Class: t.Class})
+			}
+		}
+	}
+	if len(lines) > count {
+		lines = lines[:count]
+	}
+	return lines
+}
+
+// lineCount counts the lines of src as an editor shows them
+func lineCount(src []byte) int {
+	if len(src) == 0 {
+		return 0
+	}
+	n := bytes.Count(src, []byte("\n"))
+	if src[len(src)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// getHighlight returns syntax highlighting tokens for one side of a file
+// in a diff, the new side unless ?side=old. Go is highlighted with the
+// standard library's scanner and other languages with chroma when it is
+// installed; otherwise Source is empty and so is Lines.
+func getHighlight(c *gin.Context) {
+	filePath := filePathParam(c)
+	side := c.DefaultQuery("side", "new")
+	if side != "old" && side != "new" {
+		respondError(c, http.StatusBadRequest, "side must be old or new", nil)
+		return
+	}
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+	if spec.Reverse {
+		side = map[string]string{"old": "new", "new": "old"}[side]
+	}
+
+	var data []byte
+	var found bool
+	var err error
+	if side == "new" {
+		data, found, err = newSideContent(spec, filePath)
+	} else if spec.Base != "" {
+		var sha string
+		var size int64
+		sha, size, found, err = blobInfo(spec.Base, filePath)
+		if err == nil && found && !exceedsLimit(size, false) {
+			data, err = readBlob(sha)
+		}
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read file", err)
+		return
+	}
+	if !found {
+		respondError(c, http.StatusNotFound, "File not found: "+filePath, nil)
+		return
+	}
+
+	result := HighlightedFile{Path: filePath, Side: c.DefaultQuery("side", "new"), Lines: [][]HighlightToken{}}
+	if data != nil && !isBinary(data) {
+		var tokens []HighlightToken
+		switch {
+		case strings.HasSuffix(filePath, ".go"):
+			tokens = goTokens(data)
+			result.Source = "go"
+		case chromaAvailable():
+			tokens, err = chromaTokens(filePath, data)
+			result.Source = "chroma"
+		}
+		if err != nil {
+			respondError(c, http.StatusUnprocessableEntity, "Failed to highlight file", err)
+			return
+		}
+		if tokens != nil {
+			result.Lines = tokenLines(tokens, lineCount(data))
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGoTokens(t *testing.T) {
+	src := "package main\r\n\n/* a\r\nb */\nfunc f(s string) int { return len(`x\r\ny`) + 1 } // done\n"
+	lines := tokenLines(goTokens([]byte(src)), lineCount([]byte(src)))
+	var joined []string
+	for _, line := range lines {
+		var b strings.Builder
+		for _, tok := range line {
+			b.WriteString(tok.Text)
+		}
+		joined = append(joined, b.String())
+	}
+	if want := strings.Split(strings.TrimSuffix(src, "\n"), "\n"); !reflect.DeepEqual(joined, want) {
+		t.Fatalf("lines do not rejoin to the source:\n got %q\nwant %q", joined, want)
+	}
+
+	want := []HighlightToken{
+		{"func", classKeyword}, {" ", ""}, {"f", classFunction}, {"(", classPunctuation},
+		{"s ", ""}, {"string", classType}, {")", classPunctuation}, {" ", ""},
+		{"int", classType}, {" ", ""}, {"{", classPunctuation}, {" ", ""}, {"return", classKeyword},
+		{" ", ""}, {"len", classBuiltin}, {"(", classPunctuation}, {"`x\r", classString},
+	}
+	if got := lines[4]; !reflect.DeepEqual(got, want) {
+		t.Errorf("line 5 = %+v", got)
+	}
+	if got := lines[5]; len(got) < 2 || got[0] != (HighlightToken{"y`", classString}) || got[len(got)-1] != (HighlightToken{"// done", classComment}) {
+		t.Errorf("line 6 = %+v", got)
+	}
+	if got := lines[2]; len(got) != 1 || got[0].Class != classComment {
+		t.Errorf("block comment line = %+v", got)
+	}
+}
+
+func TestChromaClass(t *testing.T) {
+	for typ, want := range map[string]string{
+		"KeywordDeclaration":  classKeyword,
+		"KeywordType":         classType,
+		"NameFunction":        classFunction,
+		"LiteralStringDouble": classString,
+		"LiteralNumberHex":    classNumber,
+		"CommentSingle":       classComment,
+		"NameOther":           "",
+		"Text":                "",
+	} {
+		if got := chromaClass(typ); got != want {
+			t.Errorf("chromaClass(%q) = %q, want %q", typ, got, want)
+		}
+	}
+}
+
+func TestGetHighlight(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/highlight/:id/*filepath", getHighlight)
+
+	os.WriteFile("test1.go", []byte("package main\n\nfunc greet() {}\n"), 0644)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/highlight/working/test1.go", nil))
+	var result HighlightedFile
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Source != "go" || len(result.Lines) != 3 || result.Lines[2][2].Text != "greet" {
+		t.Fatalf("new side = %d: %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/highlight/working/test1.go?side=old", nil))
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Side != "old" || strings.Contains(w.Body.String(), "greet") {
+		t.Errorf("old side = %d: %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/highlight/working/missing.go", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing file = %d, want 404", w.Code)
+	}
+}
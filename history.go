@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultDeepenBy is how many commits a deepen request fetches when the
+// client does not say
+const defaultDeepenBy = 50
+
+// isShallowRepo reports whether the repository is a shallow clone, in
+// which case some commits have parents that are not present locally
+func isShallowRepo() bool {
+	output, err := runGit("rev-parse", "--is-shallow-repository")
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// isPartialClone reports whether the repository was cloned with a filter,
+// so blobs may be fetched lazily from a promisor remote
+func isPartialClone() bool {
+	output, err := runGit("config", "--get", "extensions.partialClone")
+	return err == nil && strings.TrimSpace(string(output)) != ""
+}
+
+// shallowBoundary returns the commits whose parents were cut off by a
+// shallow clone. Git records them in $GIT_DIR/shallow.
+func shallowBoundary() map[string]bool {
+	output, err := runGit("rev-parse", "--git-path", "shallow")
+	if err != nil {
+		return nil
+	}
+	path := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(gitRoot, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	boundary := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if sha := strings.TrimSpace(scanner.Text()); sha != "" {
+			boundary[sha] = true
+		}
+	}
+	return boundary
+}
+
+// deepenHistory fetches more history into a shallow clone
+func deepenHistory(c *gin.Context) {
+	var req struct {
+		Depth int `json:"depth"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid request", err)
+			return
+		}
+	}
+	if req.Depth < 0 {
+		respondError(c, http.StatusBadRequest, "depth must be positive", nil)
+		return
+	}
+	if req.Depth == 0 {
+		req.Depth = defaultDeepenBy
+	}
+	if !isShallowRepo() {
+		respondError(c, http.StatusBadRequest, "Repository is not a shallow clone", nil)
+		return
+	}
+
+	if _, err := runGitContext(c.Request.Context(), "fetch", "--deepen="+strconv.Itoa(req.Depth)); err != nil {
+		respondError(c, http.StatusBadGateway, "Failed to deepen history", err)
+		return
+	}
+	// Commits that were boundaries may now have parents, changing their
+	// diffstats
+	cache.reset()
+	c.JSON(http.StatusOK, gin.H{"shallow": isShallowRepo()})
+}
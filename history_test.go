@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestShallowClone(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	cloneDir := filepath.Join(repoDir, "..", filepath.Base(repoDir)+"-shallow")
+	defer os.RemoveAll(cloneDir)
+	if output, err := exec.Command("git", "clone", "--depth=1", "file://"+repoDir, cloneDir).CombinedOutput(); err != nil {
+		t.Fatalf("shallow clone failed: %v\n%s", err, output)
+	}
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(cloneDir); err != nil {
+		t.Fatalf("Failed to change to clone: %v", err)
+	}
+	oldRoot := gitRoot
+	gitRoot = cloneDir
+	defer func() { gitRoot = oldRoot }()
+	cache.reset()
+	defer cache.reset()
+
+	if !isShallowRepo() {
+		t.Fatal("isShallowRepo() = false for a --depth=1 clone")
+	}
+
+	commits, err := loadCommits(context.Background(), logFilter{})
+	if err != nil {
+		t.Fatalf("loadCommits(context.Background(), logFilter{}) error: %v", err)
+	}
+	if len(commits) != 1 {
+		t.Fatalf("got %d commits, want 1", len(commits))
+	}
+	if !commits[0].Boundary {
+		t.Error("the only commit of a shallow clone should be a boundary")
+	}
+	if commits[0].FilesCount == 0 {
+		t.Error("boundary commit should be diffed against the empty tree")
+	}
+
+	r := gin.New()
+	r.POST("/api/deepen", deepenHistory)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/deepen", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("deepen status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]bool
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["shallow"] {
+		t.Error("deepening past the full history should leave a complete clone")
+	}
+
+	commits, err = loadCommits(context.Background(), logFilter{})
+	if err != nil {
+		t.Fatalf("loadCommits(context.Background(), logFilter{}) error: %v", err)
+	}
+	if len(commits) != 3 || commits[0].Boundary {
+		t.Errorf("after deepen got %d commits, boundary=%v", len(commits), commits[0].Boundary)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/deepen", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("deepen on a complete clone = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HookResult reports the outcome of running the pre-commit hook
+type HookResult struct {
+	Runner   string        `json:"runner"` // hook, pre-commit, or none
+	Passed   bool          `json:"passed"`
+	ExitCode int           `json:"exitCode"`
+	Output   string        `json:"output"`
+	Hooks    []HookOutcome `json:"hooks,omitempty"`
+}
+
+// HookOutcome is one hook's status as reported by the pre-commit framework
+type HookOutcome struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // Passed, Failed, Skipped
+}
+
+// CommitOptions are accepted by every endpoint that makes a commit
+type CommitOptions struct {
+	// NoVerify skips the pre-commit, pre-merge-commit and commit-msg hooks
+	NoVerify bool `json:"noVerify"`
+	// Sign signs the commit with the key configured by user.signingKey
+	// and gpg.format, as commit.gpgSign would
+	Sign bool `json:"sign"`
+}
+
+// gitArgs returns args, a git commit or merge command line, with the
+// options' flags added
+func (o CommitOptions) gitArgs(args ...string) []string {
+	if o.NoVerify {
+		args = append(args, "--no-verify")
+	}
+	if o.Sign {
+		args = append(args, "-S")
+	}
+	return args
+}
+
+// preCommitStatusLine matches the framework's "name.....Passed" lines
+var preCommitStatusLine = regexp.MustCompile(`^(.+?)\.{3,}(?:\([^)]*\))?(Passed|Failed|Skipped)$`)
+
+// parsePreCommitOutput extracts per-hook statuses from pre-commit run output
+func parsePreCommitOutput(output string) []HookOutcome {
+	var outcomes []HookOutcome
+	for _, line := range strings.Split(output, "\n") {
+		if m := preCommitStatusLine.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			outcomes = append(outcomes, HookOutcome{Name: strings.TrimSpace(m[1]), Status: m[2]})
+		}
+	}
+	return outcomes
+}
+
+// preCommitHookPath returns the pre-commit hook git would run, honouring
+// core.hooksPath, or "" if there is no executable hook
+func preCommitHookPath() string {
+	output, err := runGit("rev-parse", "--git-path", "hooks/pre-commit")
+	if err != nil {
+		return ""
+	}
+	path := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(gitRoot, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+		return ""
+	}
+	return path
+}
+
+// preCommitCommand picks how to run pre-commit checks: the pre-commit
+// framework when the repository configures it and it is installed,
+// otherwise the hook itself via git
+func preCommitCommand() (runner string, cmd *exec.Cmd) {
+	if _, err := os.Stat(filepath.Join(gitRoot, ".pre-commit-config.yaml")); err == nil {
+		if path, err := exec.LookPath("pre-commit"); err == nil {
+			return "pre-commit", toolCommand(path, "run", "--color=never")
+		}
+	}
+	if preCommitHookPath() != "" {
+		return "hook", gitCommand("hook", "run", "pre-commit")
+	}
+	return "none", nil
+}
+
+// runPreCommit runs the pre-commit hook against the staged changes without
+// committing, so the UI can tell whether a commit would be rejected. Hooks
+// that fix files in place will still modify the working tree.
+func runPreCommit(c *gin.Context) {
+	runner, cmd := preCommitCommand()
+	if cmd == nil {
+		c.JSON(http.StatusOK, HookResult{Runner: runner, Passed: true})
+		return
+	}
+	cmd.Dir = gitRoot
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	result := HookResult{Runner: runner}
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, "Failed to run pre-commit hook", err)
+		return
+	}
+	result.Passed = result.ExitCode == 0
+	result.Output = output.String()
+	if runner == "pre-commit" {
+		result.Hooks = parsePreCommitOutput(result.Output)
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParsePreCommitOutput(t *testing.T) {
+	output := "trim trailing whitespace.................................................Passed\n" +
+		"check yaml...........................................(no files to check)Skipped\n" +
+		"gofmt....................................................................Failed\n" +
+		"- hook id: gofmt\n- exit code: 1\n"
+	want := []HookOutcome{
+		{Name: "trim trailing whitespace", Status: "Passed"},
+		{Name: "check yaml", Status: "Skipped"},
+		{Name: "gofmt", Status: "Failed"},
+	}
+	got := parsePreCommitOutput(output)
+	if len(got) != len(want) {
+		t.Fatalf("parsePreCommitOutput() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("outcome %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRunPreCommit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test hook is a shell script")
+	}
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	oldRoot := gitRoot
+	gitRoot = repoDir
+	defer func() { gitRoot = oldRoot }()
+
+	r := gin.New()
+	r.POST("/api/hooks/pre-commit", runPreCommit)
+	r.POST("/api/commit/:id/fixup", createFixup)
+	run := func() HookResult {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/hooks/pre-commit", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		var result HookResult
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return result
+	}
+
+	if result := run(); result.Runner != "none" || !result.Passed {
+		t.Errorf("without a hook = %+v, want none/passed", result)
+	}
+
+	hook := filepath.Join(repoDir, ".git", "hooks", "pre-commit")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\necho 'staged files are not formatted'\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	result := run()
+	if result.Runner != "hook" || result.Passed || result.ExitCode != 1 {
+		t.Errorf("failing hook = %+v", result)
+	}
+	if !strings.Contains(result.Output, "not formatted") {
+		t.Errorf("output = %q, want the hook's message", result.Output)
+	}
+
+	// Committing runs the same hook unless noVerify skips it
+	fixup := func(body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/commit/HEAD/fixup", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	runGit("add", "test2.ts")
+	if code := fixup(""); code == http.StatusOK {
+		t.Error("fixup succeeded past a failing pre-commit hook")
+	}
+	if code := fixup(`{"noVerify":true}`); code != http.StatusOK {
+		t.Errorf("fixup with noVerify = %d, want 200", code)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxDiffLines is the most changed lines getFileDiff returns as full
+	// content; bigger diffs are sent as pages of hunks instead, unless
+	// ?force=true asks for the content anyway
+	maxDiffLines = 20000
+	// hunkPageLines is roughly how many hunk lines are sent per page
+	hunkPageLines = 5000
+)
+
+// Hunk is one hunk of a unified diff. Lines keep their leading
+// " ", "-", or "+" marker.
+type Hunk struct {
+	OldStart int      `json:"oldStart"`
+	OldLines int      `json:"oldLines"`
+	NewStart int      `json:"newStart"`
+	NewLines int      `json:"newLines"`
+	Header   string   `json:"header,omitempty"` // function context after the @@
+	Lines    []string `json:"lines"`
+}
+
+// HunkPage is a run of lines from a large diff, as hunks. A hunk split
+// across pages is sent as partial hunks with their own line ranges.
+// Offsets count hunk lines from the start of the diff; NextOffset is the
+// offset to request the following page with, or nil after the last page.
+type HunkPage struct {
+	Hunks      []Hunk `json:"hunks"`
+	TotalLines int    `json:"totalLines"`
+	NextOffset *int   `json:"nextOffset,omitempty"`
+}
+
+var fullHunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// countLines returns the number of lines in data, counting an
+// unterminated last line
+func countLines(data []byte) int {
+	n := bytes.Count(data, []byte("\n"))
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// changedLines returns how many lines a diff adds and deletes in one file
+func changedLines(spec diffSpec, filePath string) (int, error) {
+	args := append(append([]string{"diff", "--numstat", "-z"}, spec.revArgs()...), "--", filePath)
+	output, err := runGit(args...)
+	if err != nil {
+		return 0, err
+	}
+	additions, deletions, _ := parseDiffStat(string(output), nil)
+	return additions + deletions, nil
+}
+
+// fileHunks returns the hunks of one file's diff
+func fileHunks(spec diffSpec, filePath string) ([]Hunk, error) {
+	args := append([]string{"diff", "--no-color", "--no-ext-diff"}, spec.revArgs()...)
+	output, err := runGit(append(args, "--", filePath)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseHunks(output), nil
+}
+
+// parseHunks splits a single file's unified diff into hunks, skipping the
+// file header
+func parseHunks(patch []byte) []Hunk {
+	var hunks []Hunk
+	scanner := bufio.NewScanner(bytes.NewReader(patch))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := fullHunkHeader.FindStringSubmatch(line); m != nil {
+			hunks = append(hunks, Hunk{
+				OldStart: atoiDefault(m[1]),
+				OldLines: atoiDefault(m[2]),
+				NewStart: atoiDefault(m[3]),
+				NewLines: atoiDefault(m[4]),
+				Header:   m[5],
+			})
+			continue
+		}
+		if len(hunks) == 0 {
+			continue
+		}
+		h := &hunks[len(hunks)-1]
+		if line != "" && strings.ContainsRune(" -+\\", rune(line[0])) {
+			h.Lines = append(h.Lines, line)
+		}
+	}
+	return hunks
+}
+
+// hunkPage returns up to hunkPageLines lines of hunks starting offset
+// lines into the diff
+func hunkPage(hunks []Hunk, offset int) HunkPage {
+	page := HunkPage{Hunks: []Hunk{}}
+	pos := 0
+	for _, h := range hunks {
+		page.TotalLines += len(h.Lines)
+	}
+	for _, h := range hunks {
+		from, to := max(offset-pos, 0), len(h.Lines)
+		pos += len(h.Lines)
+		if from >= to {
+			continue
+		}
+		to = min(to, from+hunkPageLines-pageLines(page))
+		page.Hunks = append(page.Hunks, h.slice(from, to))
+		if pageLines(page) == hunkPageLines {
+			break
+		}
+	}
+	if next := offset + pageLines(page); next < page.TotalLines {
+		page.NextOffset = &next
+	}
+	return page
+}
+
+// atoiDefault parses a hunk header count, which defaults to 1 when omitted
+func atoiDefault(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func pageLines(page HunkPage) int {
+	n := 0
+	for _, h := range page.Hunks {
+		n += len(h.Lines)
+	}
+	return n
+}
+
+// slice returns the part of the hunk holding lines [from, to), with its
+// ranges adjusted to cover just those lines
+func (h Hunk) slice(from, to int) Hunk {
+	if from == 0 && to == len(h.Lines) {
+		return h
+	}
+	count := func(lines []string) (old, new int) {
+		for _, line := range lines {
+			switch line[0] {
+			case ' ':
+				old++
+				new++
+			case '-':
+				old++
+			case '+':
+				new++
+			}
+		}
+		return old, new
+	}
+	skipOld, skipNew := count(h.Lines[:from])
+	oldLines, newLines := count(h.Lines[from:to])
+	return Hunk{
+		OldStart: h.OldStart + skipOld,
+		OldLines: oldLines,
+		NewStart: h.NewStart + skipNew,
+		NewLines: newLines,
+		Header:   h.Header,
+		Lines:    h.Lines[from:to],
+	}
+}
+
+// getFileHunks returns a page of a file's hunks, continuing a diff that
+// getFileDiff truncated. ?offset= is the line to start from.
+func getFileHunks(c *gin.Context) {
+	filePath := filePathParam(c)
+	offset, ok := hunkOffset(c)
+	if !ok {
+		return
+	}
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+	hunks, err := fileHunks(spec, filePath)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to compute hunks", err)
+		return
+	}
+	c.JSON(http.StatusOK, hunkPage(hunks, offset))
+}
+
+// hunkOffset parses ?offset=, answering 400 when it is invalid
+func hunkOffset(c *gin.Context) (int, bool) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		respondError(c, http.StatusBadRequest, "offset must be a non-negative integer", nil)
+		return 0, false
+	}
+	return offset, true
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseHunks(t *testing.T) {
+	patch := `diff --git a/f b/f
+--- a/f
++++ b/f
+@@ -1,2 +1,2 @@ func main() {
+ keep
+-old
++new
+@@ -10 +10,0 @@
+-gone
+\ No newline at end of file
+`
+	hunks := parseHunks([]byte(patch))
+	if len(hunks) != 2 {
+		t.Fatalf("got %d hunks", len(hunks))
+	}
+	if h := hunks[0]; h.OldStart != 1 || h.OldLines != 2 || h.NewLines != 2 || h.Header != "func main() {" || len(h.Lines) != 3 {
+		t.Errorf("first hunk = %+v", h)
+	}
+	if h := hunks[1]; h.OldStart != 10 || h.OldLines != 1 || h.NewLines != 0 || len(h.Lines) != 2 {
+		t.Errorf("second hunk = %+v", h)
+	}
+}
+
+func TestHunkPageSplitsLargeHunks(t *testing.T) {
+	var lines []string
+	for i := range hunkPageLines + 10 {
+		lines = append(lines, fmt.Sprintf("+line %d", i))
+	}
+	hunks := []Hunk{
+		{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1, Lines: []string{" ctx"}},
+		{OldStart: 5, OldLines: 0, NewStart: 5, NewLines: len(lines), Lines: lines},
+	}
+
+	first := hunkPage(hunks, 0)
+	if first.TotalLines != hunkPageLines+11 || first.NextOffset == nil || *first.NextOffset != hunkPageLines {
+		t.Fatalf("first page: total %d, next %v", first.TotalLines, first.NextOffset)
+	}
+	if n := len(first.Hunks[1].Lines); n != hunkPageLines-1 {
+		t.Errorf("first page holds %d lines of the big hunk", n)
+	}
+
+	rest := hunkPage(hunks, *first.NextOffset)
+	if rest.NextOffset != nil || len(rest.Hunks) != 1 {
+		t.Fatalf("second page = %d hunks, next %v", len(rest.Hunks), rest.NextOffset)
+	}
+	if h := rest.Hunks[0]; h.NewStart != 5+hunkPageLines-1 || h.NewLines != 11 || h.Lines[0] != fmt.Sprintf("+line %d", hunkPageLines-1) {
+		t.Errorf("continued hunk = start %d, %d lines, first %q", h.NewStart, h.NewLines, h.Lines[0])
+	}
+}
+
+func TestFileDiffTruncatesHugeDiffs(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot = repoDir
+	secureRoot, err = os.OpenRoot(repoDir)
+	if err != nil {
+		t.Fatalf("Failed to open root: %v", err)
+	}
+	defer secureRoot.Close()
+
+	os.WriteFile("gen.txt", nil, 0644)
+	runGit("add", "gen.txt")
+	runGit("commit", "-q", "-m", "Add empty generated file")
+
+	var b strings.Builder
+	for i := range maxDiffLines + 1 {
+		fmt.Fprintf(&b, "generated %d\n", i)
+	}
+	os.WriteFile("gen.txt", []byte(b.String()), 0644)
+
+	r := gin.New()
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+	r.GET("/api/file-hunks/:id/*filepath", getFileHunks)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/gen.txt", nil))
+	var diff FileDiff
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if !diff.Truncated || diff.NewContent != "" || diff.Hunks == nil || diff.Hunks.NextOffset == nil {
+		t.Fatalf("huge diff not truncated: truncated=%v hunks=%v", diff.Truncated, diff.Hunks != nil)
+	}
+
+	lines := pageLines(*diff.Hunks)
+	for next := diff.Hunks.NextOffset; next != nil; {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/file-hunks/working/gen.txt?offset=%d", *next), nil))
+		var page HunkPage
+		json.Unmarshal(w.Body.Bytes(), &page)
+		lines += pageLines(page)
+		next = page.NextOffset
+	}
+	if lines != maxDiffLines+1 {
+		t.Errorf("pages held %d lines, want %d", lines, maxDiffLines+1)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/gen.txt?force=true", nil))
+	diff = FileDiff{}
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if diff.Truncated || diff.NewContent != b.String() {
+		t.Error("force=true did not return full content")
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IgnoreFile is the patterns in .gitignore or .git/info/exclude
+type IgnoreFile struct {
+	// File is "gitignore" for the shared .gitignore at the repository
+	// root, or "exclude" for the local .git/info/exclude
+	File     string   `json:"file"`
+	Path     string   `json:"path"`
+	Patterns []string `json:"patterns"`
+}
+
+// IgnoreRequest is the body of POST /api/ignore
+type IgnoreRequest struct {
+	File     string   `json:"file"`
+	Patterns []string `json:"patterns"`
+}
+
+// IgnoreMatch explains whether a path is ignored and by which rule
+type IgnoreMatch struct {
+	Path    string `json:"path"`
+	Ignored bool   `json:"ignored"`
+	// Tracked files are never ignored; git only ignores untracked ones
+	Tracked bool `json:"tracked"`
+	// Source, Line, and Pattern name the last rule matching the path,
+	// which may be a negation (!pattern) that un-ignores it
+	Source  string `json:"source,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// ignoreFilePath returns where the named ignore file lives
+func ignoreFilePath(file string) (string, error) {
+	switch file {
+	case "", "gitignore":
+		return filepath.Join(gitRoot, ".gitignore"), nil
+	case "exclude":
+		output, err := runGit("rev-parse", "--path-format=absolute", "--git-path", "info/exclude")
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+	return "", fmt.Errorf("unknown ignore file %q; use gitignore or exclude", file)
+}
+
+// readIgnoreFile returns an ignore file's lines, comments and blank lines
+// included so line numbers match check-ignore's. A missing file is empty.
+func readIgnoreFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if text == "" {
+		return []string{}, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+func getIgnore(c *gin.Context) {
+	file := c.DefaultQuery("file", "gitignore")
+	path, err := ignoreFilePath(file)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	patterns, err := readIgnoreFile(path)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read ignore file", err)
+		return
+	}
+	c.JSON(http.StatusOK, IgnoreFile{File: file, Path: path, Patterns: patterns})
+}
+
+// postIgnore appends patterns to an ignore file, skipping any it already
+// has, and returns the file as updated
+func postIgnore(c *gin.Context) {
+	var req IgnoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Patterns) == 0 {
+		respondError(c, http.StatusBadRequest, "At least one pattern is required", err)
+		return
+	}
+	if req.File == "" {
+		req.File = "gitignore"
+	}
+	path, err := ignoreFilePath(req.File)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	existing, err := readIgnoreFile(path)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read ignore file", err)
+		return
+	}
+	have := make(map[string]bool, len(existing))
+	for _, line := range existing {
+		have[line] = true
+	}
+	var added []string
+	for _, pattern := range req.Patterns {
+		if strings.TrimSpace(pattern) == "" || strings.ContainsAny(pattern, "\r\n") {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid pattern %q", pattern), nil)
+			return
+		}
+		if !have[pattern] {
+			have[pattern] = true
+			added = append(added, pattern)
+		}
+	}
+
+	if len(added) > 0 {
+		if err := appendIgnorePatterns(path, added); err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to write ignore file", err)
+			return
+		}
+	}
+	patterns, err := readIgnoreFile(path)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read ignore file", err)
+		return
+	}
+	c.JSON(http.StatusOK, IgnoreFile{File: req.File, Path: path, Patterns: patterns})
+}
+
+// appendIgnorePatterns adds lines to the end of path, first ending a last
+// line that has no newline
+func appendIgnorePatterns(path string, patterns []string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	var text strings.Builder
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		text.WriteByte('\n')
+	}
+	for _, p := range patterns {
+		text.WriteString(p + "\n")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(text.String())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// checkIgnore asks git which rule, if any, matches path
+func checkIgnore(path string) (IgnoreMatch, error) {
+	match := IgnoreMatch{Path: path}
+	_, err := runGit("ls-files", "--error-unmatch", "--", ":(literal)"+path)
+	match.Tracked = err == nil
+
+	// --no-index reports the rule even for tracked files, which git would
+	// otherwise skip; -n lists unmatched paths so exit 1 is not an error
+	output, err := runGitInput([]byte(path+"\x00"), "check-ignore", "--verbose", "--non-matching", "--no-index", "--stdin", "-z")
+	if err != nil {
+		var gitErr *gitError
+		if !errors.As(err, &gitErr) || gitErr.ExitCode() != 1 {
+			return match, err
+		}
+	}
+	// -z -v output is source, line, pattern, and path, each NUL-terminated
+	fields := strings.Split(string(output), "\x00")
+	if len(fields) < 4 || fields[0] == "" {
+		return match, nil
+	}
+	match.Source = fields[0]
+	match.Line, _ = strconv.Atoi(fields[1])
+	match.Pattern = fields[2]
+	match.Ignored = !match.Tracked && !strings.HasPrefix(match.Pattern, "!")
+	return match, nil
+}
+
+// getCheckIgnore explains why a file is or is not shown as untracked
+func getCheckIgnore(c *gin.Context) {
+	path := filePathParam(c)
+	if path == "" {
+		respondError(c, http.StatusBadRequest, "A path is required", nil)
+		return
+	}
+	// The file is usually untracked, so validateRepoPath would refuse it
+	if escapesRepo(path) {
+		respondError(c, http.StatusForbidden, fmt.Sprintf("file path outside repository: %s", path), nil)
+		return
+	}
+	match, err := checkIgnore(path)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check ignore rules", err)
+		return
+	}
+	c.JSON(http.StatusOK, match)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIgnore(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	oldRoot := gitRoot
+	defer func() { gitRoot = oldRoot }()
+	gitRoot = repoDir
+
+	// No trailing newline, so appending must first end the last line
+	os.WriteFile(".gitignore", []byte("# build output\n*.log"), 0644)
+	os.WriteFile("debug.log", []byte("x"), 0644)
+	os.WriteFile("keep.log", []byte("x"), 0644)
+	os.WriteFile("notes.txt", []byte("x"), 0644)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/ignore", getIgnore)
+	r.POST("/api/ignore", postIgnore)
+	r.GET("/api/check-ignore/*filepath", getCheckIgnore)
+
+	add := func(req IgnoreRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		httpReq := httptest.NewRequest(http.MethodPost, "/api/ignore", strings.NewReader(string(body)))
+		httpReq.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, httpReq)
+		return w
+	}
+	check := func(path string) IgnoreMatch {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/check-ignore/"+path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("check-ignore %s = %d: %s", path, w.Code, w.Body)
+		}
+		var m IgnoreMatch
+		json.Unmarshal(w.Body.Bytes(), &m)
+		return m
+	}
+
+	w := add(IgnoreRequest{Patterns: []string{"!keep.log", "*.log"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("add = %d: %s", w.Code, w.Body)
+	}
+	var file IgnoreFile
+	json.Unmarshal(w.Body.Bytes(), &file)
+	if strings.Join(file.Patterns, ",") != "# build output,*.log,!keep.log" {
+		t.Errorf("patterns = %q", file.Patterns)
+	}
+	if w := add(IgnoreRequest{Patterns: []string{"a\nb"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("multi-line pattern = %d, want 400", w.Code)
+	}
+	if w := add(IgnoreRequest{File: "global", Patterns: []string{"x"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown file = %d, want 400", w.Code)
+	}
+
+	if m := check("debug.log"); !m.Ignored || m.Source != ".gitignore" || m.Line != 2 || m.Pattern != "*.log" {
+		t.Errorf("debug.log = %+v, want ignored by .gitignore:2", m)
+	}
+	if m := check("keep.log"); m.Ignored || m.Pattern != "!keep.log" {
+		t.Errorf("keep.log = %+v, want un-ignored by !keep.log", m)
+	}
+	if m := check("notes.txt"); m.Ignored || m.Pattern != "" {
+		t.Errorf("notes.txt = %+v, want no rule", m)
+	}
+
+	if w := add(IgnoreRequest{File: "exclude", Patterns: []string{"notes.txt"}}); w.Code != http.StatusOK {
+		t.Fatalf("add to exclude = %d: %s", w.Code, w.Body)
+	}
+	if m := check("notes.txt"); !m.Ignored || !strings.HasSuffix(m.Source, "info/exclude") {
+		t.Errorf("notes.txt = %+v, want ignored by info/exclude", m)
+	}
+
+	// Tracked files match rules but are never ignored
+	runGit("add", "-f", "debug.log")
+	if m := check("debug.log"); m.Ignored || !m.Tracked || m.Pattern != "*.log" {
+		t.Errorf("tracked debug.log = %+v", m)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImagePixels bounds the images decoded for a heatmap, and the heatmap
+// itself, so a small file claiming huge dimensions cannot exhaust memory
+const maxImagePixels = 4096 * 4096
+
+// errImageTooLarge is returned by decodeImages for images over
+// maxImagePixels
+var errImageTooLarge = errors.New("image too large to compare")
+
+// ImageInfo describes one side of a changed image
+type ImageInfo struct {
+	Format string `json:"format"` // png, jpeg, gif
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int    `json:"size"`
+}
+
+// ImageDiff compares the two sides of a changed image. Old or New is nil
+// when that side is absent or not an image differing can decode. Only the
+// headers are read; GET /api/image-diff decodes the pixels to render a
+// heatmap and count the changed ones.
+type ImageDiff struct {
+	Old       *ImageInfo `json:"old,omitempty"`
+	New       *ImageInfo `json:"new,omitempty"`
+	SizeDelta int        `json:"sizeDelta"`
+}
+
+// imageInfo returns the format and dimensions of an image, or nil when
+// data is not one
+func imageInfo(data []byte) *ImageInfo {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	return &ImageInfo{Format: format, Width: config.Width, Height: config.Height, Size: len(data)}
+}
+
+// compareImages describes how an image changed, or returns nil when
+// neither side is an image
+func compareImages(oldData, newData []byte) *ImageDiff {
+	diff := &ImageDiff{Old: imageInfo(oldData), New: imageInfo(newData)}
+	if diff.Old == nil && diff.New == nil {
+		return nil
+	}
+	diff.SizeDelta = len(newData) - len(oldData)
+	return diff
+}
+
+// decodeImages decodes both sides of a changed image, checking their
+// dimensions first: each side, and the area both cover, must be within
+// maxImagePixels
+func decodeImages(oldData, newData []byte) (oldImage, newImage image.Image, err error) {
+	oldConfig, _, oldErr := image.DecodeConfig(bytes.NewReader(oldData))
+	newConfig, _, newErr := image.DecodeConfig(bytes.NewReader(newData))
+	if err := errors.Join(oldErr, newErr); err != nil {
+		return nil, nil, err
+	}
+	width := max(oldConfig.Width, newConfig.Width)
+	height := max(oldConfig.Height, newConfig.Height)
+	if width > 0 && height > maxImagePixels/width {
+		return nil, nil, fmt.Errorf("%w: %dx%d pixels", errImageTooLarge, width, height)
+	}
+	if oldImage, _, err = image.Decode(bytes.NewReader(oldData)); err != nil {
+		return nil, nil, err
+	}
+	if newImage, _, err = image.Decode(bytes.NewReader(newData)); err != nil {
+		return nil, nil, err
+	}
+	return oldImage, newImage, nil
+}
+
+// pixelDiff compares two images pixel by pixel over the area either
+// covers, counting the pixels that differ. With heatmap it also renders
+// them: unchanged pixels as a faded grey copy of the new image, changed
+// ones in red that deepens with the size of the change.
+func pixelDiff(oldImage, newImage image.Image, heatmap bool) (changed, total int, out *image.NRGBA) {
+	ob, nb := oldImage.Bounds(), newImage.Bounds()
+	width := max(ob.Dx(), nb.Dx())
+	height := max(ob.Dy(), nb.Dy())
+	if heatmap {
+		out = image.NewNRGBA(image.Rect(0, 0, width, height))
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			op := image.Point{ob.Min.X + x, ob.Min.Y + y}
+			np := image.Point{nb.Min.X + x, nb.Min.Y + y}
+			inOld, inNew := op.In(ob), np.In(nb)
+			var oc, nc color.NRGBA
+			if inOld {
+				oc = color.NRGBAModel.Convert(oldImage.At(op.X, op.Y)).(color.NRGBA)
+			}
+			if inNew {
+				nc = color.NRGBAModel.Convert(newImage.At(np.X, np.Y)).(color.NRGBA)
+			}
+			delta := 255
+			if inOld && inNew {
+				delta = max(absDiff(oc.R, nc.R), absDiff(oc.G, nc.G), absDiff(oc.B, nc.B), absDiff(oc.A, nc.A))
+			}
+			if delta > 0 {
+				changed++
+			}
+			if !heatmap {
+				continue
+			}
+			if delta > 0 {
+				// Even the smallest change stays visible against the grey
+				fade := uint8(200 - delta*200/255)
+				out.SetNRGBA(x, y, color.NRGBA{255, fade, fade, 255})
+			} else {
+				gray := color.GrayModel.Convert(nc).(color.Gray).Y
+				// Transparent pixels fade to white too
+				gray = uint8(255 - (255-int(gray))*int(nc.A)/255/4)
+				out.SetNRGBA(x, y, color.NRGBA{gray, gray, gray, 255})
+			}
+		}
+	}
+	return changed, width * height, out
+}
+
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+// getImageDiff renders a heatmap PNG of the pixels that differ between
+// the two sides of a changed image. X-Changed-Pixels counts the pixels
+// that differ in any channel, over the area either side covers, so a
+// resize counts the difference in area as changed; X-Changed-Percent is
+// their share of that area.
+func getImageDiff(c *gin.Context) {
+	filePath := filePathParam(c)
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var oldData []byte
+	if spec.Base != "" {
+		sha, size, found, err := blobInfo(spec.Base, filePath)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to read old file version", err)
+			return
+		}
+		if found && exceedsLimit(size, false) {
+			respondError(c, http.StatusRequestEntityTooLarge, "Image too large to compare: "+filePath, nil)
+			return
+		}
+		if found {
+			if oldData, err = readBlob(sha); err != nil {
+				respondError(c, http.StatusInternalServerError, "Failed to read old file version", err)
+				return
+			}
+		}
+	}
+	size, err := newSideSize(spec, filePath)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read new file version", err)
+		return
+	}
+	if exceedsLimit(size, false) {
+		respondError(c, http.StatusRequestEntityTooLarge, "Image too large to compare: "+filePath, nil)
+		return
+	}
+	newData, _, err := newSideContent(spec, filePath)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read new file version", err)
+		return
+	}
+	if spec.Reverse {
+		oldData, newData = newData, oldData
+	}
+
+	oldImage, newImage, err := decodeImages(oldData, newData)
+	if errors.Is(err, errImageTooLarge) {
+		respondError(c, http.StatusRequestEntityTooLarge, "Image too large to compare: "+filePath, err)
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, "Both sides must be PNG, JPEG or GIF images: "+filePath, nil)
+		return
+	}
+	changed, total, heatmap := pixelDiff(oldImage, newImage, true)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, heatmap); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to encode heatmap", err)
+		return
+	}
+	c.Header("X-Changed-Pixels", strconv.Itoa(changed))
+	if total > 0 {
+		c.Header("X-Changed-Percent", strconv.FormatFloat(float64(changed)*100/float64(total), 'f', -1, 64))
+	}
+	c.Data(http.StatusOK, "image/png", buf.Bytes())
+}
+
+// newSideSize returns the size of a file on the new side of a diff, or 0
+// when it is absent there
+func newSideSize(spec diffSpec, path string) (int64, error) {
+	if spec.newSideInGit() {
+		_, size, _, err := blobInfo(spec.Head, path)
+		return size, err
+	}
+	info, err := secureRoot.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testPNG encodes a w×h white image with the pixels in red painted red
+func testPNG(t *testing.T, w, h int, red ...image.Point) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+		}
+	}
+	for _, p := range red {
+		img.SetNRGBA(p.X, p.Y, color.NRGBA{255, 0, 0, 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompareImages(t *testing.T) {
+	oldData := testPNG(t, 4, 5)
+	newData := testPNG(t, 4, 5, image.Pt(1, 1), image.Pt(2, 3))
+
+	diff := compareImages(oldData, newData)
+	if diff == nil || diff.Old == nil || diff.New == nil {
+		t.Fatalf("compareImages() = %+v", diff)
+	}
+	if diff.New.Format != "png" || diff.New.Width != 4 || diff.New.Height != 5 {
+		t.Errorf("new = %+v", diff.New)
+	}
+	if diff.SizeDelta != len(newData)-len(oldData) {
+		t.Errorf("sizeDelta = %d", diff.SizeDelta)
+	}
+
+	// Growing the image changes the new area
+	oldImage, newImage, err := decodeImages(testPNG(t, 2, 2), testPNG(t, 2, 4))
+	if err != nil {
+		t.Fatalf("decodeImages() failed: %v", err)
+	}
+	if changed, total, _ := pixelDiff(oldImage, newImage, false); changed != 4 || total != 8 {
+		t.Errorf("resize changed %d of %d pixels, want 4 of 8", changed, total)
+	}
+	if diff := compareImages(nil, newData); diff == nil || diff.Old != nil || diff.SizeDelta != len(newData) {
+		t.Errorf("added image = %+v", diff)
+	}
+	if diff := compareImages([]byte("\x00not an image"), []byte("\x00still not")); diff != nil {
+		t.Errorf("non-image = %+v", diff)
+	}
+
+	// The dimensions are checked before any pixels are decoded
+	wide, tall := testPNG(t, maxImagePixels/2, 1), testPNG(t, 1, 3)
+	if _, _, err := decodeImages(wide, tall); !errors.Is(err, errImageTooLarge) {
+		t.Errorf("decodeImages() of an oversized area = %v, want errImageTooLarge", err)
+	}
+}
+
+func TestImageDiffHeatmap(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	os.WriteFile("logo.png", testPNG(t, 3, 3), 0644)
+	exec.Command("git", "add", "logo.png").Run()
+	exec.Command("git", "commit", "-m", "Add logo").Run()
+	os.WriteFile("logo.png", testPNG(t, 3, 3, image.Pt(0, 2)), 0644)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+	r.GET("/api/image-diff/:id/*filepath", getImageDiff)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/logo.png", nil))
+	var diff FileDiff
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if !diff.Binary || diff.Image == nil || diff.Image.New == nil || diff.Image.New.Width != 3 {
+		t.Fatalf("file diff = %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/image-diff/working/logo.png", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("heatmap = %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("X-Changed-Pixels") != "1" {
+		t.Errorf("X-Changed-Pixels = %q, want 1", w.Header().Get("X-Changed-Pixels"))
+	}
+	heatmap, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("heatmap is not a PNG: %v", err)
+	}
+	changed := color.NRGBAModel.Convert(heatmap.At(0, 2)).(color.NRGBA)
+	unchanged := color.NRGBAModel.Convert(heatmap.At(1, 1)).(color.NRGBA)
+	if changed.R != 255 || changed.G == 255 || unchanged.R != unchanged.G {
+		t.Errorf("changed pixel %v, unchanged %v", changed, unchanged)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/image-diff/working/test2.ts", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("heatmap of a text file = %d, want 422", w.Code)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Interdiff statuses, from the markers git range-diff prints
+const (
+	interdiffUnchanged = "unchanged" // =
+	interdiffChanged   = "changed"   // !
+	interdiffRemoved   = "removed"   // <, only in the old series
+	interdiffAdded     = "added"     // >, only in the new series
+)
+
+var interdiffStatuses = map[string]string{
+	"=": interdiffUnchanged,
+	"!": interdiffChanged,
+	"<": interdiffRemoved,
+	">": interdiffAdded,
+}
+
+// rangeDiffHeader matches a pair line of git range-diff output, such as
+// "3:  29b5a96 ! 3:  1d8dcc7 add e" or "-:  ------- > 1:  7fe271a add b"
+var rangeDiffHeader = regexp.MustCompile(`^\s*(-|\d+):\s+(-+|[0-9a-f]+)\s+([=!<>])\s+(-|\d+):\s+(-+|[0-9a-f]+)\s?(.*)$`)
+
+// InterdiffCommit pairs a commit of the old series with its counterpart
+// in the new one. Indexes are 1-based positions in each series; the
+// missing side of an added or removed commit has index 0 and no commit.
+type InterdiffCommit struct {
+	OldIndex  int    `json:"oldIndex,omitempty"`
+	OldCommit string `json:"oldCommit,omitempty"`
+	NewIndex  int    `json:"newIndex,omitempty"`
+	NewCommit string `json:"newCommit,omitempty"`
+	Status    string `json:"status"`
+	Subject   string `json:"subject"`
+	// Diff is range-diff's diff between the two patches of a changed
+	// commit: each line has the interdiff's marker before the patch's own
+	Diff string `json:"diff,omitempty"`
+}
+
+// Interdiff compares two versions of a patch series
+type Interdiff struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+	// Base is the commit both series were cut from; "" when each series
+	// is everything since the merge base of Old and New
+	Base    string            `json:"base,omitempty"`
+	Commits []InterdiffCommit `json:"commits"`
+}
+
+// parseRangeDiff parses git range-diff output. Commit names are left as
+// printed, abbreviated.
+func parseRangeDiff(output []byte) ([]InterdiffCommit, error) {
+	commits := []InterdiffCommit{}
+	var diff strings.Builder
+	flush := func() {
+		if len(commits) > 0 && diff.Len() > 0 {
+			commits[len(commits)-1].Diff = diff.String()
+		}
+		diff.Reset()
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := rangeDiffHeader.FindStringSubmatch(line); m != nil {
+			flush()
+			commit := InterdiffCommit{Status: interdiffStatuses[m[3]], Subject: m[6]}
+			if m[1] != "-" {
+				commit.OldIndex, _ = strconv.Atoi(m[1])
+				commit.OldCommit = m[2]
+			}
+			if m[4] != "-" {
+				commit.NewIndex, _ = strconv.Atoi(m[4])
+				commit.NewCommit = m[5]
+			}
+			commits = append(commits, commit)
+			continue
+		}
+		// The patch diff is indented four spaces under its pair
+		if body, ok := strings.CutPrefix(line, "    "); ok && len(commits) > 0 {
+			diff.WriteString(body)
+			diff.WriteByte('\n')
+		}
+	}
+	flush()
+	return commits, scanner.Err()
+}
+
+// rangeDiff runs git range-diff between oldTip and newTip, cut from base when it
+// is set or else from their merge base
+func rangeDiff(base, oldTip, newTip string) ([]InterdiffCommit, error) {
+	args := []string{"range-diff", "--no-color"}
+	if base != "" {
+		args = append(args, base, oldTip, newTip)
+	} else {
+		args = append(args, oldTip+"..."+newTip)
+	}
+	output, err := runGit(args...)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := parseRangeDiff(output)
+	if err != nil {
+		return nil, err
+	}
+	// range-diff abbreviates commit names; expand them for linking to diffs
+	for i := range commits {
+		if commits[i].OldCommit != "" {
+			commits[i].OldCommit, _ = resolveRev(commits[i].OldCommit)
+		}
+		if commits[i].NewCommit != "" {
+			commits[i].NewCommit, _ = resolveRev(commits[i].NewCommit)
+		}
+	}
+	return commits, nil
+}
+
+// getInterdiff compares two versions of a branch, as before and after a
+// force-push, matching up their commits with git range-diff
+func getInterdiff(c *gin.Context) {
+	if c.Query("old") == "" || c.Query("new") == "" {
+		respondError(c, http.StatusBadRequest, "old and new refs are required", nil)
+		return
+	}
+	var result Interdiff
+	var err error
+	refs := []struct {
+		name string
+		dst  *string
+	}{{"old", &result.Old}, {"new", &result.New}, {"base", &result.Base}}
+	for _, ref := range refs {
+		if value := c.Query(ref.name); value != "" {
+			if *ref.dst, err = resolveRev(value); err != nil {
+				respondError(c, http.StatusNotFound, err.Error(), err)
+				return
+			}
+		}
+	}
+
+	if result.Base == "" {
+		if _, err := runGitContext(c.Request.Context(), "merge-base", result.Old, result.New); err != nil {
+			respondError(c, http.StatusBadRequest, "old and new have no merge base; pass base", nil)
+			return
+		}
+	}
+
+	result.Commits, err = rangeDiff(result.Base, result.Old, result.New)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to compare the series", err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseRangeDiff(t *testing.T) {
+	output := "1:  9141f2f < -:  ------- add b\n" +
+		"-:  ------- > 1:  7fe271a add d\n" +
+		"2:  29b5a96 ! 2:  1d8dcc7 add e\n" +
+		"    @@ e (new)\n" +
+		"     +l2\n" +
+		"    -+l3\n" +
+		"    ++X\n" +
+		"3:  aaaaaaa = 3:  bbbbbbb add f\n"
+	commits, err := parseRangeDiff([]byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InterdiffCommit{
+		{OldIndex: 1, OldCommit: "9141f2f", Status: interdiffRemoved, Subject: "add b"},
+		{NewIndex: 1, NewCommit: "7fe271a", Status: interdiffAdded, Subject: "add d"},
+		{OldIndex: 2, OldCommit: "29b5a96", NewIndex: 2, NewCommit: "1d8dcc7", Status: interdiffChanged, Subject: "add e",
+			Diff: "@@ e (new)\n +l2\n-+l3\n++X\n"},
+		{OldIndex: 3, OldCommit: "aaaaaaa", NewIndex: 3, NewCommit: "bbbbbbb", Status: interdiffUnchanged, Subject: "add f"},
+	}
+	if len(commits) != len(want) {
+		t.Fatalf("got %d commits: %+v", len(commits), commits)
+	}
+	for i := range want {
+		if commits[i] != want[i] {
+			t.Errorf("commit %d = %+v, want %+v", i, commits[i], want[i])
+		}
+	}
+}
+
+func TestGetInterdiff(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	// Commit a file, then amend one of its lines
+	runGit("checkout", "--", "test2.ts")
+	base, _ := resolveRev("HEAD")
+	os.WriteFile("list.txt", []byte("a\nb\nc\nd\ne\n"), 0644)
+	runGit("add", "list.txt")
+	runGit("commit", "--quiet", "-m", "Add list")
+	oldTip, _ := resolveRev("HEAD")
+	os.WriteFile("list.txt", []byte("a\nb\nC\nd\ne\n"), 0644)
+	runGit("commit", "--quiet", "--all", "--amend", "--no-edit")
+	newTip, _ := resolveRev("HEAD")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/interdiff", getInterdiff)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/interdiff?old="+oldTip+"&new="+newTip+"&base="+base, nil))
+	var result Interdiff
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || len(result.Commits) != 1 {
+		t.Fatalf("interdiff = %d: %s", w.Code, w.Body)
+	}
+	if c := result.Commits[0]; c.Status != interdiffChanged || c.OldCommit != oldTip || c.NewCommit != newTip || c.Diff == "" {
+		t.Errorf("commit = %+v", c)
+	}
+
+	// Without a base, the series start from the merge base
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/interdiff?old="+oldTip+"&new="+newTip, nil))
+	if json.Unmarshal(w.Body.Bytes(), &result); w.Code != http.StatusOK || len(result.Commits) != 1 {
+		t.Errorf("interdiff from merge base = %d: %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/interdiff?old=nope&new=HEAD", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown ref = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Span is a changed region within a line, as 1-based start and exclusive
+// end columns counted in UTF-16 code units to match Monaco's positions.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// IntralineChange pairs a removed line with the line that replaced it and
+// marks the words that differ on each side.
+type IntralineChange struct {
+	OldLine int    `json:"oldLine"`
+	NewLine int    `json:"newLine"`
+	Old     []Span `json:"old"`
+	New     []Span `json:"new"`
+}
+
+// intralineChanges diffs old and new by line, then pairs up lines within
+// each replaced block in order and diffs each pair word by word.
+func intralineChanges(oldText, newText string) []IntralineChange {
+	dmp := diffmatchpatch.New()
+	a, b, lines := dmp.DiffLinesToRunes(oldText, newText)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMainRunes(a, b, false), lines)
+
+	var changes []IntralineChange
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(diffs); i++ {
+		d := diffs[i]
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			n := len(splitLines(d.Text))
+			oldLine += n
+			newLine += n
+		case diffmatchpatch.DiffInsert:
+			newLine += len(splitLines(d.Text))
+		case diffmatchpatch.DiffDelete:
+			removed := splitLines(d.Text)
+			if i+1 < len(diffs) && diffs[i+1].Type == diffmatchpatch.DiffInsert {
+				added := splitLines(diffs[i+1].Text)
+				for j := 0; j < len(removed) && j < len(added); j++ {
+					oldSpans, newSpans, related := wordDiff(dmp, removed[j], added[j])
+					if related {
+						changes = append(changes, IntralineChange{
+							OldLine: oldLine + j,
+							NewLine: newLine + j,
+							Old:     oldSpans,
+							New:     newSpans,
+						})
+					}
+				}
+				newLine += len(added)
+				i++
+			}
+			oldLine += len(removed)
+		}
+	}
+	return changes
+}
+
+// splitLines splits text into lines without their terminators
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, "\r\n")
+	}
+	return lines
+}
+
+// wordDiff diffs two lines at word granularity. related is false when the
+// lines share no words, in which case highlighting within them is noise.
+func wordDiff(dmp *diffmatchpatch.DiffMatchPatch, oldLine, newLine string) (oldSpans, newSpans []Span, related bool) {
+	oldWords, newWords := tokenizeWords(oldLine), tokenizeWords(newLine)
+
+	// Map each distinct word to a rune so the character differ works on words
+	ids := make(map[string]rune)
+	encode := func(words []string) []rune {
+		out := make([]rune, len(words))
+		for i, w := range words {
+			id, ok := ids[w]
+			if !ok {
+				id = rune(0xE000 + len(ids)) // private use area, clear of surrogates
+				ids[w] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	a, b := encode(oldWords), encode(newWords)
+
+	oldCol, newCol := 1, 1
+	oldIdx, newIdx := 0, 0
+	for _, d := range dmp.DiffMainRunes(a, b, false) {
+		n := len([]rune(d.Text))
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			for k := 0; k < n; k++ {
+				if strings.TrimSpace(oldWords[oldIdx]) != "" {
+					related = true
+				}
+				oldCol += utf16Len(oldWords[oldIdx])
+				newCol += utf16Len(newWords[newIdx])
+				oldIdx++
+				newIdx++
+			}
+		case diffmatchpatch.DiffDelete:
+			start := oldCol
+			for k := 0; k < n; k++ {
+				oldCol += utf16Len(oldWords[oldIdx])
+				oldIdx++
+			}
+			oldSpans = appendSpan(oldSpans, Span{Start: start, End: oldCol})
+		case diffmatchpatch.DiffInsert:
+			start := newCol
+			for k := 0; k < n; k++ {
+				newCol += utf16Len(newWords[newIdx])
+				newIdx++
+			}
+			newSpans = appendSpan(newSpans, Span{Start: start, End: newCol})
+		}
+	}
+	return oldSpans, newSpans, related
+}
+
+// appendSpan adds s, merging it into the previous span when they touch
+func appendSpan(spans []Span, s Span) []Span {
+	if n := len(spans); n > 0 && spans[n-1].End == s.Start {
+		spans[n-1].End = s.End
+		return spans
+	}
+	return append(spans, s)
+}
+
+// tokenizeWords splits a line into runs of word characters, runs of
+// whitespace, and individual punctuation characters
+func tokenizeWords(line string) []string {
+	var tokens []string
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		j := i + 1
+		switch {
+		case isWordRune(runes[i]):
+			for j < len(runes) && isWordRune(runes[j]) {
+				j++
+			}
+		case unicode.IsSpace(runes[i]):
+			for j < len(runes) && unicode.IsSpace(runes[j]) {
+				j++
+			}
+		}
+		tokens = append(tokens, string(runes[i:j]))
+		i = j
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// utf16Len returns the length of s in UTF-16 code units
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestIntralineChanges(t *testing.T) {
+	oldText := "package main\n\nfunc hello() {}\nvar x = 1\n"
+	newText := "package main\n\nfunc hello() string {}\nvar x = 2\nadded line\n"
+
+	changes := intralineChanges(oldText, newText)
+	if len(changes) != 2 {
+		t.Fatalf("intralineChanges() returned %d changes, want 2: %+v", len(changes), changes)
+	}
+
+	first := changes[0]
+	if first.OldLine != 3 || first.NewLine != 3 {
+		t.Errorf("first change lines = %d/%d, want 3/3", first.OldLine, first.NewLine)
+	}
+	if len(first.Old) != 0 {
+		t.Errorf("first change old spans = %+v, want none", first.Old)
+	}
+	// "func hello() string {}": "string " is inserted at column 14
+	if len(first.New) != 1 || first.New[0] != (Span{Start: 14, End: 21}) {
+		t.Errorf("first change new spans = %+v, want [{14 21}]", first.New)
+	}
+
+	second := changes[1]
+	if second.OldLine != 4 || second.NewLine != 4 {
+		t.Errorf("second change lines = %d/%d, want 4/4", second.OldLine, second.NewLine)
+	}
+	if len(second.Old) != 1 || second.Old[0] != (Span{Start: 9, End: 10}) {
+		t.Errorf("second change old spans = %+v, want [{9 10}]", second.Old)
+	}
+}
+
+func TestWordDiffUnrelatedLines(t *testing.T) {
+	changes := intralineChanges("alpha\n", "omega\n")
+	if len(changes) != 0 {
+		t.Errorf("unrelated lines should not get intraline spans: %+v", changes)
+	}
+}
+
+func TestUTF16Columns(t *testing.T) {
+	// The emoji occupies two UTF-16 code units
+	changes := intralineChanges("😀 a\n", "😀 b\n")
+	if len(changes) != 1 || changes[0].Old[0] != (Span{Start: 4, End: 5}) {
+		t.Errorf("spans after a surrogate pair = %+v", changes)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jsonUsage describes the json command's arguments
+const jsonUsage = "json takes diffs, files <id> or file-diff <id> <path>, then any key=value query parameters"
+
+// jsonRequest maps the json command's arguments to the API request that
+// answers them, returning the rest as query parameters
+func jsonRequest(args []string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, errors.New(jsonUsage)
+	}
+	switch {
+	case args[0] == "diffs":
+		return "/api/diffs", args[1:], nil
+	case args[0] == "files" && len(args) >= 2:
+		return "/api/diffs/" + url.PathEscape(args[1]) + "/files", args[2:], nil
+	case args[0] == "file-diff" && len(args) >= 3:
+		segments := strings.Split(repoPath(args[2]), "/")
+		for i, s := range segments {
+			segments[i] = url.PathEscape(s)
+		}
+		return "/api/file-diff/" + url.PathEscape(args[1]) + "/" + strings.Join(segments, "/"), args[3:], nil
+	}
+	return "", nil, errors.New(jsonUsage)
+}
+
+// runJSON answers an API request in-process and writes its JSON body to
+// out, for scripts that want differing's output without a server. An
+// error response is written too, and returned as an error.
+func runJSON(args []string, out io.Writer) error {
+	path, params, err := jsonRequest(args)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	for _, param := range params {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return fmt.Errorf("query parameter %q is not key=value", param)
+		}
+		query.Add(key, value)
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	// The same handlers as the server, without its logging and tracking
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.UseRawPath = true
+	r.UnescapePathValues = true
+	r.GET("/api/diffs", getDiffs)
+	r.GET("/api/diffs/:id/files", getDiffFiles)
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	body := strings.TrimRight(w.Body.String(), "\n")
+	fmt.Fprintln(out, body)
+	if w.Code >= 300 {
+		return fmt.Errorf("%s", http.StatusText(w.Code))
+	}
+	return nil
+}
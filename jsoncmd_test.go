@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRunJSON(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	var out strings.Builder
+	if err := runJSON([]string{"diffs"}, &out); err != nil {
+		t.Fatalf("diffs: %v", err)
+	}
+	var diffs []DiffInfo
+	if err := json.Unmarshal([]byte(out.String()), &diffs); err != nil || len(diffs) != 4 || diffs[0].ID != "working" {
+		t.Errorf("diffs = %v %s", err, out.String())
+	}
+
+	out.Reset()
+	if err := runJSON([]string{"files", "HEAD", "mode=commit"}, &out); err != nil {
+		t.Fatalf("files: %v", err)
+	}
+	var files []FileInfo
+	if json.Unmarshal([]byte(out.String()), &files); len(files) != 1 || files[0].Path != "test2.ts" {
+		t.Errorf("files = %s", out.String())
+	}
+
+	out.Reset()
+	if err := runJSON([]string{"file-diff", "working", "test2.ts"}, &out); err != nil {
+		t.Fatalf("file-diff: %v", err)
+	}
+	var diff FileDiff
+	if json.Unmarshal([]byte(out.String()), &diff); diff.Path != "test2.ts" || diff.NewContent == diff.OldContent {
+		t.Errorf("file-diff = %s", out.String())
+	}
+
+	out.Reset()
+	if err := runJSON([]string{"files", "nope"}, &out); err == nil || !strings.Contains(out.String(), "error") {
+		t.Errorf("unknown diff = %v %s, want an error body", err, out.String())
+	}
+	if err := runJSON([]string{"file-diff", "working"}, &out); err == nil {
+		t.Errorf("file-diff without a path succeeded")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// lfsPointerVersion is the first line of every Git LFS pointer file
+const lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+
+// lfsMaxPointerSize bounds how large a pointer file can be, matching the
+// limit git-lfs itself uses when scanning for pointers
+const lfsMaxPointerSize = 1024
+
+// LFSPointer is the object metadata stored in a Git LFS pointer file
+type LFSPointer struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// parseLFSPointer returns the pointer described by data, or nil if data
+// is not an LFS pointer file
+func parseLFSPointer(data []byte) *LFSPointer {
+	if len(data) == 0 || len(data) > lfsMaxPointerSize || !bytes.HasPrefix(data, []byte(lfsPointerVersion+"\n")) {
+		return nil
+	}
+	var pointer LFSPointer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		switch key {
+		case "oid":
+			pointer.OID, _ = strings.CutPrefix(value, "sha256:")
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			pointer.Size = size
+		}
+	}
+	if pointer.OID == "" {
+		return nil
+	}
+	return &pointer
+}
+
+// lfsAvailable reports whether the git-lfs extension is installed
+var lfsAvailable = sync.OnceValue(func() bool {
+	_, err := runGit("lfs", "version")
+	return err == nil
+})
+
+// smudgeLFS returns the real content for a pointer file, fetching the
+// object from the LFS remote if it is not in the local store
+func smudgeLFS(pointer []byte, path string) ([]byte, error) {
+	return runGitInput(pointer, "lfs", "smudge", "--", path)
+}
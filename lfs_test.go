@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testLFSPointer = "version https://git-lfs.github.com/spec/v1\n" +
+	"oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\n" +
+	"size 12345\n"
+
+func TestParseLFSPointer(t *testing.T) {
+	pointer := parseLFSPointer([]byte(testLFSPointer))
+	if pointer == nil {
+		t.Fatal("parseLFSPointer() = nil for a valid pointer")
+	}
+	if pointer.OID != "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393" || pointer.Size != 12345 {
+		t.Errorf("pointer = %+v", pointer)
+	}
+
+	for _, data := range []string{
+		"",
+		"package main\n",
+		"version https://git-lfs.github.com/spec/v1\nsize 10\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:abc\nsize big\n",
+	} {
+		if got := parseLFSPointer([]byte(data)); got != nil {
+			t.Errorf("parseLFSPointer(%q) = %+v, want nil", data, got)
+		}
+	}
+}
+
+func TestGetFileDiffLFSPointer(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(repoDir, "design.png"), []byte(testLFSPointer), 0644); err != nil {
+		t.Fatalf("Failed to write pointer: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/design.png", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var diff FileDiff
+	if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil {
+		t.Fatal(err)
+	}
+	if diff.NewLFS == nil || diff.NewLFS.Size != 12345 {
+		t.Errorf("NewLFS = %+v, want pointer metadata", diff.NewLFS)
+	}
+	if diff.OldLFS != nil {
+		t.Errorf("OldLFS = %+v, want nil for an added file", diff.OldLFS)
+	}
+	if diff.NewContent != "" {
+		t.Errorf("NewContent = %q, pointer text should not be returned", diff.NewContent)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shutdownGrace is how long in-flight requests, and the git commands
+// they are running, get to finish before the server closes them
+const shutdownGrace = 10 * time.Second
+
+// lifecycle tracks activity so the server can shut itself down when asked
+// to or when it has been idle
+type lifecycle struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+	inFlight atomic.Int64
+	// lastActive is the UnixNano time the last request finished
+	lastActive atomic.Int64
+}
+
+var server = newLifecycle()
+
+func newLifecycle() *lifecycle {
+	l := &lifecycle{stop: make(chan struct{})}
+	l.lastActive.Store(time.Now().UnixNano())
+	return l
+}
+
+// requestShutdown asks serve to shut down; later calls do nothing
+func (l *lifecycle) requestShutdown(reason string) {
+	l.stopOnce.Do(func() {
+		slog.Info("shutdown requested", "reason", reason)
+		close(l.stop)
+	})
+}
+
+// track counts in-flight requests and records when the server was last used
+func (l *lifecycle) track() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l.inFlight.Add(1)
+		defer func() {
+			l.lastActive.Store(time.Now().UnixNano())
+			l.inFlight.Add(-1)
+		}()
+		c.Next()
+	}
+}
+
+// idleFor returns how long the server has had no requests, or zero while
+// any are in flight
+func (l *lifecycle) idleFor(now time.Time) time.Duration {
+	if l.inFlight.Load() > 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, l.lastActive.Load()))
+}
+
+// serve runs srv on ln until SIGINT or SIGTERM, a shutdown request, or
+// idleTimeout without requests (zero disables the timeout). In-flight
+// requests are drained before it returns.
+func (l *lifecycle) serve(srv *http.Server, ln net.Listener, idleTimeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var idle <-chan time.Time
+	if idleTimeout > 0 {
+		ticker := time.NewTicker(min(idleTimeout, time.Minute))
+		defer ticker.Stop()
+		idle = ticker.C
+	}
+
+wait:
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case sig := <-signals:
+			l.requestShutdown(sig.String())
+		case now := <-idle:
+			if l.idleFor(now) >= idleTimeout {
+				l.requestShutdown("idle")
+			}
+		case <-l.stop:
+			break wait
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("requests still running at shutdown", "error", err)
+		srv.Close()
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// postShutdown stops the server once this response has been sent
+func postShutdown(c *gin.Context) {
+	c.JSON(http.StatusAccepted, gin.H{"message": "Shutting down"})
+	server.requestShutdown("api")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveAsync runs l.serve on a free port and returns its result channel
+func serveAsync(t *testing.T, l *lifecycle, handler http.Handler, idleTimeout time.Duration) <-chan error {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- l.serve(&http.Server{Handler: handler}, ln, idleTimeout)
+	}()
+	return done
+}
+
+func TestServeStopsWhenIdle(t *testing.T) {
+	l := newLifecycle()
+	select {
+	case err := <-serveAsync(t, l, http.NotFoundHandler(), 50*time.Millisecond):
+		if err != nil {
+			t.Errorf("serve() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle server did not stop")
+	}
+}
+
+func TestIdleForIgnoresBusyServer(t *testing.T) {
+	l := newLifecycle()
+	l.inFlight.Add(1)
+	if d := l.idleFor(time.Now().Add(time.Hour)); d != 0 {
+		t.Errorf("idleFor() = %v with a request in flight", d)
+	}
+	l.inFlight.Add(-1)
+	if d := l.idleFor(time.Now().Add(time.Hour)); d < time.Hour {
+		t.Errorf("idleFor() = %v, want at least an hour", d)
+	}
+}
+
+func TestShutdownEndpoint(t *testing.T) {
+	old := server
+	defer func() { server = old }()
+	server = newLifecycle()
+
+	r := gin.New()
+	r.Use(server.track())
+	r.POST("/api/shutdown", postShutdown)
+	done := serveAsync(t, server, r, 0)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shutdown", nil))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("shutdown = %d", w.Code)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop after shutdown request")
+	}
+}
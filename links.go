@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MessageLink is an issue reference found in a commit message. Start and
+// End are UTF-16 offsets into the message, as JavaScript indexes strings.
+type MessageLink struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	URL   string `json:"url"`
+}
+
+// linkRule turns matches of Pattern into URLs built from Template, which
+// may refer to submatches as $0, $1, ${name}
+type linkRule struct {
+	Pattern  *regexp.Regexp
+	Template string
+}
+
+// linkRules returns the rules configured for this repository with
+//
+//	git config --add differing.link '<regexp> <url template>'
+//
+// for example 'JIRA-\d+ https://jira.example.com/browse/$0' or
+// '#(\d+) https://github.com/org/repo/issues/$1'. Invalid rules are
+// logged and skipped.
+func linkRules() []linkRule {
+	output, err := runGit("config", "--get-all", "differing.link")
+	if err != nil {
+		// git config exits 1 when the key is unset
+		return nil
+	}
+	var rules []linkRule
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// URLs cannot contain spaces, so the template starts after the last one
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			slog.Warn("ignoring differing.link without a URL template", "rule", line)
+			continue
+		}
+		pattern, err := regexp.Compile(strings.TrimSpace(line[:i]))
+		if err != nil {
+			slog.Warn("ignoring invalid differing.link pattern", "rule", line, "error", err)
+			continue
+		}
+		rules = append(rules, linkRule{Pattern: pattern, Template: line[i+1:]})
+	}
+	return rules
+}
+
+// findLinks applies rules to message, returning non-overlapping links in
+// order. Where matches overlap, the earlier rule wins.
+func findLinks(rules []linkRule, message string) []MessageLink {
+	type match struct {
+		start, end int // byte offsets
+		url        string
+	}
+	var matches []match
+	for _, rule := range rules {
+		for _, loc := range rule.Pattern.FindAllStringSubmatchIndex(message, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			overlaps := false
+			for _, m := range matches {
+				if loc[0] < m.end && m.start < loc[1] {
+					overlaps = true
+					break
+				}
+			}
+			if overlaps {
+				continue
+			}
+			url := rule.Pattern.ExpandString(nil, rule.Template, message, loc)
+			matches = append(matches, match{loc[0], loc[1], string(url)})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+
+	var links []MessageLink
+	for _, m := range matches {
+		start := utf16Len(message[:m.start])
+		links = append(links, MessageLink{
+			Start: start,
+			End:   start + utf16Len(message[m.start:m.end]),
+			URL:   m.url,
+		})
+	}
+	return links
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestFindLinks(t *testing.T) {
+	rules := []linkRule{
+		{Pattern: regexp.MustCompile(`JIRA-\d+`), Template: "https://jira.example.com/browse/$0"},
+		{Pattern: regexp.MustCompile(`#(\d+)`), Template: "https://github.com/org/repo/issues/$1"},
+	}
+
+	links := findLinks(rules, "Fix crash (#12), see JIRA-345")
+	want := []MessageLink{
+		{Start: 11, End: 14, URL: "https://github.com/org/repo/issues/12"},
+		{Start: 21, End: 29, URL: "https://jira.example.com/browse/JIRA-345"},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("findLinks() = %+v, want %+v", links, want)
+	}
+	for i := range want {
+		if links[i] != want[i] {
+			t.Errorf("link %d = %+v, want %+v", i, links[i], want[i])
+		}
+	}
+
+	// Offsets count UTF-16 code units so the frontend can slice directly
+	links = findLinks(rules, "🐛 #7")
+	if len(links) != 1 || links[0].Start != 3 || links[0].End != 5 {
+		t.Errorf("findLinks() with emoji = %+v", links)
+	}
+
+	// An earlier rule takes precedence over an overlapping later one
+	overlapping := append(rules, linkRule{Pattern: regexp.MustCompile(`JIRA-(\d+)`), Template: "https://other/$1"})
+	links = findLinks(overlapping, "JIRA-1")
+	if len(links) != 1 || links[0].URL != "https://jira.example.com/browse/JIRA-1" {
+		t.Errorf("overlapping findLinks() = %+v", links)
+	}
+}
+
+func TestLinkRules(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	if rules := linkRules(); rules != nil {
+		t.Errorf("linkRules() without config = %v, want nil", rules)
+	}
+
+	runGit("config", "--add", "differing.link", `#(\d+) https://github.com/org/repo/issues/$1`)
+	runGit("config", "--add", "differing.link", `(unclosed https://example.com`)
+	runGit("config", "--add", "differing.link", `nourl`)
+	rules := linkRules()
+	if len(rules) != 1 || rules[0].Template != "https://github.com/org/repo/issues/$1" {
+		t.Errorf("linkRules() = %+v, want only the valid rule", rules)
+	}
+}
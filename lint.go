@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LintIssue is a problem found in a commit message. Line is 1-based.
+type LintIssue struct {
+	Line    int    `json:"line"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// lintConfig holds the commit message rules, read from git config:
+//
+//	differing.lint.subjectLength  longest subject line (default 72, 0 for no limit)
+//	differing.lint.bodyLength     longest body line (default 0, no limit)
+//	differing.lint.conventional   require a Conventional Commits subject
+type lintConfig struct {
+	SubjectLength int
+	BodyLength    int
+	Conventional  bool
+}
+
+func loadLintConfig() lintConfig {
+	cfg := lintConfig{SubjectLength: 72}
+	if output, err := runGit("config", "--type=int", "--get", "differing.lint.subjectLength"); err == nil {
+		cfg.SubjectLength, _ = strconv.Atoi(strings.TrimSpace(string(output)))
+	}
+	if output, err := runGit("config", "--type=int", "--get", "differing.lint.bodyLength"); err == nil {
+		cfg.BodyLength, _ = strconv.Atoi(strings.TrimSpace(string(output)))
+	}
+	if output, err := runGit("config", "--type=bool", "--get", "differing.lint.conventional"); err == nil {
+		cfg.Conventional = strings.TrimSpace(string(output)) == "true"
+	}
+	return cfg
+}
+
+// lintMessage checks a commit message against cfg. Comment lines starting
+// with "#" are ignored, as git strips them when committing.
+func lintMessage(message string, cfg lintConfig) []LintIssue {
+	type line struct {
+		number int
+		text   string
+	}
+	var lines []line
+	for i, text := range strings.Split(strings.ReplaceAll(message, "\r\n", "\n"), "\n") {
+		if !strings.HasPrefix(text, "#") {
+			lines = append(lines, line{i + 1, strings.TrimRight(text, " \t")})
+		}
+	}
+	for len(lines) > 0 && lines[0].text == "" {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return []LintIssue{{Line: 1, Rule: "empty", Message: "Message is empty"}}
+	}
+
+	var issues []LintIssue
+	subject := lines[0]
+	if n := len([]rune(subject.text)); cfg.SubjectLength > 0 && n > cfg.SubjectLength {
+		issues = append(issues, LintIssue{subject.number, "subject-length",
+			"Subject is " + strconv.Itoa(n) + " characters; the limit is " + strconv.Itoa(cfg.SubjectLength)})
+	}
+	if cfg.Conventional && parseConventional(subject.text) == nil {
+		issues = append(issues, LintIssue{subject.number, "conventional",
+			`Subject should look like "type(scope): description"`})
+	}
+	if len(lines) > 1 && lines[1].text != "" {
+		issues = append(issues, LintIssue{lines[1].number, "blank-line",
+			"Separate the subject from the body with a blank line"})
+	}
+	if cfg.BodyLength > 0 {
+		for _, l := range lines[1:] {
+			if n := len([]rune(l.text)); n > cfg.BodyLength {
+				issues = append(issues, LintIssue{l.number, "body-length",
+					"Line is " + strconv.Itoa(n) + " characters; the limit is " + strconv.Itoa(cfg.BodyLength)})
+			}
+		}
+	}
+	return issues
+}
+
+// checkMessageLint lints a message about to be committed, refusing it with
+// the issues found. It responds and returns false when there are any.
+func checkMessageLint(c *gin.Context, message string) bool {
+	issues := lintMessage(message, loadLintConfig())
+	if len(issues) == 0 {
+		return true
+	}
+	apiErr := newAPIError(http.StatusUnprocessableEntity, "The commit message breaks the lint rules", nil)
+	apiErr.Code = codeLint
+	apiErr.Issues = issues
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, apiErr)
+	return false
+}
+
+// postLintMessage validates a proposed commit message
+func postLintMessage(c *gin.Context) {
+	var req struct {
+		Message string `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	issues := lintMessage(req.Message, loadLintConfig())
+	if issues == nil {
+		issues = []LintIssue{}
+	}
+	c.JSON(http.StatusOK, gin.H{"valid": len(issues) == 0, "issues": issues})
+}
+
+// getCommitTemplate returns the message template from commit.template, or
+// from .gitmessage at the repository root when that is unset
+func getCommitTemplate(c *gin.Context) {
+	path := ".gitmessage"
+	if output, err := runGitContext(c.Request.Context(), "config", "--path", "--get", "commit.template"); err == nil {
+		path = strings.TrimSpace(string(output))
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(gitRoot, path)
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		c.JSON(http.StatusOK, gin.H{"template": ""})
+		return
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, "Failed to read commit template", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"template": string(data), "path": path})
+}
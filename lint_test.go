@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLintMessage(t *testing.T) {
+	cfg := lintConfig{SubjectLength: 20, BodyLength: 30, Conventional: true}
+	rules := func(issues []LintIssue) []string {
+		var names []string
+		for _, issue := range issues {
+			names = append(names, issue.Rule)
+		}
+		return names
+	}
+
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"feat: short\n\nBody text.\n", ""},
+		{"# only a comment\n\n", "empty"},
+		{"feat: this subject is far too long", "subject-length"},
+		{"Add a thing", "conventional"},
+		{"fix: thing\nno blank line", "blank-line"},
+		{"fix: thing\n\n" + strings.Repeat("x", 31), "body-length"},
+		{"# Please enter a message\nfix: thing\n# comment\n\nok", ""},
+	}
+	for _, tt := range tests {
+		got := strings.Join(rules(lintMessage(tt.message, cfg)), ",")
+		if got != tt.want {
+			t.Errorf("lintMessage(%q) rules = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+
+	issues := lintMessage("# header\nfix: thing\ntrailing", cfg)
+	if len(issues) != 1 || issues[0].Line != 3 {
+		t.Errorf("issues = %+v, want blank-line on line 3", issues)
+	}
+}
+
+func TestCommitTemplate(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	oldRoot := gitRoot
+	gitRoot = repoDir
+	defer func() { gitRoot = oldRoot }()
+
+	r := gin.New()
+	r.GET("/api/commit-template", getCommitTemplate)
+	r.POST("/api/lint-message", postLintMessage)
+	get := func() map[string]string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/commit-template", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	if resp := get(); resp["template"] != "" {
+		t.Errorf("template without config = %q, want empty", resp["template"])
+	}
+
+	if err := os.WriteFile(filepath.Join(repoDir, ".gitmessage"), []byte("fix: \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if resp := get(); resp["template"] != "fix: \n" {
+		t.Errorf(".gitmessage template = %q", resp["template"])
+	}
+
+	custom := filepath.Join(repoDir, "template.txt")
+	if err := os.WriteFile(custom, []byte("feat: \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit("config", "commit.template", custom)
+	if resp := get(); resp["template"] != "feat: \n" {
+		t.Errorf("commit.template = %q", resp["template"])
+	}
+
+	runGit("config", "differing.lint.conventional", "true")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/lint-message", strings.NewReader(`{"message": "Add things"}`)))
+	var lint struct {
+		Valid  bool        `json:"valid"`
+		Issues []LintIssue `json:"issues"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &lint)
+	if lint.Valid || len(lint.Issues) != 1 || lint.Issues[0].Rule != "conventional" {
+		t.Errorf("lint response = %+v", lint)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logFilter narrows the commit list, mapping onto git log's --author,
+// --since, and --until flags and pathspecs. Rev, a resolved SHA, lists
+// another branch's history instead of HEAD's.
+type logFilter struct {
+	Rev     string
+	Authors []string
+	Paths   []string
+	Since   string
+	Until   string
+}
+
+// logFilterFromQuery reads ref=, author=, path=, since=, and until= from
+// the request. author= and path= may be repeated; git matches any of
+// them. An unknown ref is reported as errUnknownRevision.
+func logFilterFromQuery(c *gin.Context) (logFilter, error) {
+	f := logFilter{
+		Authors: c.QueryArray("author"),
+		Paths:   c.QueryArray("path"),
+		Since:   c.Query("since"),
+		Until:   c.Query("until"),
+	}
+	for _, v := range append(append([]string{f.Since, f.Until}, f.Authors...), f.Paths...) {
+		if strings.ContainsRune(v, 0) {
+			return logFilter{}, fmt.Errorf("invalid filter value %q", v)
+		}
+	}
+	// Relative dates such as "2 weeks ago" are fixed now, so a cached
+	// listing is not reused once they have moved on
+	for _, d := range []*string{&f.Since, &f.Until} {
+		if *d == "" {
+			continue
+		}
+		output, err := runGitContext(c.Request.Context(), "rev-parse", "--since="+*d)
+		if err != nil {
+			return logFilter{}, err
+		}
+		_, unix, _ := strings.Cut(strings.TrimSpace(string(output)), "=")
+		*d = "@" + unix
+	}
+	if ref := c.Query("ref"); ref != "" {
+		rev, err := resolveRev(ref)
+		if err != nil {
+			return logFilter{}, err
+		}
+		f.Rev = rev
+	}
+	return f, nil
+}
+
+// args returns the git log arguments for the filter, pathspecs last
+func (f logFilter) args() []string {
+	var args []string
+	for _, a := range f.Authors {
+		if a != "" {
+			args = append(args, "--author="+a)
+		}
+	}
+	if f.Since != "" {
+		args = append(args, "--since="+f.Since)
+	}
+	if f.Until != "" {
+		args = append(args, "--until="+f.Until)
+	}
+	if f.Rev != "" {
+		args = append(args, f.Rev)
+	}
+	var paths []string
+	for _, p := range f.Paths {
+		if p != "" {
+			paths = append(paths, ":(literal)"+p)
+		}
+	}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+	return args
+}
+
+// key identifies the filter for caching; it is empty when nothing is
+// filtered
+func (f logFilter) key() string {
+	args := f.args()
+	if len(args) == 0 {
+		return ""
+	}
+	return "\x00" + strings.Join(args, "\x00")
+}
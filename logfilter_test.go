@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetDiffsFilters(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	cache.reset()
+	defer cache.reset()
+	runGit("-c", "user.name=Other", "-c", "user.email=other@example.com", "commit", "-q", "-am", "Other's change")
+
+	r := gin.New()
+	r.GET("/api/diffs", getDiffs)
+	list := func(query string) []string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s = %d: %s", query, w.Code, w.Body.String())
+		}
+		var diffs []DiffInfo
+		json.Unmarshal(w.Body.Bytes(), &diffs)
+		var messages []string
+		for _, d := range diffs[1:] {
+			messages = append(messages, d.Message)
+		}
+		return messages
+	}
+
+	if got := list(""); len(got) != 4 {
+		t.Errorf("unfiltered = %q", got)
+	}
+	if got := list("?path=test1.go"); len(got) != 2 || got[0] != "Update hello function" {
+		t.Errorf("path filter = %q", got)
+	}
+	if got := list("?author=Other"); len(got) != 1 || got[0] != "Other's change" {
+		t.Errorf("author filter = %q", got)
+	}
+	if got := list("?author=Other&path=test1.go"); len(got) != 0 {
+		t.Errorf("combined filter = %q", got)
+	}
+	if got := list("?until=2000-01-01"); len(got) != 0 {
+		t.Errorf("until filter = %q", got)
+	}
+	if got := list("?since=2000-01-01"); len(got) != 4 {
+		t.Errorf("since filter = %q", got)
+	}
+	// The unfiltered listing is not served from a filtered cache entry
+	if got := list(""); len(got) != 4 {
+		t.Errorf("unfiltered after filtering = %q", got)
+	}
+}
+
+func TestGetDiffsRef(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	cache.reset()
+	defer cache.reset()
+	runGit("branch", "old", "HEAD~1")
+
+	r := gin.New()
+	r.GET("/api/diffs", getDiffs)
+	get := func(query string) (int, []DiffInfo) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs"+query, nil))
+		var diffs []DiffInfo
+		json.Unmarshal(w.Body.Bytes(), &diffs)
+		return w.Code, diffs
+	}
+
+	code, diffs := get("?ref=old")
+	if code != http.StatusOK {
+		t.Fatalf("ref=old = %d", code)
+	}
+	if len(diffs) != 2 || diffs[0].ID == "working" {
+		t.Errorf("ref=old listed %d entries starting %q", len(diffs), diffs[0].ID)
+	}
+	if _, diffs := get("?ref=HEAD"); len(diffs) == 0 || diffs[0].ID != "working" {
+		t.Errorf("ref=HEAD should keep the working entry")
+	}
+	if code, _ := get("?ref=nope"); code != http.StatusNotFound {
+		t.Errorf("unknown ref = %d, want 404", code)
+	}
+}
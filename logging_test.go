@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewLogger(t *testing.T) {
+	logger, err := newLogger("debug", "json")
+	if err != nil {
+		t.Fatalf("newLogger(debug, json) failed: %v", err)
+	}
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("debug logger should have debug enabled")
+	}
+	if _, err := newLogger("loud", "text"); err == nil {
+		t.Error("newLogger() should reject an unknown level")
+	}
+	if _, err := newLogger("info", "xml"); err == nil {
+		t.Error("newLogger() should reject an unknown format")
+	}
+}
+
+func TestRequestLoggerSetsRequestID(t *testing.T) {
+	r := gin.New()
+	r.Use(requestLogger())
+	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	if w.Header().Get(requestIDHeader) == "" {
+		t.Error("response should carry a generated request ID")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set(requestIDHeader, "abc123")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get(requestIDHeader); got != "abc123" {
+		t.Errorf("request ID = %q, want client-supplied abc123", got)
+	}
+}
+
+func TestGitLogsCarryRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(requestIDHandler{slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})}))
+	defer slog.SetDefault(previous)
+
+	r := gin.New()
+	r.Use(requestLogger())
+	r.GET("/version", func(c *gin.Context) {
+		if _, err := runGitContext(c.Request.Context(), "--version"); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	req.Header.Set(requestIDHeader, "abc123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("git --version failed: %d", w.Code)
+	}
+
+	found := false
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var record map[string]any
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		if record["msg"] == "git" {
+			found = true
+			if record["id"] != "abc123" {
+				t.Errorf("git log id = %v, want abc123", record["id"])
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no git command was logged:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Diagnostic is a problem a language server reports in a file. Lines
+// and columns are 1-based; columns count UTF-16 code units, as LSP does.
+type Diagnostic struct {
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	Severity  string `json:"severity"` // error, warning, information, or hint
+	Message   string `json:"message"`
+	Source    string `json:"source,omitempty"`
+}
+
+// lspLanguageIDs maps file extensions to LSP language identifiers where
+// they differ from the extension itself
+var lspLanguageIDs = map[string]string{
+	"ts":  "typescript",
+	"tsx": "typescriptreact",
+	"js":  "javascript",
+	"jsx": "javascriptreact",
+	"py":  "python",
+	"rs":  "rust",
+	"rb":  "ruby",
+}
+
+// lspCommand returns the language server command configured for a file's
+// extension with differing.lsp.<ext>, such as differing.lsp.go=gopls
+func lspCommand(filePath string) (ext, command string) {
+	ext = strings.TrimPrefix(path.Ext(filePath), ".")
+	if ext == "" {
+		return "", ""
+	}
+	output, err := runGit("config", "--get", "differing.lsp."+ext)
+	if err != nil {
+		return ext, ""
+	}
+	return ext, strings.TrimSpace(string(output))
+}
+
+// fileURI returns the file:// URI for an absolute path
+func fileURI(abs string) string {
+	p := filepath.ToSlash(abs)
+	if !strings.HasPrefix(p, "/") {
+		// Windows drive paths become file:///C:/...
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// lspMessage is a JSON-RPC message in either direction. Requests have an
+// ID and method, responses an ID alone, and notifications a method alone.
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// languageServer is a running language server process and the
+// diagnostics it has published
+type languageServer struct {
+	command string
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	writeMu sync.Mutex
+	stdin   io.WriteCloser
+
+	mu       sync.Mutex
+	nextID   int
+	pending  map[int]chan *lspMessage
+	versions map[string]int
+	texts    map[string]string
+	diags    map[string][]Diagnostic
+	// stale marks documents changed since the server last published
+	stale   map[string]bool
+	waiters map[string][]chan struct{}
+}
+
+// languageServers holds the running servers by file extension. They are
+// started on first use and live until the repository changes.
+var languageServers = struct {
+	sync.Mutex
+	byExt map[string]*languageServer
+}{byExt: make(map[string]*languageServer)}
+
+// lspStartTimeout bounds how long a server may take to initialize
+const lspStartTimeout = 30 * time.Second
+
+// serverFor returns the running language server for ext, starting it if
+// needed
+func serverFor(ext, command string) (*languageServer, error) {
+	languageServers.Lock()
+	defer languageServers.Unlock()
+	if s := languageServers.byExt[ext]; s != nil && s.command == command {
+		select {
+		case <-s.done:
+		default:
+			return s, nil
+		}
+	}
+	if old := languageServers.byExt[ext]; old != nil {
+		old.stop()
+	}
+	s, err := startLanguageServer(command, gitRoot)
+	if err != nil {
+		return nil, err
+	}
+	languageServers.byExt[ext] = s
+	return s, nil
+}
+
+// startLanguageServer launches command in root and performs the LSP
+// initialize handshake
+func startLanguageServer(command, root string) (*languageServer, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := shellCommand(ctx, command)
+	cmd.Dir = root
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s := &languageServer{
+		command:  command,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		stdin:    stdin,
+		pending:  make(map[int]chan *lspMessage),
+		versions: make(map[string]int),
+		texts:    make(map[string]string),
+		diags:    make(map[string][]Diagnostic),
+		stale:    make(map[string]bool),
+		waiters:  make(map[string][]chan struct{}),
+	}
+	go func() {
+		s.readLoop(stdout)
+		cmd.Wait()
+		close(s.done)
+	}()
+
+	rootURI := fileURI(root)
+	_, err = s.request("initialize", map[string]any{
+		"processId": os.Getpid(),
+		"rootUri":   rootURI,
+		"workspaceFolders": []map[string]string{
+			{"uri": rootURI, "name": filepath.Base(root)},
+		},
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{"publishDiagnostics": map[string]any{}},
+		},
+	}, lspStartTimeout)
+	if err == nil {
+		err = s.notify("initialized", map[string]any{})
+	}
+	if err != nil {
+		s.stop()
+		return nil, fmt.Errorf("language server %q failed to start: %w", command, err)
+	}
+	return s, nil
+}
+
+// send writes one message with LSP's Content-Length framing
+func (s *languageServer) send(msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if _, err := fmt.Fprintf(s.stdin, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = s.stdin.Write(body)
+	return err
+}
+
+func (s *languageServer) notify(method string, params any) error {
+	return s.send(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// request sends a request and waits up to timeout for its response
+func (s *languageServer) request(method string, params any, timeout time.Duration) (json.RawMessage, error) {
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	ch := make(chan *lspMessage, 1)
+	s.pending[id] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+	}()
+
+	if err := s.send(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return nil, err
+	}
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return nil, errors.New(msg.Error.Message)
+		}
+		return msg.Result, nil
+	case <-s.done:
+		return nil, errors.New("language server exited")
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("%s timed out", method)
+	}
+}
+
+// readLoop dispatches messages from the server until it exits
+func (s *languageServer) readLoop(r io.Reader) {
+	reader := bufio.NewReader(r)
+	for {
+		length := -1
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				break
+			}
+			if value, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+				length, _ = strconv.Atoi(strings.TrimSpace(value))
+			}
+		}
+		if length < 0 {
+			continue
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return
+		}
+		var msg lspMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			slog.Debug("invalid language server message", "error", err)
+			continue
+		}
+		s.dispatch(&msg)
+	}
+}
+
+func (s *languageServer) dispatch(msg *lspMessage) {
+	switch {
+	case msg.ID != nil && msg.Method != "":
+		// Servers ask clients for configuration, progress tokens, and
+		// capability registration; an empty answer satisfies them all
+		var result any
+		if msg.Method == "workspace/configuration" {
+			var params struct {
+				Items []json.RawMessage `json:"items"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			result = make([]any, len(params.Items))
+		}
+		s.send(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+	case msg.ID != nil:
+		id, err := strconv.Atoi(string(*msg.ID))
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		ch := s.pending[id]
+		s.mu.Unlock()
+		if ch != nil {
+			ch <- msg
+		}
+	case msg.Method == "textDocument/publishDiagnostics":
+		s.publish(msg.Params)
+	}
+}
+
+// lspSeverities names LSP's numeric diagnostic severities
+var lspSeverities = map[int]string{1: "error", 2: "warning", 3: "information", 4: "hint"}
+
+// publish stores diagnostics for a document and wakes anyone waiting
+func (s *languageServer) publish(params json.RawMessage) {
+	type position struct {
+		Line      int `json:"line"`
+		Character int `json:"character"`
+	}
+	var p struct {
+		URI         string `json:"uri"`
+		Diagnostics []struct {
+			Range struct {
+				Start position `json:"start"`
+				End   position `json:"end"`
+			} `json:"range"`
+			Severity int    `json:"severity"`
+			Message  string `json:"message"`
+			Source   string `json:"source"`
+		} `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return
+	}
+	diags := make([]Diagnostic, 0, len(p.Diagnostics))
+	for _, d := range p.Diagnostics {
+		severity := lspSeverities[d.Severity]
+		if severity == "" {
+			// The spec leaves a missing severity to the client
+			severity = "error"
+		}
+		diags = append(diags, Diagnostic{
+			Line:      d.Range.Start.Line + 1,
+			Column:    d.Range.Start.Character + 1,
+			EndLine:   d.Range.End.Line + 1,
+			EndColumn: d.Range.End.Character + 1,
+			Severity:  severity,
+			Message:   d.Message,
+			Source:    d.Source,
+		})
+	}
+	s.mu.Lock()
+	s.diags[p.URI] = diags
+	delete(s.stale, p.URI)
+	waiters := s.waiters[p.URI]
+	delete(s.waiters, p.URI)
+	s.mu.Unlock()
+	for _, ch := range waiters {
+		close(ch)
+	}
+}
+
+// update sends a document's current text to the server, opening it on
+// first use. The returned channel is closed when the server next
+// publishes diagnostics for it; it is nil if the text is unchanged and
+// the server has already published for it.
+func (s *languageServer) update(abs, text string) (<-chan struct{}, error) {
+	uri := fileURI(abs)
+	s.mu.Lock()
+	version := s.versions[uri]
+	unchanged := version > 0 && s.texts[uri] == text
+	if unchanged && !s.stale[uri] {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	ch := make(chan struct{})
+	s.waiters[uri] = append(s.waiters[uri], ch)
+	if unchanged {
+		// Sent already; just wait for the server to catch up
+		s.mu.Unlock()
+		return ch, nil
+	}
+	s.versions[uri] = version + 1
+	s.texts[uri] = text
+	s.stale[uri] = true
+	s.mu.Unlock()
+
+	if version == 0 {
+		ext := strings.TrimPrefix(filepath.Ext(abs), ".")
+		languageID := lspLanguageIDs[ext]
+		if languageID == "" {
+			languageID = ext
+		}
+		return ch, s.notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": languageID, "version": 1, "text": text},
+		})
+	}
+	return ch, s.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": version + 1},
+		"contentChanges": []map[string]string{{"text": text}},
+	})
+}
+
+// diagnostics returns what the server last published for a document
+func (s *languageServer) diagnostics(abs string) []Diagnostic {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	diags := s.diags[fileURI(abs)]
+	if diags == nil {
+		return []Diagnostic{}
+	}
+	return diags
+}
+
+// stop asks the server to shut down, then kills it if it lingers
+func (s *languageServer) stop() {
+	select {
+	case <-s.done:
+		s.cancel()
+		return
+	default:
+	}
+	if _, err := s.request("shutdown", nil, time.Second); err == nil {
+		s.notify("exit", nil)
+	}
+	select {
+	case <-s.done:
+	case <-time.After(time.Second):
+	}
+	s.cancel()
+}
+
+// stopLanguageServers stops every running language server
+func stopLanguageServers() {
+	languageServers.Lock()
+	servers := languageServers.byExt
+	languageServers.byExt = make(map[string]*languageServer)
+	languageServers.Unlock()
+	for _, s := range servers {
+		s.stop()
+	}
+}
+
+// lspFileSaved tells a running language server about new file content
+// so diagnostics are fresh by the time they are asked for. It never
+// starts a server.
+func lspFileSaved(filePath, text string) {
+	ext := strings.TrimPrefix(path.Ext(filePath), ".")
+	languageServers.Lock()
+	s := languageServers.byExt[ext]
+	languageServers.Unlock()
+	if s == nil {
+		return
+	}
+	if _, err := s.update(filepath.Join(gitRoot, filepath.FromSlash(filePath)), text); err != nil {
+		slog.Warn("failed to update language server", "path", filePath, "error", err)
+	}
+}
+
+// defaultDiagnosticsWait and maxDiagnosticsWait bound how long
+// GET /api/diagnostics waits for the server to publish
+const (
+	defaultDiagnosticsWait = 2 * time.Second
+	maxDiagnosticsWait     = 10 * time.Second
+)
+
+// getDiagnostics returns language server diagnostics for the working
+// copy of a file, starting the configured server on first use. The
+// response waits up to ?wait= milliseconds for fresh results; pending is
+// set if they had not arrived.
+func getDiagnostics(c *gin.Context) {
+	filePath := filePathParam(c)
+	ext, command := lspCommand(filePath)
+	if command == "" {
+		respondError(c, http.StatusNotFound, fmt.Sprintf("No language server configured for .%s files (set differing.lsp.%s)", ext, ext), nil)
+		return
+	}
+	wait := defaultDiagnosticsWait
+	if ms := c.Query("wait"); ms != "" {
+		n, err := strconv.Atoi(ms)
+		if err != nil || n < 0 {
+			respondError(c, http.StatusBadRequest, "wait must be a number of milliseconds", nil)
+			return
+		}
+		wait = min(time.Duration(n)*time.Millisecond, maxDiagnosticsWait)
+	}
+
+	file, err := secureRoot.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		respondError(c, http.StatusNotFound, "File not found: "+filePath, nil)
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid file path", err)
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read file", err)
+		return
+	}
+	text, _ := decodeContent(data)
+
+	s, err := serverFor(ext, command)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, "Language server unavailable", err)
+		return
+	}
+	abs := filepath.Join(gitRoot, filepath.FromSlash(filePath))
+	ch, err := s.update(abs, text)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, "Failed to send file to language server", err)
+		return
+	}
+	pending := false
+	if ch != nil {
+		select {
+		case <-ch:
+		case <-s.done:
+		case <-time.After(wait):
+			pending = true
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"path": filePath, "diagnostics": s.diagnostics(abs), "pending": pending})
+}
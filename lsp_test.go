@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestLSPHelperProcess is a fake language server, run as a subprocess by
+// TestGetDiagnostics. It reports every line containing BAD as an error.
+func TestLSPHelperProcess(t *testing.T) {
+	if os.Getenv("DIFFERING_FAKE_LSP") != "1" {
+		return
+	}
+	in := bufio.NewReader(os.Stdin)
+	write := func(msg any) {
+		body, _ := json.Marshal(msg)
+		fmt.Printf("Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	for {
+		length := 0
+		for {
+			line, err := in.ReadString('\n')
+			if err != nil {
+				os.Exit(0)
+			}
+			if line = strings.TrimSpace(line); line == "" {
+				break
+			}
+			if v, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+				length, _ = strconv.Atoi(strings.TrimSpace(v))
+			}
+		}
+		body := make([]byte, length)
+		io.ReadFull(in, body)
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				TextDocument struct {
+					URI  string `json:"uri"`
+					Text string `json:"text"`
+				} `json:"textDocument"`
+				ContentChanges []struct {
+					Text string `json:"text"`
+				} `json:"contentChanges"`
+			} `json:"params"`
+		}
+		json.Unmarshal(body, &msg)
+		switch msg.Method {
+		case "initialize":
+			// Servers may ask the client things before answering
+			write(map[string]any{"jsonrpc": "2.0", "id": "cfg", "method": "workspace/configuration", "params": map[string]any{"items": []any{map[string]any{}}}})
+			write(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]any{"capabilities": map[string]any{}}})
+		case "shutdown":
+			write(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": nil})
+		case "exit":
+			os.Exit(0)
+		case "textDocument/didOpen", "textDocument/didChange":
+			text := msg.Params.TextDocument.Text
+			if len(msg.Params.ContentChanges) > 0 {
+				text = msg.Params.ContentChanges[0].Text
+			}
+			diags := []any{}
+			for i, line := range strings.Split(text, "\n") {
+				if col := strings.Index(line, "BAD"); col >= 0 {
+					r := map[string]any{
+						"start": map[string]int{"line": i, "character": col},
+						"end":   map[string]int{"line": i, "character": col + 3},
+					}
+					diags = append(diags, map[string]any{"range": r, "severity": 1, "message": "bad code", "source": "fake"})
+				}
+			}
+			write(map[string]any{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics", "params": map[string]any{"uri": msg.Params.TextDocument.URI, "diagnostics": diags}})
+		}
+	}
+}
+
+func TestGetDiagnostics(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+	defer stopLanguageServers()
+
+	t.Setenv("DIFFERING_FAKE_LSP", "1")
+	runGit("config", "differing.lsp.go", shellQuote(os.Args[0])+" -test.run=^TestLSPHelperProcess$")
+
+	r := gin.New()
+	r.GET("/api/diagnostics/*filepath", getDiagnostics)
+	r.POST("/api/file-save/:id/*filepath", saveFile)
+
+	get := func(path string) (int, []Diagnostic) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body struct {
+			Diagnostics []Diagnostic `json:"diagnostics"`
+			Pending     bool         `json:"pending"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if body.Pending {
+			t.Errorf("%s timed out waiting for diagnostics", path)
+		}
+		return w.Code, body.Diagnostics
+	}
+
+	if code, _ := get("/api/diagnostics/test2.ts"); code != http.StatusNotFound {
+		t.Errorf("unconfigured language = %d, want 404", code)
+	}
+
+	code, diags := get("/api/diagnostics/test1.go")
+	if code != http.StatusOK || len(diags) != 0 {
+		t.Fatalf("clean file = %d %+v", code, diags)
+	}
+
+	// Saving through differing updates the running server
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/file-save/working/test1.go", strings.NewReader(`{"content":"package main\n\n  BAD\n"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("save = %d: %s", w.Code, w.Body.String())
+	}
+	code, diags = get("/api/diagnostics/test1.go")
+	want := Diagnostic{Line: 3, Column: 3, EndLine: 3, EndColumn: 6, Severity: "error", Message: "bad code", Source: "fake"}
+	if code != http.StatusOK || len(diags) != 1 || diags[0] != want {
+		t.Errorf("diagnostics = %d %+v, want %+v", code, diags, want)
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -37,33 +41,220 @@ type DiffInfo struct {
 	FilesCount int       `json:"filesCount"`
 	Additions  int       `json:"additions"`
 	Deletions  int       `json:"deletions"`
+	// Signature is nil for unsigned commits and the working changes entry
+	Signature *SignatureInfo `json:"signature,omitempty"`
+	// Boundary marks the oldest commit of a shallow clone, whose parent is
+	// missing locally; its diff is shown as if it were a root commit
+	Boundary bool `json:"boundary,omitempty"`
+	// Links are issue references in Message matched by differing.link rules
+	Links []MessageLink `json:"links,omitempty"`
+	// Conventional is set when Message follows the Conventional Commits format
+	Conventional *ConventionalCommit `json:"conventional,omitempty"`
 }
 
 type FileInfo struct {
 	Path      string `json:"path"`
-	Status    string `json:"status"` // added, modified, deleted
-	Additions int    `json:"additions"`
-	Deletions int    `json:"deletions"`
+	Status    string `json:"status"` // added, modified, deleted, typechange, unmerged, unknown
+	Submodule bool   `json:"submodule,omitempty"`
+	// OldPath is the path a renamed or copied file had on the old side
+	OldPath string `json:"oldPath,omitempty"`
+	// Symlink is set when either side is a symbolic link, whose content
+	// is the link target
+	Symlink bool `json:"symlink,omitempty"`
+	// Generated and Vendored come from linguist-* attributes in .gitattributes
+	Generated bool `json:"generated,omitempty"`
+	Vendored  bool `json:"vendored,omitempty"`
+	Additions int  `json:"additions"`
+	Deletions int  `json:"deletions"`
 }
 
 type FileDiff struct {
-	Path       string `json:"path"`
-	OldContent string `json:"oldContent"`
-	NewContent string `json:"newContent"`
+	Path       string           `json:"path"`
+	OldContent string           `json:"oldContent"`
+	NewContent string           `json:"newContent"`
+	Submodule  *SubmoduleChange `json:"submodule,omitempty"`
+	// OldExists and NewExists distinguish an absent file from an empty one
+	OldExists bool `json:"oldExists"`
+	NewExists bool `json:"newExists"`
+	// TooLarge and Binary are set instead of returning content; pass
+	// ?force=true to load oversized files anyway
+	TooLarge bool `json:"tooLarge,omitempty"`
+	Binary   bool `json:"binary,omitempty"`
+	// Image describes binary files that are PNG, JPEG or GIF images
+	Image *ImageDiff `json:"image,omitempty"`
+	// Truncated is set instead of returning content when more than
+	// maxDiffLines lines changed; Hunks holds the first page, and the rest
+	// come from /api/file-hunks starting at Hunks.NextOffset. Diffs read
+	// from a patch by differing view always carry Hunks, since their
+	// content is only the lines the patch shows.
+	Truncated   bool      `json:"truncated,omitempty"`
+	Hunks       *HunkPage `json:"hunks,omitempty"`
+	OldEncoding string    `json:"oldEncoding,omitempty"`
+	NewEncoding string    `json:"newEncoding,omitempty"`
+	// NewLineEnding is "crlf" when the working tree file's CRLF endings,
+	// which git normalizes to LF, were converted for display. Saving
+	// converts them back.
+	NewLineEnding string `json:"newLineEnding,omitempty"`
+	// Minified is set when either side is a minified JS or CSS file or
+	// single-line JSON. With ?prettify=true both sides are then formatted
+	// before diffing and Prettified is set; the content is for reading and
+	// should not be saved back.
+	Minified   bool `json:"minified,omitempty"`
+	Prettified bool `json:"prettified,omitempty"`
+	// Intraline is only computed when requested with ?intraline=true
+	Intraline []IntralineChange `json:"intraline,omitempty"`
+	// Whitespace lists trailing whitespace, mixed indentation and a missing
+	// final newline introduced on added lines, when requested with
+	// ?whitespaceCheck=true
+	Whitespace []WhitespaceIssue `json:"whitespace,omitempty"`
+	// Structural is set for JSON and YAML files when requested with
+	// ?structural=true; StructuralError explains why it could not be computed
+	Structural      []StructuralChange `json:"structural,omitempty"`
+	StructuralError string             `json:"structuralError,omitempty"`
+	// Table compares CSV and TSV files by row when requested with
+	// ?table=true; rows are matched by the first column unless
+	// &key=<column>[,<column>...] names others. TableError explains why
+	// it could not be computed.
+	Table      *TableDiff `json:"table,omitempty"`
+	TableError string     `json:"tableError,omitempty"`
+	// Cells holds per-cell changes for notebooks when requested with
+	// ?notebook=true (add &outputs=true to compare outputs too)
+	Cells []CellDiff `json:"cells,omitempty"`
+	// OldLFS and NewLFS describe Git LFS pointers; the pointer text is not
+	// returned as content unless ?lfs=true smudges in the real objects
+	OldLFS *LFSPointer `json:"oldLfs,omitempty"`
+	NewLFS *LFSPointer `json:"newLfs,omitempty"`
+	// Coverage marks new-side lines from the coverage profile when
+	// requested with ?coverage=true
+	Coverage *FileCoverage `json:"coverage,omitempty"`
+	// Annotations give the last commit to touch each unchanged new-side
+	// line when requested with ?annotations=true
+	Annotations []LineAnnotation `json:"annotations,omitempty"`
 }
 
+// SubmoduleChange describes a gitlink pointer change. Either side may be
+// empty when the submodule was added or removed.
+type SubmoduleChange struct {
+	OldCommit string `json:"oldCommit"`
+	NewCommit string `json:"newCommit"`
+}
+
+// gitlinkMode is the tree entry mode git uses for submodule commits
+const gitlinkMode = "160000"
+
+// usage describes the subcommands ahead of the flag list
+const usage = `Usage: differing [command] [flags]
+
+Commands:
+  (none)   serve the current repository, or show the server already running for it
+  serve    serve the current repository, or with -clone a remote one
+  start    serve the current repository in the background
+  stop     stop the background server for the current repository
+  status   list running servers
+  desktop  open a window listing running servers, with change notifications
+  diff     compare two files or directories: differing diff [flags] <old> <new>
+  view     show a unified diff from a file, or - for stdin: git diff | differing view -
+  json     print what the API returns without starting a server:
+           differing json diffs|files <id>|file-diff <id> <path> [key=value...]
+  tool     for git difftool and mergetool: differing tool <local> <remote> [<base> <merged>]
+           shows the files in the repository's server and waits until they are marked done
+  watch    serve the current repository and print links to each change as files are edited
+           and commits made; -open opens the first one
+
+Flags:
+`
+
 func main() {
+	command, args := splitCommand(os.Args[1:])
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
 	// Parse command-line flags
 	var (
-		addr = flag.String("addr", "localhost", "listen address")
-		port = flag.String("port", "3844", "listen port")
-		open = flag.Bool("open", false, "automatically open web browser")
+		addr      = flag.String("addr", "localhost", "listen address")
+		port      = flag.String("port", "3844", "listen port")
+		logLevel  = flag.String("log-level", "info", "log level: debug, info, warn, error")
+		logFormat = flag.String("log-format", "text", "log format: text or json")
+		idle      = flag.Duration("idle-timeout", 0, "exit after this long without requests (0 to never)")
 	)
+	var open openFlag
+	flag.Var(&open, "open", "automatically open web browser, or with -open=`commit[:path[:line]]` at that location")
+	gitProcs := flag.Int("git-procs", defaultGitProcs(), "most git processes to run at once")
+	cloneURL := flag.String("clone", "", "with serve, serve a read-only shallow clone of `url`")
+	cloneRef := flag.String("ref", "", "with -clone, the branch or tag to clone (default: the remote's default branch)")
+	fetchInterval := flag.Duration("fetch-interval", 5*time.Minute, "with -clone, how often to fetch updates (0 to never)")
+	gitExe := flag.String("git-path", "", "git executable to run (default: git on PATH)")
+	var gitEnv, gitConfig envList
+	flag.Var(&gitEnv, "git-env", "set `name=value` in the environment of git and other subprocesses (repeatable)")
+	flag.Var(&gitConfig, "git-config", "pass git config `key=value` to every git command (repeatable)")
+	flag.Int64Var(&maxFileSize, "max-file-size", maxFileSize, "largest file in bytes to show without ?force=true (0 for no limit)")
+	apiDocsUI := flag.Bool("api-docs", false, "serve Swagger UI for the API at /api/docs")
+	timeline := flag.Duration("timeline", 0, "snapshot working changes this often, and after saves, for /api/timeline (0 to disable)")
+	watchInterval := flag.Duration("watch-interval", 2*time.Second, "with watch, how often to check for changes")
 	flag.StringVar(port, "p", "3844", "listen port (shorthand)")
-	flag.Parse()
+	flag.CommandLine.Parse(args)
+	portSet := false
+	flag.Visit(func(f *flag.Flag) {
+		portSet = portSet || f.Name == "port" || f.Name == "p"
+	})
+
+	setGitProcs(*gitProcs)
+	if err := configureGit(*gitExe, gitEnv, gitConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	logger, err := newLogger(*logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	// These commands work outside any repository
+	switch command {
+	case "status":
+		exitOn(printStatus())
+		return
+	case "desktop":
+		exitOn(runDesktop(*addr, *port, portSet))
+		return
+	case "diff":
+		if flag.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "Error: diff takes two paths to compare")
+			os.Exit(2)
+		}
+		d, err := comparePaths(flag.Arg(0), flag.Arg(1))
+		exitOn(err)
+		exitOn(serveStatic(d, *addr, *port, open.set, *idle))
+		return
+	case "view":
+		if flag.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "Error: view takes one patch file, or - to read stdin")
+			os.Exit(2)
+		}
+		d, err := readPatchFile(flag.Arg(0))
+		exitOn(err)
+		exitOn(serveStatic(d, *addr, *port, open.set, *idle))
+		return
+	}
+
+	if *cloneURL != "" {
+		if command != "serve" {
+			fmt.Fprintln(os.Stderr, "Error: -clone is only supported by the serve command")
+			os.Exit(2)
+		}
+		dir, err := prepareClone(*cloneURL, *cloneRef)
+		if err == nil {
+			err = os.Chdir(dir)
+		}
+		exitOn(err)
+		readOnly = true
+	}
 
 	// Check if we're in a git repository and get the root
-	var err error
 	gitRoot, err = getGitRoot()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -76,85 +267,291 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Error: failed to create secure root: %v\n", err)
 		os.Exit(1)
 	}
+	// Resolve -open's location before starting so a bad one fails fast
+	var openPath string
+	if open.location != "" {
+		loc, err := parseLocation(open.location)
+		if err == nil {
+			loc, err = resolveLocation(context.Background(), loc)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -open: %v\n", err)
+			os.Exit(1)
+		}
+		openPath = loc.URL()
+	}
 
-	// Set GIN to release mode for production
-	gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
+	switch command {
+	case "json":
+		exitOn(runJSON(flag.Args(), os.Stdout))
+		return
+	case "tool":
+		code, err := runTool(flag.Args(), portSet, open.set)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(code)
+	case "start":
+		exitOn(startDaemon(gitRoot, args, portSet))
+		return
+	case "stop":
+		exitOn(stopDaemon(gitRoot))
+		return
+	case "serve":
+	case "watch":
+		// Watch through the server already running for this repository
+		if inst, ok := liveInstance(gitRoot); ok {
+			fmt.Printf("Watching %s through %s\n", gitRoot, inst.URL)
+			watchRepo(newWatcher(inst.URL, os.Stdout, open.set, *timeline > 0), *watchInterval)
+			return
+		}
+	case "":
+		// Attach to the server already running for this repository
+		if inst, ok := liveInstance(gitRoot); ok {
+			fmt.Printf("differing is already running for %s at %s\n", gitRoot, inst.URL)
+			if open.set {
+				openBrowser(inst.URL + openPath)
+			}
+			return
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q\n", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := recordRecentRepo(gitRoot); err != nil {
+		slog.Warn("failed to record recent repository", "path", gitRoot, "error", err)
+	}
+
+	r := newRouter()
+
+	// Switching repositories waits for in-flight API requests, so it is
+	// registered outside the group that holds the active repository
+	r.POST("/api/repo/switch", postSwitchRepo)
+	r.POST("/api/shutdown", postShutdown)
+	// Proposals can wait for a decision for a long time, so they take the
+	// repository only while they use it
+	r.POST("/api/proposals", postProposal)
+	r.GET("/api/proposals/:id", getProposal)
+	r.POST("/api/tool-sessions", postToolSession)
+	r.GET("/api/tool-sessions/:id", getToolSession)
+	r.GET("/api/editor/state", getEditorState)
+	r.GET("/api/openapi.json", getOpenAPI(r))
+	if *apiDocsUI {
+		r.GET("/api/docs", getSwaggerUI)
+	}
 
 	// API routes
-	api := r.Group("/api")
+	api := r.Group("/api", holdRepo())
 	{
 		api.GET("/repo-info", getRepoInfo)
+		api.GET("/recent-repos", getRecentRepos)
+		api.GET("/format-patch", getFormatPatch)
+		api.POST("/send-email", postSendEmail)
+		api.POST("/am", serializeHistory(), postApplyMailbox)
+		api.GET("/bundle", getBundle)
+		api.POST("/bundle", postBundle)
+		api.GET("/location", getLocation)
+		api.POST("/deepen", deepenHistory)
 		api.GET("/diffs", getDiffs)
 		api.GET("/diffs/:id/files", getDiffFiles)
+		api.GET("/diffs/:id/tree", getDiffTree)
+		api.GET("/diffs/:id/archive.zip", getDiffArchive)
+		api.GET("/diffs/:id/submodule", getSubmodule)
+		api.GET("/diffs/:id/coverage", getDiffCoverage)
+		api.GET("/diffs/:id/affected-tests", getAffectedTests)
+		api.GET("/diffs/:id/risk", getDiffRisk)
+		api.GET("/diffs/:id/stats", getDiffStats)
+		api.GET("/analytics/churn", getChurn)
+		api.GET("/diffs/:id/owners", getDiffOwners)
+		api.GET("/owners/*filepath", getOwners)
+		api.POST("/run-tests", runTests)
+		api.GET("/symbols/:id/*filepath", getSymbols)
+		api.GET("/highlight/:id/*filepath", getHighlight)
+		api.GET("/diagnostics/*filepath", getDiagnostics)
+		api.GET("/diffs/:id/progress", getProgress)
+		api.PUT("/diffs/:id/progress", putProgress)
+		api.DELETE("/diffs/:id/progress", deleteProgress)
+		api.GET("/diffs/:id/submodule/file", getSubmoduleFileDiff)
 		api.GET("/file-diff/:id/*filepath", getFileDiff)
+		api.GET("/dir-diff/:id/*dirpath", getDirDiff)
+		api.GET("/compare-files", getCompareFiles)
+		api.POST("/compare-content/*filepath", postCompareContent)
+		api.GET("/file-patch/:id/*filepath", getFilePatch)
+		api.GET("/file-hunks/:id/*filepath", getFileHunks)
+		api.GET("/raw/:id/*filepath", getRawFile)
+		api.GET("/image-diff/:id/*filepath", getImageDiff)
 		api.POST("/file-save/:id/*filepath", saveFile)
+		api.POST("/apply-suggestion/*filepath", postApplySuggestion)
+		api.POST("/fix-whitespace/*filepath", postFixWhitespace)
+		api.GET("/index/*filepath", getIndexFile)
+		api.PUT("/index/*filepath", putIndexFile)
+		api.GET("/notes/:commit", getNote)
+		api.PUT("/notes/:commit", putNote)
+		api.DELETE("/notes/:commit", deleteNote)
+		api.POST("/notes/:commit/approve", approveCommit)
+		api.GET("/commits/:commit", getCommit)
+		api.POST("/commits/:commit/squash", serializeHistory(), squashCommit)
+		api.POST("/commits/:commit/drop", serializeHistory(), dropCommit)
+		api.POST("/commits/:commit/edit", serializeHistory(), editCommit)
+		api.GET("/stack", getStack)
+		api.POST("/stack/reorder", serializeHistory(), reorderStack)
+		api.GET("/interdiff", getInterdiff)
+		api.GET("/snapshots", getSnapshots)
+		api.POST("/snapshots", postSnapshot)
+		api.DELETE("/snapshots/:id", deleteSnapshot)
+		api.GET("/timeline", getTimeline)
+		api.POST("/timeline", postTimeline)
+		api.GET("/baseline", getBaseline)
+		api.PUT("/baseline", putBaseline)
+		api.DELETE("/baseline", deleteBaseline)
+		api.GET("/proposals", getProposals)
+		api.POST("/proposals/:id/approve", approveProposal)
+		api.POST("/proposals/:id/reject", rejectProposal)
+		api.GET("/tool-sessions", getToolSessions)
+		api.POST("/tool-sessions/:id/done", finishToolSession)
+		api.POST("/editor/goto", postEditorGoto)
+		api.POST("/commit/:id/fixup", serializeHistory(), createFixup)
+		api.POST("/autosquash", serializeHistory(), autosquash)
+		api.POST("/commits/:commit/split", serializeHistory(), startSplit)
+		api.GET("/split", getSplit)
+		api.POST("/split/commit", serializeHistory(), commitSplitPart)
+		api.POST("/split/continue", serializeHistory(), continueSplit)
+		api.POST("/split/abort", serializeHistory(), abortSplit)
+		api.GET("/rebase", getRebase)
+		api.POST("/rebase", serializeHistory(), rebaseBranch)
+		api.POST("/rebase/continue", serializeHistory(), continueRebase)
+		api.POST("/rebase/abort", serializeHistory(), abortRebase)
+		api.POST("/merge", serializeHistory(), mergeBranch)
+		api.POST("/merge/continue", serializeHistory(), continueMerge)
+		api.POST("/merge/abort", serializeHistory(), abortMerge)
+		api.GET("/branches", getBranches)
+		api.POST("/branches", createBranch)
+		api.POST("/branches/rename", renameBranch)
+		api.DELETE("/branches/*name", deleteBranch)
+		api.GET("/remotes", getRemotes)
+		api.POST("/remotes", addRemote)
+		api.DELETE("/remotes/:name", removeRemote)
+		api.PUT("/upstream", putUpstream)
+		api.DELETE("/upstream", deleteUpstream)
+		api.PUT("/coverage", putCoverage)
+		api.DELETE("/coverage", deleteCoverage)
+		api.GET("/checks", getChecks)
+		api.POST("/checks/run", runChecks)
+		api.POST("/hooks/pre-commit", runPreCommit)
+		api.GET("/plugins", getPlugins)
+		api.POST("/plugins/:name/run", runPlugin)
+		api.GET("/commit-template", getCommitTemplate)
+		api.POST("/lint-message", postLintMessage)
+		api.GET("/preferences", getPreferences)
+		api.PUT("/preferences", putPreferences)
+		api.POST("/undo", serializeHistory(), postUndo)
+		api.GET("/secrets/staged", getStagedSecrets)
+		api.GET("/clean/preview", getCleanPreview)
+		api.POST("/clean", postClean)
+		api.GET("/ignore", getIgnore)
+		api.GET("/nested-repos", getNestedRepos)
+		api.POST("/ignore", postIgnore)
+		api.GET("/check-ignore/*filepath", getCheckIgnore)
 	}
 
-	// Serve embedded frontend files
-	frontendSubFS, err := fs.Sub(frontendFS, "frontend/dist")
-	if err != nil {
-		log.Fatal("Failed to create frontend sub filesystem:", err)
+	if err := mountFrontend(r); err != nil {
+		slog.Error("failed to load frontend", "error", err)
+		os.Exit(1)
 	}
 
-	// Custom handler for serving embedded files
-	serveFile := func(c *gin.Context, filename string) {
-		data, err := frontendSubFS.Open(filename)
-		if err != nil {
-			c.String(http.StatusNotFound, "File not found: %s", filename)
-			return
-		}
-		defer data.Close()
-		content, _ := io.ReadAll(data)
+	ln, url, err := listen(*addr, *port)
+	exitOn(err)
 
-		contentType := "text/plain"
-		if strings.HasSuffix(filename, ".js") {
-			contentType = "application/javascript"
-		} else if strings.HasSuffix(filename, ".css") {
-			contentType = "text/css"
-		} else if strings.HasSuffix(filename, ".html") {
-			contentType = "text/html; charset=utf-8"
-		}
+	fmt.Printf("differing starting on %s\n", strings.TrimPrefix(url, "http://"))
+	fmt.Printf("Open %s in your browser\n", url)
+	registerSelf(gitRoot, url)
+	if *cloneURL != "" {
+		go fetchPeriodically(gitRoot, *cloneRef, *fetchInterval)
+	}
+	startTimeline(*timeline)
+
+	// Open browser if requested. Watching opens it at the first change
+	// instead.
+	if command == "watch" {
+		go watchRepo(newWatcher(url, os.Stdout, open.set, *timeline > 0), *watchInterval)
+	} else if open.set {
+		go openBrowser(url + openPath)
+	}
 
-		c.Data(http.StatusOK, contentType, content)
+	err = server.serve(&http.Server{Handler: versionedAPI(r)}, ln, *idle)
+	unregisterSelf()
+	stopLanguageServers()
+	if err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// newRouter returns an engine with the middleware every differing server
+// uses. Request logging goes through slog rather than gin's default logger.
+func newRouter() *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	// Match routes on the escaped path so diff IDs like origin%2Fmain..HEAD
+	// can contain slashes
+	r.UseRawPath = true
+	r.UnescapePathValues = true
+	r.Use(server.track(), requestLogger(), gin.Recovery(), rejectWrites(), compressResponses())
+	return r
+}
+
+// mountFrontend serves the embedded frontend at / and for every path that
+// no route handles, except under /api
+func mountFrontend(r *gin.Engine) error {
+	frontendSubFS, err := fs.Sub(frontendFS, "frontend/dist")
+	if err != nil {
+		return err
+	}
+	frontend, err := newFrontendHandler(frontendSubFS)
+	if err != nil {
+		return err
 	}
 
 	// Serve index.html at root
-	r.GET("/", func(c *gin.Context) {
-		serveFile(c, "index.html")
-	})
+	r.GET("/", frontend.serve)
 
 	// Handle all other routes - serve static files or SPA fallback
 	r.NoRoute(func(c *gin.Context) {
 		// Don't serve SPA fallback for API routes
 		if strings.HasPrefix(c.Request.URL.Path, "/api") {
-			c.JSON(http.StatusNotFound, gin.H{"error": "API endpoint not found"})
+			respondError(c, http.StatusNotFound, "API endpoint not found", nil)
 			return
 		}
-
-		path := strings.TrimPrefix(c.Request.URL.Path, "/")
-
-		// Try to serve the file from embedded frontend
-		if _, err := frontendSubFS.Open(path); err == nil {
-			serveFile(c, path)
-		} else {
-			// If not found, serve index.html for client-side routing
-			serveFile(c, "index.html")
-		}
+		frontend.serve(c)
 	})
+	return nil
+}
 
-	listen := fmt.Sprintf("%s:%s", *addr, *port)
-	url := fmt.Sprintf("http://%s:%s", *addr, *port)
-
-	fmt.Printf("differing starting on %s\n", listen)
-	fmt.Printf("Open %s in your browser\n", url)
+// listen opens addr:port and returns the URL it is reachable at. Listening
+// before announcing lets port 0 be reported as the port the system chose.
+func listen(addr, port string) (net.Listener, string, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort(addr, port))
+	if err != nil {
+		return nil, "", err
+	}
+	return ln, "http://" + net.JoinHostPort(addr, strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)), nil
+}
 
-	// Open browser if requested
-	if *open {
-		go openBrowser(url)
+// splitCommand separates a leading subcommand from the flags after it
+func splitCommand(args []string) (command string, rest []string) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return args[0], args[1:]
 	}
+	return "", args
+}
 
-	log.Fatal(r.Run(listen))
+// exitOn reports err and exits unsuccessfully if it is not nil
+func exitOn(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 }
 
 // openBrowser opens the default browser to the given URL
@@ -163,51 +560,142 @@ func openBrowser(url string) {
 	var cmd *exec.Cmd
 	switch runtime.GOOS {
 	case "darwin":
-		cmd = exec.Command("open", url)
+		cmd = toolCommand("open", url)
 	case "linux":
-		cmd = exec.Command("xdg-open", url)
+		cmd = toolCommand("xdg-open", url)
 	case "windows":
-		cmd = exec.Command("cmd", "/c", "start", url)
+		cmd = toolCommand("cmd", "/c", "start", url)
 	default:
-		fmt.Println("Unable to open browser on this platform")
+		slog.Warn("unable to open browser on this platform", "os", runtime.GOOS)
 		return
 	}
 	if err := cmd.Start(); err != nil {
-		log.Printf("Failed to open browser: %v", err)
+		slog.Warn("failed to open browser", "error", err)
 	}
 }
 
-func getRepoInfo(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"path": gitRoot})
-}
-
 func getDiffs(c *gin.Context) {
 	var diffs []DiffInfo
 
-	// Always include working changes entry
-	// Get diffstat for working changes (unstaged + staged combined)
-	workingStatCmd := exec.Command("git", "diff", "HEAD", "--numstat")
-	workingStatOutput, _ := workingStatCmd.Output()
-	workingAdditions, workingDeletions, workingFilesCount := parseDiffStat(string(workingStatOutput))
-
-	diffs = append(diffs, DiffInfo{
-		ID:         "working",
-		Message:    "Working Changes",
-		Author:     "",
-		Timestamp:  time.Now(),
-		FilesCount: workingFilesCount,
-		Additions:  workingAdditions,
-		Deletions:  workingDeletions,
+	filter, err := logFilterFromQuery(c)
+	switch {
+	case errors.Is(err, errUnknownRevision):
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	case err != nil:
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	head := currentHead()
+	// Cached diffstats leave out generated and vendored files, so they
+	// only hold while the attributes marking those do
+	cache.useAttributes(attributesKey())
+	if c.Query("stream") == "true" {
+		streamDiffs(c, filter, head)
+		return
+	}
+
+	// Always include working changes entry, unless listing another branch,
+	// whose history the working tree has nothing to do with
+	if filter.Rev == "" || filter.Rev == head {
+		working := workingDiffInfo()
+		fillWorkingStat(c.Request.Context(), &working)
+		diffs = append(diffs, working)
+		if baseline := baselineDiffInfo(); baseline != nil {
+			fillBaselineStat(baseline)
+			diffs = append(diffs, *baseline)
+		}
+		diffs = append(diffs, proposalDiffInfos()...)
+		diffs = append(diffs, toolDiffInfos()...)
+	}
+
+	// Get git commits/diffs. The listing and each commit's diffstat are
+	// cached, so this only shells out when HEAD or the filter changes.
+	logKey := ""
+	if head != "" {
+		logKey = head + filter.key()
+	}
+	ids, ok := cache.log(logKey)
+	if !ok {
+		commits, err := loadCommits(c.Request.Context(), filter)
+		if err != nil {
+			slog.Error("git log failed", "error", err)
+			respondError(c, http.StatusInternalServerError, "Failed to get git log", nil)
+			return
+		}
+		ids = make([]string, 0, len(commits))
+		for _, info := range commits {
+			ids = append(ids, info.ID)
+		}
+		cache.putLog(logKey, ids)
+	}
+
+	// Links are found per request rather than cached so edits to the
+	// rules apply immediately
+	rules := linkRules()
+	for _, id := range ids {
+		if info, ok := cache.commit(id); ok {
+			info.Links = findLinks(rules, info.Message)
+			diffs = append(diffs, info)
+		}
+	}
+
+	if groupBy := c.Query("groupBy"); groupBy != "" {
+		groups, err := groupDiffs(diffs, groupBy)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		c.JSON(http.StatusOK, groups)
+		return
+	}
+
+	c.JSON(http.StatusOK, diffs)
+}
+
+// workingDiffInfo returns the working changes entry without its diffstat
+func workingDiffInfo() DiffInfo {
+	return DiffInfo{
+		ID:        "working",
+		Message:   "Working Changes",
+		Author:    "",
+		Timestamp: time.Now(),
+	}
+}
+
+// fillWorkingStat sets the working changes entry's diffstat, staged and
+// unstaged changes combined
+func fillWorkingStat(ctx context.Context, info *DiffInfo) {
+	workingStatOutput, _ := runGitContext(ctx, "diff", "HEAD", "--numstat", "-z")
+	info.Additions, info.Deletions, info.FilesCount = headlineDiffStat(string(workingStatOutput))
+}
+
+// loadCommits lists recent commits matching filter with their diffstats,
+// reusing cached stats for commits that have been seen before
+func loadCommits(ctx context.Context, filter logFilter) ([]DiffInfo, error) {
+	commits, pending, err := logCommits(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	forEachParallel(len(pending), commitStatParallelism, func(j int) {
+		i := pending[j]
+		fillCommitStat(ctx, &commits[i])
+		cache.putCommit(commits[i])
 	})
+	return commits, nil
+}
 
-	// Get git commits/diffs
-	cmd := exec.Command("git", "log", "--oneline", "-20", "--pretty=format:%H%x00%s%x00%an%x00%at")
-	output, err := cmd.Output()
+// logCommits lists recent commits matching filter. Commits seen before
+// come from the cache complete with their diffstats; pending holds the
+// indexes of the rest, whose stats are left for fillCommitStat.
+func logCommits(ctx context.Context, filter logFilter) (commits []DiffInfo, pending []int, err error) {
+	args := append([]string{"log", "--oneline", "-20", "--pretty=format:%H%x00%s%x00%an%x00%at%x00" + signatureFormat}, filter.args()...)
+	output, err := runGitContext(ctx, args...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get git log"})
-		return
+		return nil, nil, err
 	}
 
+	boundary := shallowBoundary()
 	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
 
 	for _, line := range lines {
@@ -219,46 +707,52 @@ func getDiffs(c *gin.Context) {
 			continue
 		}
 
-		timestamp, _ := strconv.ParseInt(parts[3], 10, 64)
+		if info, ok := cache.commit(parts[0]); ok {
+			commits = append(commits, info)
+			continue
+		}
 
-		// Get diffstat for this commit
-		statCmd := exec.Command("git", "diff", parts[0]+"^", parts[0], "--numstat")
-		statOutput, _ := statCmd.Output()
-		additions, deletions, filesCount := parseDiffStat(string(statOutput))
-
-		diffs = append(diffs, DiffInfo{
-			ID:         parts[0],
-			Message:    parts[1],
-			Author:     parts[2],
-			Timestamp:  time.Unix(timestamp, 0),
-			FilesCount: filesCount,
-			Additions:  additions,
-			Deletions:  deletions,
-		})
+		timestamp, _ := strconv.ParseInt(parts[3], 10, 64)
+		info := DiffInfo{
+			ID:        parts[0],
+			Message:   parts[1],
+			Author:    parts[2],
+			Timestamp: time.Unix(timestamp, 0),
+			Boundary:  boundary[parts[0]],
+			// Conventional is derived from the subject alone; breaking
+			// changes flagged only by a BREAKING CHANGE footer are missed
+			Conventional: parseConventional(parts[1]),
+		}
+		if len(parts) >= 7 {
+			info.Signature = parseSignature(parts[4], parts[5], parts[6])
+		}
+		pending = append(pending, len(commits))
+		commits = append(commits, info)
 	}
 
-	c.JSON(http.StatusOK, diffs)
+	return commits, pending, nil
 }
 
-// parseDiffStat parses git diff --numstat output and returns additions, deletions, and file count
-func parseDiffStat(output string) (additions, deletions, filesCount int) {
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-		parts := strings.Fields(line)
-		if len(parts) >= 2 {
-			// Handle binary files (shown as "-" in numstat)
-			if parts[0] != "-" {
-				add, _ := strconv.Atoi(parts[0])
-				additions += add
-			}
-			if parts[1] != "-" {
-				del, _ := strconv.Atoi(parts[1])
-				deletions += del
-			}
-			filesCount++
+// fillCommitStat sets a commit's diffstat. Root commits, and commits whose
+// parent is missing from a shallow clone, are diffed against the empty
+// tree.
+func fillCommitStat(ctx context.Context, info *DiffInfo) {
+	spec, err := resolveDiff(info.ID, modeCommit)
+	if err != nil {
+		return
+	}
+	statOutput, _ := runGitContext(ctx, append([]string{"diff", "--numstat", "-z"}, spec.revArgs()...)...)
+	info.Additions, info.Deletions, info.FilesCount = headlineDiffStat(string(statOutput))
+}
+
+// parseDiffStat parses git diff --numstat -z output and returns additions, deletions, and file count.
+// Files in skip are counted but their line changes are not.
+func parseDiffStat(output string, skip map[string]bool) (additions, deletions, filesCount int) {
+	for _, e := range parseNumstat(output) {
+		filesCount++
+		if !skip[e.Path] {
+			additions += e.Additions
+			deletions += e.Deletions
 		}
 	}
 	return
@@ -267,66 +761,98 @@ func parseDiffStat(output string) (additions, deletions, filesCount int) {
 func getDiffFiles(c *gin.Context) {
 	diffID := c.Param("id")
 
-	var cmd *exec.Cmd
-	var statBaseArg string
+	opts, err := diffOptionsFromQuery(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
 
-	if diffID == "working" {
-		// For working changes, diff HEAD against working tree
-		cmd = exec.Command("git", "diff", "--name-status", "HEAD")
-		statBaseArg = "HEAD"
-	} else {
-		// Get files changed from parent of commit to working tree
-		// This shows all changes including the selected commit
-		cmd = exec.Command("git", "diff", "--name-status", diffID+"^")
-		statBaseArg = diffID + "^"
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
 	}
 
-	output, err := cmd.Output()
+	files, err := listDiffFiles(c.Request.Context(), spec, opts, pathspecsFromQuery(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get diff files"})
+		slog.Error("git diff failed", "diff", diffID, "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to get diff files", nil)
 		return
 	}
 
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	var files []FileInfo
-
-	for _, line := range lines {
-		if line == "" {
-			continue
+	// Reviews usually start at the top of the list
+	var first []string
+	for _, f := range files {
+		if len(first) == prefetchFiles {
+			break
 		}
-		parts := strings.Fields(line)
-		if len(parts) < 2 {
-			continue
+		if !f.Submodule {
+			first = append(first, f.Path)
 		}
+	}
+	prefetchFileDiffs(spec, first)
 
-		status := "modified"
-		switch parts[0] {
-		case "A":
-			status = "added"
-		case "D":
-			status = "deleted"
-		case "M":
-			status = "modified"
+	c.JSON(http.StatusOK, files)
+}
+
+// listDiffFiles returns the files changed by a diff, sorted by path and
+// limited to the given pathspecs when any are supplied. The diff options
+// affect the per-file line counts.
+func listDiffFiles(ctx context.Context, spec diffSpec, opts DiffOptions, pathspecs []string) ([]FileInfo, error) {
+	// Diffs between two commits are the same every time, as long as the
+	// attributes marking generated and vendored files are
+	var cacheKey string
+	if spec.newSideInGit() {
+		cache.useAttributes(attributesKey())
+		cacheKey = fmt.Sprintf("%s\x00%s\x00%t\x00%s\x00%s", spec.Base, spec.Head, spec.Reverse,
+			strings.Join(opts.args(), "\x00"), strings.Join(pathspecs, "\x00"))
+		if files, ok := cache.fileList(cacheKey); ok {
+			return files, nil
 		}
+	}
+
+	args := append([]string{"diff", "--raw", "-z"}, spec.revArgs()...)
+	if len(pathspecs) > 0 {
+		args = append(append(args, "--"), pathspecs...)
+	}
+
+	output, err := runGitContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	files := parseRawDiff(string(output))
+	// Files the repository tracks inside a nested repository belong to
+	// that repository now, whatever the parent's index says
+	if !spec.newSideInGit() {
+		files = withoutNestedRepos(files)
+	}
 
-		// Get additions/deletions for this file
-		statCmd := exec.Command("git", "diff", statBaseArg, "--numstat", "--", parts[1])
-		statOutput, _ := statCmd.Output()
-		additions, deletions := 0, 0
+	// Get additions/deletions for each file
+	forEachParallel(len(files), fileStatParallelism, func(i int) {
+		statArgs := append(append([]string{"diff"}, opts.args()...), spec.revArgs()...)
+		statArgs = append(statArgs, "--numstat", "--", files[i].Path)
+		statOutput, _ := runGitContext(ctx, statArgs...)
 		if statOutput != nil {
 			statParts := strings.Fields(string(statOutput))
 			if len(statParts) >= 2 {
-				additions, _ = strconv.Atoi(statParts[0])
-				deletions, _ = strconv.Atoi(statParts[1])
+				files[i].Additions, _ = strconv.Atoi(statParts[0])
+				files[i].Deletions, _ = strconv.Atoi(statParts[1])
 			}
 		}
+	})
 
-		files = append(files, FileInfo{
-			Path:      parts[1],
-			Status:    status,
-			Additions: additions,
-			Deletions: deletions,
-		})
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	if attrs, err := lookupAttrs(paths); err == nil {
+		for i := range files {
+			a := attrs[files[i].Path]
+			files[i].Generated = a.Generated
+			files[i].Vendored = a.Vendored
+		}
+	} else {
+		slog.Warn("git check-attr failed", "error", err)
 	}
 
 	// Sort files alphabetically
@@ -334,40 +860,410 @@ func getDiffFiles(c *gin.Context) {
 		return files[i].Path < files[j].Path
 	})
 
-	c.JSON(http.StatusOK, files)
+	if cacheKey != "" {
+		cache.putFileList(cacheKey, files)
+	}
+	return files, nil
+}
+
+// parseRawDiff parses `git diff --raw -z` output into file entries.
+// Entries are ":oldmode newmode oldsha newsha status\0path\0"; copies and
+// renames carry a second path, which we report as the entry's path, and
+// the first as its OldPath.
+func parseRawDiff(output string) []FileInfo {
+	var files []FileInfo
+	tokens := strings.Split(output, "\x00")
+	for i := 0; i < len(tokens); i++ {
+		meta := tokens[i]
+		if !strings.HasPrefix(meta, ":") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(meta, ":"))
+		if len(fields) < 5 || i+1 >= len(tokens) {
+			continue
+		}
+		code := fields[4]
+		i++
+		path, oldPath := tokens[i], ""
+		if (code[0] == 'R' || code[0] == 'C') && i+1 < len(tokens) {
+			i++
+			path, oldPath = tokens[i], path
+		}
+		files = append(files, FileInfo{
+			Path:      path,
+			Status:    statusFromCode(code),
+			Submodule: fields[0] == gitlinkMode || fields[1] == gitlinkMode,
+			OldPath:   oldPath,
+			Symlink:   fields[0] == symlinkMode || fields[1] == symlinkMode,
+		})
+	}
+	return files
+}
+
+// statusFromCode maps a git status letter to the status names used by the API
+func statusFromCode(code string) string {
+	if code == "" {
+		return "modified"
+	}
+	switch code[0] {
+	case 'A':
+		return "added"
+	case 'D':
+		return "deleted"
+	case 'T':
+		return "typechange"
+	case 'U':
+		return "unmerged"
+	case 'X':
+		return "unknown"
+	default:
+		return "modified"
+	}
+}
+
+// submoduleCommit returns the commit a gitlink points to at the given
+// revision, or "" if the path is not a submodule there.
+func submoduleCommit(rev, path string) string {
+	output, err := runGit("ls-tree", rev, "--", path)
+	if err != nil {
+		return ""
+	}
+	// Format: "<mode> <type> <sha>\t<path>"
+	fields := strings.Fields(string(output))
+	if len(fields) < 3 || fields[0] != gitlinkMode {
+		return ""
+	}
+	return fields[2]
+}
+
+// workingSubmoduleCommit returns the commit currently checked out in a
+// submodule, falling back to the index entry when it isn't checked out.
+func workingSubmoduleCommit(path string) string {
+	// An uninitialized submodule is an empty directory, where rev-parse
+	// would resolve the superproject's HEAD instead
+	if _, err := os.Stat(filepath.Join(gitRoot, path, ".git")); err == nil {
+		if output, err := runGit("-C", filepath.Join(gitRoot, path), "rev-parse", "HEAD"); err == nil {
+			return strings.TrimSpace(string(output))
+		}
+	}
+	return indexSubmoduleCommit(path)
+}
+
+// indexSubmoduleCommit returns the commit the index records for a
+// submodule, or "" when path is not one
+func indexSubmoduleCommit(path string) string {
+	output, err := runGit("ls-files", "-s", "--", path)
+	if err != nil {
+		return ""
+	}
+	// Format: "<mode> <sha> <stage>\t<path>"
+	fields := strings.Fields(string(output))
+	if len(fields) < 2 || fields[0] != gitlinkMode {
+		return ""
+	}
+	return fields[1]
+}
+
+// isWorkingSubmodule reports whether path is a submodule in the index
+func isWorkingSubmodule(path string) bool {
+	output, err := runGit("ls-files", "-s", "--", path)
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(output))
+	return len(fields) >= 1 && fields[0] == gitlinkMode
+}
+
+// submoduleDiff builds a FileDiff for a submodule pointer change, rendering
+// each side as a single "Subproject commit" line like git diff does.
+func submoduleDiff(filePath, oldCommit, newCommit string) FileDiff {
+	content := func(commit string) string {
+		if commit == "" {
+			return ""
+		}
+		return "Subproject commit " + commit + "\n"
+	}
+	return FileDiff{
+		Path:       filePath,
+		OldContent: content(oldCommit),
+		NewContent: content(newCommit),
+		Submodule:  &SubmoduleChange{OldCommit: oldCommit, NewCommit: newCommit},
+	}
 }
 
 func getFileDiff(c *gin.Context) {
-	diffID := c.Param("id")
-	filePath := strings.TrimPrefix(c.Param("filepath"), "/")
+	filePath := filePathParam(c)
+
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+
+	// Submodules are directories in the working tree; show the pointer
+	// change instead of trying to read them as files
+	if oldSubmodule, newSubmodule, ok := submoduleRange(spec, filePath); ok {
+		c.JSON(http.StatusOK, submoduleDiff(filePath, oldSubmodule, newSubmodule))
+		return
+	}
+
+	prefetchNextFile(spec, filePath)
+
+	force := c.Query("force") == "true"
+	intraline := c.Query("intraline") == "true"
+	checkWhitespace := c.Query("whitespaceCheck") == "true"
+	structural := c.Query("structural") == "true"
+	notebook := c.Query("notebook") == "true"
+	includeOutputs := c.Query("outputs") == "true"
+	smudge := c.Query("lfs") == "true"
+	withCoverage := c.Query("coverage") == "true"
+	annotate := c.Query("annotations") == "true"
+	pretty := c.Query("prettify") == "true"
+	tabular := c.Query("table") == "true"
+	fileDiff := FileDiff{Path: filePath}
+
+	// A case-only rename leaves the file under another name on one side;
+	// look for one when a side is missing
+	basePath, headPath := filePath, filePath
+	renameChecked := false
+	renamed := func() bool {
+		if !renameChecked {
+			renameChecked = true
+			if oldPath, newPath, ok := caseRename(spec, filePath); ok {
+				basePath, headPath = oldPath, newPath
+			}
+		}
+		return basePath != headPath
+	}
+
+	// Look up the old version of the file. Check the blob size first so
+	// huge generated files are never read into memory.
+	var oldSHA string
+	var oldData []byte
+	if spec.Base != "" {
+		sha, size, found, err := blobInfo(spec.Base, basePath)
+		if err == nil && !found && renamed() {
+			sha, size, found, err = blobInfo(spec.Base, basePath)
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to read old file version", err)
+			return
+		}
+		oldSHA = sha
+		fileDiff.OldExists = found
+		if found && exceedsLimit(size, force) {
+			fileDiff.TooLarge = true
+		}
+	}
 
-	var oldCmd *exec.Cmd
-	if diffID == "working" {
-		// For working changes, compare HEAD to working tree
-		oldCmd = exec.Command("git", "show", "HEAD:"+filePath)
+	// Get new version of file: from git when the diff ends at a commit or
+	// the index, otherwise from the working tree
+	var newSHA string
+	var newData []byte
+	var newVersion string
+	if spec.newSideInGit() {
+		sha, size, found, err := blobInfo(spec.Head, headPath)
+		if err == nil && !found && renamed() {
+			sha, size, found, err = blobInfo(spec.Head, headPath)
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to read new file version", err)
+			return
+		}
+		newSHA, newVersion = sha, sha
+		fileDiff.NewExists = found
+		if found && exceedsLimit(size, force) {
+			fileDiff.TooLarge = true
+		}
 	} else {
-		// Get old version of file (from parent of selected commit)
-		oldCmd = exec.Command("git", "show", diffID+"^:"+filePath)
+		if _, err := secureRoot.Lstat(headPath); errors.Is(err, fs.ErrNotExist) {
+			renamed()
+		}
+		// Use secureRoot which is rooted at gitRoot, ensuring correct path resolution
+		// regardless of the current working directory. A symlink's content is
+		// its target, as in git, not the file it points to.
+		target, isLink, err := workingLink(headPath)
+		var file *os.File
+		if err == nil && !isLink {
+			file, err = secureRoot.Open(headPath)
+		}
+		switch {
+		case isLink:
+			fileDiff.NewExists = true
+			newData = []byte(target)
+			newVersion = contentHash(newData)
+		case errors.Is(err, fs.ErrNotExist):
+			// Deleted in the working tree
+		case err != nil:
+			respondError(c, http.StatusInternalServerError, "Failed to open file", err)
+			return
+		default:
+			defer file.Close()
+			fileDiff.NewExists = true
+			info, err := file.Stat()
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, "Failed to stat file", err)
+				return
+			}
+			if exceedsLimit(info.Size(), force) {
+				fileDiff.TooLarge = true
+				newVersion = fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano())
+			} else if newData, err = io.ReadAll(file); err != nil {
+				respondError(c, http.StatusInternalServerError, "Failed to read file", err)
+				return
+			} else {
+				newVersion = contentHash(newData)
+				if hasCRLF(newData) && worktreeNormalizesEOL(filePath) {
+					newData = bytes.ReplaceAll(newData, []byte("\r\n"), []byte("\n"))
+					fileDiff.NewLineEnding = "crlf"
+				}
+			}
+		}
 	}
 
-	oldOutput, _ := oldCmd.Output()
-	oldContent := string(oldOutput)
+	// Each side is identified by its blob SHA, or for the working tree by a
+	// hash of its content, so an unchanged file can be answered with a 304
+	// before reading any blobs. The query string covers the view options.
+	// Coverage can change without the file changing, so it is never cached.
+	etag := contentETag(oldSHA, newVersion, c.Request.URL.RawQuery, strconv.FormatInt(maxFileSize, 10))
+	if !withCoverage && notModified(c, etag) {
+		return
+	}
 
-	// Get new version of file (from working tree)
-	// Use secureRoot which is rooted at gitRoot, ensuring correct path resolution
-	// regardless of the current working directory
-	newContent := ""
-	if file, err := secureRoot.Open(filePath); err == nil {
-		if fileData, err := io.ReadAll(file); err == nil {
-			newContent = string(fileData)
+	var err error
+	if fileDiff.OldExists && !fileDiff.TooLarge {
+		oldData, err = readBlob(oldSHA)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to read old file version", err)
+			return
+		}
+	}
+	if newSHA != "" && !fileDiff.TooLarge {
+		newData, err = readBlob(newSHA)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to read new file version", err)
+			return
 		}
-		file.Close()
 	}
 
-	fileDiff := FileDiff{
-		Path:       filePath,
-		OldContent: oldContent,
-		NewContent: newContent,
+	// A reversed diff shows the new version as the old side. The working
+	// tree is then not the side an edit would be saved from.
+	if spec.Reverse {
+		oldData, newData = newData, oldData
+		fileDiff.OldExists, fileDiff.NewExists = fileDiff.NewExists, fileDiff.OldExists
+		fileDiff.NewLineEnding = ""
+	}
+
+	// LFS pointers are meaningless to diff as text. Report the object
+	// metadata, and swap in the real content when asked to and git-lfs
+	// can provide it.
+	fileDiff.OldLFS, fileDiff.NewLFS = parseLFSPointer(oldData), parseLFSPointer(newData)
+	if fileDiff.OldLFS != nil || fileDiff.NewLFS != nil {
+		if !smudge || !lfsAvailable() {
+			c.JSON(http.StatusOK, fileDiff)
+			return
+		}
+		for _, side := range []struct {
+			pointer *LFSPointer
+			data    *[]byte
+		}{{fileDiff.OldLFS, &oldData}, {fileDiff.NewLFS, &newData}} {
+			if side.pointer == nil {
+				continue
+			}
+			if exceedsLimit(side.pointer.Size, force) {
+				fileDiff.TooLarge = true
+				break
+			}
+			if *side.data, err = smudgeLFS(*side.data, filePath); err != nil {
+				respondError(c, http.StatusBadGateway, "Failed to fetch LFS object", err)
+				return
+			}
+		}
+	}
+
+	if fileDiff.TooLarge {
+		c.JSON(http.StatusOK, fileDiff)
+		return
+	}
+	if isBinary(oldData) || isBinary(newData) {
+		fileDiff.Binary = true
+		fileDiff.Image = compareImages(oldData, newData)
+		c.JSON(http.StatusOK, fileDiff)
+		return
+	}
+
+	// Only files long enough to hold a huge diff pay for the numstat
+	if !force && countLines(oldData)+countLines(newData) > maxDiffLines {
+		if n, err := changedLines(spec, filePath); err == nil && n > maxDiffLines {
+			hunks, err := fileHunks(spec, filePath)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, "Failed to compute hunks", err)
+				return
+			}
+			page := hunkPage(hunks, 0)
+			fileDiff.Truncated = true
+			fileDiff.Hunks = &page
+			c.JSON(http.StatusOK, fileDiff)
+			return
+		}
+	}
+
+	fileDiff.OldContent, fileDiff.OldEncoding = decodeContent(oldData)
+	fileDiff.NewContent, fileDiff.NewEncoding = decodeContent(newData)
+	fileDiff.Minified = looksMinified(filePath, fileDiff.OldContent) || looksMinified(filePath, fileDiff.NewContent)
+	if pretty && fileDiff.Minified {
+		fileDiff.OldContent = prettify(filePath, fileDiff.OldContent)
+		fileDiff.NewContent = prettify(filePath, fileDiff.NewContent)
+		fileDiff.Prettified = true
+	}
+	if intraline {
+		fileDiff.Intraline = intralineChanges(fileDiff.OldContent, fileDiff.NewContent)
+	}
+	// Prettified lines are not the file's, so whitespace, coverage and
+	// annotations, which point at lines, are left out
+	if checkWhitespace && !fileDiff.Prettified {
+		fileDiff.Whitespace = whitespaceIssues(fileDiff.OldContent, fileDiff.NewContent, fileDiff.OldExists)
+	}
+	// Coverage and annotations describe the newer tree, so they are
+	// left out of reversed diffs
+	if withCoverage && !spec.Reverse && !fileDiff.Prettified {
+		if profile, err := loadCoverage(); err != nil {
+			slog.Warn("failed to load coverage", "error", err)
+		} else if profile != nil {
+			fc := profile.fileCoverage(filePath, nil)
+			fc.Path = ""
+			fileDiff.Coverage = &fc
+		}
+	}
+	if annotate && fileDiff.NewExists && !spec.Reverse && !fileDiff.Prettified {
+		if fileDiff.Annotations, err = unchangedLineAnnotations(spec, filePath); err != nil {
+			slog.Warn("failed to blame file", "path", filePath, "error", gitStderr(err))
+		}
+	}
+	if notebook && isNotebook(filePath) {
+		// Outputs and execution counts are noise unless asked for
+		oldCells, oldErr := parseNotebook(fileDiff.OldContent)
+		newCells, newErr := parseNotebook(fileDiff.NewContent)
+		if oldErr == nil && newErr == nil {
+			fileDiff.Cells = notebookDiff(oldCells, newCells, includeOutputs)
+		}
+	}
+	if tabular && isTabular(filePath) {
+		// On parse failure the client falls back to the text diff
+		table, err := tableDiff(filePath, fileDiff.OldContent, fileDiff.NewContent, c.Query("key"))
+		if err != nil {
+			fileDiff.TableError = err.Error()
+		} else {
+			fileDiff.Table = table
+		}
+	}
+	if structural && supportsStructuralDiff(filePath) {
+		// On parse failure the client falls back to the text diff
+		changes, err := structuralDiff(filePath, fileDiff.OldContent, fileDiff.NewContent)
+		if err != nil {
+			fileDiff.StructuralError = err.Error()
+		} else {
+			fileDiff.Structural = changes
+		}
 	}
 
 	c.JSON(http.StatusOK, fileDiff)
@@ -376,8 +1272,7 @@ func getFileDiff(c *gin.Context) {
 // getGitRoot returns the root directory of the git repository
 // This works for both regular repositories and git worktrees
 func getGitRoot() (string, error) {
-	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
-	output, err := cmd.Output()
+	output, err := runGit("rev-parse", "--show-toplevel")
 	if err != nil {
 		return "", fmt.Errorf("not a git repository")
 	}
@@ -388,16 +1283,25 @@ func getGitRoot() (string, error) {
 // Returns an error if the file is not tracked or path traversal is attempted
 func validateRepoPath(filePath string) error {
 	// Prevent empty or absolute paths
-	if filePath == "" || filepath.IsAbs(filePath) {
+	if filePath == "" || isAbsPath(filePath) {
 		return fmt.Errorf("invalid file path: %s", filePath)
 	}
 
 	// Check if the file is tracked by git
-	cmd := exec.Command("git", "-C", gitRoot, "ls-files", "--error-unmatch", filePath)
-	if err := cmd.Run(); err != nil {
+	if _, err := runGit("-C", gitRoot, "ls-files", "--error-unmatch", filePath); err != nil {
 		return fmt.Errorf("file not tracked by git: %s", filePath)
 	}
 
+	if repo := (nestedRepoFinder{}).repoOf(filePath); repo != "" {
+		return fmt.Errorf("file is inside the nested repository %s: %s", repo, filePath)
+	}
+
+	// Writing to a tracked symlink would change whatever it points to,
+	// which may be outside the repository
+	if err := checkNotSymlink(filePath); err != nil {
+		return err
+	}
+
 	// Additional check: ensure the path doesn't escape the repository
 	// This is redundant with os.Root but provides defense in depth
 	fullPath := filepath.Join(gitRoot, filePath)
@@ -411,9 +1315,10 @@ func validateRepoPath(filePath string) error {
 		return fmt.Errorf("unable to resolve file path: %w", err)
 	}
 
-	// Ensure the file is within the repository
-	if !strings.HasPrefix(absFilePath, absRepoDir+string(filepath.Separator)) &&
-		absFilePath != absRepoDir {
+	// Ensure the file is within the repository. filepath.Rel compares
+	// drive letters case-insensitively on Windows.
+	rel, err := filepath.Rel(absRepoDir, absFilePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
 		return fmt.Errorf("file path outside repository: %s", filePath)
 	}
 
@@ -421,20 +1326,42 @@ func validateRepoPath(filePath string) error {
 }
 
 func saveFile(c *gin.Context) {
-	filePath := strings.TrimPrefix(c.Param("filepath"), "/")
+	filePath := filePathParam(c)
 
 	var req struct {
-		Content string `json:"content"`
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
 		return
 	}
 
 	// Validate that the file is tracked by git and within repository boundaries
 	if err := validateRepoPath(filePath); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		respondError(c, http.StatusForbidden, err.Error(), err)
+		return
+	}
+
+	data, err := encodeContent(req.Content, req.Encoding)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	// Files shown with LF because git normalizes their CRLF endings are
+	// written back with CRLF. Files git keeps as they are, including ones
+	// with mixed endings, are written exactly as sent.
+	existing, readErr := secureRoot.ReadFile(filePath)
+	if !hasCRLF(data) && readErr == nil && uniformCRLF(existing) && worktreeNormalizesEOL(filePath) {
+		data = toCRLF(data)
+	}
+
+	var secrets []SecretFinding
+	if secretsMode() != secretsOff {
+		secrets = scanNewContent(filePath, string(existing), req.Content)
+	}
+	if !secretsAllowed(c, secrets) {
 		return
 	}
 
@@ -442,16 +1369,25 @@ func saveFile(c *gin.Context) {
 	// against directory traversal attacks
 	file, err := secureRoot.OpenFile(filePath, os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		respondError(c, http.StatusInternalServerError, "Failed to open file", err)
 		return
 	}
 	defer file.Close()
 
-	_, err = file.Write([]byte(req.Content))
+	_, err = file.Write(data)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write file"})
+		respondError(c, http.StatusInternalServerError, "Failed to write file", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "File saved successfully", "path": filePath})
+	if readErr == nil {
+		recordSave(filePath, existing, data)
+	}
+	lspFileSaved(filePath, req.Content)
+	emitEvent(eventFileSaved, map[string]string{"path": filePath})
+	response := gin.H{"message": "File saved successfully", "path": filePath}
+	if len(secrets) > 0 {
+		response["secrets"] = secrets
+	}
+	c.JSON(http.StatusOK, response)
 }
@@ -331,6 +331,18 @@ func TestValidateRepoPath(t *testing.T) {
 			wantError: true,
 			errorMsg:  "invalid file path",
 		},
+		{
+			name:      "drive letter path",
+			filePath:  `C:\Windows\win.ini`,
+			wantError: true,
+			errorMsg:  "invalid file path",
+		},
+		{
+			name:      "UNC path",
+			filePath:  `\\server\share\file`,
+			wantError: true,
+			errorMsg:  "invalid file path",
+		},
 		{
 			name:      "empty path",
 			filePath:  "",
@@ -628,3 +640,51 @@ func TestSaveFileInWorktree(t *testing.T) {
 		t.Error("os.Root should prevent directory traversal in worktree")
 	}
 }
+
+func TestParseRawDiff(t *testing.T) {
+	sha := strings.Repeat("a", 40)
+	zero := strings.Repeat("0", 40)
+	output := ":100644 100644 " + sha + " " + zero + " M\x00file with space.go\x00" +
+		":000000 100644 " + zero + " " + sha + " A\x00added.txt\x00" +
+		":100644 120000 " + sha + " " + sha + " T\x00link\x00" +
+		":000000 000000 " + zero + " " + zero + " U\x00conflict.go\x00" +
+		":160000 160000 " + sha + " " + sha + " M\x00vendor/lib\x00" +
+		":100644 100644 " + sha + " " + sha + " R100\x00README.md\x00Readme.md\x00"
+
+	files := parseRawDiff(output)
+	want := []FileInfo{
+		{Path: "file with space.go", Status: "modified"},
+		{Path: "added.txt", Status: "added"},
+		{Path: "link", Status: "typechange", Symlink: true},
+		{Path: "conflict.go", Status: "unmerged"},
+		{Path: "vendor/lib", Status: "modified", Submodule: true},
+		{Path: "Readme.md", Status: "modified", OldPath: "README.md"},
+	}
+
+	if len(files) != len(want) {
+		t.Fatalf("parseRawDiff() returned %d entries, want %d: %+v", len(files), len(want), files)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, files[i], want[i])
+		}
+	}
+}
+
+func TestSubmoduleDiff(t *testing.T) {
+	diff := submoduleDiff("vendor/lib", "abc123", "def456")
+	if diff.Submodule == nil {
+		t.Fatal("submoduleDiff() should set Submodule")
+	}
+	if diff.OldContent != "Subproject commit abc123\n" {
+		t.Errorf("OldContent = %q", diff.OldContent)
+	}
+	if diff.NewContent != "Subproject commit def456\n" {
+		t.Errorf("NewContent = %q", diff.NewContent)
+	}
+
+	removed := submoduleDiff("vendor/lib", "abc123", "")
+	if removed.NewContent != "" {
+		t.Errorf("removed submodule NewContent = %q, want empty", removed.NewContent)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mergeInProgress reports whether a merge has stopped on conflicts
+func mergeInProgress() bool {
+	_, err := runGit("rev-parse", "--quiet", "--verify", "MERGE_HEAD")
+	return err == nil
+}
+
+// squashInProgress reports whether a squash merge has staged its result
+// without committing it, which leaves a SQUASH_MSG but no MERGE_HEAD
+func squashInProgress() bool {
+	output, err := runGit("rev-parse", "--path-format=absolute", "--git-path", "SQUASH_MSG")
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(strings.TrimSpace(string(output)))
+	return err == nil
+}
+
+// mergeBranch merges a ref into the current branch. Conflicts leave the
+// merge stopped and are returned with a 409 for the client to resolve.
+func mergeBranch(c *gin.Context) {
+	var req struct {
+		Source  string `json:"source"`
+		NoFF    bool   `json:"noFF"`
+		Squash  bool   `json:"squash"`
+		Message string `json:"message"`
+		// Trailers are appended to Message, which they require
+		Trailers []Trailer `json:"trailers"`
+		CommitOptions
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Source == "" {
+		respondError(c, http.StatusBadRequest, "A source ref is required", nil)
+		return
+	}
+	if len(req.Trailers) > 0 && req.Message == "" {
+		respondError(c, http.StatusBadRequest, "Trailers need a message to be added to", nil)
+		return
+	}
+	message, err := appendTrailers(req.Message, req.Trailers)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	// Without a message git's own is used, which needs no checking
+	if message != "" && !checkMessageLint(c, message) {
+		return
+	}
+	if req.NoFF && req.Squash {
+		respondError(c, http.StatusBadRequest, "noFF and squash cannot be combined", nil)
+		return
+	}
+	// Validated, but passed by name so git's default message names it
+	if _, err := resolveRev(req.Source); err != nil {
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	}
+	if mergeInProgress() || rebaseInProgress() {
+		respondError(c, http.StatusConflict, "A merge or rebase is already in progress", nil)
+		return
+	}
+	if dirty, _ := worktreeDirty(); dirty {
+		respondError(c, http.StatusConflict, "The working tree has uncommitted changes", nil)
+		return
+	}
+
+	before := currentHead()
+	args := req.gitArgs("merge", "--no-edit")
+	switch {
+	case req.NoFF:
+		args = append(args, "--no-ff")
+	case req.Squash:
+		args = append(args, "--squash")
+	}
+	if message != "" && !req.Squash {
+		args = append(args, "-m", message)
+	}
+	if _, err := runGitContext(c.Request.Context(), append(args, req.Source)...); err != nil {
+		if conflicts := conflictedFiles(); len(conflicts) > 0 {
+			apiErr := newAPIError(http.StatusConflict, "Merge stopped on conflicts", err)
+			apiErr.Conflicts = conflicts
+			c.JSON(http.StatusConflict, apiErr)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Merge failed", err)
+		return
+	}
+
+	// A squash merge only stages the result; commit it here so both
+	// strategies end with the branch updated
+	var secrets []SecretFinding
+	if req.Squash && hasStagedChanges() {
+		var ok bool
+		if secrets, ok = checkStagedSecrets(c); !ok {
+			runGitContext(c.Request.Context(), "reset", "--merge")
+			return
+		}
+		var err error
+		if message != "" {
+			_, err = runGitEnvContext(c.Request.Context(), nil, []byte(message), req.gitArgs("commit", "--quiet", "--file=-")...)
+		} else {
+			_, err = runGitContext(c.Request.Context(), req.gitArgs("commit", "--quiet", "--no-edit")...)
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to commit squash merge", err)
+			return
+		}
+	}
+	recordHistory("merge", before)
+	head := currentHead()
+	// A fast-forward moves the branch without creating a commit
+	if source, _ := resolveRev(req.Source); head != before && head != source {
+		emitEvent(eventCommitCreated, map[string]string{"commit": head, "action": "merge"})
+	}
+	response := gin.H{"head": head}
+	if len(secrets) > 0 {
+		response["secrets"] = secrets
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// continueMerge commits a stopped merge once its conflicts are resolved,
+// with the message git prepared for it
+func continueMerge(c *gin.Context) {
+	var opts CommitOptions
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid request", err)
+			return
+		}
+	}
+	squash := !mergeInProgress() && squashInProgress()
+	if !mergeInProgress() && !squash {
+		respondError(c, http.StatusConflict, "No merge in progress", nil)
+		return
+	}
+	if conflicts := conflictedFiles(); len(conflicts) > 0 {
+		apiErr := newAPIError(http.StatusConflict, "Resolve conflicts before continuing", nil)
+		apiErr.Conflicts = conflicts
+		c.JSON(http.StatusConflict, apiErr)
+		return
+	}
+	// Only a squash merge's result is new content, as in mergeBranch
+	var secrets []SecretFinding
+	if squash {
+		var ok bool
+		if secrets, ok = checkStagedSecrets(c); !ok {
+			return
+		}
+	}
+
+	before := currentHead()
+	if _, err := runGitContext(c.Request.Context(), opts.gitArgs("commit", "--quiet", "--no-edit")...); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to commit merge", err)
+		return
+	}
+	recordHistory("merge", before)
+	head := currentHead()
+	emitEvent(eventCommitCreated, map[string]string{"commit": head, "action": "merge"})
+	response := gin.H{"head": head}
+	if len(secrets) > 0 {
+		response["secrets"] = secrets
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// abortMerge abandons a conflicted merge, including a squash merge,
+// which leaves no MERGE_HEAD behind
+func abortMerge(c *gin.Context) {
+	if !mergeInProgress() && len(conflictedFiles()) == 0 {
+		respondError(c, http.StatusConflict, "No merge in progress", nil)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "reset", "--merge"); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to abort merge", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"head": currentHead()})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMergeBranch(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	runGit("checkout", "--", ".")
+	runGit("branch", "-M", "main")
+	runGit("checkout", "-q", "-b", "topic")
+	os.WriteFile(filepath.Join(repoDir, "topic.txt"), []byte("topic\n"), 0644)
+	runGit("add", "topic.txt")
+	runGit("commit", "-q", "-m", "Topic change")
+	runGit("checkout", "-q", "main")
+
+	r := gin.New()
+	r.POST("/api/merge", mergeBranch)
+	r.POST("/api/merge/continue", continueMerge)
+	r.POST("/api/merge/abort", abortMerge)
+
+	merge := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/merge", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := merge(`{"source":"topic","noFF":true,"squash":true}`); w.Code != http.StatusBadRequest {
+		t.Errorf("noFF with squash = %d, want 400", w.Code)
+	}
+	if w := merge(`{"source":"--abort"}`); w.Code != http.StatusNotFound {
+		t.Errorf("option as source = %d, want 404", w.Code)
+	}
+
+	if w := merge(`{"source":"topic","trailers":[{"key":"Reviewed-by","value":"Pat <pat@example.com>"}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("trailers without a message = %d, want 400", w.Code)
+	}
+
+	w := merge(`{"source":"topic","squash":true,"message":"Squashed topic\nwith no blank line"}`)
+	var apiErr APIError
+	json.Unmarshal(w.Body.Bytes(), &apiErr)
+	if w.Code != http.StatusUnprocessableEntity || apiErr.Code != codeLint || len(apiErr.Issues) != 1 || apiErr.Issues[0].Rule != "blank-line" {
+		t.Errorf("merge with a badly formed message = %d: %s", w.Code, w.Body.String())
+	}
+
+	start := currentHead()
+	if w := merge(`{"source":"topic","squash":true,"message":"Squashed topic","trailers":[{"key":"Reviewed-by","value":"Pat <pat@example.com>"}]}`); w.Code != http.StatusOK {
+		t.Fatalf("squash merge = %d: %s", w.Code, w.Body.String())
+	}
+	output, _ := runGit("log", "-1", "--format=%s%n%P")
+	if lines := strings.Fields(string(output)); len(lines) < 3 || lines[len(lines)-1] != start {
+		t.Errorf("squash merge should make a single-parent commit, got %q", output)
+	}
+	if body, _ := runGit("log", "-1", "--format=%B"); !strings.HasSuffix(strings.TrimSpace(string(body)), "\n\nReviewed-by: Pat <pat@example.com>") {
+		t.Errorf("squash merge message = %q, want the trailer appended", body)
+	}
+
+	runGit("reset", "-q", "--hard", start)
+	if w := merge(`{"source":"topic","noFF":true}`); w.Code != http.StatusOK {
+		t.Fatalf("no-ff merge = %d: %s", w.Code, w.Body.String())
+	}
+	parents, _ := runGit("log", "-1", "--format=%P")
+	if len(strings.Fields(string(parents))) != 2 {
+		t.Errorf("no-ff merge parents = %q, want 2", parents)
+	}
+
+	// Conflicting changes come back as the conflict set
+	runGit("reset", "-q", "--hard", start)
+	os.WriteFile(filepath.Join(repoDir, "topic.txt"), []byte("main\n"), 0644)
+	runGit("add", "topic.txt")
+	runGit("commit", "-q", "-m", "Main change")
+	w = merge(`{"source":"topic"}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("conflicting merge = %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Conflicts []string `json:"conflicts"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if len(body.Conflicts) != 1 || body.Conflicts[0] != "topic.txt" {
+		t.Errorf("conflicts = %v", body.Conflicts)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/merge/continue", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("continue with conflicts = %d, want 409", w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/merge/abort", nil))
+	if w.Code != http.StatusOK || mergeInProgress() {
+		t.Errorf("abort = %d, merge in progress %v", w.Code, mergeInProgress())
+	}
+
+	// Once resolved, continuing commits the merge
+	merge(`{"source":"topic"}`)
+	os.WriteFile(filepath.Join(repoDir, "topic.txt"), []byte("both\n"), 0644)
+	runGit("add", "topic.txt")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/merge/continue", nil))
+	if w.Code != http.StatusOK || mergeInProgress() {
+		t.Fatalf("continue = %d, merge in progress %v: %s", w.Code, mergeInProgress(), w.Body.String())
+	}
+	if _, err := runGit("rev-parse", "--verify", "HEAD^2"); err != nil {
+		t.Error("continuing did not commit a merge")
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/merge/continue", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("continue without a merge = %d, want 409", w.Code)
+	}
+}
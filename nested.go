@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NestedRepo is a git repository inside the working tree that is not a
+// submodule, such as a clone made in a subdirectory. Its files belong to
+// it, not to the served repository. Root is its absolute path, for
+// serving it with POST /api/repo/switch.
+type NestedRepo struct {
+	Path string `json:"path"`
+	Root string `json:"root"`
+	// TrackedByParent is set when the served repository tracks files
+	// inside it, which working diffs leave out
+	TrackedByParent bool `json:"trackedByParent,omitempty"`
+}
+
+// nestedRepoFinder finds the nested repositories containing paths,
+// remembering which directories it has checked for a .git
+type nestedRepoFinder map[string]bool
+
+// repoOf returns the outermost nested repository containing path, or ""
+func (f nestedRepoFinder) repoOf(path string) string {
+	repo := ""
+	for dir := pathDir(path); dir != ""; dir = pathDir(dir) {
+		if f.isRepo(dir) {
+			repo = dir
+		}
+	}
+	return repo
+}
+
+// isRepo reports whether dir has a .git directory or file of its own
+func (f nestedRepoFinder) isRepo(dir string) bool {
+	found, ok := f[dir]
+	if !ok {
+		_, err := secureRoot.Lstat(dir + "/.git")
+		found = err == nil
+		f[dir] = found
+	}
+	return found
+}
+
+// withoutNestedRepos drops files that are inside nested repositories
+func withoutNestedRepos(files []FileInfo) []FileInfo {
+	finder := nestedRepoFinder{}
+	kept := files[:0]
+	for _, f := range files {
+		if finder.repoOf(f.Path) == "" {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// listNestedRepos finds the nested repositories in the working tree: the
+// untracked ones, which git lists as directories without looking inside,
+// and any holding files the served repository tracks. Ignored
+// directories are not searched.
+func listNestedRepos() ([]NestedRepo, error) {
+	finder := nestedRepoFinder{}
+	repos := make(map[string]bool) // path -> tracked by parent
+
+	untracked, err := runGit("ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range strings.Split(string(untracked), "\x00") {
+		if dir, ok := strings.CutSuffix(entry, "/"); ok && finder.isRepo(dir) {
+			if outer := finder.repoOf(dir); outer != "" {
+				dir = outer
+			}
+			if _, ok := repos[dir]; !ok {
+				repos[dir] = false
+			}
+		}
+	}
+	tracked, err := runGit("ls-files", "-z")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range strings.Split(string(tracked), "\x00") {
+		if repo := finder.repoOf(path); repo != "" {
+			repos[repo] = true
+		}
+	}
+
+	result := []NestedRepo{}
+	for path, trackedByParent := range repos {
+		result = append(result, NestedRepo{
+			Path:            path,
+			Root:            filepath.Join(gitRoot, filepath.FromSlash(path)),
+			TrackedByParent: trackedByParent,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+// getNestedRepos lists the nested repositories in the working tree
+func getNestedRepos(c *gin.Context) {
+	repos, err := listNestedRepos()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list nested repositories", err)
+		return
+	}
+	c.JSON(http.StatusOK, repos)
+}
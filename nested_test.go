@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNestedRepos(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	// tools/gen is tracked by the parent and later turned into a
+	// repository of its own; third_party/lib is an untracked clone
+	os.MkdirAll("tools/gen", 0755)
+	os.WriteFile("tools/gen/main.go", []byte("package main\n"), 0644)
+	exec.Command("git", "add", "tools").Run()
+	exec.Command("git", "commit", "-m", "Add generator").Run()
+	for _, dir := range []string{"tools/gen", "third_party/lib"} {
+		if output, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+			t.Fatalf("git init %s failed: %v: %s", dir, err, output)
+		}
+	}
+	os.WriteFile("third_party/lib/lib.go", []byte("package lib\n"), 0644)
+	os.WriteFile("tools/gen/main.go", []byte("package main\n\nfunc main() {}\n"), 0644)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/nested-repos", getNestedRepos)
+	r.GET("/api/diffs/:id/files", getDiffFiles)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/nested-repos", nil))
+	var repos []NestedRepo
+	json.Unmarshal(w.Body.Bytes(), &repos)
+	want := []NestedRepo{
+		{Path: "third_party/lib", Root: filepath.Join(gitRoot, "third_party", "lib")},
+		{Path: "tools/gen", Root: filepath.Join(gitRoot, "tools", "gen"), TrackedByParent: true},
+	}
+	if !reflect.DeepEqual(repos, want) {
+		t.Errorf("nested repos = %+v, want %+v", repos, want)
+	}
+
+	// The working changes leave out the nested repository's file, but a
+	// commit from before it existed still shows it
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/working/files", nil))
+	var files []FileInfo
+	json.Unmarshal(w.Body.Bytes(), &files)
+	for _, f := range files {
+		if f.Path == "tools/gen/main.go" {
+			t.Errorf("working files include %s from a nested repository", f.Path)
+		}
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/HEAD/files?mode=commit", nil))
+	files = nil
+	json.Unmarshal(w.Body.Bytes(), &files)
+	if len(files) != 1 || files[0].Path != "tools/gen/main.go" {
+		t.Errorf("commit files = %+v, want tools/gen/main.go", files)
+	}
+
+	if err := validateRepoPath("tools/gen/main.go"); err == nil {
+		t.Error("validateRepoPath() allowed a file inside a nested repository")
+	}
+}
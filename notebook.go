@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// CellDiff describes one changed notebook cell. Indexes are 0-based and
+// -1 on the side where the cell does not exist.
+type CellDiff struct {
+	OldIndex   int    `json:"oldIndex"`
+	NewIndex   int    `json:"newIndex"`
+	CellType   string `json:"cellType"`
+	Status     string `json:"status"` // added, removed, modified
+	OldSource  string `json:"oldSource,omitempty"`
+	NewSource  string `json:"newSource,omitempty"`
+	OldOutputs string `json:"oldOutputs,omitempty"`
+	NewOutputs string `json:"newOutputs,omitempty"`
+}
+
+type notebookCell struct {
+	CellType string
+	Source   string
+	Outputs  string
+}
+
+// key identifies a cell's reviewable content for alignment
+func (c notebookCell) key(includeOutputs bool) string {
+	k := c.CellType + "\x00" + c.Source
+	if includeOutputs {
+		k += "\x00" + c.Outputs
+	}
+	return k
+}
+
+func isNotebook(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".ipynb")
+}
+
+// multiline decodes nbformat's string-or-list-of-strings fields
+func multiline(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var parts []string
+	if json.Unmarshal(raw, &parts) == nil {
+		return strings.Join(parts, "")
+	}
+	return ""
+}
+
+// parseNotebook extracts cells from an nbformat 4 document, rendering
+// outputs as text and dropping execution counts and metadata.
+func parseNotebook(content string) ([]notebookCell, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, nil
+	}
+	var nb struct {
+		Cells []struct {
+			CellType string            `json:"cell_type"`
+			Source   json.RawMessage   `json:"source"`
+			Outputs  []json.RawMessage `json:"outputs"`
+		} `json:"cells"`
+	}
+	if err := json.Unmarshal([]byte(content), &nb); err != nil {
+		return nil, err
+	}
+
+	cells := make([]notebookCell, len(nb.Cells))
+	for i, c := range nb.Cells {
+		var outputs []string
+		for _, raw := range c.Outputs {
+			outputs = append(outputs, renderOutput(raw))
+		}
+		cells[i] = notebookCell{
+			CellType: c.CellType,
+			Source:   multiline(c.Source),
+			Outputs:  strings.Join(outputs, "\n"),
+		}
+	}
+	return cells, nil
+}
+
+// renderOutput turns a cell output into reviewable text; rich media is
+// represented by its MIME type
+func renderOutput(raw json.RawMessage) string {
+	var out struct {
+		OutputType string                     `json:"output_type"`
+		Text       json.RawMessage            `json:"text"`
+		Data       map[string]json.RawMessage `json:"data"`
+		Ename      string                     `json:"ename"`
+		Evalue     string                     `json:"evalue"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return ""
+	}
+	switch out.OutputType {
+	case "stream":
+		return strings.TrimRight(multiline(out.Text), "\n")
+	case "error":
+		return out.Ename + ": " + out.Evalue
+	}
+	if text, ok := out.Data["text/plain"]; ok {
+		return strings.TrimRight(multiline(text), "\n")
+	}
+	var types []string
+	for mime := range out.Data {
+		types = append(types, mime)
+	}
+	sort.Strings(types)
+	return "[" + strings.Join(types, ", ") + "]"
+}
+
+// notebookDiff aligns the cells of two notebooks and reports those that
+// were added, removed, or modified. Cells are matched by content, with
+// replaced runs paired up in order as modifications.
+func notebookDiff(oldCells, newCells []notebookCell, includeOutputs bool) []CellDiff {
+	ids := make(map[string]rune)
+	encode := func(cells []notebookCell) []rune {
+		out := make([]rune, len(cells))
+		for i, c := range cells {
+			k := c.key(includeOutputs)
+			id, ok := ids[k]
+			if !ok {
+				id = rune(0xE000 + len(ids))
+				ids[k] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMainRunes(encode(oldCells), encode(newCells), false)
+
+	cellDiff := func(oldIdx, newIdx int) CellDiff {
+		d := CellDiff{OldIndex: oldIdx, NewIndex: newIdx}
+		if oldIdx >= 0 {
+			d.CellType = oldCells[oldIdx].CellType
+			d.OldSource = oldCells[oldIdx].Source
+			if includeOutputs {
+				d.OldOutputs = oldCells[oldIdx].Outputs
+			}
+		}
+		if newIdx >= 0 {
+			d.CellType = newCells[newIdx].CellType
+			d.NewSource = newCells[newIdx].Source
+			if includeOutputs {
+				d.NewOutputs = newCells[newIdx].Outputs
+			}
+		}
+		switch {
+		case oldIdx < 0:
+			d.Status = "added"
+		case newIdx < 0:
+			d.Status = "removed"
+		default:
+			d.Status = "modified"
+		}
+		return d
+	}
+
+	changes := []CellDiff{}
+	oi, ni := 0, 0
+	for i := 0; i < len(diffs); i++ {
+		n := len([]rune(diffs[i].Text))
+		switch diffs[i].Type {
+		case diffmatchpatch.DiffEqual:
+			oi += n
+			ni += n
+		case diffmatchpatch.DiffInsert:
+			for k := 0; k < n; k++ {
+				changes = append(changes, cellDiff(-1, ni+k))
+			}
+			ni += n
+		case diffmatchpatch.DiffDelete:
+			added := 0
+			if i+1 < len(diffs) && diffs[i+1].Type == diffmatchpatch.DiffInsert {
+				added = len([]rune(diffs[i+1].Text))
+				i++
+			}
+			for k := 0; k < n || k < added; k++ {
+				switch {
+				case k < n && k < added:
+					changes = append(changes, cellDiff(oi+k, ni+k))
+				case k < n:
+					changes = append(changes, cellDiff(oi+k, -1))
+				default:
+					changes = append(changes, cellDiff(-1, ni+k))
+				}
+			}
+			oi += n
+			ni += added
+		}
+	}
+	return changes
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+const testNotebookOld = `{
+ "cells": [
+  {"cell_type": "markdown", "source": ["# Title\n"], "metadata": {}},
+  {"cell_type": "code", "execution_count": 1, "source": ["x = 1\n", "print(x)"], "outputs": [{"output_type": "stream", "name": "stdout", "text": ["1\n"]}], "metadata": {}},
+  {"cell_type": "code", "execution_count": 2, "source": "y = 2", "outputs": [], "metadata": {}}
+ ],
+ "metadata": {}, "nbformat": 4, "nbformat_minor": 5
+}`
+
+const testNotebookNew = `{
+ "cells": [
+  {"cell_type": "markdown", "source": ["# Title\n"], "metadata": {}},
+  {"cell_type": "code", "execution_count": 7, "source": ["x = 1\n", "print(x)"], "outputs": [{"output_type": "stream", "name": "stdout", "text": ["1\n"]}], "metadata": {}},
+  {"cell_type": "code", "execution_count": 8, "source": "y = 3", "outputs": [{"output_type": "execute_result", "data": {"image/png": "..."}}], "metadata": {}},
+  {"cell_type": "code", "execution_count": 9, "source": "z = 4", "outputs": [], "metadata": {}}
+ ],
+ "metadata": {}, "nbformat": 4, "nbformat_minor": 5
+}`
+
+func TestNotebookDiff(t *testing.T) {
+	oldCells, err := parseNotebook(testNotebookOld)
+	if err != nil {
+		t.Fatalf("parseNotebook(old) failed: %v", err)
+	}
+	newCells, err := parseNotebook(testNotebookNew)
+	if err != nil {
+		t.Fatalf("parseNotebook(new) failed: %v", err)
+	}
+	if oldCells[1].Source != "x = 1\nprint(x)" || oldCells[1].Outputs != "1" {
+		t.Errorf("parsed cell = %+v", oldCells[1])
+	}
+
+	// Execution count changes alone are ignored
+	changes := notebookDiff(oldCells, newCells, false)
+	if len(changes) != 2 {
+		t.Fatalf("notebookDiff() = %+v, want 2 changes", changes)
+	}
+	if changes[0].Status != "modified" || changes[0].OldIndex != 2 || changes[0].NewSource != "y = 3" {
+		t.Errorf("first change = %+v", changes[0])
+	}
+	if changes[1].Status != "added" || changes[1].NewIndex != 3 || changes[1].OldIndex != -1 {
+		t.Errorf("second change = %+v", changes[1])
+	}
+	if changes[0].NewOutputs != "" {
+		t.Error("outputs should be omitted unless requested")
+	}
+
+	withOutputs := notebookDiff(oldCells, newCells, true)
+	if withOutputs[0].NewOutputs != "[image/png]" {
+		t.Errorf("rich output rendered as %q", withOutputs[0].NewOutputs)
+	}
+}
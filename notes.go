@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultNotesRef is where review notes and approvals are kept; git expands
+// it to refs/notes/review
+const defaultNotesRef = "review"
+
+// notesRef returns the validated ref= query parameter or the default
+func notesRef(c *gin.Context) (string, error) {
+	ref := c.DefaultQuery("ref", defaultNotesRef)
+	if strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid notes ref: %s", ref)
+	}
+	if _, err := runGitContext(c.Request.Context(), "check-ref-format", "--allow-onelevel", ref); err != nil {
+		return "", fmt.Errorf("invalid notes ref: %s", ref)
+	}
+	return ref, nil
+}
+
+// readNote returns the note attached to commit, or "" if there is none
+func readNote(ref, commit string) (string, error) {
+	output, err := runGit("notes", "--ref="+ref, "show", commit)
+	if err != nil {
+		// git notes show exits 1 when the commit has no note
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(output), nil
+}
+
+// noteTarget resolves the :commit parameter and notes ref, writing an
+// error response and returning false on failure
+func noteTarget(c *gin.Context) (ref, commit string, ok bool) {
+	commit, err := resolveRev(c.Param("commit"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return "", "", false
+	}
+	ref, err = notesRef(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return "", "", false
+	}
+	return ref, commit, true
+}
+
+func getNote(c *gin.Context) {
+	ref, commit, ok := noteTarget(c)
+	if !ok {
+		return
+	}
+	note, err := readNote(ref, commit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read note", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"commit": commit, "ref": ref, "note": note})
+}
+
+func putNote(c *gin.Context) {
+	ref, commit, ok := noteTarget(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+
+	// Read the message from stdin so it is stored verbatim
+	if _, err := runGitEnvContext(c.Request.Context(), nil, []byte(req.Note), "notes", "--ref="+ref, "add", "--force", "--file=-", commit); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to write note", err)
+		return
+	}
+	emitEvent(eventNoteUpdated, map[string]string{"commit": commit, "ref": ref})
+	c.JSON(http.StatusOK, gin.H{"commit": commit, "ref": ref, "note": req.Note})
+}
+
+func deleteNote(c *gin.Context) {
+	ref, commit, ok := noteTarget(c)
+	if !ok {
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "notes", "--ref="+ref, "remove", "--ignore-missing", commit); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to remove note", err)
+		return
+	}
+	emitEvent(eventNoteDeleted, map[string]string{"commit": commit, "ref": ref})
+	c.JSON(http.StatusOK, gin.H{"commit": commit, "ref": ref})
+}
+
+// approveCommit records a sign-off in the commit's note as an
+// "Approved-by:" trailer, so approvals travel with the notes ref when pushed.
+func approveCommit(c *gin.Context) {
+	ref, commit, ok := noteTarget(c)
+	if !ok {
+		return
+	}
+
+	name, _ := runGitContext(c.Request.Context(), "config", "user.name")
+	email, _ := runGitContext(c.Request.Context(), "config", "user.email")
+	line := fmt.Sprintf("Approved-by: %s <%s> %s\n",
+		strings.TrimSpace(string(name)), strings.TrimSpace(string(email)), time.Now().UTC().Format(time.RFC3339))
+
+	if _, err := runGitEnvContext(c.Request.Context(), nil, []byte(line), "notes", "--ref="+ref, "append", "--file=-", commit); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to record approval", err)
+		return
+	}
+	emitEvent(eventCommitApproved, map[string]string{"commit": commit, "ref": ref})
+
+	note, err := readNote(ref, commit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read note", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"commit": commit, "ref": ref, "note": note})
+}
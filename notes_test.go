@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNotesAPI(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/notes/:commit", getNote)
+	r.PUT("/api/notes/:commit", putNote)
+	r.DELETE("/api/notes/:commit", deleteNote)
+	r.POST("/api/notes/:commit/approve", approveCommit)
+
+	do := func(method, path, body string) (int, map[string]string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := do(http.MethodGet, "/api/notes/HEAD", "")
+	if code != http.StatusOK || resp["note"] != "" {
+		t.Errorf("GET without note = %d %v", code, resp)
+	}
+
+	code, _ = do(http.MethodPut, "/api/notes/HEAD", `{"note": "Looks good\n"}`)
+	if code != http.StatusOK {
+		t.Fatalf("PUT note = %d", code)
+	}
+	if _, err := runGit("show-ref", "--verify", "refs/notes/review"); err != nil {
+		t.Error("note should be stored under refs/notes/review")
+	}
+
+	code, resp = do(http.MethodPost, "/api/notes/HEAD/approve", "")
+	if code != http.StatusOK {
+		t.Fatalf("approve = %d", code)
+	}
+	if !strings.HasPrefix(resp["note"], "Looks good\n") || !strings.Contains(resp["note"], "Approved-by: Test User <test@example.com>") {
+		t.Errorf("note after approval = %q", resp["note"])
+	}
+
+	code, _ = do(http.MethodDelete, "/api/notes/HEAD", "")
+	if code != http.StatusOK {
+		t.Errorf("DELETE note = %d", code)
+	}
+	if _, resp = do(http.MethodGet, "/api/notes/HEAD", ""); resp["note"] != "" {
+		t.Errorf("note after delete = %q", resp["note"])
+	}
+
+	if code, _ = do(http.MethodGet, "/api/notes/HEAD?ref=--bad", ""); code != http.StatusBadRequest {
+		t.Errorf("invalid ref status = %d, want 400", code)
+	}
+	if code, _ = do(http.MethodGet, "/api/notes/nonexistent", ""); code != http.StatusNotFound {
+		t.Errorf("unknown commit status = %d, want 404", code)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiVersion is the current version of the HTTP API. It is served under
+// /api/v1, and /api stays as an alias for existing clients.
+const apiVersion = "v1"
+
+// apiDocs are what the OpenAPI document says about each route, keyed by
+// "METHOD path" as registered with gin. The bodies are example values
+// whose types are reflected into schemas. Routes without an entry are
+// still listed, just without schemas.
+var apiDocs = map[string]apiDoc{
+	"GET /api/repo-info":                   {Summary: "Describe the served repository", Response: RepoInfo{}},
+	"GET /api/recent-repos":                {Summary: "List recently served repositories", Response: []RecentRepo{}},
+	"POST /api/repo/switch":                {Summary: "Serve another repository"},
+	"POST /api/shutdown":                   {Summary: "Stop the server"},
+	"GET /api/diffs":                       {Summary: "List the working changes and commits", Response: []DiffInfo{}},
+	"GET /api/diffs/:id/files":             {Summary: "List the files a diff changes", Response: []FileInfo{}},
+	"GET /api/diffs/:id/tree":              {Summary: "List the files a diff changes as a directory tree", Response: TreeNode{}},
+	"GET /api/diffs/:id/submodule":         {Summary: "Describe a submodule change", Response: SubmoduleInfo{}},
+	"GET /api/diffs/:id/submodule/file":    {Summary: "Show one file's diff inside a submodule change", Response: FileDiff{}},
+	"GET /api/diffs/:id/coverage":          {Summary: "Report test coverage of a diff's changed lines"},
+	"GET /api/diffs/:id/affected-tests":    {Summary: "List the test packages a diff affects", Response: AffectedTests{}},
+	"GET /api/diffs/:id/risk":              {Summary: "Rank a diff's files by risk", Response: []FileRisk{}},
+	"GET /api/diffs/:id/stats":             {Summary: "Break a diff's changes down by language, extension, and test versus code", Response: DiffStats{}},
+	"GET /api/diffs/:id/owners":            {Summary: "List the likely reviewers of a diff's files", Response: []FileOwners{}},
+	"GET /api/diffs/:id/progress":          {Summary: "Get review progress", Response: ReviewProgress{}},
+	"GET /api/owners/*filepath":            {Summary: "List a file's most frequent authors", Response: FileOwners{}},
+	"GET /api/analytics/churn":             {Summary: "List the most frequently changed files", Response: []FileChurn{}},
+	"GET /api/symbols/:id/*filepath":       {Summary: "Outline the symbols a file's diff touches", Response: SymbolOutline{}},
+	"GET /api/highlight/:id/*filepath":     {Summary: "Syntax highlighting tokens for a file, one list per line; ?side=old for the old side. Go is always highlighted, other languages when chroma is installed", Response: HighlightedFile{}},
+	"GET /api/file-diff/:id/*filepath":     {Summary: "Get both sides of one file's diff", Response: FileDiff{}},
+	"GET /api/dir-diff/:id/*dirpath":       {Summary: "Summarize a diff's changes under a directory", Response: DirDiff{}},
+	"GET /api/compare-files":               {Summary: "Diff two files, each at any revision or in the working tree", Response: FileComparison{}},
+	"POST /api/compare-content/*filepath":  {Summary: "Diff a file at any revision or in the working tree against posted text", Request: CompareContentRequest{}, Response: FileComparison{}},
+	"GET /api/file-hunks/:id/*filepath":    {Summary: "Page through the hunks of a truncated file diff", Response: HunkPage{}},
+	"GET /api/location":                    {Summary: "Resolve a commit[:path[:line]] location", Response: Location{}},
+	"GET /api/format-patch":                {Summary: "Format commits as email patches", Response: []EmailPatch{}},
+	"GET /api/branches":                    {Summary: "List local branches", Response: []Branch{}},
+	"GET /api/remotes":                     {Summary: "List remotes", Response: []Remote{}},
+	"GET /api/split":                       {Summary: "Get the state of an in-progress commit split", Response: SplitState{}},
+	"GET /api/preferences":                 {Summary: "Get the reviewer's preferences", Response: Preferences{}},
+	"PUT /api/preferences":                 {Summary: "Save the reviewer's preferences", Request: Preferences{}, Response: Preferences{}},
+	"GET /api/secrets/staged":              {Summary: "Scan the staged changes for likely credentials", Response: SecretScan{}},
+	"GET /api/clean/preview":               {Summary: "List the untracked files git clean would remove", Response: CleanPreview{}},
+	"POST /api/clean":                      {Summary: "Remove the untracked files from a preview", Request: CleanRequest{}},
+	"GET /api/ignore":                      {Summary: "Get the patterns in .gitignore or .git/info/exclude", Response: IgnoreFile{}},
+	"GET /api/nested-repos":                {Summary: "List the git repositories nested in the working tree that are not submodules", Response: []NestedRepo{}},
+	"POST /api/ignore":                     {Summary: "Append patterns to .gitignore or .git/info/exclude", Request: IgnoreRequest{}, Response: IgnoreFile{}},
+	"GET /api/check-ignore/*filepath":      {Summary: "Explain which ignore rule, if any, hides a file", Response: IgnoreMatch{}},
+	"POST /api/undo":                       {Summary: "Revert the most recent save or history change made through differing", Response: UndoResult{}},
+	"POST /api/hooks/pre-commit":           {Summary: "Run the pre-commit hook", Response: HookResult{}},
+	"POST /api/lint-message":               {Summary: "Check a commit message against the lint rules"},
+	"GET /api/openapi.json":                {Summary: "This document"},
+	"GET /api/diffs/:id/archive.zip":       {Summary: "Download a diff's changed files as a zip archive"},
+	"POST /api/file-save/:id/*filepath":    {Summary: "Save a working tree file"},
+	"POST /api/apply-suggestion/*filepath": {Summary: "Replace a line range of a working tree file if it is unchanged", Request: SuggestionRequest{}, Response: SuggestionResult{}},
+	"POST /api/fix-whitespace/*filepath":   {Summary: "Strip trailing whitespace and restore the final newline on the lines a working tree diff adds", Response: WhitespaceFix{}},
+	"GET /api/index/*filepath":             {Summary: "Get a file's staged content", Response: IndexFile{}},
+	"PUT /api/index/*filepath":             {Summary: "Stage content for a file without changing the working tree", Request: IndexWriteRequest{}, Response: IndexFile{}},
+	"GET /api/raw/:id/*filepath":           {Summary: "Download one side of a file"},
+	"GET /api/image-diff/:id/*filepath":    {Summary: "Render a heatmap PNG of the pixels a changed image differs in"},
+	"GET /api/file-patch/:id/*filepath":    {Summary: "Get one file's diff as a patch"},
+	"GET /api/diagnostics/*filepath":       {Summary: "Get language server diagnostics for a file"},
+	"GET /api/commits/:commit":             {Summary: "Get a commit's full message and metadata", Response: CommitDetails{}},
+	"POST /api/commits/:commit/squash":     {Summary: "Squash a commit into its parent; pushed commits need force=true"},
+	"POST /api/commits/:commit/drop":       {Summary: "Drop a commit from history; pushed commits need force=true"},
+	"POST /api/commits/:commit/split":      {Summary: "Start splitting a commit"},
+	"POST /api/commits/:commit/edit":       {Summary: "Start a rebase stopped at a commit so it can be amended"},
+	"GET /api/interdiff":                   {Summary: "Match up the commits of two versions of a branch with git range-diff", Response: Interdiff{}},
+	"GET /api/snapshots":                   {Summary: "List saved snapshots of the working tree, newest first", Response: []Snapshot{}},
+	"POST /api/snapshots":                  {Summary: "Save the working tree as a snapshot to diff against with snapshot:<id>", Request: SnapshotRequest{}, Response: Snapshot{}},
+	"DELETE /api/snapshots/:id":            {Summary: "Delete a snapshot"},
+	"GET /api/timeline":                    {Summary: "List automatic snapshots of the working tree, newest first; diff one with timeline:<id>", Response: []Snapshot{}},
+	"POST /api/timeline":                   {Summary: "Record a timeline entry now if the working tree changed", Response: Snapshot{}},
+	"GET /api/baseline":                    {Summary: "Show what was last marked as reviewed", Response: Baseline{}},
+	"PUT /api/baseline":                    {Summary: "Mark a ref, or the working tree without one, as reviewed; diff what changed since with the baseline diff ID", Request: BaselineRequest{}, Response: Baseline{}},
+	"DELETE /api/baseline":                 {Summary: "Clear the review baseline"},
+	"POST /api/proposals":                  {Summary: "Propose file changes for approval; with ?wait= milliseconds, block until decided (200) or still pending (202)", Request: ProposalRequest{}, Response: Proposal{}},
+	"GET /api/proposals":                   {Summary: "List proposed changes, newest first", Response: []Proposal{}},
+	"GET /api/proposals/:id":               {Summary: "Show a proposal, waiting up to ?wait= milliseconds for its decision", Response: Proposal{}},
+	"POST /api/proposals/:id/approve":      {Summary: "Apply a pending proposal to the working tree", Response: Proposal{}},
+	"POST /api/proposals/:id/reject":       {Summary: "Reject a pending proposal", Request: ProposalDecision{}, Response: Proposal{}},
+	"POST /api/tool-sessions":              {Summary: "Show files from git difftool or mergetool, as the diff tool:<id>", Request: ToolRequest{}, Response: ToolSession{}},
+	"GET /api/tool-sessions":               {Summary: "List difftool and mergetool sessions, newest first", Response: []ToolSession{}},
+	"GET /api/tool-sessions/:id":           {Summary: "Show a tool session, waiting up to ?wait= milliseconds for it to be done (200) or still pending (202)", Response: ToolSession{}},
+	"POST /api/tool-sessions/:id/done":     {Summary: "Let the waiting difftool or mergetool exit, with a merge result or as failed", Request: ToolDecision{}, Response: ToolSession{}},
+	"GET /api/editor/state":                {Summary: "Show the file selected in differing or an editor, with links to open it in each; with ?since=<seq>, wait up to ?wait= milliseconds for a newer selection", Response: EditorState{}},
+	"POST /api/editor/goto":                {Summary: "Select a file and line for differing and editors following along", Request: EditorGoto{}, Response: EditorState{}},
+	"GET /api/stack":                       {Summary: "List the branch's unpushed commits with their review state and pre-rebase versions", Response: Stack{}},
+	"POST /api/stack/reorder":              {Summary: "Replay the stack's commits in a new order; pushed commits need force=true", Request: StackOrderRequest{}},
+	"POST /api/commit/:id/fixup":           {Summary: "Commit staged changes as a fixup of a commit", Request: CommitOptions{}},
+	"POST /api/merge":                      {Summary: "Merge a branch into the current one"},
+	"POST /api/merge/continue":             {Summary: "Commit a merge stopped on conflicts once they are resolved", Request: CommitOptions{}},
+	"POST /api/merge/abort":                {Summary: "Abandon a merge stopped on conflicts"},
+	"GET /api/notes/:commit":               {Summary: "Get a commit's review note"},
+	"POST /api/notes/:commit/approve":      {Summary: "Record an approval note on a commit"},
+	"GET /api/checks":                      {Summary: "List the configured checks"},
+	"GET /api/plugins":                     {Summary: "List the installed plugins"},
+	"GET /api/commit-template":             {Summary: "Get the configured commit message template"},
+	"GET /api/rebase":                      {Summary: "Get the state of an in-progress rebase"},
+	"POST /api/deepen":                     {Summary: "Fetch more history into a shallow clone"},
+}
+
+// apiDoc documents one route
+type apiDoc struct {
+	Summary  string
+	Request  any
+	Response any
+}
+
+// routeParam matches gin's :name and *name path parameters
+var routeParam = regexp.MustCompile(`[:*](\w+)`)
+
+// openAPISpec builds an OpenAPI 3 document for the routes registered under
+// /api, relative to the /api/v1 server
+func openAPISpec(routes gin.RoutesInfo) map[string]any {
+	gen := schemaGen{schemas: map[string]any{}}
+	gen.schema(reflect.TypeOf(APIError{}))
+
+	paths := map[string]map[string]any{}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, "/api/") {
+			continue
+		}
+		path := routeParam.ReplaceAllString(strings.TrimPrefix(route.Path, "/api"), "{$1}")
+		doc := apiDocs[route.Method+" "+route.Path]
+
+		op := map[string]any{}
+		if doc.Summary != "" {
+			op["summary"] = doc.Summary
+		}
+		var params []any
+		for _, m := range routeParam.FindAllStringSubmatch(route.Path, -1) {
+			params = append(params, map[string]any{
+				"name": m[1], "in": "path", "required": true,
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if doc.Request != nil {
+			op["requestBody"] = map[string]any{
+				"content": map[string]any{"application/json": map[string]any{"schema": gen.schema(reflect.TypeOf(doc.Request))}},
+			}
+		}
+		ok := map[string]any{"description": "OK"}
+		if doc.Response != nil {
+			ok["content"] = map[string]any{"application/json": map[string]any{"schema": gen.schema(reflect.TypeOf(doc.Response))}}
+		}
+		op["responses"] = map[string]any{
+			"200": ok,
+			"default": map[string]any{
+				"description": "Error",
+				"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/APIError"}}},
+			},
+		}
+
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": "differing", "version": apiVersion},
+		"servers": []any{map[string]any{"url": "/api/" + apiVersion}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": gen.schemas,
+		},
+	}
+}
+
+// schemaGen converts Go types to OpenAPI schemas, collecting named
+// structs as components so each is described once
+type schemaGen struct {
+	schemas map[string]any
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		s := g.schema(t.Elem())
+		if _, isRef := s["$ref"]; isRef {
+			return map[string]any{"allOf": []any{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		ref := map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// Reserve the name first so recursive types terminate
+			g.schemas[t.Name()] = nil
+			g.schemas[t.Name()] = g.object(t)
+		}
+		return ref
+	}
+	return map[string]any{}
+}
+
+// object describes a struct's JSON fields, flattening embedded structs as
+// encoding/json does
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				add(f.Type)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = g.schema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	add(t)
+	s := map[string]any{"type": "object", "properties": props}
+	if required != nil {
+		s["required"] = required
+	}
+	return s
+}
+
+// versionedAPI serves /api/v1/... as /api/..., so the routes only need
+// registering once
+func versionedAPI(h http.Handler) http.Handler {
+	prefix := "/api/" + apiVersion
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rest, ok := strings.CutPrefix(r.URL.Path, prefix); ok && (rest == "" || rest[0] == '/') {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/api" + rest
+			if r.URL.RawPath != "" {
+				r2.URL.RawPath = "/api" + strings.TrimPrefix(r.URL.RawPath, prefix)
+			}
+			r = r2
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// getOpenAPI serves the OpenAPI document for r's routes
+func getOpenAPI(r *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, openAPISpec(r.Routes()))
+	}
+}
+
+// swaggerPage renders the OpenAPI document with Swagger UI, loaded from
+// its CDN; it is only served when -api-docs is set
+const swaggerPage = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>differing API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+SwaggerUIBundle({ url: '/api/` + apiVersion + `/openapi.json', dom_id: '#swagger-ui' });
+</script>
+</body>
+</html>
+`
+
+func getSwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerPage))
+}
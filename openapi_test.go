@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/diffs", getDiffs)
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+	r.POST("/api/undocumented", func(c *gin.Context) {})
+	r.GET("/", func(c *gin.Context) {})
+	r.GET("/api/openapi.json", getOpenAPI(r))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Summary    string `json:"summary"`
+			Parameters []struct {
+				Name string `json:"name"`
+			} `json:"parameters"`
+			Responses map[string]json.RawMessage `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(spec.Paths) != 4 {
+		t.Errorf("paths = %v, want the four /api routes", spec.Paths)
+	}
+	op, ok := spec.Paths["/file-diff/{id}/{filepath}"]["get"]
+	if !ok {
+		t.Fatalf("file-diff path missing from %v", spec.Paths)
+	}
+	if len(op.Parameters) != 2 || op.Parameters[0].Name != "id" || op.Parameters[1].Name != "filepath" {
+		t.Errorf("parameters = %+v", op.Parameters)
+	}
+	if _, ok := spec.Paths["/undocumented"]["post"].Responses["200"]; !ok {
+		t.Error("undocumented route has no response")
+	}
+
+	fileDiff := spec.Components.Schemas["FileDiff"]
+	if fileDiff.Properties["oldContent"]["type"] != "string" {
+		t.Errorf("FileDiff.oldContent = %v", fileDiff.Properties["oldContent"])
+	}
+	if fileDiff.Properties["hunks"]["nullable"] != true {
+		t.Errorf("FileDiff.hunks = %v, want nullable", fileDiff.Properties["hunks"])
+	}
+	if _, ok := spec.Components.Schemas["Hunk"]; !ok {
+		t.Error("nested Hunk schema not collected")
+	}
+	for _, name := range fileDiff.Required {
+		if name == "binary" {
+			t.Error("omitempty field binary listed as required")
+		}
+	}
+	if spec.Components.Schemas["DiffInfo"].Properties["timestamp"]["format"] != "date-time" {
+		t.Errorf("DiffInfo.timestamp = %v", spec.Components.Schemas["DiffInfo"].Properties["timestamp"])
+	}
+}
+
+func TestVersionedAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.UseRawPath = true
+	r.UnescapePathValues = true
+	r.GET("/api/diffs/:id/files", func(c *gin.Context) { c.String(http.StatusOK, c.Param("id")) })
+	r.GET("/api/v1x", func(c *gin.Context) { c.String(http.StatusOK, "v1x") })
+	h := versionedAPI(r)
+
+	for path, want := range map[string]string{
+		"/api/v1/diffs/working/files":             "working",
+		"/api/diffs/working/files":                "working",
+		"/api/v1/diffs/origin%2Fmain..HEAD/files": "origin/main..HEAD",
+		"/api/v1x": "v1x",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("%s = %d %q, want %q", path, w.Code, w.Body.String(), want)
+		}
+	}
+}
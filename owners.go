@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// codeownersPaths are where GitHub and GitLab look for CODEOWNERS, in
+// order of precedence
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// ownerRule is one CODEOWNERS line
+type ownerRule struct {
+	Pattern string
+	Owners  []string
+	re      *regexp.Regexp
+}
+
+// Contributor is an author of commits touching a file
+type Contributor struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Commits int    `json:"commits"`
+}
+
+// FileOwners reports who owns and who knows a file
+type FileOwners struct {
+	Path string `json:"path"`
+	// Owners and Rule come from the last matching CODEOWNERS line
+	Owners       []string      `json:"owners"`
+	Rule         string        `json:"rule,omitempty"`
+	Contributors []Contributor `json:"contributors"`
+}
+
+// maxContributors bounds how many contributors are listed per file
+const maxContributors = 10
+
+// codeownersPattern converts a CODEOWNERS pattern, which follows
+// gitignore rules, to a regular expression over repository paths
+func codeownersPattern(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.HasPrefix(pattern, "/") || strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.Trim(pattern, "/")
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "/**/"):
+			re.WriteString("/(?:.*/)?")
+			i += 3
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**"):
+			re.WriteString("/.*")
+			i += 2
+		case ch == '*':
+			re.WriteString("[^/]*")
+		case ch == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	if dirOnly {
+		// A directory pattern matches everything beneath it
+		re.WriteString("/.*")
+	} else {
+		// A pattern naming a directory also matches its contents
+		re.WriteString("(?:/.*)?")
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+// parseCodeowners reads CODEOWNERS rules, skipping comments, section
+// headers, and patterns that cannot be compiled
+func parseCodeowners(r io.Reader) []ownerRule {
+	var rules []ownerRule
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "^[") {
+			continue
+		}
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		re, err := codeownersPattern(fields[0])
+		if err != nil {
+			continue
+		}
+		rules = append(rules, ownerRule{Pattern: fields[0], Owners: fields[1:], re: re})
+	}
+	return rules
+}
+
+// loadCodeowners reads the working tree's CODEOWNERS file, if any
+func loadCodeowners() []ownerRule {
+	for _, p := range codeownersPaths {
+		data, err := secureRoot.ReadFile(p)
+		if err == nil {
+			return parseCodeowners(bytes.NewReader(data))
+		}
+	}
+	return nil
+}
+
+// matchOwners returns the last rule matching filePath; later lines take
+// precedence in CODEOWNERS
+func matchOwners(rules []ownerRule, filePath string) *ownerRule {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].re.MatchString(filePath) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// contributors counts the authors of non-merge commits reachable from
+// HEAD that touch each of paths, most active first
+func contributors(paths []string) (map[string][]Contributor, error) {
+	args := []string{"-c", "core.quotePath=false", "log", "--no-merges", "--no-renames", "--format=%x00%aN\t%aE", "--name-only", "HEAD", "--"}
+	for _, p := range paths {
+		args = append(args, ":(literal)"+p)
+	}
+	output, err := runGit(args...)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		wanted[p] = true
+	}
+	counts := make(map[string]map[Contributor]int)
+	var author Contributor
+	for _, line := range strings.Split(string(output), "\n") {
+		if header, ok := strings.CutPrefix(line, "\x00"); ok {
+			author.Name, author.Email, _ = strings.Cut(header, "\t")
+			continue
+		}
+		if !wanted[line] {
+			continue
+		}
+		if counts[line] == nil {
+			counts[line] = make(map[Contributor]int)
+		}
+		counts[line][author]++
+	}
+
+	result := make(map[string][]Contributor, len(paths))
+	for _, p := range paths {
+		list := []Contributor{}
+		for who, n := range counts[p] {
+			who.Commits = n
+			list = append(list, who)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Commits != list[j].Commits {
+				return list[i].Commits > list[j].Commits
+			}
+			return list[i].Name < list[j].Name
+		})
+		if len(list) > maxContributors {
+			list = list[:maxContributors]
+		}
+		result[p] = list
+	}
+	return result, nil
+}
+
+// fileOwners combines CODEOWNERS and history for each path
+func fileOwners(paths []string) ([]FileOwners, error) {
+	rules := loadCodeowners()
+	history, err := contributors(paths)
+	if err != nil {
+		return nil, err
+	}
+	owners := make([]FileOwners, 0, len(paths))
+	for _, p := range paths {
+		fo := FileOwners{Path: p, Owners: []string{}, Contributors: history[p]}
+		if rule := matchOwners(rules, p); rule != nil {
+			fo.Owners = append(fo.Owners, rule.Owners...)
+			fo.Rule = rule.Pattern
+		}
+		owners = append(owners, fo)
+	}
+	return owners, nil
+}
+
+// getOwners reports the owners and contributors of one file
+func getOwners(c *gin.Context) {
+	filePath := path.Clean(filePathParam(c))
+	if filePath == "." || filePath == ".." || strings.HasPrefix(filePath, "../") {
+		respondError(c, http.StatusBadRequest, "Invalid file path", nil)
+		return
+	}
+	owners, err := fileOwners([]string{filePath})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read history", err)
+		return
+	}
+	c.JSON(http.StatusOK, owners[0])
+}
+
+// getDiffOwners reports owners for every file in a diff
+func getDiffOwners(c *gin.Context) {
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+	files, err := listDiffFiles(c.Request.Context(), spec, DiffOptions{}, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to get diff files", err)
+		return
+	}
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	if len(paths) == 0 {
+		c.JSON(http.StatusOK, []FileOwners{})
+		return
+	}
+	owners, err := fileOwners(paths)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read history", err)
+		return
+	}
+	c.JSON(http.StatusOK, owners)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCodeownersMatching(t *testing.T) {
+	rules := parseCodeowners(strings.NewReader(`# comment
+*           @everyone
+*.go        @gophers # trailing comment
+/docs/      @writers
+build/      @infra
+src/**/ui   @design
+[Section]
+`))
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"README.md", "@everyone"},
+		{"cmd/main.go", "@gophers"},
+		{"docs/guide.md", "@writers"},
+		{"sub/docs/guide.md", "@everyone"},
+		{"sub/build/out.txt", "@infra"},
+		{"src/a/b/ui/button.tsx", "@design"},
+		{"src/ui", "@design"},
+	}
+	for _, tt := range tests {
+		rule := matchOwners(rules, tt.path)
+		if rule == nil || strings.Join(rule.Owners, " ") != tt.want {
+			t.Errorf("matchOwners(%q) = %+v, want %s", tt.path, rule, tt.want)
+		}
+	}
+}
+
+func TestGetOwners(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+	os.MkdirAll(filepath.Join(repoDir, ".github"), 0755)
+	os.WriteFile(filepath.Join(repoDir, ".github", "CODEOWNERS"), []byte("*.ts @web-team\n"), 0644)
+
+	r := gin.New()
+	r.GET("/api/owners/*filepath", getOwners)
+	r.GET("/api/diffs/:id/owners", getDiffOwners)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/owners/test1.go", nil))
+	var owners FileOwners
+	json.Unmarshal(w.Body.Bytes(), &owners)
+	if w.Code != http.StatusOK || len(owners.Owners) != 0 || len(owners.Contributors) != 1 || owners.Contributors[0].Commits != 2 {
+		t.Errorf("owners of test1.go = %d %+v", w.Code, owners)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/working/owners", nil))
+	var list []FileOwners
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Path != "test2.ts" || list[0].Rule != "*.ts" || list[0].Owners[0] != "@web-team" {
+		t.Errorf("diff owners = %+v", list)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getFilePatch returns git's unified diff for one file, computed with the
+// requested diff algorithm and context options.
+func getFilePatch(c *gin.Context) {
+	filePath := filePathParam(c)
+
+	opts, err := diffOptionsFromQuery(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+
+	args := append([]string{"diff", "--no-color"}, opts.args()...)
+	args = append(append(args, spec.revArgs()...), "--", filePath)
+
+	output, err := runGitContext(c.Request.Context(), args...)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to compute patch", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"path": filePath, "patch": string(output)})
+}
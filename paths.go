@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// filePathParam returns the *filepath route parameter as a repository path
+func filePathParam(c *gin.Context) string {
+	return repoPath(strings.TrimPrefix(c.Param("filepath"), "/"))
+}
+
+// repoPath converts a client-supplied path to the slash-separated form git
+// uses. On Windows backslashes are separators too; elsewhere they are
+// ordinary filename characters and are left alone.
+func repoPath(p string) string {
+	return filepath.ToSlash(p)
+}
+
+// isAbsPath reports whether p is absolute on any platform: rooted at a
+// slash or backslash, or starting with a drive letter. filepath.IsAbs only
+// knows the current platform's rules, so a Unix server would otherwise
+// accept C:\ paths and a Windows one \\server\share paths.
+func isAbsPath(p string) bool {
+	if p == "" {
+		return false
+	}
+	if p[0] == '/' || p[0] == '\\' || filepath.IsAbs(p) {
+		return true
+	}
+	return len(p) >= 2 && p[1] == ':' && ('a' <= p[0]|0x20 && p[0]|0x20 <= 'z')
+}
+
+// escapesRepo reports whether p, a slash-separated path relative to the
+// repository root, is absolute or climbs out of the repository with ..
+func escapesRepo(p string) bool {
+	if isAbsPath(p) {
+		return true
+	}
+	clean := path.Clean(p)
+	return clean == ".." || strings.HasPrefix(clean, "../")
+}
+
+// hasCRLF reports whether data uses CRLF line endings
+func hasCRLF(data []byte) bool {
+	return bytes.Contains(data, []byte("\r\n"))
+}
+
+// uniformCRLF reports whether every line of data ends with CRLF
+func uniformCRLF(data []byte) bool {
+	n := bytes.Count(data, []byte("\n"))
+	return n > 0 && bytes.Count(data, []byte("\r\n")) == n
+}
+
+// worktreeNormalizesEOL reports whether git stores path with LF endings
+// while the working tree copy has CRLF, as core.autocrlf and eol
+// attributes arrange on Windows. Such files are shown with LF so that
+// every line does not appear changed.
+func worktreeNormalizesEOL(path string) bool {
+	output, err := runGit("ls-files", "--eol", "--", path)
+	if err != nil {
+		return false
+	}
+	// Format: "i/<eol> w/<eol> attr/<attrs>\t<path>"
+	fields := strings.Fields(string(output))
+	return len(fields) >= 2 && fields[0] == "i/lf" && fields[1] == "w/crlf"
+}
+
+// toCRLF converts LF line endings to CRLF, leaving existing CRLFs alone
+func toCRLF(data []byte) []byte {
+	lf := bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(lf, []byte("\n"), []byte("\r\n"))
+}
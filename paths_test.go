@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsAbsPath(t *testing.T) {
+	for p, want := range map[string]bool{
+		"":                   false,
+		"a/b.go":             false,
+		"dir with space/":    false,
+		"c:relative":         true,
+		"/etc/passwd":        true,
+		`\Windows`:           true,
+		`C:\Program Files\x`: true,
+		`\\server\share`:     true,
+		"1:/x":               false,
+	} {
+		if got := isAbsPath(p); got != want {
+			t.Errorf("isAbsPath(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestEscapesRepo(t *testing.T) {
+	for p, want := range map[string]bool{
+		"":           false,
+		"a/b.go":     false,
+		"a/..":       false,
+		"..":         true,
+		"../x":       true,
+		"a/../../x":  true,
+		"/etc":       true,
+		"..foo/bar":  false,
+		"a/./../b/c": false,
+	} {
+		if got := escapesRepo(p); got != want {
+			t.Errorf("escapesRepo(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestToCRLF(t *testing.T) {
+	if got := string(toCRLF([]byte("a\nb\r\nc"))); got != "a\r\nb\r\nc" {
+		t.Errorf("toCRLF() = %q", got)
+	}
+}
+
+func TestNormalizedCRLFRoundTrip(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot = repoDir
+	secureRoot, err = os.OpenRoot(repoDir)
+	if err != nil {
+		t.Fatalf("Failed to open root: %v", err)
+	}
+	defer secureRoot.Close()
+
+	// With autocrlf the index holds LF while the working tree has CRLF,
+	// as on a typical Windows checkout
+	runGit("config", "core.autocrlf", "true")
+	os.WriteFile("dir with space.txt", []byte("one\r\ntwo\r\n"), 0644)
+	runGit("add", "dir with space.txt")
+	runGit("commit", "-q", "-m", "Add CRLF file")
+	os.WriteFile("dir with space.txt", []byte("one\r\ntwo\r\nthree\r\n"), 0644)
+	if !worktreeNormalizesEOL("dir with space.txt") {
+		t.Fatal("autocrlf file not detected as normalized")
+	}
+
+	r := gin.New()
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+	r.POST("/api/file-save/:id/*filepath", saveFile)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/dir%20with%20space.txt", nil))
+	var diff FileDiff
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if diff.NewContent != "one\ntwo\nthree\n" || diff.NewLineEnding != "crlf" {
+		t.Errorf("new side = %q (%q), want LF content marked crlf", diff.NewContent, diff.NewLineEnding)
+	}
+
+	body, _ := json.Marshal(map[string]string{"content": "one\nTWO\n"})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/file-save/working/dir%20with%20space.txt", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("save = %d: %s", w.Code, w.Body.String())
+	}
+	data, _ := os.ReadFile("dir with space.txt")
+	if string(data) != "one\r\nTWO\r\n" {
+		t.Errorf("saved %q, want CRLF endings kept", data)
+	}
+	if strings.Contains(diff.OldContent, "\r") {
+		t.Errorf("old side has CR: %q", diff.OldContent)
+	}
+
+	// A file git leaves alone keeps the endings it was saved with
+	os.WriteFile(".gitattributes", []byte("mixed.txt -text\n"), 0644)
+	os.WriteFile("mixed.txt", []byte("one\r\ntwo\n"), 0644)
+	runGit("add", ".gitattributes", "mixed.txt")
+	runGit("commit", "-q", "-m", "Add mixed file")
+	body, _ = json.Marshal(map[string]string{"content": "one\ntwo\nthree\n"})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/file-save/working/mixed.txt", bytes.NewReader(body)))
+	if data, _ := os.ReadFile("mixed.txt"); w.Code != http.StatusOK || string(data) != "one\ntwo\nthree\n" {
+		t.Errorf("save of a mixed file = %d, wrote %q", w.Code, data)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pathspecsFromQuery builds git pathspecs from the path=, glob=, and
+// exclude= query parameters, each of which may be repeated. Unless the
+// request passes defaultExcludes=false, the repository's configured
+// differing.exclude patterns are excluded too.
+func pathspecsFromQuery(c *gin.Context) []string {
+	var specs []string
+	for _, p := range c.QueryArray("path") {
+		if p != "" {
+			specs = append(specs, ":(literal)"+p)
+		}
+	}
+	for _, g := range c.QueryArray("glob") {
+		if g != "" {
+			specs = append(specs, ":(glob)"+g)
+		}
+	}
+
+	excludes := c.QueryArray("exclude")
+	if c.Query("defaultExcludes") != "false" {
+		excludes = append(excludes, defaultExcludes()...)
+	}
+	for _, e := range excludes {
+		if e != "" {
+			specs = append(specs, ":(exclude,glob)"+e)
+		}
+	}
+	return specs
+}
+
+// defaultExcludes returns the glob patterns configured with
+// `git config --add differing.exclude <pattern>` for this repository
+func defaultExcludes() []string {
+	output, err := runGit("config", "--get-all", "differing.exclude")
+	if err != nil {
+		// git config exits 1 when the key is unset
+		return nil
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// plugin is an external command configured with
+//
+//	git config differing.plugin.<name> '<command>'
+//
+// The command may use {file}, {commit}, and {range}, which are filled in
+// from the run request, shell-quoted. Commands run through the shell from
+// the repository root.
+type plugin struct {
+	Name         string   `json:"name"`
+	Command      string   `json:"command"`
+	Placeholders []string `json:"placeholders"`
+}
+
+// PluginEvent is one line of the NDJSON stream returned by runPlugin
+type PluginEvent struct {
+	Type     string `json:"type"` // start, output, exit
+	Plugin   string `json:"plugin"`
+	Text     string `json:"text,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+var pluginPlaceholder = regexp.MustCompile(`\{(file|commit|range)\}`)
+
+// loadPlugins returns the configured plugins in config file order
+func loadPlugins() []plugin {
+	output, err := runGit("config", "--get-regexp", `^differing\.plugin\.`)
+	if err != nil {
+		// git config exits 1 when nothing matches
+		return nil
+	}
+	var plugins []plugin
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		key, command, _ := strings.Cut(line, " ")
+		name := strings.TrimPrefix(key, "differing.plugin.")
+		if name == "" || command == "" {
+			continue
+		}
+		p := plugin{Name: name, Command: command, Placeholders: []string{}}
+		for _, m := range pluginPlaceholder.FindAllStringSubmatch(command, -1) {
+			if !slices.Contains(p.Placeholders, m[1]) {
+				p.Placeholders = append(p.Placeholders, m[1])
+			}
+		}
+		plugins = append(plugins, p)
+	}
+	return plugins
+}
+
+// pluginArgs validates the values a run request supplies. Revisions are
+// resolved to SHAs and files must stay inside the repository.
+func pluginArgs(file, commit, rangeSpec string) (map[string]string, error) {
+	args := make(map[string]string)
+	if file != "" {
+		clean := path.Clean(strings.ReplaceAll(file, `\`, "/"))
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, errors.New("file must be inside the repository")
+		}
+		args["file"] = clean
+	}
+	if commit != "" {
+		sha, err := resolveRev(commit)
+		if err != nil {
+			return nil, err
+		}
+		args["commit"] = sha
+	}
+	if rangeSpec != "" {
+		resolved, err := resolveRangeArg(rangeSpec)
+		if err != nil {
+			return nil, err
+		}
+		args["range"] = resolved
+	}
+	return args, nil
+}
+
+// getPlugins lists the configured plugins and the placeholders each needs
+func getPlugins(c *gin.Context) {
+	plugins := loadPlugins()
+	if plugins == nil {
+		plugins = []plugin{}
+	}
+	c.JSON(http.StatusOK, plugins)
+}
+
+// runPlugin runs a plugin, streaming its combined output as NDJSON
+// PluginEvents
+func runPlugin(c *gin.Context) {
+	var req struct {
+		File   string `json:"file"`
+		Commit string `json:"commit"`
+		Range  string `json:"range"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid request", err)
+			return
+		}
+	}
+
+	var p *plugin
+	for _, candidate := range loadPlugins() {
+		if candidate.Name == c.Param("name") {
+			p = &candidate
+			break
+		}
+	}
+	if p == nil {
+		respondError(c, http.StatusNotFound, "Unknown plugin: "+c.Param("name"), nil)
+		return
+	}
+
+	args, err := pluginArgs(req.File, req.Commit, req.Range)
+	switch {
+	case errors.Is(err, errUnknownRevision):
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	case err != nil:
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	for _, name := range p.Placeholders {
+		if args[name] == "" {
+			respondError(c, http.StatusBadRequest, "Plugin "+p.Name+" requires "+name, nil)
+			return
+		}
+	}
+	script := pluginPlaceholder.ReplaceAllStringFunc(p.Command, func(m string) string {
+		return shellQuote(args[strings.Trim(m, "{}")])
+	})
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	emit := func(event PluginEvent) {
+		enc.Encode(event)
+		c.Writer.Flush()
+	}
+
+	emit(PluginEvent{Type: "start", Plugin: p.Name})
+	exitCode, err := runShell(c, script, func(line string) {
+		emit(PluginEvent{Type: "output", Plugin: p.Name, Text: line})
+	})
+	event := PluginEvent{Type: "exit", Plugin: p.Name, ExitCode: &exitCode}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	emit(event)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPluginArgs(t *testing.T) {
+	for _, file := range []string{"../secret", "/etc/passwd", `..\x`} {
+		if _, err := pluginArgs(file, "", ""); err == nil {
+			t.Errorf("pluginArgs(%q) should be rejected", file)
+		}
+	}
+	args, err := pluginArgs("./src/../main.go", "", "")
+	if err != nil || args["file"] != "main.go" {
+		t.Errorf("pluginArgs() = %v, %v", args, err)
+	}
+	if _, err := pluginArgs("", "--exec=evil", ""); err == nil {
+		t.Error("option-like commits should be rejected")
+	}
+}
+
+func TestRunPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin commands in this test use a POSIX shell")
+	}
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	oldRoot := gitRoot
+	gitRoot = repoDir
+	defer func() { gitRoot = oldRoot }()
+
+	runGit("config", "differing.plugin.show", "git show --stat --format=%s {commit} -- {file}")
+
+	plugins := loadPlugins()
+	if len(plugins) != 1 || !slices.Equal(plugins[0].Placeholders, []string{"commit", "file"}) {
+		t.Fatalf("loadPlugins() = %+v", plugins)
+	}
+
+	r := gin.New()
+	r.POST("/api/plugins/:name/run", runPlugin)
+	run := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/plugins/show/run", strings.NewReader(body)))
+		return w
+	}
+
+	if w := run(`{"commit": "HEAD"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("missing placeholder status = %d, want 400", w.Code)
+	}
+
+	w := run(`{"commit": "HEAD~1", "file": "test1.go"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var output []string
+	var exit *int
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var event PluginEvent
+		json.Unmarshal(scanner.Bytes(), &event)
+		switch event.Type {
+		case "output":
+			output = append(output, event.Text)
+		case "exit":
+			exit = event.ExitCode
+		}
+	}
+	if exit == nil || *exit != 0 {
+		t.Errorf("exit code = %v, want 0", exit)
+	}
+	if len(output) == 0 || output[0] != "Update hello function" {
+		t.Errorf("output = %q", output)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Per-endpoint parallelism for loops that run one git process per item.
+// The total across all requests is still capped by gitSlots.
+const (
+	fileStatParallelism   = 8
+	commitStatParallelism = 4
+)
+
+// gitSlots bounds how many git processes run at once, so a burst of
+// requests queues instead of forking hundreds of processes
+var gitSlots = make(chan struct{}, defaultGitProcs())
+
+// defaultGitProcs allows a couple of git processes per CPU, since many
+// spend their time waiting on disk rather than computing
+func defaultGitProcs() int {
+	return 2 * runtime.NumCPU()
+}
+
+// setGitProcs changes the process limit; it must be called before any git
+// process starts
+func setGitProcs(n int) {
+	if n < 1 {
+		n = 1
+	}
+	gitSlots = make(chan struct{}, n)
+}
+
+// acquireGit blocks until a git process may start and returns the
+// function that releases its slot
+func acquireGit() func() {
+	slots := gitSlots
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// forEachParallel calls fn for each index below n, running at most limit
+// calls at once, and returns when all have finished
+func forEachParallel(n, limit int, fn func(i int)) {
+	if limit < 1 {
+		limit = 1
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+	for i := range n {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachParallel(t *testing.T) {
+	var running, peak, calls atomic.Int32
+	forEachParallel(20, 3, func(i int) {
+		calls.Add(1)
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+	})
+	if calls.Load() != 20 {
+		t.Errorf("fn called %d times, want 20", calls.Load())
+	}
+	if peak.Load() > 3 {
+		t.Errorf("%d calls ran at once, limit was 3", peak.Load())
+	}
+}
+
+func TestAcquireGit(t *testing.T) {
+	old := gitSlots
+	defer func() { gitSlots = old }()
+	setGitProcs(1)
+
+	release := acquireGit()
+	acquired := make(chan struct{})
+	go func() {
+		acquireGit()()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second git process started while the only slot was held")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("slot was not handed on after release")
+	}
+}
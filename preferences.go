@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Preferences are per-user settings persisted across sessions and repositories
+type Preferences struct {
+	Diff DiffOptions     `json:"diff"`
+	View ViewPreferences `json:"view"`
+	// DefaultBase is the ref comparisons start from when none is chosen,
+	// such as origin/main; it need not exist in every repository
+	DefaultBase string `json:"defaultBase,omitempty"`
+}
+
+// ViewPreferences control how the frontend renders diffs. The server only
+// stores and validates them.
+type ViewPreferences struct {
+	Layout   string `json:"layout,omitempty"` // split or unified
+	TabWidth int    `json:"tabWidth,omitempty"`
+	Wrap     bool   `json:"wrap,omitempty"`
+	Theme    string `json:"theme,omitempty"` // light, dark, or system
+}
+
+// maxTabWidth bounds the tab width preference to something displayable
+const maxTabWidth = 16
+
+// validate rejects values the frontend or git would not accept
+func (p Preferences) validate() error {
+	if err := p.Diff.validate(); err != nil {
+		return err
+	}
+	switch p.View.Layout {
+	case "", "split", "unified":
+	default:
+		return fmt.Errorf("unknown layout %q (want split or unified)", p.View.Layout)
+	}
+	switch p.View.Theme {
+	case "", "light", "dark", "system":
+	default:
+		return fmt.Errorf("unknown theme %q (want light, dark, or system)", p.View.Theme)
+	}
+	if p.View.TabWidth < 0 || p.View.TabWidth > maxTabWidth {
+		return fmt.Errorf("tab width must be between 1 and %d", maxTabWidth)
+	}
+	if strings.HasPrefix(p.DefaultBase, "-") || strings.ContainsAny(p.DefaultBase, " \t\n") {
+		return fmt.Errorf("invalid default base %q", p.DefaultBase)
+	}
+	return nil
+}
+
+var (
+	prefsMu sync.Mutex
+	// prefsPath is where preferences are stored; empty disables persistence
+	prefsPath = defaultPrefsPath()
+)
+
+// defaultPrefsPath returns preferences.json in the user's config directory
+func defaultPrefsPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "differing", "preferences.json")
+}
+
+// loadPreferences reads the saved preferences, returning defaults if none
+// have been saved or the file cannot be read
+func loadPreferences() Preferences {
+	prefsMu.Lock()
+	defer prefsMu.Unlock()
+
+	var prefs Preferences
+	if prefsPath == "" {
+		return prefs
+	}
+	data, err := os.ReadFile(prefsPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("failed to read preferences", "path", prefsPath, "error", err)
+		}
+		return prefs
+	}
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		slog.Warn("failed to parse preferences", "path", prefsPath, "error", err)
+		return Preferences{}
+	}
+	return prefs
+}
+
+// savePreferences writes preferences atomically via a temp file and rename
+func savePreferences(prefs Preferences) error {
+	prefsMu.Lock()
+	defer prefsMu.Unlock()
+
+	if prefsPath == "" {
+		return errors.New("no user config directory available")
+	}
+	if err := os.MkdirAll(filepath.Dir(prefsPath), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(prefs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := prefsPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, prefsPath)
+}
+
+func getPreferences(c *gin.Context) {
+	c.JSON(http.StatusOK, loadPreferences())
+}
+
+func putPreferences(c *gin.Context) {
+	var prefs Preferences
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	if err := prefs.validate(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err := savePreferences(prefs); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to save preferences", err)
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"container/list"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+const (
+	// prefetchFiles is how many files from the top of a file list have
+	// their diffs loaded in the background
+	prefetchFiles = 3
+	// blobCacheBytes bounds the memory held by prefetched and recently
+	// shown blobs
+	blobCacheBytes = 64 << 20
+)
+
+// blobCache holds blob contents by object name, evicting the least
+// recently used once the byte budget is exceeded. Blobs are immutable, so
+// entries never go stale.
+type blobCache struct {
+	mu      sync.Mutex
+	limit   int
+	size    int
+	order   *list.List // of *blobEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type blobEntry struct {
+	sha  string
+	data []byte
+}
+
+var blobs = newBlobCache(blobCacheBytes)
+
+func newBlobCache(limit int) *blobCache {
+	return &blobCache{limit: limit, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (bc *blobCache) get(sha string) ([]byte, bool) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	el, ok := bc.entries[sha]
+	if !ok {
+		return nil, false
+	}
+	bc.order.MoveToFront(el)
+	return el.Value.(*blobEntry).data, true
+}
+
+func (bc *blobCache) put(sha string, data []byte) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if _, ok := bc.entries[sha]; ok || len(data) > bc.limit {
+		return
+	}
+	bc.entries[sha] = bc.order.PushFront(&blobEntry{sha: sha, data: data})
+	bc.size += len(data)
+	for bc.size > bc.limit {
+		oldest := bc.order.Back()
+		entry := oldest.Value.(*blobEntry)
+		bc.order.Remove(oldest)
+		delete(bc.entries, entry.sha)
+		bc.size -= len(entry.data)
+	}
+}
+
+func (bc *blobCache) reset() {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.order.Init()
+	bc.entries = make(map[string]*list.Element)
+	bc.size = 0
+}
+
+// readBlob returns a blob's content, from the cache when it has been read
+// or prefetched before
+func readBlob(sha string) ([]byte, error) {
+	if data, ok := blobs.get(sha); ok {
+		return data, nil
+	}
+	data, err := runGit("show", sha)
+	if err != nil {
+		return nil, err
+	}
+	blobs.put(sha, data)
+	return data, nil
+}
+
+// prefetchFileDiffs loads the committed sides of each file's diff into
+// the blob cache in the background. Working tree files are read straight
+// from disk and are not worth prefetching.
+func prefetchFileDiffs(spec diffSpec, paths []string) {
+	if len(paths) == 0 || (spec.Base == "" && spec.Head == "") {
+		return
+	}
+	go func() {
+		repoMu.RLock()
+		defer repoMu.RUnlock()
+		for _, path := range paths {
+			for _, rev := range []string{spec.Base, spec.Head} {
+				if rev == "" {
+					continue
+				}
+				sha, size, found, err := blobInfo(rev, path)
+				if err != nil || !found || exceedsLimit(size, false) {
+					continue
+				}
+				if _, err := readBlob(sha); err != nil {
+					slog.Debug("prefetch failed", "path", path, "error", gitStderr(err))
+				}
+			}
+		}
+	}()
+}
+
+// prefetchNextFile prefetches the diff of the file after path in the
+// diff's alphabetical file list, the one j moves to next
+func prefetchNextFile(spec diffSpec, path string) {
+	if spec.Base == "" && spec.Head == "" {
+		return
+	}
+	go func() {
+		repoMu.RLock()
+		output, err := runGit(append([]string{"diff", "--raw", "-z"}, spec.revArgs()...)...)
+		repoMu.RUnlock()
+		if err != nil {
+			return
+		}
+		files := parseRawDiff(string(output))
+		paths := make([]string, len(files))
+		for i, f := range files {
+			paths[i] = f.Path
+		}
+		sort.Strings(paths)
+		if i := sort.SearchStrings(paths, path); i < len(paths) && paths[i] == path && i+1 < len(paths) {
+			prefetchFileDiffs(spec, paths[i+1:i+2])
+		}
+	}()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBlobCacheEviction(t *testing.T) {
+	bc := newBlobCache(10)
+	bc.put("a", []byte("aaaa"))
+	bc.put("b", []byte("bbbb"))
+	bc.get("a")
+	bc.put("c", []byte("cccc"))
+
+	if _, ok := bc.get("b"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, sha := range []string{"a", "c"} {
+		if _, ok := bc.get(sha); !ok {
+			t.Errorf("%s was evicted", sha)
+		}
+	}
+	bc.put("big", make([]byte, 11))
+	if _, ok := bc.get("big"); ok {
+		t.Error("blob larger than the whole cache was stored")
+	}
+}
+
+func TestPrefetchNextFile(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	blobs.reset()
+	defer blobs.reset()
+
+	os.WriteFile("a.txt", []byte("one\n"), 0644)
+	os.WriteFile("b.txt", []byte("two\n"), 0644)
+	runGit("add", "a.txt", "b.txt")
+	runGit("commit", "-q", "-m", "Add two files")
+	spec, err := resolveDiff("HEAD", modeCommit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, _ := runGit("rev-parse", "HEAD:b.txt", "HEAD:a.txt")
+	shas := strings.Fields(string(output))
+
+	prefetchNextFile(spec, "a.txt")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if data, ok := blobs.get(shas[0]); ok {
+			if string(data) != "two\n" {
+				t.Errorf("prefetched b.txt = %q", data)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("next file was not prefetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := blobs.get(shas[1]); ok {
+		t.Error("the requested file itself was prefetched")
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// A minified file is one whose long lines hold most of its text. Longer
+// lines than this are not written by hand.
+const minifiedLineLength = 500
+
+// singleLineJSONLength is how long a JSON document on one line has to be
+// before it is worth breaking up
+const singleLineJSONLength = 120
+
+// prettifyKind returns the formatter for a file, "js", "css" or "json",
+// or "" when differing cannot reformat it
+func prettifyKind(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".js", ".mjs", ".cjs":
+		return "js"
+	case ".css":
+		return "css"
+	case ".json", ".map":
+		return "json"
+	}
+	return ""
+}
+
+// looksMinified reports whether content is minified or generated on too
+// few lines to review, such as a bundle or a single-line JSON document
+func looksMinified(path, content string) bool {
+	kind := prettifyKind(path)
+	if kind == "" {
+		return false
+	}
+	trimmed := strings.TrimRight(content, "\r\n")
+	if kind == "json" && len(trimmed) > singleLineJSONLength && !strings.Contains(trimmed, "\n") {
+		return true
+	}
+	long := 0
+	for line := range strings.Lines(content) {
+		if len(line) > minifiedLineLength {
+			long += len(line)
+		}
+	}
+	return long > len(content)/2
+}
+
+// prettify formats content for reading. Both sides of a diff go through
+// it when either looks minified, so that only what changed shows up as
+// changed.
+func prettify(path, content string) string {
+	if strings.TrimSpace(content) == "" {
+		return content
+	}
+	switch prettifyKind(path) {
+	case "json":
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, []byte(strings.TrimSpace(content)), "", "  "); err != nil {
+			// Not JSON after all; leave it for the text diff
+			return content
+		}
+		buf.WriteByte('\n')
+		return buf.String()
+	case "js":
+		return breakBlocks(content, true)
+	case "css":
+		return breakBlocks(content, false)
+	}
+	return content
+}
+
+// breakBlocks puts each statement or declaration of JavaScript or CSS on
+// its own line, indenting by brace depth. Strings, comments, template
+// literals and, for JavaScript, regular expressions are copied as they
+// are. It only moves whitespace, and does not try to be a full formatter.
+func breakBlocks(src string, js bool) string {
+	var b strings.Builder
+	b.Grow(len(src) + len(src)/8)
+	depth := 0  // brace depth, for indentation
+	parens := 0 // a semicolon inside parentheses does not end a statement
+	lineStart := true
+	space := false // whitespace seen since the last write
+	var prev byte  // last code character written, for telling regexes from division
+
+	newline := func() {
+		if !lineStart {
+			b.WriteByte('\n')
+			lineStart = true
+		}
+		space = false
+	}
+	write := func(s string) {
+		switch {
+		case lineStart:
+			b.WriteString(strings.Repeat("  ", depth))
+			lineStart = false
+		case space:
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(s)
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			// Collapse whitespace to one space, or none at a break
+			space = true
+			i = skipSpace(src, i)
+			continue
+		case c == '"' || c == '\'' || (js && c == '`'):
+			end := quotedEnd(src, i)
+			write(src[i:end])
+			i, prev = end, c
+			continue
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := len(src)
+			if k := strings.Index(src[i+2:], "*/"); k >= 0 {
+				end = i + 2 + k + 2
+			}
+			write(src[i:end])
+			i = end
+			continue
+		case js && c == '/' && i+1 < len(src) && src[i+1] == '/':
+			end := len(src)
+			if k := strings.IndexByte(src[i:], '\n'); k >= 0 {
+				end = i + k
+			}
+			write(src[i:end])
+			newline()
+			i = end
+			continue
+		case js && c == '/' && startsRegex(prev, src[:i]):
+			end := regexEnd(src, i)
+			write(src[i:end])
+			i, prev = end, '/'
+			continue
+		case c == '(' || c == '[':
+			parens++
+		case c == ')' || c == ']':
+			if parens > 0 {
+				parens--
+			}
+		case c == '{':
+			write("{")
+			depth++
+			newline()
+			i, prev = i+1, c
+			continue
+		case c == '}':
+			newline()
+			if depth > 0 {
+				depth--
+			}
+			write("}")
+			// Keep }, }; }) and the like together
+			if j := skipSpace(src, i+1); j >= len(src) || strings.IndexByte(",;)]", src[j]) < 0 {
+				newline()
+			}
+			i, prev = i+1, c
+			continue
+		case c == ';' && parens == 0:
+			write(";")
+			newline()
+			i, prev = i+1, c
+			continue
+		}
+		write(src[i : i+1])
+		i, prev = i+1, c
+	}
+	newline()
+	return b.String()
+}
+
+// quotedEnd returns the index just past the string starting at src[start],
+// or the end of src when it is unterminated. Template literals may span
+// lines and nest expressions, which are skipped by brace count.
+func quotedEnd(src string, start int) int {
+	quote := src[start]
+	braces := 0
+	for i := start + 1; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '\\':
+			i++
+		case quote == '`' && c == '$' && i+1 < len(src) && src[i+1] == '{':
+			braces++
+			i++
+		case quote == '`' && braces > 0 && c == '}':
+			braces--
+		case c == quote && braces == 0:
+			return i + 1
+		case c == '\n' && quote != '`':
+			return i
+		}
+	}
+	return len(src)
+}
+
+// startsRegex reports whether a slash after prev, the last code character,
+// and the source before it begins a regular expression rather than a
+// division
+func startsRegex(prev byte, before string) bool {
+	if prev == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", prev) >= 0 {
+		return true
+	}
+	trimmed := strings.TrimRight(before, " \t\n\r")
+	return strings.HasSuffix(trimmed, "return") || strings.HasSuffix(trimmed, "typeof")
+}
+
+// regexEnd returns the index just past the regular expression literal
+// starting at src[start], not counting its flags
+func regexEnd(src string, start int) int {
+	class := false
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '[':
+			class = true
+		case ']':
+			class = false
+		case '/':
+			if !class {
+				return i + 1
+			}
+		case '\n':
+			return i
+		}
+	}
+	return len(src)
+}
+
+// skipSpace returns the index of the first non-whitespace byte at or after i
+func skipSpace(src string, i int) int {
+	for i < len(src) && strings.IndexByte(" \t\n\r", src[i]) >= 0 {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLooksMinified(t *testing.T) {
+	bundle := strings.Repeat("var a=1;", 100)
+	tests := []struct {
+		name, path, content string
+		want                bool
+	}{
+		{"bundle", "app.min.js", bundle + "\n", true},
+		{"bundle with a license header", "app.js", "/*! license */\n" + bundle, true},
+		{"hand-written js", "app.js", strings.Repeat("var a = 1;\n", 100), false},
+		{"single-line json", "data.json", `{"items":[` + strings.Repeat(`"item",`, 30) + `"last"]}` + "\n", true},
+		{"short json", "package.json", `{"name":"app"}`, false},
+		{"not a web file", "data.txt", bundle, false},
+	}
+	for _, tt := range tests {
+		if got := looksMinified(tt.path, tt.content); got != tt.want {
+			t.Errorf("%s: looksMinified() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPrettify(t *testing.T) {
+	tests := []struct {
+		name, path, content, want string
+	}{
+		{"json", "a.json", `{"a":[1,2],"b":{}}`, "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": {}\n}\n"},
+		{"invalid json", "a.json", `{"a":`, `{"a":`},
+		{
+			"js",
+			"a.js",
+			`function f(a){for(var i=0;i<a;i++){g("{;}")}return x}var y={a:1},z=/[;}]/g;`,
+			"function f(a){\n  for(var i=0;i<a;i++){\n    g(\"{;}\")\n  }\n  return x\n}\nvar y={\n  a:1\n},z=/[;}]/g;\n",
+		},
+		{"js template literal", "a.js", "a=`${b;}`;c", "a=`${b;}`;\nc\n"},
+		{"js comment", "a.js", "a;// b;c\nd", "a;\n// b;c\nd\n"},
+		{
+			"css",
+			"a.css",
+			`a{color:red;background:url(data:image/png;base64,AA)}b:after{content:";"}`,
+			"a{\n  color:red;\n  background:url(data:image/png;base64,AA)\n}\nb:after{\n  content:\";\"\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := prettify(tt.path, tt.content); got != tt.want {
+			t.Errorf("%s: prettify() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileDiffPrettify(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	bundle := func(value string) string {
+		return strings.Repeat("function f(){return 1}", 30) + "var v=" + value + ";" + strings.Repeat("g();", 100)
+	}
+	os.WriteFile("bundle.js", []byte(bundle("1")), 0644)
+	exec.Command("git", "add", "bundle.js").Run()
+	exec.Command("git", "commit", "-m", "Add bundle").Run()
+	os.WriteFile("bundle.js", []byte(bundle("2")), 0644)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/bundle.js", nil))
+	var diff FileDiff
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if !diff.Minified || diff.Prettified || strings.Count(diff.NewContent, "\n") != 0 {
+		t.Fatalf("without prettify: minified=%v prettified=%v", diff.Minified, diff.Prettified)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/bundle.js?prettify=true", nil))
+	diff = FileDiff{}
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if !diff.Prettified {
+		t.Fatalf("prettify=true did not prettify: %s", w.Body.String())
+	}
+	oldLines := strings.Split(diff.OldContent, "\n")
+	newLines := strings.Split(diff.NewContent, "\n")
+	if len(oldLines) != len(newLines) {
+		t.Fatalf("prettified sides have %d and %d lines", len(oldLines), len(newLines))
+	}
+	var changed []string
+	for i := range oldLines {
+		if oldLines[i] != newLines[i] {
+			changed = append(changed, oldLines[i]+" -> "+newLines[i])
+		}
+	}
+	if len(changed) != 1 || changed[0] != "var v=1; -> var v=2;" {
+		t.Errorf("changed lines = %q, want only the var", changed)
+	}
+}
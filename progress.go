@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReviewProgress records how far a review of one diff has got
+type ReviewProgress struct {
+	// Viewed maps each file marked as viewed to when it was marked
+	Viewed    map[string]time.Time `json:"viewed"`
+	Comments  int                  `json:"comments"`
+	TimeSpent int64                `json:"timeSpent"` // seconds
+	LastFile  string               `json:"lastFile,omitempty"`
+	Updated   time.Time            `json:"updated"`
+}
+
+// progressUpdate is applied to the stored progress by PUT; counts are
+// increments so several tabs can report without overwriting each other
+type progressUpdate struct {
+	Viewed    []string `json:"viewed"`
+	Unviewed  []string `json:"unviewed"`
+	Comments  int      `json:"comments"`
+	TimeSpent int64    `json:"timeSpent"`
+	LastFile  *string  `json:"lastFile"`
+}
+
+// progressMu serializes reads and writes of the progress file
+var progressMu sync.Mutex
+
+// progressPath returns where review progress is stored for this
+// repository, inside its git directory so it never shows up as a change
+func progressPath() (string, error) {
+	output, err := runGit("rev-parse", "--git-path", "differing/progress.json")
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(gitRoot, path)
+	}
+	return path, nil
+}
+
+// progressKey identifies a diff by its resolved revisions, so progress on
+// a commit survives HEAD moving on
+func progressKey(spec diffSpec) string {
+	if spec.Index {
+		return spec.Base + "..index"
+	}
+	return spec.Base + ".." + spec.Head
+}
+
+func readProgress(path string) (map[string]*ReviewProgress, error) {
+	all := make(map[string]*ReviewProgress)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// writeProgress writes progress atomically via a temp file and rename
+func writeProgress(path string, all map[string]*ReviewProgress) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// progressResponse reports progress along with the diff's current files,
+// dropping viewed marks for files no longer in the diff
+func progressResponse(c *gin.Context, spec diffSpec, progress *ReviewProgress) {
+	files, err := listDiffFiles(c.Request.Context(), spec, DiffOptions{}, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to get diff files", err)
+		return
+	}
+	viewed := []string{}
+	for _, f := range files {
+		if _, ok := progress.Viewed[f.Path]; ok {
+			viewed = append(viewed, f.Path)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"viewed":     viewed,
+		"totalFiles": len(files),
+		"comments":   progress.Comments,
+		"timeSpent":  progress.TimeSpent,
+		"lastFile":   progress.LastFile,
+		"updated":    progress.Updated,
+	})
+}
+
+func getProgress(c *gin.Context) {
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+	path, err := progressPath()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to locate progress file", err)
+		return
+	}
+
+	progressMu.Lock()
+	all, err := readProgress(path)
+	progressMu.Unlock()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read progress", err)
+		return
+	}
+	progress := all[progressKey(spec)]
+	if progress == nil {
+		progress = &ReviewProgress{}
+	}
+	progressResponse(c, spec, progress)
+}
+
+func putProgress(c *gin.Context) {
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+	var update progressUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	path, err := progressPath()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to locate progress file", err)
+		return
+	}
+
+	progressMu.Lock()
+	all, err := readProgress(path)
+	if err != nil {
+		progressMu.Unlock()
+		respondError(c, http.StatusInternalServerError, "Failed to read progress", err)
+		return
+	}
+	key := progressKey(spec)
+	progress := all[key]
+	if progress == nil {
+		progress = &ReviewProgress{}
+		all[key] = progress
+	}
+	if progress.Viewed == nil {
+		progress.Viewed = make(map[string]time.Time)
+	}
+	now := time.Now()
+	for _, file := range update.Viewed {
+		progress.Viewed[file] = now
+	}
+	for _, file := range update.Unviewed {
+		delete(progress.Viewed, file)
+	}
+	progress.Comments = max(0, progress.Comments+update.Comments)
+	progress.TimeSpent = max(0, progress.TimeSpent+update.TimeSpent)
+	if update.LastFile != nil {
+		progress.LastFile = *update.LastFile
+	}
+	progress.Updated = now
+	err = writeProgress(path, all)
+	progressMu.Unlock()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to save progress", err)
+		return
+	}
+	progressResponse(c, spec, progress)
+}
+
+func deleteProgress(c *gin.Context) {
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+	path, err := progressPath()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to locate progress file", err)
+		return
+	}
+
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	all, err := readProgress(path)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read progress", err)
+		return
+	}
+	delete(all, progressKey(spec))
+	if err := writeProgress(path, all); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to save progress", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReviewProgress(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	oldRoot := gitRoot
+	gitRoot = repoDir
+	defer func() { gitRoot = oldRoot }()
+
+	r := gin.New()
+	r.GET("/api/diffs/:id/progress", getProgress)
+	r.PUT("/api/diffs/:id/progress", putProgress)
+	r.DELETE("/api/diffs/:id/progress", deleteProgress)
+
+	type response struct {
+		Viewed     []string `json:"viewed"`
+		TotalFiles int      `json:"totalFiles"`
+		Comments   int      `json:"comments"`
+		TimeSpent  int64    `json:"timeSpent"`
+		LastFile   string   `json:"lastFile"`
+	}
+	do := func(method, path, body string) response {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if w.Code != http.StatusOK && w.Code != http.StatusNoContent {
+			t.Fatalf("%s %s = %d: %s", method, path, w.Code, w.Body.String())
+		}
+		var resp response
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// HEAD~2 cumulatively touches test1.go and test2.ts
+	resp := do(http.MethodGet, "/api/diffs/HEAD~2/progress", "")
+	if len(resp.Viewed) != 0 || resp.TotalFiles != 2 {
+		t.Errorf("initial progress = %+v", resp)
+	}
+
+	do(http.MethodPut, "/api/diffs/HEAD~2/progress", `{"viewed": ["test1.go", "gone.go"], "comments": 2, "timeSpent": 30, "lastFile": "test1.go"}`)
+	resp = do(http.MethodPut, "/api/diffs/HEAD~2/progress", `{"timeSpent": 15}`)
+	if len(resp.Viewed) != 1 || resp.Viewed[0] != "test1.go" || resp.Comments != 2 || resp.TimeSpent != 45 || resp.LastFile != "test1.go" {
+		t.Errorf("progress after updates = %+v", resp)
+	}
+
+	// Progress is keyed by the resolved commits, not the spelling of the ID
+	sha, err := resolveRev("HEAD~2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := do(http.MethodGet, "/api/diffs/"+sha+"/progress", ""); resp.TimeSpent != 45 {
+		t.Errorf("progress by SHA = %+v", resp)
+	}
+	if resp := do(http.MethodGet, "/api/diffs/working/progress", ""); resp.TimeSpent != 0 {
+		t.Errorf("other diff progress = %+v, want empty", resp)
+	}
+
+	do(http.MethodDelete, "/api/diffs/HEAD~2/progress", "")
+	if resp := do(http.MethodGet, "/api/diffs/HEAD~2/progress", ""); resp.TimeSpent != 0 || len(resp.Viewed) != 0 {
+		t.Errorf("progress after reset = %+v", resp)
+	}
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// proposalDiffPrefix marks a diff ID showing a proposal's changes against
+// the working tree it was made for, as in proposal:3
+const proposalDiffPrefix = "proposal:"
+
+// Proposal statuses
+const (
+	proposalPending  = "pending"
+	proposalApproved = "approved" // and applied to the working tree
+	proposalRejected = "rejected"
+)
+
+// maxLongPoll bounds how long a request may block waiting for a change:
+// a proposal or tool session to be decided, or the editor selection to move
+const maxLongPoll = time.Hour
+
+// ProposalFile is one file of a proposal. A null content deletes the file.
+type ProposalFile struct {
+	Path     string  `json:"path"`
+	Content  *string `json:"content"`
+	Encoding string  `json:"encoding,omitempty"`
+}
+
+// ProposalRequest is the body of POST /api/proposals
+type ProposalRequest struct {
+	Title string         `json:"title"`
+	Files []ProposalFile `json:"files"`
+}
+
+// ProposalDecision is the body of POST /api/proposals/:id/reject
+type ProposalDecision struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// Proposal is a set of file changes waiting for a reviewer to approve
+// them into the working tree or reject them
+type Proposal struct {
+	ID     string   `json:"id"`
+	Title  string   `json:"title"`
+	Status string   `json:"status"`
+	Files  []string `json:"files"`
+	// Base holds the working tree the proposal was made against and
+	// Commit the same tree with the proposal applied
+	Base    string     `json:"base"`
+	Commit  string     `json:"commit"`
+	Created time.Time  `json:"created"`
+	Decided *time.Time `json:"decided,omitempty"`
+	Reason  string     `json:"reason,omitempty"`
+	// Secrets lists likely credentials the approved files added
+	Secrets []SecretFinding `json:"secrets,omitempty"`
+
+	repo string
+	// contents maps each path to its proposed bytes, nil to delete it
+	contents map[string][]byte
+	// done is closed once the proposal is decided
+	done chan struct{}
+}
+
+// proposals are kept in memory: an agent waiting on one holds its
+// request open, so neither outlives the server
+var proposals = struct {
+	sync.Mutex
+	byID map[string]*Proposal
+	next int
+}{byID: map[string]*Proposal{}}
+
+// lookupProposal returns the proposal with id made in the current
+// repository
+func lookupProposal(id string) (*Proposal, bool) {
+	proposals.Lock()
+	defer proposals.Unlock()
+	p, ok := proposals.byID[id]
+	if !ok || p.repo != gitRoot {
+		return nil, false
+	}
+	return p, true
+}
+
+// snapshot returns a copy of p safe to encode while it may be decided
+func (p *Proposal) snapshot() Proposal {
+	proposals.Lock()
+	defer proposals.Unlock()
+	return *p
+}
+
+// proposalContents validates the files of a proposal and decodes their
+// content, keyed by path
+func proposalContents(files []ProposalFile) (map[string][]byte, error) {
+	if len(files) == 0 {
+		return nil, errors.New("a proposal needs at least one file")
+	}
+	contents := make(map[string][]byte, len(files))
+	for _, f := range files {
+		p := repoPath(f.Path)
+		if p == "" || escapesRepo(p) || path.Clean(p) != p {
+			return nil, fmt.Errorf("invalid file path: %s", f.Path)
+		}
+		if p == ".git" || strings.HasPrefix(p, ".git/") {
+			return nil, fmt.Errorf("file path inside .git: %s", f.Path)
+		}
+		if _, ok := contents[p]; ok {
+			return nil, fmt.Errorf("file proposed twice: %s", f.Path)
+		}
+		if f.Content == nil {
+			contents[p] = nil
+			continue
+		}
+		data, err := encodeContent(*f.Content, f.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		contents[p] = data
+	}
+	return contents, nil
+}
+
+// proposalTree writes the working tree with contents applied to a tree
+// object, keeping the mode of files it replaces
+func proposalTree(contents map[string][]byte) (string, error) {
+	return editedWorkingTree(func(env []string) error {
+		for p, data := range contents {
+			if data == nil {
+				if _, err := runGitEnv(env, nil, "update-index", "--force-remove", "--", p); err != nil {
+					return err
+				}
+				continue
+			}
+			blob, err := runGitInput(data, "hash-object", "-w", "--stdin")
+			if err != nil {
+				return err
+			}
+			mode := "100644"
+			if staged, err := runGitEnv(env, nil, "ls-files", "--stage", "--", ":(literal)"+p); err == nil {
+				if fields := strings.Fields(string(staged)); len(fields) > 0 && fields[0] != gitlinkMode {
+					mode = fields[0]
+				}
+			}
+			info := mode + "," + strings.TrimSpace(string(blob)) + "," + p
+			if _, err := runGitEnv(env, nil, "update-index", "--add", "--cacheinfo", info); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// createProposal records the proposal as two commits, the working tree
+// and the working tree with the changes, so it can be diffed like any
+// other pair
+func createProposal(title string, contents map[string][]byte) (*Proposal, error) {
+	tree, err := workingTreeObject()
+	if err != nil {
+		return nil, err
+	}
+	base, err := snapshotCommit(tree, "Working tree")
+	if err != nil {
+		return nil, err
+	}
+	proposed, err := proposalTree(contents)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := runGit("commit-tree", proposed, "-p", base, "-m", title)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proposal{
+		Title:    title,
+		Status:   proposalPending,
+		Files:    make([]string, 0, len(contents)),
+		Base:     base,
+		Commit:   strings.TrimSpace(string(commit)),
+		Created:  time.Now(),
+		repo:     gitRoot,
+		contents: contents,
+		done:     make(chan struct{}),
+	}
+	for file := range contents {
+		p.Files = append(p.Files, file)
+	}
+	sort.Strings(p.Files)
+
+	proposals.Lock()
+	proposals.next++
+	p.ID = strconv.Itoa(proposals.next)
+	proposals.byID[p.ID] = p
+	proposals.Unlock()
+	return p, nil
+}
+
+// decide settles a pending proposal, returning false if it was already
+// decided. Callers hold the proposals lock.
+func (p *Proposal) decide(status, reason string) bool {
+	if p.Status != proposalPending {
+		return false
+	}
+	now := time.Now()
+	p.Status, p.Reason, p.Decided = status, reason, &now
+	close(p.done)
+	return true
+}
+
+// proposalConflicts lists the proposal's files that have changed in the
+// working tree since it was made. Files are compared as git would store
+// them, so line ending conversion and clean filters are not changes.
+func proposalConflicts(p *Proposal) ([]string, error) {
+	var conflicts []string
+	for _, file := range p.Files {
+		current, err := secureRoot.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		exists := err == nil
+		base, _, found, err := blobInfo(p.Base, file)
+		if err != nil {
+			return nil, err
+		}
+		if exists != found {
+			conflicts = append(conflicts, file)
+			continue
+		}
+		if !exists {
+			continue
+		}
+		output, err := runGitInput(current, "hash-object", "--stdin", "--path="+file)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(string(output)) != base {
+			conflicts = append(conflicts, file)
+		}
+	}
+	return conflicts, nil
+}
+
+// proposalSecrets scans the lines the proposal adds to each file
+func proposalSecrets(p *Proposal) []SecretFinding {
+	if secretsMode() == secretsOff {
+		return nil
+	}
+	var findings []SecretFinding
+	for _, file := range p.Files {
+		data := p.contents[file]
+		if data == nil || isBinary(data) {
+			continue
+		}
+		existing, _ := secureRoot.ReadFile(file)
+		findings = append(findings, scanNewContent(file, string(existing), string(data))...)
+	}
+	return findings
+}
+
+// checkProposalFile refuses to write a proposed file through a symbolic
+// link, into a nested repository, or over a directory
+func checkProposalFile(file string) error {
+	if repo := (nestedRepoFinder{}).repoOf(file); repo != "" {
+		return fmt.Errorf("file is inside the nested repository %s: %s", repo, file)
+	}
+	if err := checkNotSymlink(file); err != nil {
+		return err
+	}
+	if info, err := secureRoot.Stat(file); err == nil && info.IsDir() {
+		return fmt.Errorf("path is a directory: %s", file)
+	}
+	return nil
+}
+
+// applyProposal writes the proposal's files into the working tree. Every
+// file is checked before any is written, and if a write fails the files
+// already written are put back as they were.
+func applyProposal(p *Proposal) error {
+	for _, file := range p.Files {
+		if err := checkProposalFile(file); err != nil {
+			return err
+		}
+	}
+
+	// previous holds the content of each file that existed before
+	previous := make(map[string][]byte, len(p.Files))
+	var written []string
+	rollback := func() {
+		for i := len(written) - 1; i >= 0; i-- {
+			file := written[i]
+			if data, ok := previous[file]; ok {
+				secureRoot.WriteFile(file, data, 0644)
+			} else {
+				secureRoot.Remove(file)
+			}
+		}
+	}
+	for _, file := range p.Files {
+		if existing, err := secureRoot.ReadFile(file); err == nil {
+			previous[file] = existing
+		}
+		written = append(written, file)
+		data := p.contents[file]
+		var err error
+		if data == nil {
+			if err = secureRoot.Remove(file); os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			if dir := pathDir(file); dir != "" {
+				err = secureRoot.MkdirAll(dir, 0755)
+			}
+			if err == nil {
+				err = secureRoot.WriteFile(file, data, 0644)
+			}
+		}
+		if err != nil {
+			rollback()
+			return err
+		}
+	}
+
+	for _, file := range p.Files {
+		if data := p.contents[file]; data != nil {
+			if existing, ok := previous[file]; ok {
+				recordSave(file, existing, data)
+			}
+			lspFileSaved(file, string(data))
+		}
+		emitEvent(eventFileSaved, map[string]string{"path": file})
+	}
+	return nil
+}
+
+// pathDir returns the directory of a slash-separated repository path, or
+// "" at the root
+func pathDir(p string) string {
+	if dir := path.Dir(p); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// proposalDiffInfos returns diff list entries for the pending proposals,
+// oldest first
+func proposalDiffInfos() []DiffInfo {
+	proposals.Lock()
+	var pending []Proposal
+	for _, p := range proposals.byID {
+		if p.repo == gitRoot && p.Status == proposalPending {
+			pending = append(pending, *p)
+		}
+	}
+	proposals.Unlock()
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Created.Before(pending[j].Created) })
+
+	infos := make([]DiffInfo, 0, len(pending))
+	for _, p := range pending {
+		info := DiffInfo{ID: proposalDiffPrefix + p.ID, Message: "Proposed: " + p.Title, Timestamp: p.Created}
+		output, _ := runGit("diff", "--numstat", "-z", p.Base, p.Commit)
+		info.Additions, info.Deletions, info.FilesCount = headlineDiffStat(string(output))
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// waitForDone blocks for up to ?wait= milliseconds until done is closed,
+// returning false if it has written an error or the client has gone
+func waitForDone(c *gin.Context, done <-chan struct{}) bool {
+	ms := c.Query("wait")
+	if ms == "" {
+		return true
+	}
+	n, err := strconv.Atoi(ms)
+	if err != nil || n < 0 {
+		respondError(c, http.StatusBadRequest, "wait must be a number of milliseconds", nil)
+		return false
+	}
+	timer := time.NewTimer(min(time.Duration(n)*time.Millisecond, maxLongPoll))
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+		return false
+	case <-server.stop:
+	}
+	return true
+}
+
+// waitForDecision waits as waitForDone does until p is decided, then
+// responds with it: 200 once decided, 202 while pending
+func waitForDecision(c *gin.Context, p *Proposal) {
+	if !waitForDone(c, p.done) {
+		return
+	}
+	result := p.snapshot()
+	if result.Status == proposalPending {
+		c.JSON(http.StatusAccepted, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// postProposal records an agent's proposed changes for review, optionally
+// waiting for the decision. It is registered outside the repository hold,
+// which it takes only while recording, so a long wait does not keep the
+// repository from being switched.
+func postProposal(c *gin.Context) {
+	var req ProposalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	contents, err := proposalContents(req.Files)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = "Proposed changes"
+	}
+
+	repoMu.RLock()
+	p, err := createProposal(title, contents)
+	repoMu.RUnlock()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to record proposal", err)
+		return
+	}
+	emitEvent(eventProposalCreated, map[string]string{"proposal": p.ID, "title": p.Title})
+	waitForDecision(c, p)
+}
+
+// getProposal returns a proposal, waiting as postProposal does so an agent
+// can poll for the decision. Like postProposal it is outside the hold.
+func getProposal(c *gin.Context) {
+	repoMu.RLock()
+	p, ok := lookupProposal(c.Param("id"))
+	repoMu.RUnlock()
+	if !ok {
+		respondError(c, http.StatusNotFound, "No such proposal", nil)
+		return
+	}
+	waitForDecision(c, p)
+}
+
+// getProposals lists the repository's proposals, newest first
+func getProposals(c *gin.Context) {
+	proposals.Lock()
+	list := []Proposal{}
+	for _, p := range proposals.byID {
+		if p.repo == gitRoot {
+			list = append(list, *p)
+		}
+	}
+	proposals.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+	c.JSON(http.StatusOK, list)
+}
+
+// approveProposal applies a pending proposal to the working tree. Files
+// edited since the proposal was made are a conflict, and nothing is
+// written.
+func approveProposal(c *gin.Context) {
+	p, ok := lookupProposal(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, "No such proposal", nil)
+		return
+	}
+	// Held throughout so the proposal cannot be decided twice
+	proposals.Lock()
+	defer proposals.Unlock()
+	if p.Status != proposalPending {
+		respondError(c, http.StatusConflict, "Proposal is already "+p.Status, nil)
+		return
+	}
+	conflicts, err := proposalConflicts(p)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check the working tree", err)
+		return
+	}
+	if len(conflicts) > 0 {
+		apiErr := newAPIError(http.StatusConflict, "Files changed since the proposal was made", nil)
+		apiErr.Conflicts = conflicts
+		c.JSON(http.StatusConflict, apiErr)
+		return
+	}
+	secrets := proposalSecrets(p)
+	if !secretsAllowed(c, secrets) {
+		return
+	}
+	p.Secrets = secrets
+	if err := applyProposal(p); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to apply proposal", err)
+		return
+	}
+	p.decide(proposalApproved, "")
+	emitEvent(eventProposalDecided, map[string]string{"proposal": p.ID, "status": p.Status})
+	c.JSON(http.StatusOK, *p)
+}
+
+// rejectProposal discards a pending proposal, with an optional reason for
+// the agent
+func rejectProposal(c *gin.Context) {
+	var req ProposalDecision
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	p, ok := lookupProposal(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, "No such proposal", nil)
+		return
+	}
+	proposals.Lock()
+	defer proposals.Unlock()
+	if !p.decide(proposalRejected, strings.TrimSpace(req.Reason)) {
+		respondError(c, http.StatusConflict, "Proposal is already "+p.Status, nil)
+		return
+	}
+	emitEvent(eventProposalDecided, map[string]string{"proposal": p.ID, "status": p.Status})
+	c.JSON(http.StatusOK, *p)
+}
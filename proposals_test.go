@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProposals(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/proposals", postProposal)
+	r.GET("/api/proposals/:id", getProposal)
+	r.POST("/api/proposals/:id/approve", approveProposal)
+	r.POST("/api/proposals/:id/reject", rejectProposal)
+	r.GET("/api/diffs", getDiffs)
+	r.GET("/api/diffs/:id/files", getDiffFiles)
+
+	propose := func(body string) Proposal {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/proposals", strings.NewReader(body)))
+		var p Proposal
+		json.Unmarshal(w.Body.Bytes(), &p)
+		if w.Code != http.StatusAccepted || p.Status != proposalPending {
+			t.Fatalf("propose = %d: %s", w.Code, w.Body)
+		}
+		return p
+	}
+
+	p := propose(`{"title":"Rename hello","files":[
+		{"path":"test1.go","content":"package main\n\nfunc greet() {}\n"},
+		{"path":"docs/new.md","content":"# New\n"},
+		{"path":"test2.ts","content":null}]}`)
+
+	// Nothing is written until approval, but the proposal can be reviewed
+	if _, err := os.Stat("docs/new.md"); !os.IsNotExist(err) {
+		t.Errorf("proposal wrote docs/new.md before approval")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/proposal:"+p.ID+"/files", nil))
+	var files []FileInfo
+	json.Unmarshal(w.Body.Bytes(), &files)
+	if len(files) != 3 || files[0].Path != "docs/new.md" || files[0].Status != "added" || files[2].Status != "deleted" {
+		t.Errorf("proposal files = %d %+v", w.Code, files)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs", nil))
+	if !strings.Contains(w.Body.String(), `"id":"proposal:`+p.ID+`"`) {
+		t.Errorf("diff list does not show the pending proposal: %s", w.Body)
+	}
+
+	// An agent waiting on the proposal hears of the approval
+	decided := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/proposals/"+p.ID+"?wait=10000", nil))
+		decided <- w
+	}()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/proposals/"+p.ID+"/approve", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("approve = %d: %s", w.Code, w.Body)
+	}
+	w = <-decided
+	var result Proposal
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Status != proposalApproved {
+		t.Errorf("waiting agent got %d: %s", w.Code, w.Body)
+	}
+	if data, _ := os.ReadFile("test1.go"); string(data) != "package main\n\nfunc greet() {}\n" {
+		t.Errorf("test1.go = %q", data)
+	}
+	if data, _ := os.ReadFile("docs/new.md"); string(data) != "# New\n" {
+		t.Errorf("docs/new.md = %q", data)
+	}
+	if _, err := os.Stat("test2.ts"); !os.IsNotExist(err) {
+		t.Errorf("test2.ts was not deleted")
+	}
+
+	// A file edited since the proposal was made is not overwritten
+	p = propose(`{"files":[{"path":"test1.go","content":"package main\n"}]}`)
+	os.WriteFile("test1.go", []byte("package main\n\n// edited\n"), 0644)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/proposals/"+p.ID+"/approve", nil))
+	var apiErr APIError
+	json.Unmarshal(w.Body.Bytes(), &apiErr)
+	if w.Code != http.StatusConflict || apiErr.Code != codeConflict || len(apiErr.Conflicts) != 1 || apiErr.Conflicts[0] != "test1.go" {
+		t.Errorf("approve after edit = %d: %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/proposals/"+p.ID+"/reject", strings.NewReader(`{"reason":"stale"}`)))
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Status != proposalRejected || result.Reason != "stale" {
+		t.Errorf("reject = %d: %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/proposals/"+p.ID+"/approve", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("approve after reject = %d, want 409", w.Code)
+	}
+
+	// Line endings git normalizes away are not an edit
+	os.WriteFile(".gitattributes", []byte("*.txt text\n"), 0644)
+	os.WriteFile("notes.txt", []byte("one\r\ntwo\r\n"), 0644)
+	runGit("add", ".gitattributes", "notes.txt")
+	runGit("commit", "-q", "-m", "Add notes")
+	p = propose(`{"files":[{"path":"notes.txt","content":"one\r\ntwo\r\nthree\r\n"}]}`)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/proposals/"+p.ID+"/approve", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("approve of a CRLF file = %d: %s", w.Code, w.Body)
+	}
+
+	// Every file is checked before any is written
+	p = propose(`{"files":[{"path":"notes.txt","content":"changed\n"},{"path":"build","content":"x\n"}]}`)
+	os.Mkdir("build", 0755)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/proposals/"+p.ID+"/approve", nil))
+	if w.Code == http.StatusOK {
+		t.Errorf("approve writing over a directory = %d: %s", w.Code, w.Body)
+	}
+	if data, _ := os.ReadFile("notes.txt"); string(data) != "one\r\ntwo\r\nthree\r\n" {
+		t.Errorf("notes.txt was written by a failed approval: %q", data)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/proposals", strings.NewReader(`{"files":[{"path":"../outside","content":""}]}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("path outside repository = %d, want 400", w.Code)
+	}
+}
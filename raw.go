@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getRawFile serves one side of a file in a diff as-is, with range
+// support, so binaries and large files need not go through JSON. The new
+// side is served by default; ?side=old serves the old one, and
+// ?download=true asks the browser to save rather than display it.
+func getRawFile(c *gin.Context) {
+	filePath := filePathParam(c)
+	side := c.DefaultQuery("side", "new")
+	if side != "old" && side != "new" {
+		respondError(c, http.StatusBadRequest, "side must be old or new", nil)
+		return
+	}
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+	if spec.Reverse {
+		side = map[string]string{"old": "new", "new": "old"}[side]
+	}
+
+	name := path.Base(filePath)
+	disposition := "inline"
+	if c.Query("download") == "true" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	// Repository content is untrusted; never let it run script in the
+	// app's origin or be sniffed into something executable
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	rev := spec.Head
+	if side == "old" {
+		rev = spec.Base
+	} else if !spec.newSideInGit() {
+		// The new side of working changes is the file on disk, or for a
+		// symlink its target, as git stores it
+		if target, ok, err := workingLink(filePath); ok {
+			http.ServeContent(c.Writer, c.Request, name, time.Time{}, strings.NewReader(target))
+			return
+		} else if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to read link", err)
+			return
+		}
+		file, err := secureRoot.Open(filePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			respondError(c, http.StatusNotFound, "File not found: "+filePath, nil)
+			return
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to open file", err)
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			respondError(c, http.StatusNotFound, "Not a file: "+filePath, nil)
+			return
+		}
+		http.ServeContent(c.Writer, c.Request, name, info.ModTime(), file)
+		return
+	}
+
+	if side == "old" && rev == "" {
+		respondError(c, http.StatusNotFound, "The old side of this diff is empty", nil)
+		return
+	}
+	sha, _, found, err := blobInfo(rev, filePath)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to look up file", err)
+		return
+	}
+	if !found {
+		respondError(c, http.StatusNotFound, "File not found: "+filePath, nil)
+		return
+	}
+	data, err := runGitContext(c.Request.Context(), "cat-file", "blob", sha)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read file", err)
+		return
+	}
+	// Blobs are immutable, so the object name is a strong validator
+	c.Header("ETag", `"`+sha+`"`)
+	http.ServeContent(c.Writer, c.Request, name, time.Time{}, bytes.NewReader(data))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetRawFile(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/raw/:id/*filepath", getRawFile)
+	get := func(url string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/api/raw/HEAD~1/test1.go?side=old&download=true")
+	if w.Code != http.StatusOK || w.Body.String() != "package main\n\nfunc hello() {}\n" {
+		t.Errorf("old side = %d %q", w.Code, w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != "attachment; filename=test1.go" {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	// Range requests work for blobs and for working tree files
+	w = get("/api/raw/HEAD~1/test1.go?mode=commit", "Range", "bytes=0-6")
+	if w.Code != http.StatusPartialContent || w.Body.String() != "package" {
+		t.Errorf("ranged blob = %d %q", w.Code, w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+	if w := get("/api/raw/HEAD~1/test1.go?mode=commit", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("conditional blob request = %d, want 304", w.Code)
+	}
+
+	w = get("/api/raw/working/test2.ts", "Range", "bytes=0-3")
+	if w.Code != http.StatusPartialContent || w.Body.Len() != 4 {
+		t.Errorf("ranged working file = %d %q", w.Code, w.Body.String())
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "sandbox") {
+		t.Errorf("Content-Security-Policy = %q, want sandbox", csp)
+	}
+
+	if w := get("/api/raw/working/missing.txt"); w.Code != http.StatusNotFound {
+		t.Errorf("missing file = %d, want 404", w.Code)
+	}
+	if w := get("/api/raw/HEAD~1/test2.ts?side=old"); w.Code != http.StatusNotFound {
+		t.Errorf("file absent on the old side = %d, want 404", w.Code)
+	}
+}
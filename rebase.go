@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RebaseEvent is one line of the NDJSON stream from POST /api/rebase
+type RebaseEvent struct {
+	Type      string   `json:"type"` // output, conflict, done, or error
+	Text      string   `json:"text,omitempty"`
+	Conflicts []string `json:"conflicts,omitempty"`
+	Head      string   `json:"head,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// conflictedFiles lists paths with unresolved merge conflicts
+func conflictedFiles() []string {
+	output, err := runGit("diff", "--name-only", "--diff-filter=U", "-z")
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, p := range strings.Split(string(output), "\x00") {
+		if p != "" {
+			files = append(files, p)
+		}
+	}
+	return files
+}
+
+// rebaseBranch rebases the current branch onto a target ref, streaming
+// git's output. A conflict leaves the rebase stopped for the client to
+// resolve and then continue or abort. Like the other history rewrites it
+// replays commits remote branches contain only with force=true.
+func rebaseBranch(c *gin.Context) {
+	var req struct {
+		Upstream  string `json:"upstream"`
+		Onto      string `json:"onto"`
+		Autostash bool   `json:"autostash"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Upstream == "" {
+		respondError(c, http.StatusBadRequest, "An upstream ref is required", nil)
+		return
+	}
+	if rebaseInProgress() {
+		respondError(c, http.StatusConflict, "A rebase is already in progress", nil)
+		return
+	}
+	upstream, err := resolveRev(req.Upstream)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	}
+	// core.editor keeps git from waiting on an editor nobody can see
+	args := []string{"-c", "core.editor=true", "rebase"}
+	if req.Autostash {
+		args = append(args, "--autostash")
+	} else if dirty, _ := worktreeDirty(); dirty {
+		respondError(c, http.StatusConflict, "The working tree has uncommitted changes; use autostash", nil)
+		return
+	}
+	if req.Onto != "" {
+		onto, err := resolveRev(req.Onto)
+		if err != nil {
+			respondError(c, http.StatusNotFound, err.Error(), err)
+			return
+		}
+		args = append(args, "--onto", onto)
+	}
+	args = append(args, upstream)
+
+	// Every commit being replayed gets a new identity
+	replayed, err := runGitContext(c.Request.Context(), "rev-list", "HEAD", "^"+upstream)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list commits", err)
+		return
+	}
+	if _, err := checkPushed(forceRewrite(c), strings.Fields(string(replayed))...); err != nil {
+		writeRewriteError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	emit := func(event RebaseEvent) {
+		enc.Encode(event)
+		c.Writer.Flush()
+	}
+
+	// The rebase is left to finish if the client goes away, rather than
+	// killed partway
+	release := acquireGit()
+	exitCode, err := streamCommand(gitCommand(args...), func(line string) {
+		emit(RebaseEvent{Type: "output", Text: line})
+	})
+	release()
+	switch {
+	case err != nil:
+		emit(RebaseEvent{Type: "error", Error: err.Error()})
+	case exitCode == 0:
+		recordHistory("rebase", previousHead())
+		emitEvent(eventHistoryRewritten, map[string]string{"action": "rebase", "upstream": req.Upstream})
+		emit(RebaseEvent{Type: "done", Head: currentHead()})
+	case rebaseInProgress():
+		emit(RebaseEvent{Type: "conflict", Conflicts: conflictedFiles()})
+	default:
+		emit(RebaseEvent{Type: "error", Error: "git rebase failed"})
+	}
+}
+
+// getRebase reports whether a rebase is stopped and on which files
+func getRebase(c *gin.Context) {
+	inProgress := rebaseInProgress()
+	conflicts := []string{}
+	if inProgress {
+		conflicts = append(conflicts, conflictedFiles()...)
+	}
+	c.JSON(http.StatusOK, gin.H{"inProgress": inProgress, "conflicts": conflicts})
+}
+
+// continueRebase resumes a stopped rebase after conflicts are resolved
+func continueRebase(c *gin.Context) {
+	if !rebaseInProgress() {
+		respondError(c, http.StatusConflict, "No rebase in progress", nil)
+		return
+	}
+	// A split has its own checks before the rebase may go on
+	if state, _ := splitState(); state != nil {
+		respondError(c, http.StatusConflict, "A commit split is in progress; use the split endpoints", nil)
+		return
+	}
+	if conflicts := conflictedFiles(); len(conflicts) > 0 {
+		apiErr := newAPIError(http.StatusConflict, "Resolve conflicts before continuing", nil)
+		apiErr.Conflicts = conflicts
+		c.JSON(http.StatusConflict, apiErr)
+		return
+	}
+	// Changes staged at a stop amend the commit it stopped at
+	var amended string
+	if hasStagedChanges() {
+		amended, _ = resolveRev("REBASE_HEAD")
+	}
+	if _, err := runGitEnvContext(c.Request.Context(), []string{"GIT_EDITOR=true"}, nil, "rebase", "--continue"); err != nil {
+		if rebaseInProgress() {
+			apiErr := newAPIError(http.StatusConflict, "Rebase stopped again", err)
+			apiErr.Conflicts = conflictedFiles()
+			c.JSON(http.StatusConflict, apiErr)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to continue rebase", err)
+		return
+	}
+	recordHistory("rebase", previousHead())
+	if amended != "" {
+		emitEvent(eventCommitAmended, map[string]string{"commit": amended, "action": "rebase"})
+	}
+	emitEvent(eventHistoryRewritten, map[string]string{"action": "rebase"})
+	c.JSON(http.StatusOK, gin.H{"head": currentHead()})
+}
+
+// abortRebase abandons a stopped rebase, restoring the original branch
+func abortRebase(c *gin.Context) {
+	if !rebaseInProgress() {
+		respondError(c, http.StatusConflict, "No rebase in progress", nil)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "rebase", "--abort"); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to abort rebase", err)
+		return
+	}
+	clearSplit()
+	c.JSON(http.StatusOK, gin.H{"head": currentHead()})
+}
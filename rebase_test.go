@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRebaseBranch(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	oldRoot := gitRoot
+	defer func() { gitRoot = oldRoot }()
+	gitRoot = repoDir
+
+	// topic edits test1.go off HEAD~1; main keeps HEAD, which adds test2.ts
+	runGit("checkout", "--", ".")
+	runGit("branch", "-M", "main")
+	runGit("checkout", "-q", "-b", "topic", "HEAD~1")
+	os.WriteFile(filepath.Join(repoDir, "test1.go"), []byte("package main\n// topic\n"), 0644)
+	runGit("commit", "-q", "-am", "Topic change")
+
+	r := gin.New()
+	r.GET("/api/rebase", getRebase)
+	r.POST("/api/rebase", rebaseBranch)
+	r.POST("/api/rebase/continue", continueRebase)
+	r.POST("/api/rebase/abort", abortRebase)
+
+	rebase := func(query, body string) (int, []RebaseEvent) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/rebase"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		var events []RebaseEvent
+		scanner := bufio.NewScanner(w.Body)
+		for scanner.Scan() {
+			var event RebaseEvent
+			if json.Unmarshal(scanner.Bytes(), &event) == nil {
+				events = append(events, event)
+			}
+		}
+		return w.Code, events
+	}
+
+	if code, _ := rebase("", `{"upstream":"--root"}`); code != http.StatusNotFound {
+		t.Errorf("option as upstream = %d, want 404", code)
+	}
+
+	// Replaying a commit a remote branch has needs force
+	runGit("update-ref", "refs/remotes/origin/topic", "topic")
+	if code, _ := rebase("", `{"upstream":"main"}`); code != http.StatusConflict {
+		t.Errorf("rebase of pushed commits = %d, want 409", code)
+	}
+	code, events := rebase("?force=true", `{"upstream":"main"}`)
+	if code != http.StatusOK || len(events) == 0 || events[len(events)-1].Type != "done" {
+		t.Fatalf("rebase = %d, events %+v", code, events)
+	}
+	if _, err := runGit("merge-base", "--is-ancestor", "main", "HEAD"); err != nil {
+		t.Error("branch was not rebased onto main")
+	}
+
+	// A conflicting change stops the rebase for resolution
+	runGit("checkout", "-q", "main")
+	os.WriteFile(filepath.Join(repoDir, "test1.go"), []byte("package main\n// main\n"), 0644)
+	runGit("commit", "-q", "-am", "Main change")
+	runGit("checkout", "-q", "topic")
+
+	_, events = rebase("?force=true", `{"upstream":"main"}`)
+	last := events[len(events)-1]
+	if last.Type != "conflict" || len(last.Conflicts) != 1 || last.Conflicts[0] != "test1.go" {
+		t.Fatalf("conflicting rebase ended with %+v", last)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/rebase/continue", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("continue with conflicts = %d, want 409", w.Code)
+	}
+
+	os.WriteFile(filepath.Join(repoDir, "test1.go"), []byte("package main\n// both\n"), 0644)
+	runGit("add", "test1.go")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/rebase/continue", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("continue = %d: %s", w.Code, w.Body.String())
+	}
+	if rebaseInProgress() {
+		t.Error("rebase still in progress after continue")
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/rebase/abort", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("abort with no rebase = %d, want 409", w.Code)
+	}
+}
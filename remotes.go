@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Remote is a configured remote with its fetch and push URLs
+type Remote struct {
+	Name     string `json:"name"`
+	FetchURL string `json:"fetchUrl"`
+	PushURL  string `json:"pushUrl"`
+}
+
+// validRemoteName reports whether name works as a remote name, which
+// git requires to form a valid refs/remotes/<name>/ prefix
+func validRemoteName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "-") {
+		return false
+	}
+	_, err := runGit("check-ref-format", "refs/remotes/"+name+"/x")
+	return err == nil
+}
+
+// listRemotes returns the configured remotes
+func listRemotes() ([]Remote, error) {
+	output, err := runGit("remote")
+	if err != nil {
+		return nil, err
+	}
+	remotes := []Remote{}
+	for _, name := range strings.Fields(string(output)) {
+		fetch, _ := runGit("remote", "get-url", name)
+		push, _ := runGit("remote", "get-url", "--push", name)
+		remotes = append(remotes, Remote{
+			Name:     name,
+			FetchURL: strings.TrimSpace(string(fetch)),
+			PushURL:  strings.TrimSpace(string(push)),
+		})
+	}
+	return remotes, nil
+}
+
+func getRemotes(c *gin.Context) {
+	remotes, err := listRemotes()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list remotes", err)
+		return
+	}
+	c.JSON(http.StatusOK, remotes)
+}
+
+func addRemote(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !validRemoteName(req.Name) {
+		respondError(c, http.StatusBadRequest, "Invalid remote name", nil)
+		return
+	}
+	if req.URL == "" || strings.HasPrefix(req.URL, "-") {
+		respondError(c, http.StatusBadRequest, "Invalid remote URL", nil)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "remote", "add", "--", req.Name, req.URL); err != nil {
+		respondError(c, http.StatusConflict, "Failed to add remote", err)
+		return
+	}
+	c.JSON(http.StatusCreated, Remote{Name: req.Name, FetchURL: req.URL, PushURL: req.URL})
+}
+
+// removeRemote deletes a remote along with its remote-tracking branches
+func removeRemote(c *gin.Context) {
+	name := c.Param("name")
+	if !validRemoteName(name) {
+		respondError(c, http.StatusBadRequest, "Invalid remote name", nil)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "remote", "get-url", name); err != nil {
+		respondError(c, http.StatusNotFound, "No such remote: "+name, nil)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "remote", "remove", name); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to remove remote", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// currentBranch returns the checked-out branch name, or "" when HEAD is
+// detached
+func currentBranch() string {
+	output, err := runGit("symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// putUpstream sets the current branch's upstream, such as origin/main
+func putUpstream(c *gin.Context) {
+	var req struct {
+		Upstream string `json:"upstream"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Upstream == "" {
+		respondError(c, http.StatusBadRequest, "An upstream ref is required", nil)
+		return
+	}
+	branch := currentBranch()
+	if branch == "" {
+		respondError(c, http.StatusConflict, "HEAD is detached; there is no current branch", nil)
+		return
+	}
+	if !setUpstream(c, branch, req.Upstream) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"branch": branch, "upstream": req.Upstream})
+}
+
+// deleteUpstream stops the current branch tracking anything
+func deleteUpstream(c *gin.Context) {
+	branch := currentBranch()
+	if branch == "" {
+		respondError(c, http.StatusConflict, "HEAD is detached; there is no current branch", nil)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "branch", "--unset-upstream", "--", branch); err != nil {
+		respondError(c, http.StatusConflict, "Failed to unset upstream", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
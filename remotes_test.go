@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRemoteEndpoints(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	runGit("branch", "-M", "main")
+
+	r := gin.New()
+	r.GET("/api/remotes", getRemotes)
+	r.POST("/api/remotes", addRemote)
+	r.DELETE("/api/remotes/:name", removeRemote)
+	r.PUT("/api/upstream", putUpstream)
+	r.DELETE("/api/upstream", deleteUpstream)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, bad := range []string{`{"name":"-x","url":"/tmp"}`, `{"name":"a b","url":"/tmp"}`, `{"name":"ok","url":"--upload-pack=x"}`} {
+		if w := do(http.MethodPost, "/api/remotes", bad); w.Code != http.StatusBadRequest {
+			t.Errorf("add %s = %d, want 400", bad, w.Code)
+		}
+	}
+	if w := do(http.MethodPost, "/api/remotes", `{"name":"origin","url":"`+repoDir+`"}`); w.Code != http.StatusCreated {
+		t.Fatalf("add = %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do(http.MethodGet, "/api/remotes", "")
+	var remotes []Remote
+	json.Unmarshal(w.Body.Bytes(), &remotes)
+	if len(remotes) != 1 || remotes[0].Name != "origin" || remotes[0].FetchURL != repoDir {
+		t.Errorf("remotes = %+v", remotes)
+	}
+
+	if w := do(http.MethodPut, "/api/upstream", `{"upstream":"origin/main"}`); w.Code != http.StatusNotFound {
+		t.Errorf("upstream before fetch = %d, want 404", w.Code)
+	}
+	runGit("fetch", "--quiet", "origin")
+	if w := do(http.MethodPut, "/api/upstream", `{"upstream":"origin/main"}`); w.Code != http.StatusOK {
+		t.Fatalf("set upstream = %d: %s", w.Code, w.Body.String())
+	}
+	if out, _ := runGit("rev-parse", "--abbrev-ref", "@{upstream}"); strings.TrimSpace(string(out)) != "origin/main" {
+		t.Errorf("upstream = %q", out)
+	}
+	if w := do(http.MethodDelete, "/api/upstream", ""); w.Code != http.StatusNoContent {
+		t.Errorf("unset upstream = %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodDelete, "/api/remotes/origin", ""); w.Code != http.StatusNoContent {
+		t.Errorf("remove = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodDelete, "/api/remotes/origin", ""); w.Code != http.StatusNotFound {
+		t.Errorf("remove missing = %d, want 404", w.Code)
+	}
+}
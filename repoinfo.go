@@ -0,0 +1,176 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RepoInfo describes the served repository for the header bar
+type RepoInfo struct {
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Shallow bool   `json:"shallow"`
+	Partial bool   `json:"partial"`
+	// ReadOnly is set when serving a managed clone; edits are rejected
+	ReadOnly bool `json:"readOnly"`
+	// Branch is empty when HEAD is detached, and Head is empty before the
+	// first commit
+	Branch string `json:"branch,omitempty"`
+	Head   string `json:"head,omitempty"`
+	// Upstream is the current branch's upstream, with how many commits
+	// each side has that the other lacks
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+	// Dirty is set when anything is staged, modified, conflicted, or
+	// untracked
+	Dirty      bool     `json:"dirty"`
+	Staged     int      `json:"staged"`
+	Unstaged   int      `json:"unstaged"`
+	Untracked  int      `json:"untracked"`
+	Conflicted int      `json:"conflicted"`
+	Stashes    int      `json:"stashes"`
+	Remotes    []Remote `json:"remotes"`
+	// Operation is the operation that has stopped partway: merge, rebase,
+	// am, cherry-pick, revert, bisect, or split
+	Operation string `json:"operation,omitempty"`
+}
+
+func getRepoInfo(c *gin.Context) {
+	info := RepoInfo{
+		Path:     gitRoot,
+		Name:     filepath.Base(gitRoot),
+		Shallow:  isShallowRepo(),
+		Partial:  isPartialClone(),
+		ReadOnly: readOnly,
+	}
+	if err := readWorkingStatus(&info); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to get repository status", err)
+		return
+	}
+	info.Stashes = stashCount()
+	info.Operation = operationInProgress()
+	remotes, err := listRemotes()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list remotes", err)
+		return
+	}
+	info.Remotes = remotes
+	c.JSON(http.StatusOK, info)
+}
+
+// readWorkingStatus fills in the branch and working tree fields from git
+// status, which reports them all in one pass
+func readWorkingStatus(info *RepoInfo) error {
+	output, err := runGit("status", "--porcelain=v2", "--branch", "-z")
+	if err != nil {
+		return err
+	}
+	entries := strings.Split(string(output), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if header, ok := strings.CutPrefix(entry, "# "); ok {
+			key, value, _ := strings.Cut(header, " ")
+			switch key {
+			case "branch.oid":
+				if value != "(initial)" {
+					info.Head = value
+				}
+			case "branch.head":
+				if value != "(detached)" {
+					info.Branch = value
+				}
+			case "branch.upstream":
+				info.Upstream = value
+			case "branch.ab":
+				// "+<ahead> -<behind>"
+				if ahead, behind, ok := strings.Cut(value, " "); ok {
+					info.Ahead, _ = strconv.Atoi(strings.TrimPrefix(ahead, "+"))
+					info.Behind, _ = strconv.Atoi(strings.TrimPrefix(behind, "-"))
+				}
+			}
+			continue
+		}
+		if len(entry) < 4 {
+			continue
+		}
+		switch entry[0] {
+		case '1', '2':
+			// "<type> <XY> ...": X is the index side, Y the working tree
+			if entry[2] != '.' {
+				info.Staged++
+			}
+			if entry[3] != '.' {
+				info.Unstaged++
+			}
+			if entry[0] == '2' {
+				// Renames are followed by their original path
+				i++
+			}
+		case 'u':
+			info.Conflicted++
+		case '?':
+			info.Untracked++
+		}
+	}
+	info.Dirty = info.Staged+info.Unstaged+info.Untracked+info.Conflicted > 0
+	return nil
+}
+
+// stashCount returns the number of stash entries
+func stashCount() int {
+	output, err := runGit("rev-list", "--walk-reflogs", "--count", "refs/stash")
+	if err != nil {
+		// No stash ref means nothing has been stashed
+		return 0
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(output)))
+	return n
+}
+
+// operationMarkers are the files git leaves in the git directory while an
+// operation is stopped, checked in order
+var operationMarkers = []struct {
+	path      string
+	operation string
+}{
+	{"rebase-apply/applying", "am"},
+	{"rebase-merge", "rebase"},
+	{"rebase-apply", "rebase"},
+	{"MERGE_HEAD", "merge"},
+	{"CHERRY_PICK_HEAD", "cherry-pick"},
+	{"REVERT_HEAD", "revert"},
+	{"BISECT_LOG", "bisect"},
+}
+
+// operationInProgress names the operation that has stopped partway, or
+// returns "" when there is none. A commit split runs as a rebase but is
+// reported as itself.
+func operationInProgress() string {
+	if _, err := resolveRev(splitRef); err == nil {
+		return "split"
+	}
+	args := []string{"rev-parse", "--path-format=absolute"}
+	for _, m := range operationMarkers {
+		args = append(args, "--git-path", m.path)
+	}
+	output, err := runGit(args...)
+	if err != nil {
+		return ""
+	}
+	paths := strings.Split(strings.TrimSpace(string(output)), "\n")
+	for i, m := range operationMarkers {
+		if i >= len(paths) {
+			break
+		}
+		if _, err := os.Stat(paths[i]); err == nil {
+			return m.operation
+		}
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetRepoInfo(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot = repoDir
+
+	git := func(args ...string) {
+		t.Helper()
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	git("checkout", "-q", "-b", "feature")
+	git("branch", "base", "HEAD~1")
+	git("branch", "--set-upstream-to=base")
+	git("remote", "add", "origin", "https://example.com/repo.git")
+	// One stash, then a staged file, the unstaged test2.ts edit from
+	// setupTestRepo, and an untracked file
+	git("stash", "-q")
+	git("stash", "apply", "-q")
+	os.WriteFile("staged.txt", []byte("staged\n"), 0644)
+	git("add", "staged.txt")
+	os.WriteFile("untracked.txt", []byte("new\n"), 0644)
+
+	get := func() RepoInfo {
+		t.Helper()
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/repo-info", nil)
+		getRepoInfo(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var info RepoInfo
+		if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	info := get()
+	if info.Name != filepath.Base(repoDir) || info.Branch != "feature" || len(info.Head) != 40 {
+		t.Errorf("name/branch/head = %q/%q/%q", info.Name, info.Branch, info.Head)
+	}
+	if info.Upstream != "base" || info.Ahead != 1 || info.Behind != 0 {
+		t.Errorf("upstream = %q +%d -%d", info.Upstream, info.Ahead, info.Behind)
+	}
+	if !info.Dirty || info.Staged != 1 || info.Unstaged != 1 || info.Untracked != 1 || info.Conflicted != 0 {
+		t.Errorf("status = %+v", info)
+	}
+	if info.Stashes != 1 {
+		t.Errorf("stashes = %d", info.Stashes)
+	}
+	if len(info.Remotes) != 1 || info.Remotes[0].Name != "origin" {
+		t.Errorf("remotes = %+v", info.Remotes)
+	}
+	if info.Operation != "" {
+		t.Errorf("operation = %q", info.Operation)
+	}
+
+	// A bisect in progress is reported, and a detached HEAD has no branch
+	os.WriteFile(filepath.Join(".git", "BISECT_LOG"), nil, 0644)
+	git("checkout", "-q", "--detach")
+	info = get()
+	if info.Operation != "bisect" || info.Branch != "" || info.Upstream != "" {
+		t.Errorf("operation/branch/upstream = %q/%q/%q", info.Operation, info.Branch, info.Upstream)
+	}
+}
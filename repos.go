@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRecentRepos bounds the recent repository list
+const maxRecentRepos = 20
+
+// RecentRepo is a repository differing has served
+type RecentRepo struct {
+	Path       string    `json:"path"`
+	LastOpened time.Time `json:"lastOpened"`
+}
+
+var (
+	// repoMu guards the active repository. API requests hold it for
+	// reading; switching repositories takes it for writing so no request
+	// sees a half-switched state.
+	repoMu sync.RWMutex
+
+	recentMu sync.Mutex
+	// recentPath is where the recent list is stored; empty disables persistence
+	recentPath = defaultRecentPath()
+)
+
+// defaultRecentPath returns recent-repos.json in the user's config directory
+func defaultRecentPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "differing", "recent-repos.json")
+}
+
+// loadRecentRepos returns the recent repositories, most recent first
+func loadRecentRepos() []RecentRepo {
+	recentMu.Lock()
+	defer recentMu.Unlock()
+	return readRecentRepos()
+}
+
+func readRecentRepos() []RecentRepo {
+	var repos []RecentRepo
+	if recentPath == "" {
+		return repos
+	}
+	data, err := os.ReadFile(recentPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("failed to read recent repositories", "path", recentPath, "error", err)
+		}
+		return repos
+	}
+	if err := json.Unmarshal(data, &repos); err != nil {
+		slog.Warn("failed to parse recent repositories", "path", recentPath, "error", err)
+		return nil
+	}
+	return repos
+}
+
+// recordRecentRepo moves root to the front of the recent list
+func recordRecentRepo(root string) error {
+	recentMu.Lock()
+	defer recentMu.Unlock()
+
+	if recentPath == "" {
+		return errors.New("no user config directory available")
+	}
+	repos := []RecentRepo{{Path: root, LastOpened: time.Now()}}
+	for _, repo := range readRecentRepos() {
+		if repo.Path != root && len(repos) < maxRecentRepos {
+			repos = append(repos, repo)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(recentPath), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(repos, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := recentPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, recentPath)
+}
+
+// holdRepo keeps the active repository from being switched while a
+// request is using it
+func holdRepo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repoMu.RLock()
+		defer repoMu.RUnlock()
+		c.Next()
+	}
+}
+
+// switchRepo makes the repository containing dir the active one. Git
+// commands run in the process's working directory, so it changes that too.
+func switchRepo(dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("repository path must be absolute: %s", dir)
+	}
+	output, err := runGit("-C", dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %s", dir)
+	}
+	root := strings.TrimSpace(string(output))
+	newRoot, err := os.OpenRoot(root)
+	if err != nil {
+		return "", err
+	}
+
+	repoMu.Lock()
+	defer repoMu.Unlock()
+	if err := os.Chdir(root); err != nil {
+		newRoot.Close()
+		return "", err
+	}
+	oldRoot := secureRoot
+	gitRoot, secureRoot = root, newRoot
+	if oldRoot != nil {
+		oldRoot.Close()
+	}
+
+	// Everything cached belongs to the previous repository
+	cache.reset()
+	blobs.reset()
+	uploadedCoverage.mu.Lock()
+	uploadedCoverage.profile = nil
+	uploadedCoverage.mu.Unlock()
+	stopLanguageServers()
+	return root, nil
+}
+
+func getRecentRepos(c *gin.Context) {
+	repos := loadRecentRepos()
+	if repos == nil {
+		repos = []RecentRepo{}
+	}
+	c.JSON(http.StatusOK, repos)
+}
+
+// postSwitchRepo switches the active repository. It must not run under
+// holdRepo, which would deadlock with the switch.
+func postSwitchRepo(c *gin.Context) {
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Path == "" {
+		respondError(c, http.StatusBadRequest, "path is required", nil)
+		return
+	}
+	root, err := switchRepo(req.Path)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Failed to switch repository", err)
+		return
+	}
+	if err := recordRecentRepo(root); err != nil {
+		slog.Warn("failed to record recent repository", "path", root, "error", err)
+	}
+	reregisterSelf(root)
+	slog.Info("switched repository", "path", root)
+	c.JSON(http.StatusOK, gin.H{"path": root})
+}
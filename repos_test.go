@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecentRepos(t *testing.T) {
+	oldPath := recentPath
+	recentPath = filepath.Join(t.TempDir(), "differing", "recent-repos.json")
+	defer func() { recentPath = oldPath }()
+
+	for _, root := range []string{"/a", "/b", "/a"} {
+		if err := recordRecentRepo(root); err != nil {
+			t.Fatalf("recordRecentRepo(%q) error: %v", root, err)
+		}
+	}
+	repos := loadRecentRepos()
+	if len(repos) != 2 || repos[0].Path != "/a" || repos[1].Path != "/b" {
+		t.Errorf("recent repos = %+v, want /a then /b", repos)
+	}
+
+	for i := 0; i < maxRecentRepos+5; i++ {
+		recordRecentRepo(filepath.Join("/repo", string(rune('a'+i))))
+	}
+	if n := len(loadRecentRepos()); n != maxRecentRepos {
+		t.Errorf("recent list has %d entries, want %d", n, maxRecentRepos)
+	}
+}
+
+func TestSwitchRepo(t *testing.T) {
+	firstDir, cleanupFirst := setupTestRepo(t)
+	defer cleanupFirst()
+	secondDir, cleanupSecond := setupTestRepo(t)
+	defer cleanupSecond()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	oldRoot, oldSecure := gitRoot, secureRoot
+	defer func() { gitRoot, secureRoot = oldRoot, oldSecure }()
+	secureRoot = nil
+
+	if _, err := switchRepo(firstDir); err != nil {
+		t.Fatalf("switchRepo() error: %v", err)
+	}
+	// A subdirectory resolves to the repository containing it
+	sub := filepath.Join(secondDir, "nested")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	root, err := switchRepo(sub)
+	if err != nil {
+		t.Fatalf("switchRepo() error: %v", err)
+	}
+	want, _ := filepath.EvalSymlinks(secondDir)
+	if got, _ := filepath.EvalSymlinks(root); got != want || gitRoot != root {
+		t.Errorf("root = %q, gitRoot = %q, want %q", root, gitRoot, want)
+	}
+	if cwd, _ := os.Getwd(); cwd != root {
+		t.Errorf("cwd = %q, want %q so git runs in the new repository", cwd, root)
+	}
+	if _, err := secureRoot.Stat("test1.go"); err != nil {
+		t.Errorf("secureRoot should open the new repository: %v", err)
+	}
+	secureRoot.Close()
+
+	if _, err := switchRepo(t.TempDir()); err == nil {
+		t.Error("switchRepo() should reject directories outside a repository")
+	}
+	if _, err := switchRepo("relative/path"); err == nil {
+		t.Error("switchRepo() should reject relative paths")
+	}
+}
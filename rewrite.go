@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errUnsafeRewrite is wrapped by checkRewritable when rewriting history
+// could lose work or break other clones
+var errUnsafeRewrite = errors.New("unsafe to rewrite history")
+
+// historyMu is held by requests that rewrite or add to history, so that
+// checking for a stopped rebase or merge and starting one happen together
+var historyMu sync.Mutex
+
+// serializeHistory runs a request that changes history only once any
+// other such request has finished
+func serializeHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		historyMu.Lock()
+		defer historyMu.Unlock()
+		c.Next()
+	}
+}
+
+// worktreeDirty reports whether tracked files have uncommitted changes
+func worktreeDirty() (bool, error) {
+	output, err := runGit("status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return false, err
+	}
+	return len(strings.TrimSpace(string(output))) > 0, nil
+}
+
+// pushedError is returned by checkRewritable when the commits to rewrite
+// are already on remote branches and the caller has not passed force=true
+type pushedError struct {
+	Branches []string
+}
+
+func (e *pushedError) Error() string {
+	return fmt.Sprintf("the commits to rewrite are already on %s; pass force=true to rewrite them anyway",
+		strings.Join(e.Branches, ", "))
+}
+
+func (e *pushedError) Unwrap() error { return errUnsafeRewrite }
+
+// remoteBranchesContaining lists the remote-tracking branches that contain
+// any of commits, skipping symbolic refs like origin/HEAD
+func remoteBranchesContaining(commits ...string) ([]string, error) {
+	branches := []string{}
+	if len(commits) == 0 {
+		return branches, nil
+	}
+	args := []string{"for-each-ref", "--format=%(if)%(symref)%(then)%(else)%(refname:short)%(end)"}
+	for _, sha := range commits {
+		args = append(args, "--contains", sha)
+	}
+	output, err := runGit(append(args, "refs/remotes")...)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			branches = append(branches, line)
+		}
+	}
+	return branches, nil
+}
+
+// checkPushed returns the remote branches containing commits, failing
+// with a pushedError when there are any and force is not set
+func checkPushed(force bool, commits ...string) ([]string, error) {
+	branches, err := remoteBranchesContaining(commits...)
+	if err != nil {
+		return nil, err
+	}
+	if len(branches) > 0 && !force {
+		return nil, &pushedError{Branches: branches}
+	}
+	return branches, nil
+}
+
+// forceRewrite reports whether the request acknowledged rewriting pushed
+// commits with force=true
+func forceRewrite(c *gin.Context) bool {
+	return c.Query("force") == "true"
+}
+
+// checkRewritable verifies that sha and everything after it on the
+// current branch can be rewritten: no rebase or merge is stopped partway,
+// the commit is an ancestor of HEAD, the working tree is clean, and there
+// are no merges for a linear rebase to flatten. Commits already on remote branches are only rewritten with
+// force; the branches are returned so the caller can report them.
+func checkRewritable(sha string, force bool) ([]string, error) {
+	if rebaseInProgress() || mergeInProgress() {
+		return nil, fmt.Errorf("%w: a rebase or merge is already in progress", errUnsafeRewrite)
+	}
+	if _, err := runGit("merge-base", "--is-ancestor", sha, "HEAD"); err != nil {
+		return nil, fmt.Errorf("%w: %s is not on the current branch", errUnsafeRewrite, sha)
+	}
+	dirty, err := worktreeDirty()
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("%w: the working tree has uncommitted changes", errUnsafeRewrite)
+	}
+	merges, err := runGit("rev-list", "--merges", "HEAD", "--not", sha+"^@")
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(merges))) > 0 {
+		return nil, fmt.Errorf("%w: there are merge commits after %s", errUnsafeRewrite, sha)
+	}
+	// A remote branch with any later commit also contains sha
+	return checkPushed(force, sha)
+}
+
+// rebaseTodo returns an interactive rebase todo list replaying the
+// commits after base onto it ("" replays from the root), with action
+// choosing each commit's command: pick, squash, fixup, drop, or edit.
+func rebaseTodo(base string, action func(sha string) string) (string, error) {
+	args := []string{"rev-list", "--reverse", "--no-merges", "HEAD"}
+	if base != "" {
+		args = append(args, "^"+base)
+	}
+	output, err := runGit(args...)
+	if err != nil {
+		return "", err
+	}
+	var todo strings.Builder
+	for _, sha := range strings.Fields(string(output)) {
+		fmt.Fprintf(&todo, "%s %s\n", action(sha), sha)
+	}
+	return todo.String(), nil
+}
+
+// scriptedRebase runs git rebase -i with todo in place of the editor
+// session. Messages git would ask to edit, as when squashing, are
+// accepted as proposed. If stopOnEdit is false, a rebase that stops for
+// any reason is aborted and the error returned.
+func scriptedRebase(base, todo string, stopOnEdit bool) error {
+	tmp, err := os.CreateTemp("", "differing-todo-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(todo)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// Git runs the sequence editor through the shell with the todo path
+	// appended, so copying our list over it replaces the user's edit
+	return runRebase("cp "+posixQuote(tmp.Name()), base, stopOnEdit, "--no-autosquash")
+}
+
+// runRebase runs git rebase -i onto base ("" for --root) with
+// sequenceEditor standing in for the todo editor and flags added. It
+// refuses to start while another rebase is stopped, and callers hold
+// historyMu, so the only rebase it ever aborts is its own.
+func runRebase(sequenceEditor, base string, stopOnEdit bool, flags ...string) error {
+	if rebaseInProgress() {
+		return fmt.Errorf("%w: a rebase is already in progress", errUnsafeRewrite)
+	}
+	env := []string{"GIT_SEQUENCE_EDITOR=" + sequenceEditor, "GIT_EDITOR=true"}
+	args := append([]string{"rebase", "--interactive"}, flags...)
+	if base == "" {
+		args = append(args, "--root")
+	} else {
+		args = append(args, base)
+	}
+	if _, err := runGitEnv(env, nil, args...); err != nil {
+		if !stopOnEdit && rebaseInProgress() {
+			runGit("rebase", "--abort")
+		}
+		return err
+	}
+	return nil
+}
+
+// rebaseInProgress reports whether a rebase has stopped partway
+func rebaseInProgress() bool {
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		output, err := runGit("rev-parse", "--path-format=absolute", "--git-path", dir)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(strings.TrimSpace(string(output))); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteTarget resolves the :commit parameter and checks it can be
+// rewritten, returning the remote branches that already contain it. On
+// failure it writes an error response and returns false.
+func rewriteTarget(c *gin.Context) (string, []string, bool) {
+	sha, err := resolveRev(c.Param("commit"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return "", nil, false
+	}
+	pushedTo, err := checkRewritable(sha, forceRewrite(c))
+	if err != nil {
+		writeRewriteError(c, err)
+		return "", nil, false
+	}
+	return sha, pushedTo, true
+}
+
+// writeRewriteError reports a failed history rewrite. Safety refusals
+// are conflicts with the repository's state; anything else is git failing.
+func writeRewriteError(c *gin.Context, err error) {
+	var pushed *pushedError
+	if errors.As(err, &pushed) {
+		apiErr := newAPIError(http.StatusConflict, err.Error(), nil)
+		apiErr.Code = codePushed
+		apiErr.PushedTo = pushed.Branches
+		c.AbortWithStatusJSON(http.StatusConflict, apiErr)
+		return
+	}
+	if errors.Is(err, errUnsafeRewrite) {
+		respondError(c, http.StatusConflict, err.Error(), err)
+		return
+	}
+	respondError(c, http.StatusConflict, "Rebase failed and was aborted", err)
+}
+
+// dropCommit removes a commit from the current branch, replaying the
+// commits after it
+func dropCommit(c *gin.Context) {
+	sha, pushedTo, ok := rewriteTarget(c)
+	if !ok {
+		return
+	}
+	base, _ := resolveRev(sha + "^")
+	todo, err := rebaseTodo(base, func(s string) string {
+		if s == sha {
+			return "drop"
+		}
+		return "pick"
+	})
+	if err == nil {
+		err = scriptedRebase(base, todo, false)
+	}
+	if err != nil {
+		writeRewriteError(c, err)
+		return
+	}
+	recordHistory("drop", previousHead())
+	emitEvent(eventHistoryRewritten, map[string]string{"commit": sha, "action": "drop"})
+	c.JSON(http.StatusOK, gin.H{"head": currentHead(), "pushedTo": pushedTo})
+}
+
+// squashCommit melds a commit into its parent, keeping both messages
+func squashCommit(c *gin.Context) {
+	sha, err := resolveRev(c.Param("commit"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	}
+	parent, err := resolveRev(sha + "^")
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "A root commit has no parent to squash into", nil)
+		return
+	}
+	// The parent is rewritten too, so it must be safe to change; the
+	// commit must be on the branch as well, or the rebase would only pick
+	if _, err := runGitContext(c.Request.Context(), "merge-base", "--is-ancestor", sha, "HEAD"); err != nil {
+		writeRewriteError(c, fmt.Errorf("%w: %s is not on the current branch", errUnsafeRewrite, sha))
+		return
+	}
+	pushedTo, err := checkRewritable(parent, forceRewrite(c))
+	if err != nil {
+		writeRewriteError(c, err)
+		return
+	}
+	base, _ := resolveRev(parent + "^")
+	todo, err := rebaseTodo(base, func(s string) string {
+		if s == sha {
+			return "squash"
+		}
+		return "pick"
+	})
+	if err == nil {
+		err = scriptedRebase(base, todo, false)
+	}
+	if err != nil {
+		writeRewriteError(c, err)
+		return
+	}
+	recordHistory("squash", previousHead())
+	emitEvent(eventHistoryRewritten, map[string]string{"commit": sha, "action": "squash"})
+	c.JSON(http.StatusOK, gin.H{"head": currentHead(), "pushedTo": pushedTo})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSquashAndDropCommits(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	r := gin.New()
+	r.POST("/api/commits/:commit/squash", squashCommit)
+	r.POST("/api/commits/:commit/drop", dropCommit)
+
+	post := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w
+	}
+
+	// The test repo leaves test2.ts modified
+	if w := post("/api/commits/HEAD~1/drop"); w.Code != http.StatusConflict {
+		t.Errorf("drop with dirty worktree = %d, want 409", w.Code)
+	}
+	runGit("checkout", "--", ".")
+
+	// Pushed commits are refused
+	runGit("update-ref", "refs/remotes/origin/main", "HEAD~1")
+	if w := post("/api/commits/HEAD/drop"); w.Code != http.StatusOK {
+		t.Errorf("drop of unpushed commit = %d: %s", w.Code, w.Body.String())
+	}
+	w := post("/api/commits/HEAD~1/drop")
+	if w.Code != http.StatusConflict {
+		t.Errorf("drop of pushed commit = %d, want 409", w.Code)
+	}
+	var apiErr APIError
+	json.Unmarshal(w.Body.Bytes(), &apiErr)
+	if apiErr.Code != codePushed || len(apiErr.PushedTo) != 1 || apiErr.PushedTo[0] != "origin/main" {
+		t.Errorf("refusal = %+v, want origin/main reported", apiErr)
+	}
+	// A symbolic origin/HEAD is not reported twice
+	runGit("symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/main")
+	if branches, _ := remoteBranchesContaining("HEAD"); len(branches) != 1 {
+		t.Errorf("remote branches = %v, want only origin/main", branches)
+	}
+	runGit("commit", "-q", "--allow-empty", "-m", "Local")
+	w = post("/api/commits/HEAD~1/squash?force=true")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"pushedTo":["origin/main"]`) {
+		t.Errorf("forced squash of pushed commit = %d: %s", w.Code, w.Body.String())
+	}
+	runGit("update-ref", "-d", "refs/remotes/origin/HEAD")
+	runGit("update-ref", "-d", "refs/remotes/origin/main")
+
+	if w := post("/api/commits/HEAD/squash"); w.Code != http.StatusOK {
+		t.Fatalf("squash = %d: %s", w.Code, w.Body.String())
+	}
+	output, _ := runGit("log", "--format=%s")
+	if strings.TrimSpace(string(output)) != "Initial commit" {
+		t.Errorf("log after squash = %q, want a single squashed commit", output)
+	}
+	message, _ := runGit("log", "-1", "--format=%B")
+	if !strings.Contains(string(message), "Update hello function") {
+		t.Errorf("squashed message lost the second commit's message: %q", message)
+	}
+
+	if w := post("/api/commits/HEAD/squash"); w.Code != http.StatusBadRequest {
+		t.Errorf("squash of root commit = %d, want 400", w.Code)
+	}
+
+	// A commit from another branch is refused even though its parent is
+	// on this one
+	runGit("checkout", "-q", "-b", "side")
+	runGit("commit", "-q", "--allow-empty", "-m", "Side")
+	side := currentHead()
+	runGit("checkout", "-q", "-")
+	head := currentHead()
+	if w := post("/api/commits/" + side + "/squash"); w.Code != http.StatusConflict || currentHead() != head {
+		t.Errorf("squash of a commit on another branch = %d, head moved %v", w.Code, currentHead() != head)
+	}
+	if w := post("/api/commits/--all/drop"); w.Code != http.StatusNotFound {
+		t.Errorf("drop of invalid commit = %d, want 404", w.Code)
+	}
+}
+
+func TestRewriteRefusedDuringRebase(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	runGit("checkout", "--", ".")
+
+	// Stop a rebase of the user's own at the last commit
+	head, _ := resolveRev("HEAD")
+	base, _ := resolveRev("HEAD^")
+	if err := scriptedRebase(base, "edit "+head+"\n", true); err != nil || !rebaseInProgress() {
+		t.Fatalf("rebase did not stop: %v", err)
+	}
+
+	r := gin.New()
+	r.POST("/api/commits/:commit/drop", dropCommit)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/commits/"+base+"/drop", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("drop during a rebase = %d, want 409", w.Code)
+	}
+	if err := runRebase("true", "", false); err == nil {
+		t.Error("runRebase() started during another rebase")
+	}
+	if !rebaseInProgress() {
+		t.Error("the user's rebase was aborted")
+	}
+}
+
+func TestSerializeHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	started, release := make(chan string, 2), make(chan struct{})
+	r.POST("/api/history/:name", serializeHistory(), func(c *gin.Context) {
+		started <- c.Param("name")
+		<-release
+	})
+
+	done := make(chan struct{})
+	for _, name := range []string{"first", "second"} {
+		go func() {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/history/"+name, nil))
+			done <- struct{}{}
+		}()
+	}
+	<-started
+	select {
+	case name := <-started:
+		t.Fatalf("%s started while another history change was running", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+	<-done
+	<-done
+}
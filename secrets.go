@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"log/slog"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Secret scanning modes, set with `git config differing.secrets <mode>`
+const (
+	secretsOff   = "off"
+	secretsWarn  = "warn" // the default: report findings but go ahead
+	secretsBlock = "block"
+)
+
+// secretAllowMarkers skip a line, usually from a comment on it. gitleaks's
+// marker is honoured too so repositories need only one.
+var secretAllowMarkers = []string{"differing:allow-secret", "gitleaks:allow"}
+
+// SecretFinding is a likely credential on a line being added
+type SecretFinding struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Rule string `json:"rule"`
+	// Match is the secret with all but its first few characters masked
+	Match string `json:"match"`
+}
+
+// SecretScan is the result of scanning the staged changes
+type SecretScan struct {
+	Mode     string          `json:"mode"`
+	Findings []SecretFinding `json:"findings"`
+}
+
+// secretRule matches one kind of credential. The secret is the last
+// capture group, or the whole match when there is none. Rules with a
+// minimum entropy only fire on values random enough to be real keys.
+type secretRule struct {
+	name       string
+	pattern    *regexp.Regexp
+	minEntropy float64
+}
+
+var secretRules = []secretRule{
+	{name: "aws-access-key-id", pattern: regexp.MustCompile(`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`)},
+	{name: "aws-secret-access-key", pattern: regexp.MustCompile(`(?i)aws.{0,20}?(?:secret|private).{0,20}?['"=:\s]\s*['"]?([A-Za-z0-9/+=]{40})\b`), minEntropy: 3.5},
+	{name: "github-token", pattern: regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`)},
+	{name: "gitlab-token", pattern: regexp.MustCompile(`\b(glpat-[A-Za-z0-9_-]{20,})\b`)},
+	{name: "slack-token", pattern: regexp.MustCompile(`\b(xox[abprs]-[A-Za-z0-9-]{10,})\b`)},
+	{name: "stripe-key", pattern: regexp.MustCompile(`\b([rs]k_live_[A-Za-z0-9]{24,})\b`)},
+	{name: "google-api-key", pattern: regexp.MustCompile(`\b(AIza[A-Za-z0-9_-]{35})\b`)},
+	{name: "private-key", pattern: regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )?PRIVATE KEY(?: BLOCK)?-----`)},
+	{name: "generic-secret", pattern: regexp.MustCompile(`(?i)(?:password|passwd|secret|token|api[_-]?key|access[_-]?key)[\w-]*['"]?\s*[:=]\s*['"]?([^\s'"]{16,})`), minEntropy: 3.5},
+}
+
+// secretsMode returns the repository's differing.secrets setting
+func secretsMode() string {
+	output, err := runGit("config", "--get", "differing.secrets")
+	if err != nil {
+		return secretsWarn
+	}
+	switch mode := strings.TrimSpace(string(output)); mode {
+	case secretsOff, secretsWarn, secretsBlock:
+		return mode
+	default:
+		slog.Warn("ignoring unknown differing.secrets mode", "mode", mode)
+		return secretsWarn
+	}
+}
+
+// shannonEntropy returns the bits of entropy per character of s
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var entropy float64
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// maskSecret keeps enough of a secret to recognize it
+func maskSecret(s string) string {
+	const keep = 4
+	if len(s) <= keep {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:keep] + strings.Repeat("*", min(len(s)-keep, 16))
+}
+
+// scanLine returns the secrets on one line
+func scanLine(path string, number int, line string) []SecretFinding {
+	for _, marker := range secretAllowMarkers {
+		if strings.Contains(line, marker) {
+			return nil
+		}
+	}
+	var findings []SecretFinding
+	for _, rule := range secretRules {
+		for _, m := range rule.pattern.FindAllStringSubmatch(line, -1) {
+			secret := m[len(m)-1]
+			if rule.minEntropy > 0 && shannonEntropy(secret) < rule.minEntropy {
+				continue
+			}
+			findings = append(findings, SecretFinding{Path: path, Line: number, Rule: rule.name, Match: maskSecret(secret)})
+		}
+	}
+	return findings
+}
+
+// scanNewContent scans the lines of newText that oldText does not
+// already have, so a save is only flagged for what it introduces
+func scanNewContent(path, oldText, newText string) []SecretFinding {
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(oldText, "\n") {
+		existing[strings.TrimSuffix(line, "\r")] = true
+	}
+	var findings []SecretFinding
+	for i, line := range strings.Split(newText, "\n") {
+		if line = strings.TrimSuffix(line, "\r"); !existing[line] {
+			findings = append(findings, scanLine(path, i+1, line)...)
+		}
+	}
+	return findings
+}
+
+// scanStaged scans the lines the staged changes add
+func scanStaged() ([]SecretFinding, error) {
+	output, err := runGit("-c", "core.quotePath=false", "diff", "--cached", "--no-color", "--no-ext-diff", "-U0", "--no-prefix")
+	if err != nil {
+		return nil, err
+	}
+	return scanPatch(output, "")
+}
+
+// scanPatch scans the lines a patch adds. prefix is stripped from the
+// paths in its +++ headers, such as "b/" for patches from format-patch; a
+// series in mbox format is scanned patch by patch.
+func scanPatch(patch []byte, prefix string) ([]SecretFinding, error) {
+	var findings []SecretFinding
+	var path string
+	line := 0
+	scanner := bufio.NewScanner(bytes.NewReader(patch))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if p, ok := strings.CutPrefix(text, "+++ "); ok {
+			path = strings.TrimPrefix(p, prefix)
+			if p == "/dev/null" {
+				path = ""
+			}
+			continue
+		}
+		// The next message of a series, whose lines are not the diff's
+		if strings.HasPrefix(text, "From ") {
+			path = ""
+			continue
+		}
+		if m := fullHunkHeader.FindStringSubmatch(text); m != nil {
+			line, _ = strconv.Atoi(m[3])
+			continue
+		}
+		if added, ok := strings.CutPrefix(text, "+"); ok && path != "" {
+			findings = append(findings, scanLine(path, line, added)...)
+			line++
+		} else if strings.HasPrefix(text, " ") {
+			// Context, in patches made with it
+			line++
+		}
+	}
+	return findings, scanner.Err()
+}
+
+// secretsAllowed applies differing.secrets to findings. In block mode it
+// refuses the request with a conflict unless it passes allowSecrets=true,
+// responding and returning false.
+func secretsAllowed(c *gin.Context, findings []SecretFinding) bool {
+	if len(findings) == 0 || secretsMode() != secretsBlock || c.Query("allowSecrets") == "true" {
+		return true
+	}
+	apiErr := newAPIError(http.StatusConflict, "The changes contain likely secrets; pass allowSecrets=true to keep them", nil)
+	apiErr.Code = codeSecrets
+	apiErr.Secrets = findings
+	c.AbortWithStatusJSON(http.StatusConflict, apiErr)
+	return false
+}
+
+// checkStagedSecrets scans the staged changes before a commit, returning
+// the findings to report. It responds and returns false when they block it.
+func checkStagedSecrets(c *gin.Context) ([]SecretFinding, bool) {
+	if secretsMode() == secretsOff {
+		return nil, true
+	}
+	findings, err := scanStaged()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to scan staged changes", err)
+		return nil, false
+	}
+	return findings, secretsAllowed(c, findings)
+}
+
+// getStagedSecrets scans the staged changes, so the UI can warn before a
+// commit is attempted
+func getStagedSecrets(c *gin.Context) {
+	scan := SecretScan{Mode: secretsMode(), Findings: []SecretFinding{}}
+	if scan.Mode != secretsOff {
+		findings, err := scanStaged()
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to scan staged changes", err)
+			return
+		}
+		if findings != nil {
+			scan.Findings = findings
+		}
+	}
+	c.JSON(http.StatusOK, scan)
+}
@@ -0,0 +1,32 @@
+package main
+
+// SignatureInfo is the result of verifying a commit's GPG or SSH signature
+type SignatureInfo struct {
+	Status string `json:"status"` // good, untrusted, bad, expired, expiredKey, revoked, unverifiable
+	Signer string `json:"signer,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+// signatureStatuses maps git's %G? codes to API status names
+var signatureStatuses = map[string]string{
+	"G": "good",
+	"U": "untrusted", // good signature, unknown key validity
+	"B": "bad",
+	"X": "expired",
+	"Y": "expiredKey",
+	"R": "revoked",
+	"E": "unverifiable", // e.g. the signing key is not available
+}
+
+// signatureFormat is appended to git log formats to request verification fields
+const signatureFormat = "%G?%x00%GS%x00%GK"
+
+// parseSignature builds SignatureInfo from the %G?, %GS, and %GK fields,
+// returning nil for unsigned commits
+func parseSignature(code, signer, key string) *SignatureInfo {
+	status, ok := signatureStatuses[code]
+	if !ok {
+		return nil
+	}
+	return &SignatureInfo{Status: status, Signer: signer, Key: key}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseSignature(t *testing.T) {
+	if sig := parseSignature("N", "", ""); sig != nil {
+		t.Errorf("unsigned commit signature = %+v, want nil", sig)
+	}
+	sig := parseSignature("G", "Test User <test@example.com>", "ABCDEF")
+	if sig == nil || sig.Status != "good" || sig.Signer != "Test User <test@example.com>" || sig.Key != "ABCDEF" {
+		t.Errorf("good signature = %+v", sig)
+	}
+	if sig := parseSignature("E", "", "ABCDEF"); sig == nil || sig.Status != "unverifiable" {
+		t.Errorf("unverifiable signature = %+v", sig)
+	}
+}
+
+func TestLoadCommitsUnsigned(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	oldCache := cache
+	cache = newCommitCache()
+	defer func() { cache = oldCache }()
+
+	commits, err := loadCommits(context.Background(), logFilter{})
+	if err != nil {
+		t.Fatalf("loadCommits(context.Background(), logFilter{}) failed: %v", err)
+	}
+	for _, c := range commits {
+		if c.Signature != nil {
+			t.Errorf("commit %s has signature %+v, want none", c.ID, c.Signature)
+		}
+		if c.Message == "" || c.Author == "" {
+			t.Errorf("commit %s lost metadata: %+v", c.ID, c)
+		}
+	}
+}
+
+func TestSignedFixup(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	key := filepath.Join(t.TempDir(), "id_ed25519")
+	if output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen failed: %v: %s", err, output)
+	}
+	runGit("config", "gpg.format", "ssh")
+	runGit("config", "user.signingKey", key)
+	runGit("add", "test2.ts")
+
+	r := gin.New()
+	r.POST("/api/commit/:id/fixup", createFixup)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/commit/HEAD/fixup", strings.NewReader(`{"sign":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("signed fixup = %d: %s", w.Code, w.Body.String())
+	}
+	commit, _ := runGit("cat-file", "commit", "HEAD")
+	if !strings.Contains(string(commit), "-----BEGIN SSH SIGNATURE-----") {
+		t.Errorf("fixup commit is not signed:\n%s", commit)
+	}
+}
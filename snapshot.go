@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// snapshotRefPrefix holds one ref per snapshot, out of the way of
+// branches and tags so they are never pushed or listed as history
+const snapshotRefPrefix = "refs/differing/snapshots/"
+
+// snapshotDiffPrefix marks a diff ID comparing a snapshot to the working
+// tree, as in snapshot:1760537412345
+const snapshotDiffPrefix = "snapshot:"
+
+// snapshotID matches the IDs snapshots are given: creation time in
+// milliseconds since the epoch
+var snapshotID = regexp.MustCompile(`^[0-9]+$`)
+
+// Snapshot is a saved copy of the tracked files in the working tree
+type Snapshot struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	// Commit holds the snapshot's files; Head is what HEAD was when it
+	// was taken, or "" on an unborn branch
+	Commit  string    `json:"commit"`
+	Head    string    `json:"head,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// SnapshotRequest is the body of POST /api/snapshots
+type SnapshotRequest struct {
+	Label string `json:"label"`
+}
+
+// workingTreeObject writes the tracked files of the working tree to a
+// tree object without touching the index. Untracked files are left out,
+// as they are from working tree diffs.
+func workingTreeObject() (string, error) {
+	return editedWorkingTree(nil)
+}
+
+// editedWorkingTree writes the working tree to a tree object as
+// workingTreeObject does, letting edit change the staged copy first. edit
+// runs git with env to update that copy rather than the real index.
+func editedWorkingTree(edit func(env []string) error) (string, error) {
+	output, err := runGit("rev-parse", "--path-format=absolute", "--git-path", "index")
+	if err != nil {
+		return "", err
+	}
+	index, err := os.ReadFile(strings.TrimSpace(string(output)))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	// Stage into a copy of the index so the real one keeps what the
+	// user staged
+	tmp, err := os.CreateTemp("", "differing-index-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(index)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	env := []string{"GIT_INDEX_FILE=" + tmp.Name()}
+	if _, err := runGitEnv(env, nil, "add", "--update", "--", ":/"); err != nil {
+		return "", err
+	}
+	if edit != nil {
+		if err := edit(env); err != nil {
+			return "", err
+		}
+	}
+	tree, err := runGitEnv(env, nil, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(tree)), nil
+}
+
+// snapshotCommit writes a commit of tree on top of HEAD, without moving
+// any branch
+func snapshotCommit(tree, message string) (string, error) {
+	args := []string{"commit-tree", tree, "-m", message}
+	if head, err := resolveRev("HEAD"); err == nil {
+		args = append(args, "-p", head)
+	}
+	commit, err := runGit(args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(commit)), nil
+}
+
+// listSnapshotRefs returns the snapshots under prefix, newest first
+func listSnapshotRefs(prefix string) ([]Snapshot, error) {
+	output, err := runGit("for-each-ref", "--sort=-refname",
+		"--format=%(refname)%00%(objectname)%00%(parent)%00%(creatordate:unix)%00%(contents:subject)", prefix)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []Snapshot{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		parts := strings.SplitN(line, "\x00", 5)
+		if len(parts) < 5 {
+			continue
+		}
+		created, _ := strconv.ParseInt(parts[3], 10, 64)
+		snapshots = append(snapshots, Snapshot{
+			ID:      strings.TrimPrefix(parts[0], prefix),
+			Commit:  parts[1],
+			Head:    parts[2],
+			Created: time.Unix(created, 0),
+			Label:   parts[4],
+		})
+	}
+	return snapshots, nil
+}
+
+// resolveSnapshot returns the commit of the snapshot with an ID under prefix
+func resolveSnapshot(prefix, id string) (string, error) {
+	if !snapshotID.MatchString(id) {
+		return "", fmt.Errorf("%w: no snapshot %q", errUnknownRevision, id)
+	}
+	sha, err := resolveRev(prefix + id)
+	if err != nil {
+		return "", fmt.Errorf("%w: no snapshot %s", errUnknownRevision, id)
+	}
+	return sha, nil
+}
+
+// takeSnapshot records tree under prefix with a label
+func takeSnapshot(prefix, tree, label string) (Snapshot, error) {
+	now := time.Now()
+	commit, err := snapshotCommit(tree, label)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	// An empty old value makes update-ref fail rather than replace a
+	// snapshot taken in the same millisecond
+	ms := now.UnixMilli()
+	id := strconv.FormatInt(ms, 10)
+	for tries := 0; ; tries++ {
+		_, err := runGit("update-ref", prefix+id, commit, "")
+		if err == nil {
+			break
+		}
+		// Only a taken ID is worth retrying
+		if _, lookupErr := resolveSnapshot(prefix, id); lookupErr != nil || tries == 10 {
+			return Snapshot{}, err
+		}
+		ms++
+		id = strconv.FormatInt(ms, 10)
+	}
+	head, _ := resolveRev("HEAD")
+	return Snapshot{ID: id, Label: label, Commit: commit, Head: head, Created: now}, nil
+}
+
+func getSnapshots(c *gin.Context) {
+	snapshots, err := listSnapshotRefs(snapshotRefPrefix)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list snapshots", err)
+		return
+	}
+	c.JSON(http.StatusOK, snapshots)
+}
+
+// postSnapshot saves the working tree so it can be diffed against later
+// with the diff ID snapshot:<id>, without committing or stashing
+func postSnapshot(c *gin.Context) {
+	var req SnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	label := strings.TrimSpace(req.Label)
+	if label == "" {
+		label = "Snapshot"
+	}
+	var snapshot Snapshot
+	tree, err := workingTreeObject()
+	if err == nil {
+		snapshot, err = takeSnapshot(snapshotRefPrefix, tree, label)
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to take snapshot", err)
+		return
+	}
+	c.JSON(http.StatusCreated, snapshot)
+}
+
+func deleteSnapshot(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := resolveSnapshot(snapshotRefPrefix, id); err != nil {
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "update-ref", "-d", snapshotRefPrefix+id); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to delete snapshot", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSnapshots(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/snapshots", getSnapshots)
+	r.POST("/api/snapshots", postSnapshot)
+	r.DELETE("/api/snapshots/:id", deleteSnapshot)
+	r.GET("/api/diffs/:id/files", getDiffFiles)
+
+	// The working tree has test2.ts modified
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/snapshots", strings.NewReader(`{"label":"before lunch"}`)))
+	var snapshot Snapshot
+	json.Unmarshal(w.Body.Bytes(), &snapshot)
+	if w.Code != http.StatusCreated || snapshot.Label != "before lunch" || snapshot.Head != currentHead() {
+		t.Fatalf("snapshot = %d: %s", w.Code, w.Body)
+	}
+	if staged, _ := runGit("diff", "--cached", "--name-only"); len(staged) != 0 {
+		t.Errorf("snapshot staged %q", staged)
+	}
+
+	os.WriteFile("test1.go", []byte("package main\n\nfunc hello() {}\n"), 0644)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/snapshot:"+snapshot.ID+"/files", nil))
+	var files []FileInfo
+	json.Unmarshal(w.Body.Bytes(), &files)
+	if w.Code != http.StatusOK || len(files) != 1 || files[0].Path != "test1.go" {
+		t.Errorf("changes since snapshot = %d %+v", w.Code, files)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/snapshots", nil))
+	var snapshots []Snapshot
+	json.Unmarshal(w.Body.Bytes(), &snapshots)
+	if len(snapshots) != 1 || snapshots[0].ID != snapshot.ID || snapshots[0].Commit != snapshot.Commit || snapshots[0].Label != "before lunch" {
+		t.Errorf("snapshots = %+v", snapshots)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/snapshots/"+snapshot.ID, nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("delete = %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/snapshot:"+snapshot.ID+"/files", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("deleted snapshot diff = %d, want 404", w.Code)
+	}
+}
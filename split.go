@@ -0,0 +1,218 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// splitRef records the commit being split while the rebase is stopped,
+// so its files and message outlive the reset that unpacks it
+const splitRef = "refs/differing/split"
+
+// SplitState describes a split in progress
+type SplitState struct {
+	Commit  string `json:"commit"`
+	Message string `json:"message"`
+	// Remaining lists the commit's files with changes not yet committed
+	Remaining []string `json:"remaining"`
+	// Secrets lists likely credentials the part just committed added
+	Secrets []SecretFinding `json:"secrets,omitempty"`
+}
+
+// splitState returns the split in progress, or nil if there is none
+func splitState() (*SplitState, error) {
+	sha, err := resolveRev(splitRef)
+	if err != nil {
+		return nil, nil
+	}
+	message, err := runGit("log", "-1", "--format=%B", sha)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := runGit("diff-tree", "--no-commit-id", "--name-only", "-r", "-z", "--root", sha)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"status", "--porcelain", "-z", "--untracked-files=all", "--"}
+	for _, p := range strings.Split(strings.TrimRight(string(paths), "\x00"), "\x00") {
+		if p != "" {
+			args = append(args, ":(literal)"+p)
+		}
+	}
+	status, err := runGit(args...)
+	if err != nil {
+		return nil, err
+	}
+	state := &SplitState{Commit: sha, Message: strings.TrimSpace(string(message)), Remaining: []string{}}
+	for _, entry := range strings.Split(string(status), "\x00") {
+		if len(entry) > 3 {
+			state.Remaining = append(state.Remaining, entry[3:])
+		}
+	}
+	return state, nil
+}
+
+// clearSplit forgets the split in progress
+func clearSplit() {
+	runGit("update-ref", "-d", splitRef)
+}
+
+// startSplit stops a rebase at :commit and resets it away, leaving its
+// changes unstaged in the working tree to be committed in pieces
+func startSplit(c *gin.Context) {
+	if state, _ := splitState(); state != nil || rebaseInProgress() {
+		respondError(c, http.StatusConflict, "A rebase is already in progress", nil)
+		return
+	}
+	sha, _, ok := rewriteTarget(c)
+	if !ok {
+		return
+	}
+	base, err := resolveRev(sha + "^")
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Splitting a root commit is not supported", nil)
+		return
+	}
+	todo, err := rebaseTodo(base, func(s string) string {
+		if s == sha {
+			return "edit"
+		}
+		return "pick"
+	})
+	if err == nil {
+		err = scriptedRebase(base, todo, true)
+	}
+	if err != nil {
+		writeRewriteError(c, err)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "update-ref", splitRef, sha); err != nil {
+		runGitContext(c.Request.Context(), "rebase", "--abort")
+		respondError(c, http.StatusInternalServerError, "Failed to record split", err)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "reset", "--quiet", "HEAD^"); err != nil {
+		runGitContext(c.Request.Context(), "rebase", "--abort")
+		clearSplit()
+		respondError(c, http.StatusInternalServerError, "Failed to unpack commit", err)
+		return
+	}
+	state, err := splitState()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read split state", err)
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+func getSplit(c *gin.Context) {
+	state, err := splitState()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read split state", err)
+		return
+	}
+	if state == nil {
+		respondError(c, http.StatusNotFound, "No split in progress", nil)
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// commitSplitPart commits one piece of the split. Paths listed in the
+// request are staged first; anything already staged is included too.
+func commitSplitPart(c *gin.Context) {
+	var req struct {
+		Message  string    `json:"message"`
+		Trailers []Trailer `json:"trailers"`
+		Paths    []string  `json:"paths"`
+		CommitOptions
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Message) == "" {
+		respondError(c, http.StatusBadRequest, "A commit message is required", nil)
+		return
+	}
+	message, err := appendTrailers(req.Message, req.Trailers)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if !checkMessageLint(c, message) {
+		return
+	}
+	state, err := splitState()
+	if err != nil || state == nil {
+		respondError(c, http.StatusConflict, "No split in progress", nil)
+		return
+	}
+	if len(req.Paths) > 0 {
+		args := []string{"add", "--"}
+		for _, p := range req.Paths {
+			args = append(args, ":(literal)"+p)
+		}
+		if _, err := runGitContext(c.Request.Context(), args...); err != nil {
+			respondError(c, http.StatusBadRequest, "Failed to stage paths", err)
+			return
+		}
+	}
+	if !hasStagedChanges() {
+		respondError(c, http.StatusBadRequest, "No staged changes to commit", nil)
+		return
+	}
+	secrets, ok := checkStagedSecrets(c)
+	if !ok {
+		return
+	}
+	if _, err := runGitEnvContext(c.Request.Context(), nil, []byte(message), req.gitArgs("commit", "--quiet", "--file=-")...); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to commit", err)
+		return
+	}
+	emitEvent(eventCommitCreated, map[string]string{"commit": currentHead(), "action": "split"})
+	state, _ = splitState()
+	if state != nil {
+		state.Secrets = secrets
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// continueSplit resumes the rebase once every change from the split
+// commit has been committed, so nothing is silently left behind
+func continueSplit(c *gin.Context) {
+	state, err := splitState()
+	if err != nil || state == nil {
+		respondError(c, http.StatusConflict, "No split in progress", nil)
+		return
+	}
+	if len(state.Remaining) > 0 {
+		apiErr := newAPIError(http.StatusConflict, "Some changes have not been committed", nil)
+		apiErr.Remaining = state.Remaining
+		c.JSON(http.StatusConflict, apiErr)
+		return
+	}
+	if _, err := runGitEnvContext(c.Request.Context(), []string{"GIT_EDITOR=true"}, nil, "rebase", "--continue"); err != nil {
+		runGitContext(c.Request.Context(), "rebase", "--abort")
+		clearSplit()
+		respondError(c, http.StatusConflict, "Rebase failed and was aborted", err)
+		return
+	}
+	clearSplit()
+	recordHistory("split", previousHead())
+	emitEvent(eventHistoryRewritten, map[string]string{"commit": state.Commit, "action": "split"})
+	c.JSON(http.StatusOK, gin.H{"head": currentHead()})
+}
+
+// abortSplit abandons the split, restoring the branch as it was
+func abortSplit(c *gin.Context) {
+	state, _ := splitState()
+	if state == nil {
+		respondError(c, http.StatusConflict, "No split in progress", nil)
+		return
+	}
+	if _, err := runGitContext(c.Request.Context(), "rebase", "--abort"); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to abort rebase", err)
+		return
+	}
+	clearSplit()
+	c.JSON(http.StatusOK, gin.H{"head": currentHead()})
+}
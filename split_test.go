@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSplitCommit(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	runGit("checkout", "--", ".")
+
+	// A commit touching two files, with another commit on top
+	os.WriteFile(filepath.Join(repoDir, "a.txt"), []byte("a\n"), 0644)
+	os.WriteFile(filepath.Join(repoDir, "test1.go"), []byte("package main\n"), 0644)
+	runGit("add", ".")
+	runGit("commit", "-q", "-m", "Big change")
+	os.WriteFile(filepath.Join(repoDir, "b.txt"), []byte("b\n"), 0644)
+	runGit("add", ".")
+	runGit("commit", "-q", "-m", "Later change")
+
+	r := gin.New()
+	r.POST("/api/commits/:commit/split", startSplit)
+	r.GET("/api/split", getSplit)
+	r.POST("/api/split/commit", commitSplitPart)
+	r.POST("/api/split/continue", continueSplit)
+	r.POST("/api/split/abort", abortSplit)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) SplitState {
+		var state SplitState
+		if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+			t.Fatalf("Failed to decode %s: %v", w.Body.String(), err)
+		}
+		return state
+	}
+
+	w := post("/api/commits/HEAD~1/split", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("start split = %d: %s", w.Code, w.Body.String())
+	}
+	state := decode(w)
+	if state.Message != "Big change" || len(state.Remaining) != 2 {
+		t.Errorf("split state = %+v", state)
+	}
+
+	if w := post("/api/commits/HEAD/split", ""); w.Code != http.StatusConflict {
+		t.Errorf("second split = %d, want 409", w.Code)
+	}
+
+	w = post("/api/split/commit", `{"message":"Add a.txt","paths":["a.txt"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("commit part = %d: %s", w.Code, w.Body.String())
+	}
+	if state := decode(w); len(state.Remaining) != 1 || state.Remaining[0] != "test1.go" {
+		t.Errorf("remaining after first part = %v", state.Remaining)
+	}
+
+	// Continuing would drop the test1.go change
+	if w := post("/api/split/continue", ""); w.Code != http.StatusConflict {
+		t.Errorf("continue with changes left = %d, want 409", w.Code)
+	}
+
+	if w := post("/api/split/commit", `{"message":"Trim test1.go","paths":["test1.go"]}`); w.Code != http.StatusOK {
+		t.Fatalf("commit second part = %d: %s", w.Code, w.Body.String())
+	}
+	if w := post("/api/split/continue", ""); w.Code != http.StatusOK {
+		t.Fatalf("continue = %d: %s", w.Code, w.Body.String())
+	}
+
+	output, _ := runGit("log", "--format=%s", "-4")
+	if got := strings.TrimSpace(string(output)); got != "Later change\nTrim test1.go\nAdd a.txt\nAdd TypeScript file" {
+		t.Errorf("log after split = %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/split", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("split state after finishing = %d, want 404", w.Code)
+	}
+
+	// Aborting restores the original history
+	head := currentHead()
+	if w := post("/api/commits/HEAD~1/split", ""); w.Code != http.StatusOK {
+		t.Fatalf("start split = %d: %s", w.Code, w.Body.String())
+	}
+	if w := post("/api/split/abort", ""); w.Code != http.StatusOK {
+		t.Fatalf("abort = %d: %s", w.Code, w.Body.String())
+	}
+	if currentHead() != head || rebaseInProgress() {
+		t.Error("abort did not restore the branch")
+	}
+}
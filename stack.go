@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxStackSize caps how many commits a stack lists, for branches with no
+// upstream where every commit counts as unpushed
+const maxStackSize = 100
+
+// Review states of a commit in a stack
+const (
+	stackUnreviewed = "unreviewed"
+	stackInProgress = "in-progress"
+	stackReviewed   = "reviewed" // every file marked viewed
+	stackApproved   = "approved" // approved in the review notes
+)
+
+// StackCommit is one commit of the stack with its review state
+type StackCommit struct {
+	DiffInfo
+	Status     string   `json:"status"`
+	Viewed     int      `json:"viewed"`
+	ApprovedBy []string `json:"approvedBy,omitempty"`
+	// Previous is the same commit before the stack was last rebased or
+	// amended, matched by patch ID or else by subject. Diffing
+	// Previous..ID shows what the rewrite changed.
+	Previous string `json:"previous,omitempty"`
+	// Rewritten is set when the commit's own changes differ from
+	// Previous's, not just the commits under it
+	Rewritten bool `json:"rewritten,omitempty"`
+}
+
+// Stack is the unpushed commits of the current branch, oldest first
+type Stack struct {
+	Branch string `json:"branch,omitempty"`
+	// Base is the commit the stack sits on; "" when it starts at the root
+	Base    string        `json:"base"`
+	Commits []StackCommit `json:"commits"`
+	// PreviousHead is the branch tip before its last rebase or amend, and
+	// Dropped the commits from then that match none in the stack now
+	PreviousHead string   `json:"previousHead,omitempty"`
+	Dropped      []string `json:"dropped,omitempty"`
+	Truncated    bool     `json:"truncated,omitempty"`
+}
+
+// StackOrderRequest is the body of POST /api/stack/reorder: every commit
+// of the stack, in the order to replay them from the base up
+type StackOrderRequest struct {
+	Order []string `json:"order"`
+}
+
+// stackExcludes returns the rev-list arguments that cut HEAD's history
+// down to the stack: everything since base= when given, since the
+// branch's upstream when it has one, or else not on any remote branch
+func stackExcludes(base string) ([]string, error) {
+	if base != "" {
+		sha, err := resolveRev(base)
+		if err != nil {
+			return nil, err
+		}
+		return []string{"^" + sha}, nil
+	}
+	if upstream, err := resolveRev("@{upstream}"); err == nil {
+		return []string{"^" + upstream}, nil
+	}
+	return []string{"--not", "--remotes"}, nil
+}
+
+// stackCommits lists the commits from tip back to excludes, oldest first
+func stackCommits(tip string, excludes []string) (commits []DiffInfo, truncated bool, err error) {
+	args := append([]string{"log", "--no-merges", "--reverse", "--format=%H%x00%s%x00%an%x00%at", tip}, excludes...)
+	output, err := runGit(args...)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		parts := strings.Split(line, "\x00")
+		if len(parts) < 4 {
+			continue
+		}
+		timestamp, _ := strconv.ParseInt(parts[3], 10, 64)
+		commits = append(commits, DiffInfo{
+			ID:           parts[0],
+			Message:      parts[1],
+			Author:       parts[2],
+			Timestamp:    time.Unix(timestamp, 0),
+			Conventional: parseConventional(parts[1]),
+		})
+	}
+	// git log cannot limit and reverse at once, so keep the newest
+	if len(commits) > maxStackSize {
+		commits = commits[len(commits)-maxStackSize:]
+		truncated = true
+	}
+	return commits, truncated, nil
+}
+
+// patchIDs returns the stable patch ID of each of commits, which is the
+// same for two commits making the same change on different bases
+func patchIDs(commits []string) (map[string]string, error) {
+	ids := make(map[string]string, len(commits))
+	if len(commits) == 0 {
+		return ids, nil
+	}
+	patches, err := runGit(append([]string{"show", "--no-color", "--no-ext-diff", "--format=commit %H"}, commits...)...)
+	if err != nil {
+		return nil, err
+	}
+	output, err := runGitInput(patches, "patch-id", "--stable")
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		// Format: "<patch-id> <commit>"
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 {
+			ids[fields[1]] = fields[0]
+		}
+	}
+	return ids, scanner.Err()
+}
+
+// previousStackHead returns the branch tip before its most recent rebase
+// or amend, from the branch's reflog, or "" if none is recorded
+func previousStackHead(branch string) string {
+	if branch == "" {
+		return ""
+	}
+	output, err := runGit("log", "--walk-reflogs", "--format=%H%x00%gs", "-n", "100", "refs/heads/"+branch)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	for i, line := range lines {
+		_, subject, _ := strings.Cut(line, "\x00")
+		if (strings.HasPrefix(subject, "rebase") || strings.HasPrefix(subject, "commit (amend)")) && i+1 < len(lines) {
+			sha, _, _ := strings.Cut(lines[i+1], "\x00")
+			return sha
+		}
+	}
+	return ""
+}
+
+// matchPrevious links each commit to its earlier version among previous,
+// first by identical patch and then by subject, returning the previous
+// commits left unmatched
+func matchPrevious(commits []StackCommit, previous []DiffInfo) ([]string, error) {
+	shas := make([]string, 0, len(commits)+len(previous))
+	for _, c := range commits {
+		shas = append(shas, c.ID)
+	}
+	for _, p := range previous {
+		shas = append(shas, p.ID)
+	}
+	ids, err := patchIDs(shas)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	for i := range commits {
+		for _, p := range previous {
+			if !used[p.ID] && ids[p.ID] != "" && ids[p.ID] == ids[commits[i].ID] {
+				commits[i].Previous = p.ID
+				used[p.ID] = true
+				break
+			}
+		}
+	}
+	for i := range commits {
+		if commits[i].Previous != "" {
+			continue
+		}
+		for _, p := range previous {
+			if !used[p.ID] && p.Message == commits[i].Message {
+				commits[i].Previous, commits[i].Rewritten = p.ID, true
+				used[p.ID] = true
+				break
+			}
+		}
+	}
+
+	var dropped []string
+	for _, p := range previous {
+		if !used[p.ID] {
+			dropped = append(dropped, p.ID)
+		}
+	}
+	return dropped, nil
+}
+
+// commitReview reads a commit's approvals from the review notes and how
+// many of its files are marked viewed in progress
+func commitReview(sha string, progress map[string]*ReviewProgress) (status string, viewed int, approvedBy []string) {
+	if note, err := readNote(defaultNotesRef, sha); err == nil {
+		for _, line := range strings.Split(note, "\n") {
+			if by, ok := strings.CutPrefix(line, "Approved-by:"); ok {
+				approvedBy = append(approvedBy, strings.TrimSpace(by))
+			}
+		}
+	}
+
+	spec, err := resolveDiff(sha, modeCommit)
+	var files []string
+	if err == nil {
+		if output, err := runGit(append([]string{"diff", "--name-only", "-z"}, spec.revArgs()...)...); err == nil {
+			files = strings.FieldsFunc(string(output), func(r rune) bool { return r == 0 })
+		}
+	}
+	if p := progress[progressKey(spec)]; p != nil {
+		for _, f := range files {
+			if _, ok := p.Viewed[f]; ok {
+				viewed++
+			}
+		}
+	}
+
+	switch {
+	case len(approvedBy) > 0:
+		status = stackApproved
+	case viewed > 0 && viewed == len(files):
+		status = stackReviewed
+	case viewed > 0:
+		status = stackInProgress
+	default:
+		status = stackUnreviewed
+	}
+	return status, viewed, approvedBy
+}
+
+// loadStack builds the stack of commits after base ("" picks the default)
+func loadStack(ctx context.Context, base string) (*Stack, error) {
+	excludes, err := stackExcludes(base)
+	if err != nil {
+		return nil, err
+	}
+	infos, truncated, err := stackCommits("HEAD", excludes)
+	if err != nil {
+		return nil, err
+	}
+	stack := &Stack{Branch: currentBranch(), Commits: []StackCommit{}, Truncated: truncated}
+	if len(infos) > 0 {
+		stack.Base, _ = resolveRev(infos[0].ID + "^")
+	}
+
+	var progress map[string]*ReviewProgress
+	if path, err := progressPath(); err == nil {
+		progressMu.Lock()
+		progress, _ = readProgress(path)
+		progressMu.Unlock()
+	}
+	for _, info := range infos {
+		fillCommitStat(ctx, &info)
+		commit := StackCommit{DiffInfo: info}
+		commit.Status, commit.Viewed, commit.ApprovedBy = commitReview(info.ID, progress)
+		stack.Commits = append(stack.Commits, commit)
+	}
+
+	// Commits the old tip shares with HEAD were not rewritten
+	if previousHead := previousStackHead(stack.Branch); previousHead != "" {
+		previous, _, err := stackCommits(previousHead, append([]string{"^HEAD"}, excludes...))
+		if err != nil {
+			return nil, err
+		}
+		if len(previous) > 0 {
+			stack.PreviousHead = previousHead
+			if stack.Dropped, err = matchPrevious(stack.Commits, previous); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Reviews of an unchanged patch carry over a rebase
+	for i, commit := range stack.Commits {
+		if commit.Previous != "" && !commit.Rewritten && commit.Status == stackUnreviewed {
+			stack.Commits[i].Status, stack.Commits[i].Viewed, stack.Commits[i].ApprovedBy = commitReview(commit.Previous, progress)
+		}
+	}
+	return stack, nil
+}
+
+// stackFromRequest loads the stack above the base= query parameter,
+// writing an error response and returning false on failure
+func stackFromRequest(c *gin.Context) (*Stack, bool) {
+	stack, err := loadStack(c.Request.Context(), c.Query("base"))
+	switch {
+	case errors.Is(err, errUnknownRevision):
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return nil, false
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, "Failed to load stack", err)
+		return nil, false
+	}
+	return stack, true
+}
+
+// getStack lists the unpushed commits of the current branch as a stack
+// of changes, each with its review state and its version before the
+// last rebase
+func getStack(c *gin.Context) {
+	stack, ok := stackFromRequest(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, stack)
+}
+
+// reorderStack replays the stack's commits in a new order
+func reorderStack(c *gin.Context) {
+	var req StackOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	if rebaseInProgress() {
+		respondError(c, http.StatusConflict, "A rebase is already in progress", nil)
+		return
+	}
+	stack, ok := stackFromRequest(c)
+	if !ok {
+		return
+	}
+	if stack.Truncated {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Stacks over %d commits cannot be reordered", maxStackSize), nil)
+		return
+	}
+
+	inStack := make(map[string]bool, len(stack.Commits))
+	for _, commit := range stack.Commits {
+		inStack[commit.ID] = true
+	}
+	var todo strings.Builder
+	for _, rev := range req.Order {
+		sha, err := resolveRev(rev)
+		if err != nil || !inStack[sha] {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("%s is not in the stack", rev), nil)
+			return
+		}
+		delete(inStack, sha)
+		fmt.Fprintf(&todo, "pick %s\n", sha)
+	}
+	if len(inStack) > 0 {
+		respondError(c, http.StatusBadRequest, "The order must list every commit of the stack once", nil)
+		return
+	}
+	if len(stack.Commits) == 0 {
+		c.JSON(http.StatusOK, stack)
+		return
+	}
+
+	pushedTo, err := checkRewritable(stack.Commits[0].ID, forceRewrite(c))
+	if err == nil {
+		err = scriptedRebase(stack.Base, todo.String(), false)
+	}
+	if err != nil {
+		writeRewriteError(c, err)
+		return
+	}
+	recordHistory("reorder", previousHead())
+	emitEvent(eventHistoryRewritten, map[string]string{"action": "reorder"})
+	c.JSON(http.StatusOK, gin.H{"head": currentHead(), "pushedTo": pushedTo})
+}
+
+// editCommit starts a rebase that stops at a commit so it can be amended;
+// POST /api/rebase/continue replays the commits after it
+func editCommit(c *gin.Context) {
+	if rebaseInProgress() {
+		respondError(c, http.StatusConflict, "A rebase is already in progress", nil)
+		return
+	}
+	sha, pushedTo, ok := rewriteTarget(c)
+	if !ok {
+		return
+	}
+	base, _ := resolveRev(sha + "^")
+	todo, err := rebaseTodo(base, func(s string) string {
+		if s == sha {
+			return "edit"
+		}
+		return "pick"
+	})
+	if err == nil {
+		err = scriptedRebase(base, todo, true)
+	}
+	if err != nil {
+		writeRewriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"head": currentHead(), "pushedTo": pushedTo, "rebasing": rebaseInProgress()})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStack(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	runGit("checkout", "--", "test2.ts")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/stack", getStack)
+	r.POST("/api/stack/reorder", reorderStack)
+	getStackAt := func(base string) Stack {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/stack?base="+base, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("stack = %d: %s", w.Code, w.Body)
+		}
+		var stack Stack
+		json.Unmarshal(w.Body.Bytes(), &stack)
+		return stack
+	}
+
+	root, _ := resolveRev("HEAD~2")
+	update, _ := resolveRev("HEAD~1")
+	add, _ := resolveRev("HEAD")
+	runGit("notes", "--ref="+defaultNotesRef, "add", "-m", "Approved-by: Reviewer <r@example.com>", add)
+
+	stack := getStackAt(root)
+	if stack.Base != root || len(stack.Commits) != 2 || stack.Commits[0].ID != update || stack.Commits[1].ID != add {
+		t.Fatalf("stack = %+v", stack)
+	}
+	if stack.Commits[0].Status != stackUnreviewed || stack.Commits[1].Status != stackApproved || stack.Commits[1].FilesCount != 1 {
+		t.Errorf("statuses = %+v", stack.Commits)
+	}
+
+	body, _ := json.Marshal(StackOrderRequest{Order: []string{add}})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/stack/reorder?base="+root, strings.NewReader(string(body))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("partial order = %d, want 400", w.Code)
+	}
+	body, _ = json.Marshal(StackOrderRequest{Order: []string{add, update}})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/stack/reorder?base="+root, strings.NewReader(string(body))))
+	if w.Code != http.StatusOK {
+		t.Fatalf("reorder = %d: %s", w.Code, w.Body)
+	}
+
+	// Both commits were replayed unchanged, so each matches its old version
+	// by patch ID and the approval carries over
+	stack = getStackAt(root)
+	if len(stack.Commits) != 2 || stack.Commits[0].Message != "Add TypeScript file" || stack.PreviousHead != add {
+		t.Fatalf("reordered stack = %+v", stack)
+	}
+	if c := stack.Commits[0]; c.Previous != add || c.Rewritten || c.Status != stackApproved {
+		t.Errorf("moved commit = %+v", c)
+	}
+	if c := stack.Commits[1]; c.Previous != update || c.Rewritten {
+		t.Errorf("replayed commit = %+v", c)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/stack?base=nope", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown base = %d, want 404", w.Code)
+	}
+}
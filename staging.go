@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IndexFile is a file's staged content, as git show :0:path prints it
+type IndexFile struct {
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+	// Mode and SHA are the index entry's, such as 100644 or 100755
+	Mode     string `json:"mode,omitempty"`
+	SHA      string `json:"sha,omitempty"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding,omitempty"`
+	// TooLarge and Binary are set instead of returning content
+	TooLarge bool `json:"tooLarge,omitempty"`
+	Binary   bool `json:"binary,omitempty"`
+	// Secrets lists likely credentials a write to the index added
+	Secrets []SecretFinding `json:"secrets,omitempty"`
+}
+
+// IndexWriteRequest is the body of PUT /api/index. Mode defaults to the
+// existing entry's, or 100644 for a file not yet in the index.
+type IndexWriteRequest struct {
+	Content  string `json:"content"`
+	Encoding string `json:"encoding,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+}
+
+// indexEntry returns the mode and object name of path's stage 0 entry in
+// the index. found is false when the path is not staged or is conflicted.
+func indexEntry(path string) (mode, sha string, found bool, err error) {
+	output, err := runGit("ls-files", "-s", "-z", "--", ":(literal)"+path)
+	if err != nil {
+		return "", "", false, err
+	}
+	for _, line := range strings.Split(string(output), "\x00") {
+		// Format: "<mode> <sha> <stage>\t<path>"
+		meta, entryPath, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if ok && entryPath == path && len(fields) == 3 && fields[2] == "0" {
+			return fields[0], fields[1], true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+// readIndexFile returns path's staged content
+func readIndexFile(path string, force bool) (IndexFile, error) {
+	file := IndexFile{Path: path}
+	mode, sha, found, err := indexEntry(path)
+	if err != nil || !found {
+		return file, err
+	}
+	file.Exists, file.Mode, file.SHA = true, mode, sha
+	if mode == gitlinkMode {
+		return file, nil
+	}
+	_, size, _, err := blobInfo("", path)
+	if err != nil {
+		return file, err
+	}
+	if exceedsLimit(size, force) {
+		file.TooLarge = true
+		return file, nil
+	}
+	data, err := readBlob(sha)
+	if err != nil {
+		return file, err
+	}
+	if isBinary(data) {
+		file.Binary = true
+		return file, nil
+	}
+	file.Content, file.Encoding = decodeContent(data)
+	return file, nil
+}
+
+// getIndexFile returns a file's staged content, to edit before staging it
+func getIndexFile(c *gin.Context) {
+	filePath := filePathParam(c)
+	if filePath == "" || escapesRepo(filePath) {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("invalid file path: %s", filePath), nil)
+		return
+	}
+	file, err := readIndexFile(filePath, c.Query("force") == "true")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read the index", err)
+		return
+	}
+	if !file.Exists {
+		respondError(c, http.StatusNotFound, "File is not staged: "+filePath, nil)
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// putIndexFile stages content for a file without touching the working
+// tree, so an edited hunk can be staged as git add -p's edit does
+func putIndexFile(c *gin.Context) {
+	filePath := filePathParam(c)
+	if filePath == "" || escapesRepo(filePath) {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("invalid file path: %s", filePath), nil)
+		return
+	}
+	var req IndexWriteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	data, err := encodeContent(req.Content, req.Encoding)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	mode := req.Mode
+	if mode == "" {
+		existing, _, found, err := indexEntry(filePath)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to read the index", err)
+			return
+		}
+		mode = "100644"
+		if found {
+			mode = existing
+		}
+	}
+	if mode != "100644" && mode != "100755" {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("mode must be 100644 or 100755, not %s", mode), nil)
+		return
+	}
+
+	var secrets []SecretFinding
+	if secretsMode() != secretsOff && !isBinary(data) {
+		var staged []byte
+		if _, sha, found, err := indexEntry(filePath); err == nil && found {
+			staged, _ = readBlob(sha)
+		}
+		secrets = scanNewContent(filePath, string(staged), string(data))
+	}
+	if !secretsAllowed(c, secrets) {
+		return
+	}
+
+	// The content is already in git's form, as read from the index, so
+	// clean filters and line ending conversion must not run again
+	output, err := runGitEnvContext(c.Request.Context(), nil, data, "hash-object", "-w", "--no-filters", "--stdin")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to write object", err)
+		return
+	}
+	sha := strings.TrimSpace(string(output))
+	if _, err := runGitContext(c.Request.Context(), "update-index", "--add", "--cacheinfo", mode+","+sha+","+filePath); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to update the index", err)
+		return
+	}
+
+	file, err := readIndexFile(filePath, true)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read the index", err)
+		return
+	}
+	file.Secrets = secrets
+	c.JSON(http.StatusOK, file)
+}
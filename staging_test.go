@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIndexFile(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/index/*filepath", getIndexFile)
+	r.PUT("/api/index/*filepath", putIndexFile)
+	do := func(method, path string, body any) (int, IndexFile) {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/api/index/"+path, strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		var file IndexFile
+		json.Unmarshal(w.Body.Bytes(), &file)
+		return w.Code, file
+	}
+
+	// The working tree test2.ts is modified but not staged
+	code, file := do(http.MethodGet, "test2.ts", nil)
+	if code != http.StatusOK || file.Content != "export function world() {}\n" || file.Mode != "100644" {
+		t.Errorf("index test2.ts = %d %+v, want the committed content", code, file)
+	}
+
+	// Stage only part of the working tree change
+	partial := "export function world() {\n}\n"
+	code, file = do(http.MethodPut, "test2.ts", IndexWriteRequest{Content: partial})
+	if code != http.StatusOK || file.Content != partial {
+		t.Fatalf("stage = %d %+v", code, file)
+	}
+	if staged, _ := runGit("diff", "--cached", "--numstat"); strings.TrimSpace(string(staged)) != "2\t1\ttest2.ts" {
+		t.Errorf("staged numstat = %q", staged)
+	}
+	if data, _ := os.ReadFile("test2.ts"); !strings.Contains(string(data), "return 'world'") {
+		t.Errorf("working tree was changed: %q", data)
+	}
+
+	// New files can be staged with a mode
+	if code, file = do(http.MethodPut, "run.sh", IndexWriteRequest{Content: "echo hi\n", Mode: "100755"}); code != http.StatusOK || file.Mode != "100755" {
+		t.Errorf("stage new file = %d %+v", code, file)
+	}
+	if code, _ := do(http.MethodPut, "x", IndexWriteRequest{Mode: "120000"}); code != http.StatusBadRequest {
+		t.Errorf("symlink mode = %d, want 400", code)
+	}
+	if code, _ := do(http.MethodGet, "missing.txt", nil); code != http.StatusNotFound {
+		t.Errorf("unstaged file = %d, want 404", code)
+	}
+	if code, _ := do(http.MethodPut, "a/../../x", IndexWriteRequest{}); code != http.StatusBadRequest {
+		t.Errorf("path outside repo = %d, want 400", code)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// standaloneID is the diff ID of the single entry a standalone server shows
+const standaloneID = "compare"
+
+// staticFile is one file of a diff computed up front rather than by git
+type staticFile struct {
+	FileInfo
+	old, new             []byte
+	oldExists, newExists bool
+	binary               bool
+	// hunks is set for files read from a patch, whose old and new are
+	// only the lines the hunks show; their stats come from the patch too
+	hunks []Hunk
+}
+
+// staticDiff is a diff that exists only in memory, served without a
+// repository by the standalone commands
+type staticDiff struct {
+	// Label is shown where the repository path normally is
+	Label string
+	Info  DiffInfo
+	// Files is sorted by path
+	Files []staticFile
+}
+
+// newStaticDiff builds the diff entry for files, counting their line changes
+func newStaticDiff(label string, files []staticFile) *staticDiff {
+	d := &staticDiff{
+		Label: label,
+		Info:  DiffInfo{ID: standaloneID, Message: label, Timestamp: time.Now()},
+		Files: files,
+	}
+	sort.Slice(d.Files, func(i, j int) bool { return d.Files[i].Path < d.Files[j].Path })
+	for i := range d.Files {
+		f := &d.Files[i]
+		if f.hunks == nil && !f.binary && !isBinary(f.old) && !isBinary(f.new) {
+			f.Additions, f.Deletions = lineStats(string(f.old), string(f.new))
+		}
+		d.Info.Additions += f.Additions
+		d.Info.Deletions += f.Deletions
+	}
+	d.Info.FilesCount = len(d.Files)
+	return d
+}
+
+// lineStats counts the lines added and removed between two texts, as
+// git's numstat would
+func lineStats(oldText, newText string) (additions, deletions int) {
+	dmp := diffmatchpatch.New()
+	a, b, _ := dmp.DiffLinesToRunes(oldText, newText)
+	// Each rune of the diff stands for one line
+	for _, d := range dmp.DiffMainRunes(a, b, false) {
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			additions += utf8.RuneCountInString(d.Text)
+		case diffmatchpatch.DiffDelete:
+			deletions += utf8.RuneCountInString(d.Text)
+		}
+	}
+	return additions, deletions
+}
+
+// file returns the file at path, or nil
+func (d *staticDiff) file(path string) *staticFile {
+	i := sort.Search(len(d.Files), func(i int) bool { return d.Files[i].Path >= path })
+	if i < len(d.Files) && d.Files[i].Path == path {
+		return &d.Files[i]
+	}
+	return nil
+}
+
+// fileDiff returns the contents of one file for the diff view, withholding
+// oversized and binary files as getFileDiff does
+func (f *staticFile) fileDiff(force, intraline bool) FileDiff {
+	fd := FileDiff{Path: f.Path, OldExists: f.oldExists, NewExists: f.newExists}
+	switch {
+	case exceedsLimit(int64(len(f.old)), force) || exceedsLimit(int64(len(f.new)), force):
+		fd.TooLarge = true
+	case f.binary || isBinary(f.old) || isBinary(f.new):
+		fd.Binary = true
+	default:
+		fd.OldContent, fd.OldEncoding = decodeContent(f.old)
+		fd.NewContent, fd.NewEncoding = decodeContent(f.new)
+		if intraline {
+			fd.Intraline = intralineChanges(fd.OldContent, fd.NewContent)
+		}
+	}
+	if f.hunks != nil {
+		page := hunkPage(f.hunks, 0)
+		fd.Hunks = &page
+	}
+	return fd
+}
+
+// routes registers the subset of the API the frontend needs to show d.
+// Everything else answers 404, which the frontend treats as unavailable.
+func (d *staticDiff) routes(r *gin.Engine) {
+	api := r.Group("/api")
+	api.POST("/shutdown", postShutdown)
+	api.GET("/repo-info", func(c *gin.Context) {
+		c.JSON(http.StatusOK, RepoInfo{Path: d.Label, Name: d.Label, ReadOnly: true, Remotes: []Remote{}})
+	})
+	api.GET("/diffs", func(c *gin.Context) {
+		c.JSON(http.StatusOK, []DiffInfo{d.Info})
+	})
+	api.GET("/diffs/:id/files", func(c *gin.Context) {
+		if c.Param("id") != d.Info.ID {
+			respondError(c, http.StatusNotFound, "Unknown diff", nil)
+			return
+		}
+		files := make([]FileInfo, len(d.Files))
+		for i, f := range d.Files {
+			files[i] = f.FileInfo
+		}
+		c.JSON(http.StatusOK, files)
+	})
+	api.GET("/file-diff/:id/*filepath", func(c *gin.Context) {
+		f := d.file(filePathParam(c))
+		if c.Param("id") != d.Info.ID || f == nil {
+			respondError(c, http.StatusNotFound, "File not found in diff", nil)
+			return
+		}
+		c.JSON(http.StatusOK, f.fileDiff(c.Query("force") == "true", c.Query("intraline") == "true"))
+	})
+	api.GET("/file-hunks/:id/*filepath", func(c *gin.Context) {
+		f := d.file(filePathParam(c))
+		if c.Param("id") != d.Info.ID || f == nil {
+			respondError(c, http.StatusNotFound, "File not found in diff", nil)
+			return
+		}
+		offset, ok := hunkOffset(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, hunkPage(f.hunks, offset))
+	})
+}
+
+// serveStatic serves d with the embedded frontend until shut down
+func serveStatic(d *staticDiff, addr, port string, open bool, idle time.Duration) error {
+	// Nothing can be written back: there is no repository behind the diff
+	readOnly = true
+	r := newRouter()
+	d.routes(r)
+	if err := mountFrontend(r); err != nil {
+		return err
+	}
+	ln, url, err := listen(addr, port)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("differing comparing %s on %s\n", d.Label, url)
+	if open {
+		go openBrowser(url)
+	}
+	return server.serve(&http.Server{Handler: versionedAPI(r)}, ln, idle)
+}
+
+// comparePaths diffs two files, or two directory trees file by file. A
+// single file pair is listed under the new file's name.
+func comparePaths(a, b string) (*staticDiff, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return nil, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return nil, err
+	}
+	label := fmt.Sprintf("%s → %s", a, b)
+	switch {
+	case infoA.IsDir() && infoB.IsDir():
+		files, err := compareDirs(a, b)
+		if err != nil {
+			return nil, err
+		}
+		return newStaticDiff(label, files), nil
+	case infoA.IsDir() || infoB.IsDir():
+		return nil, errors.New("cannot compare a file with a directory")
+	}
+	f, changed, err := compareFiles(filepath.Base(b), a, b)
+	if err != nil {
+		return nil, err
+	}
+	var files []staticFile
+	if changed {
+		files = append(files, f)
+	}
+	return newStaticDiff(label, files), nil
+}
+
+// compareDirs lists every file that differs between the trees at a and b,
+// keyed by slash-separated path relative to each root. .git directories
+// are skipped.
+func compareDirs(a, b string) ([]staticFile, error) {
+	pathsA, err := treeFiles(a)
+	if err != nil {
+		return nil, err
+	}
+	pathsB, err := treeFiles(b)
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string]bool, len(pathsA)+len(pathsB))
+	for path := range pathsA {
+		all[path] = true
+	}
+	for path := range pathsB {
+		all[path] = true
+	}
+
+	var files []staticFile
+	for path := range all {
+		oldPath, newPath := "", ""
+		if pathsA[path] {
+			oldPath = filepath.Join(a, filepath.FromSlash(path))
+		}
+		if pathsB[path] {
+			newPath = filepath.Join(b, filepath.FromSlash(path))
+		}
+		f, changed, err := compareFiles(path, oldPath, newPath)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// treeFiles returns the slash-separated paths of the files under root.
+// Symlinks are listed but not followed.
+func treeFiles(root string) (map[string]bool, error) {
+	paths := make(map[string]bool)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		paths[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	return paths, err
+}
+
+// compareFiles reads the files at oldPath and newPath, either of which may
+// be empty for a file on only one side, and reports whether they differ
+func compareFiles(path, oldPath, newPath string) (staticFile, bool, error) {
+	f := staticFile{FileInfo: FileInfo{Path: path}}
+	var err error
+	if oldPath != "" {
+		if f.old, err = readFileOrLink(oldPath); err != nil {
+			return f, false, err
+		}
+		f.oldExists = true
+	}
+	if newPath != "" {
+		if f.new, err = readFileOrLink(newPath); err != nil {
+			return f, false, err
+		}
+		f.newExists = true
+	}
+	switch {
+	case !f.oldExists:
+		f.Status = "added"
+	case !f.newExists:
+		f.Status = "deleted"
+	case string(f.old) == string(f.new):
+		return f, false, nil
+	default:
+		f.Status = "modified"
+	}
+	return f, true, nil
+}
+
+// readFileOrLink returns a file's content, or for a symlink its target,
+// which is how git stores links
+func readFileOrLink(path string) ([]byte, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		return []byte(target), err
+	}
+	return os.ReadFile(path)
+}
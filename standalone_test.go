@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestComparePathsDirs(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	writeTree(t, a, map[string]string{
+		"same.txt":       "unchanged\n",
+		"edit/file.txt":  "one\ntwo\nthree\n",
+		"gone.txt":       "bye\n",
+		".git/HEAD":      "ref: refs/heads/main\n",
+		"edit/image.bin": "a\x00b",
+	})
+	writeTree(t, b, map[string]string{
+		"same.txt":       "unchanged\n",
+		"edit/file.txt":  "one\n2\nthree\nfour\n",
+		"new.txt":        "hello\n",
+		"edit/image.bin": "a\x00c",
+	})
+
+	d, err := comparePaths(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileInfo{
+		{Path: "edit/file.txt", Status: "modified", Additions: 2, Deletions: 1},
+		{Path: "edit/image.bin", Status: "modified"},
+		{Path: "gone.txt", Status: "deleted", Deletions: 1},
+		{Path: "new.txt", Status: "added", Additions: 1},
+	}
+	if len(d.Files) != len(want) {
+		t.Fatalf("got %d files, want %d: %+v", len(d.Files), len(want), d.Files)
+	}
+	for i, f := range d.Files {
+		if f.FileInfo != want[i] {
+			t.Errorf("file %d = %+v, want %+v", i, f.FileInfo, want[i])
+		}
+	}
+	if d.Info.FilesCount != 4 || d.Info.Additions != 3 || d.Info.Deletions != 2 {
+		t.Errorf("info = %+v", d.Info)
+	}
+	if fd := d.file("edit/image.bin").fileDiff(false, false); !fd.Binary {
+		t.Errorf("binary file diff = %+v", fd)
+	}
+}
+
+func TestComparePathsFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"old.go": "package a\n", "new.go": "package b\n"})
+
+	d, err := comparePaths(filepath.Join(dir, "old.go"), filepath.Join(dir, "new.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Files) != 1 || d.Files[0].Path != "new.go" || d.Files[0].Status != "modified" {
+		t.Fatalf("files = %+v", d.Files)
+	}
+
+	if _, err := comparePaths(dir, filepath.Join(dir, "new.go")); err == nil {
+		t.Error("comparing a directory with a file succeeded")
+	}
+}
+
+func TestStaticDiffRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	d := newStaticDiff("a → b", []staticFile{{
+		FileInfo:  FileInfo{Path: "dir/x.txt", Status: "modified"},
+		old:       []byte("foo bar\n"),
+		new:       []byte("foo baz\n"),
+		oldExists: true,
+		newExists: true,
+	}})
+	r := gin.New()
+	d.routes(r)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	var diffs []DiffInfo
+	if w := get("/api/diffs"); w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &diffs) != nil || len(diffs) != 1 || diffs[0].ID != standaloneID {
+		t.Fatalf("diffs = %d %s", w.Code, w.Body)
+	}
+
+	var fd FileDiff
+	w := get("/api/file-diff/" + standaloneID + "/dir/x.txt?intraline=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("file-diff = %d %s", w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &fd); err != nil {
+		t.Fatal(err)
+	}
+	if fd.OldContent != "foo bar\n" || fd.NewContent != "foo baz\n" || len(fd.Intraline) != 1 {
+		t.Errorf("file diff = %+v", fd)
+	}
+
+	if w := get("/api/file-diff/" + standaloneID + "/missing.txt"); w.Code != http.StatusNotFound {
+		t.Errorf("missing file = %d", w.Code)
+	}
+	if w := get("/api/diffs/working/files"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown diff = %d", w.Code)
+	}
+}
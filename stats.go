@@ -0,0 +1,241 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultLargestFiles is how many of the most changed files stats list
+const defaultLargestFiles = 10
+
+// StatGroup totals the changes to one group of files
+type StatGroup struct {
+	Name      string `json:"name"`
+	Files     int    `json:"files"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+// DiffStats breaks a diff's line counts down by what was changed
+type DiffStats struct {
+	Files     int `json:"files"`
+	Additions int `json:"additions"`
+	Deletions int `json:"deletions"`
+	// Languages and Extensions are sorted by lines changed, most first
+	Languages  []StatGroup `json:"languages"`
+	Extensions []StatGroup `json:"extensions"`
+	// Kinds splits the diff into test, code, and generated files, the
+	// last covering linguist-generated and linguist-vendored paths
+	Kinds []StatGroup `json:"kinds"`
+	// Largest are the files with the most lines changed
+	Largest []FileInfo `json:"largest"`
+}
+
+// Kinds of file in DiffStats.Kinds
+const (
+	kindCode      = "code"
+	kindTest      = "test"
+	kindGenerated = "generated"
+)
+
+// languageNames maps file extensions to the language they are written in
+var languageNames = map[string]string{
+	"go":    "Go",
+	"ts":    "TypeScript",
+	"tsx":   "TypeScript",
+	"mts":   "TypeScript",
+	"js":    "JavaScript",
+	"jsx":   "JavaScript",
+	"mjs":   "JavaScript",
+	"cjs":   "JavaScript",
+	"py":    "Python",
+	"rs":    "Rust",
+	"rb":    "Ruby",
+	"java":  "Java",
+	"kt":    "Kotlin",
+	"swift": "Swift",
+	"c":     "C",
+	"h":     "C",
+	"cc":    "C++",
+	"cpp":   "C++",
+	"cxx":   "C++",
+	"hpp":   "C++",
+	"cs":    "C#",
+	"php":   "PHP",
+	"sh":    "Shell",
+	"bash":  "Shell",
+	"html":  "HTML",
+	"css":   "CSS",
+	"scss":  "SCSS",
+	"sql":   "SQL",
+	"proto": "Protocol Buffers",
+	"md":    "Markdown",
+	"json":  "JSON",
+	"yaml":  "YAML",
+	"yml":   "YAML",
+	"toml":  "TOML",
+	"ipynb": "Jupyter Notebook",
+}
+
+// languageFileNames names the language of files known by name alone
+var languageFileNames = map[string]string{
+	"Makefile":   "Makefile",
+	"Dockerfile": "Dockerfile",
+	"go.mod":     "Go Modules",
+	"go.sum":     "Go Modules",
+}
+
+// fileLanguage returns the language of a file from its name, falling back
+// to its extension, or "Other" when it has none
+func fileLanguage(p string) string {
+	base := path.Base(p)
+	if name, ok := languageFileNames[base]; ok {
+		return name
+	}
+	ext := strings.TrimPrefix(path.Ext(base), ".")
+	if name, ok := languageNames[strings.ToLower(ext)]; ok {
+		return name
+	}
+	if ext == "" {
+		return "Other"
+	}
+	return ext
+}
+
+// testDirs are directory names whose files are all tests
+var testDirs = map[string]bool{"test": true, "tests": true, "__tests__": true, "spec": true, "testdata": true}
+
+// isTestPath reports whether a path looks like a test by the naming
+// conventions of common languages
+func isTestPath(p string) bool {
+	dir, base := path.Split(p)
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if testDirs[part] {
+			return true
+		}
+	}
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	switch {
+	case strings.HasSuffix(base, "_test.go"),
+		strings.Contains(base, ".test."), strings.Contains(base, ".spec."),
+		strings.HasPrefix(base, "test_") && strings.HasSuffix(base, ".py"),
+		strings.HasSuffix(stem, "_test"), strings.HasSuffix(stem, "_spec"),
+		strings.HasSuffix(stem, "Test") || strings.HasSuffix(stem, "Tests"):
+		return true
+	}
+	return false
+}
+
+// fileKind classifies a changed file for DiffStats.Kinds
+func fileKind(f FileInfo) string {
+	switch {
+	case f.Generated || f.Vendored:
+		return kindGenerated
+	case isTestPath(f.Path):
+		return kindTest
+	default:
+		return kindCode
+	}
+}
+
+// diffStats totals files by language, extension, and kind, and picks the
+// top files with the most lines changed
+func diffStats(files []FileInfo, top int) DiffStats {
+	stats := DiffStats{Files: len(files), Largest: []FileInfo{}}
+	languages := make(map[string]*StatGroup)
+	extensions := make(map[string]*StatGroup)
+	kinds := make(map[string]*StatGroup)
+	add := func(groups map[string]*StatGroup, name string, f FileInfo) {
+		g := groups[name]
+		if g == nil {
+			g = &StatGroup{Name: name}
+			groups[name] = g
+		}
+		g.Files++
+		g.Additions += f.Additions
+		g.Deletions += f.Deletions
+	}
+
+	for _, f := range files {
+		stats.Additions += f.Additions
+		stats.Deletions += f.Deletions
+		if f.Submodule {
+			add(languages, "Submodule", f)
+			add(kinds, kindCode, f)
+			continue
+		}
+		add(languages, fileLanguage(f.Path), f)
+		ext := path.Ext(path.Base(f.Path))
+		if ext == "" {
+			ext = "(none)"
+		}
+		add(extensions, ext, f)
+		add(kinds, fileKind(f), f)
+	}
+	stats.Languages = sortedGroups(languages)
+	stats.Extensions = sortedGroups(extensions)
+	stats.Kinds = sortedGroups(kinds)
+
+	largest := append([]FileInfo(nil), files...)
+	sort.SliceStable(largest, func(i, j int) bool {
+		return largest[i].Additions+largest[i].Deletions > largest[j].Additions+largest[j].Deletions
+	})
+	for _, f := range largest {
+		if len(stats.Largest) == top || f.Additions+f.Deletions == 0 {
+			break
+		}
+		stats.Largest = append(stats.Largest, f)
+	}
+	return stats
+}
+
+// sortedGroups lists groups by lines changed, then by name
+func sortedGroups(groups map[string]*StatGroup) []StatGroup {
+	list := make([]StatGroup, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, *g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i].Additions+list[i].Deletions, list[j].Additions+list[j].Deletions
+		if a != b {
+			return a > b
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// getDiffStats summarizes what a diff changes, by language, file
+// extension, and test versus non-test code, with its largest files
+func getDiffStats(c *gin.Context) {
+	opts, err := diffOptionsFromQuery(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	top := defaultLargestFiles
+	if s := c.Query("top"); s != "" {
+		if top, err = strconv.Atoi(s); err != nil || top < 0 {
+			respondError(c, http.StatusBadRequest, "top must be a non-negative number", err)
+			return
+		}
+	}
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+
+	files, err := listDiffFiles(c.Request.Context(), spec, opts, pathspecsFromQuery(c))
+	if err != nil {
+		slog.Error("git diff failed", "diff", c.Param("id"), "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to get diff files", nil)
+		return
+	}
+	c.JSON(http.StatusOK, diffStats(files, top))
+}
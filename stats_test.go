@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsTestPath(t *testing.T) {
+	tests := map[string]bool{
+		"main_test.go":             true,
+		"src/app.test.ts":          true,
+		"src/app.spec.tsx":         true,
+		"pkg/test_utils.py":        true,
+		"spec/models/user_spec.rb": true,
+		"src/FooTest.java":         true,
+		"internal/testdata/a.txt":  true,
+		"__tests__/a.js":           true,
+		"main.go":                  false,
+		"src/contest.ts":           false,
+		"latest/notes.md":          false,
+	}
+	for p, want := range tests {
+		if got := isTestPath(p); got != want {
+			t.Errorf("isTestPath(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestDiffStats(t *testing.T) {
+	files := []FileInfo{
+		{Path: "a.go", Additions: 10, Deletions: 2},
+		{Path: "a_test.go", Additions: 30},
+		{Path: "web/x.ts", Additions: 1, Deletions: 1},
+		{Path: "web/y.tsx", Additions: 4},
+		{Path: "gen.pb.go", Generated: true, Additions: 100},
+		{Path: "Makefile", Additions: 1},
+		{Path: "logo.png"},
+	}
+	stats := diffStats(files, 2)
+	if stats.Files != 7 || stats.Additions != 146 || stats.Deletions != 3 {
+		t.Errorf("totals = %+v", stats)
+	}
+	if l := stats.Languages; len(l) != 4 || l[0] != (StatGroup{"Go", 3, 140, 2}) || l[1] != (StatGroup{"TypeScript", 2, 5, 1}) {
+		t.Errorf("languages = %+v", l)
+	}
+	if k := stats.Kinds; len(k) != 3 || k[0].Name != kindGenerated || k[1] != (StatGroup{kindTest, 1, 30, 0}) || k[2].Files != 5 {
+		t.Errorf("kinds = %+v", k)
+	}
+	if len(stats.Largest) != 2 || stats.Largest[0].Path != "gen.pb.go" || stats.Largest[1].Path != "a_test.go" {
+		t.Errorf("largest = %+v", stats.Largest)
+	}
+	if e := stats.Extensions; len(e) != 5 || e[0].Name != ".go" || e[len(e)-1].Name != ".png" {
+		t.Errorf("extensions = %+v", e)
+	}
+}
+
+func TestGetDiffStats(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/diffs/:id/stats", getDiffStats)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/HEAD~2..HEAD/stats", nil))
+	var stats DiffStats
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if w.Code != http.StatusOK || stats.Files != 2 || len(stats.Languages) != 2 || len(stats.Largest) != 2 {
+		t.Errorf("stats = %d %+v", w.Code, stats)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/working/stats?top=-1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("negative top = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StructuralChange is a key-level difference between two parsed documents.
+// Path is a JSONPath-style location such as $.dependencies["left-pad"][0].
+type StructuralChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"` // added, removed, modified
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+// supportsStructuralDiff reports whether a file can be diffed structurally
+func supportsStructuralDiff(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// structuralDiff parses both sides of a JSON or YAML file and compares
+// them by key, ignoring formatting. An empty side (added or deleted file)
+// compares as absent.
+func structuralDiff(path, oldContent, newContent string) ([]StructuralChange, error) {
+	oldDoc, err := parseStructured(path, oldContent)
+	if err != nil {
+		return nil, fmt.Errorf("old version: %w", err)
+	}
+	newDoc, err := parseStructured(path, newContent)
+	if err != nil {
+		return nil, fmt.Errorf("new version: %w", err)
+	}
+	// Absence is decided by the content, as it is by key presence below,
+	// so a document that is null compares as a value
+	oldPresent := strings.TrimSpace(oldContent) != ""
+	newPresent := strings.TrimSpace(newContent) != ""
+	changes := []StructuralChange{}
+	switch {
+	case oldPresent && newPresent:
+		compareStructured("$", oldDoc, newDoc, &changes)
+	case newPresent:
+		changes = append(changes, StructuralChange{Path: "$", Kind: "added", New: newDoc})
+	case oldPresent:
+		changes = append(changes, StructuralChange{Path: "$", Kind: "removed", Old: oldDoc})
+	}
+	return changes, nil
+}
+
+func parseStructured(path, content string) (any, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, nil
+	}
+	var doc any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(strings.NewReader(content))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		// Multi-document streams are compared as a list of documents
+		dec := yaml.NewDecoder(strings.NewReader(content))
+		var docs []any
+		for {
+			var d any
+			if err := dec.Decode(&d); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, err
+			}
+			docs = append(docs, normalizeYAML(d))
+		}
+		if len(docs) == 1 {
+			doc = docs[0]
+		} else {
+			doc = docs
+		}
+	default:
+		return nil, fmt.Errorf("unsupported file type: %s", path)
+	}
+	return doc, nil
+}
+
+// normalizeYAML converts maps with non-string keys into string-keyed maps
+// so both formats share one representation
+func normalizeYAML(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			v[k] = normalizeYAML(child)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, child := range v {
+			m[fmt.Sprint(k)] = normalizeYAML(child)
+		}
+		return m
+	case []any:
+		for i, child := range v {
+			v[i] = normalizeYAML(child)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+var identifierKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func childPath(parent, key string) string {
+	if identifierKey.MatchString(key) {
+		return parent + "." + key
+	}
+	quoted, _ := json.Marshal(key)
+	return parent + "[" + string(quoted) + "]"
+}
+
+// compareStructured appends the differences between two values present
+// at path. Keys and list items present on only one side are added or
+// removed; null is compared like any other value.
+func compareStructured(path string, a, b any, changes *[]StructuralChange) {
+	am, aIsMap := a.(map[string]any)
+	bm, bIsMap := b.(map[string]any)
+	if aIsMap && bIsMap {
+		keys := make(map[string]bool)
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			av, inA := am[k]
+			bv, inB := bm[k]
+			switch {
+			case !inA:
+				*changes = append(*changes, StructuralChange{Path: childPath(path, k), Kind: "added", New: bv})
+			case !inB:
+				*changes = append(*changes, StructuralChange{Path: childPath(path, k), Kind: "removed", Old: av})
+			default:
+				compareStructured(childPath(path, k), av, bv, changes)
+			}
+		}
+		return
+	}
+
+	al, aIsList := a.([]any)
+	bl, bIsList := b.([]any)
+	if aIsList && bIsList {
+		for i := 0; i < len(al) || i < len(bl); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(al):
+				*changes = append(*changes, StructuralChange{Path: p, Kind: "added", New: bl[i]})
+			case i >= len(bl):
+				*changes = append(*changes, StructuralChange{Path: p, Kind: "removed", Old: al[i]})
+			default:
+				compareStructured(p, al[i], bl[i], changes)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, StructuralChange{Path: path, Kind: "modified", Old: a, New: b})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+func TestStructuralDiffJSON(t *testing.T) {
+	oldContent := `{"name": "app", "version": "1.0.0", "deps": {"left-pad": "1.0"}, "files": ["a", "b"]}`
+	newContent := `{
+  "name": "app",
+  "version": "1.1.0",
+  "deps": {},
+  "files": ["a", "b", "c"],
+  "private": true
+}`
+
+	changes, err := structuralDiff("package.json", oldContent, newContent)
+	if err != nil {
+		t.Fatalf("structuralDiff() failed: %v", err)
+	}
+
+	want := []struct{ path, kind string }{
+		{`$.deps["left-pad"]`, "removed"},
+		{"$.files[2]", "added"},
+		{"$.private", "added"},
+		{"$.version", "modified"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("structuralDiff() = %+v, want %d changes", changes, len(want))
+	}
+	for i, w := range want {
+		if changes[i].Path != w.path || changes[i].Kind != w.kind {
+			t.Errorf("change %d = %s %s, want %s %s", i, changes[i].Kind, changes[i].Path, w.kind, w.path)
+		}
+	}
+}
+
+func TestStructuralDiffYAMLIgnoresFormatting(t *testing.T) {
+	oldContent := "a: 1\nb:\n  - x\n  - y\n"
+	newContent := "# comment\nb: [x, y]\na: 1\n"
+
+	changes, err := structuralDiff("config.yaml", oldContent, newContent)
+	if err != nil {
+		t.Fatalf("structuralDiff() failed: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("reformatted YAML should have no changes, got %+v", changes)
+	}
+}
+
+func TestStructuralDiffNull(t *testing.T) {
+	// null is a value: setting or clearing it modifies the key
+	for _, tt := range []struct{ path, old, new string }{
+		{"x.json", `{"a": null}`, `{"a": 1}`},
+		{"x.json", `{"a": 1}`, `{"a": null}`},
+		{"x.yaml", "a: ~\n", "a: 1\n"},
+	} {
+		changes, err := structuralDiff(tt.path, tt.old, tt.new)
+		if err != nil || len(changes) != 1 || changes[0].Kind != "modified" || changes[0].Path != "$.a" {
+			t.Errorf("%s -> %s = %+v, %v; want $.a modified", tt.old, tt.new, changes, err)
+		}
+	}
+	changes, err := structuralDiff("x.json", "", `{"a": null}`)
+	if err != nil || len(changes) != 1 || changes[0].Kind != "added" || changes[0].Path != "$" {
+		t.Errorf("added file = %+v, %v", changes, err)
+	}
+}
+
+func TestStructuralDiffParseError(t *testing.T) {
+	if _, err := structuralDiff("bad.json", `{"a": 1}`, `{"a": `); err == nil {
+		t.Error("structuralDiff() should fail on invalid JSON")
+	}
+	if !supportsStructuralDiff("x.YML") || supportsStructuralDiff("x.go") {
+		t.Error("supportsStructuralDiff() extension matching is wrong")
+	}
+}
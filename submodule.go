@@ -0,0 +1,202 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// submoduleLogLimit caps the inner commit list for large submodule bumps
+const submoduleLogLimit = 100
+
+// SubmoduleInfo describes a submodule bump within a diff and, when the
+// submodule is checked out locally, the commits and files it brings in.
+type SubmoduleInfo struct {
+	Path       string     `json:"path"`
+	OldCommit  string     `json:"oldCommit"`
+	NewCommit  string     `json:"newCommit"`
+	CheckedOut bool       `json:"checkedOut"`
+	Commits    []DiffInfo `json:"commits,omitempty"`
+	Files      []FileInfo `json:"files,omitempty"`
+}
+
+// submoduleRange resolves the submodule at path to the commits it points
+// at on each side of the diff. ok is false if path is not a submodule.
+func submoduleRange(spec diffSpec, path string) (oldCommit, newCommit string, ok bool) {
+	if spec.Base != "" {
+		oldCommit = submoduleCommit(spec.Base, path)
+	}
+	if spec.Head != "" {
+		newCommit = submoduleCommit(spec.Head, path)
+	} else if spec.Index {
+		newCommit = indexSubmoduleCommit(path)
+	} else if isWorkingSubmodule(path) {
+		newCommit = workingSubmoduleCommit(path)
+	}
+	if spec.Reverse {
+		oldCommit, newCommit = newCommit, oldCommit
+	}
+	return oldCommit, newCommit, oldCommit != "" || newCommit != ""
+}
+
+// submoduleCheckedOut reports whether the submodule has a local repository
+func submoduleCheckedOut(path string) bool {
+	_, err := os.Stat(filepath.Join(gitRoot, path, ".git"))
+	return err == nil
+}
+
+// submoduleTarget resolves the diff and ?path= submodule for a request,
+// writing an error response and returning false on failure
+func submoduleTarget(c *gin.Context) (info SubmoduleInfo, dir string, ok bool) {
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return info, "", false
+	}
+	path := strings.Trim(c.Query("path"), "/")
+	oldCommit, newCommit, ok := submoduleRange(spec, path)
+	if path == "" || !ok {
+		respondError(c, http.StatusNotFound, "Not a submodule in this diff: "+path, nil)
+		return info, "", false
+	}
+	info = SubmoduleInfo{
+		Path:       path,
+		OldCommit:  oldCommit,
+		NewCommit:  newCommit,
+		CheckedOut: submoduleCheckedOut(path),
+	}
+	return info, filepath.Join(gitRoot, path), true
+}
+
+// getSubmodule returns the commit range of a submodule bump along with the
+// submodule's own commit list and changed files for that range.
+func getSubmodule(c *gin.Context) {
+	info, dir, ok := submoduleTarget(c)
+	if !ok {
+		return
+	}
+	if !info.CheckedOut || info.NewCommit == "" {
+		c.JSON(http.StatusOK, info)
+		return
+	}
+
+	// Commits brought in by the bump, or the recent history of a newly
+	// added submodule
+	logArgs := []string{"-C", dir, "log", "-" + strconv.Itoa(submoduleLogLimit), "--pretty=format:%H%x00%s%x00%an%x00%at"}
+	if info.OldCommit != "" {
+		logArgs = append(logArgs, info.OldCommit+".."+info.NewCommit)
+	} else {
+		logArgs = append(logArgs, info.NewCommit)
+	}
+	output, err := runGitContext(c.Request.Context(), logArgs...)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read submodule log", err)
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		parts := strings.Split(line, "\x00")
+		if len(parts) < 4 {
+			continue
+		}
+		timestamp, _ := strconv.ParseInt(parts[3], 10, 64)
+		info.Commits = append(info.Commits, DiffInfo{
+			ID:        parts[0],
+			Message:   parts[1],
+			Author:    parts[2],
+			Timestamp: time.Unix(timestamp, 0),
+		})
+	}
+
+	base := info.OldCommit
+	if base == "" {
+		base = emptyTreeSHA
+	}
+	output, err = runGitContext(c.Request.Context(), "-C", dir, "diff", "--raw", "-z", base, info.NewCommit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to diff submodule", err)
+		return
+	}
+	info.Files = parseRawDiff(string(output))
+	if stats, err := runGitContext(c.Request.Context(), "-C", dir, "diff", "--numstat", base, info.NewCommit); err == nil {
+		counts := make(map[string][2]int)
+		for _, line := range strings.Split(strings.TrimSpace(string(stats)), "\n") {
+			if parts := strings.SplitN(line, "\t", 3); len(parts) == 3 {
+				add, _ := strconv.Atoi(parts[0])
+				del, _ := strconv.Atoi(parts[1])
+				counts[parts[2]] = [2]int{add, del}
+			}
+		}
+		for i := range info.Files {
+			info.Files[i].Additions = counts[info.Files[i].Path][0]
+			info.Files[i].Deletions = counts[info.Files[i].Path][1]
+		}
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// getSubmoduleFileDiff returns both versions of a file inside a checked
+// out submodule for the range the superproject diff bumps it across.
+func getSubmoduleFileDiff(c *gin.Context) {
+	info, dir, ok := submoduleTarget(c)
+	if !ok {
+		return
+	}
+	if !info.CheckedOut {
+		respondError(c, http.StatusNotFound, "Submodule is not checked out: "+info.Path, nil)
+		return
+	}
+	file := strings.TrimPrefix(c.Query("file"), "/")
+	if file == "" {
+		respondError(c, http.StatusBadRequest, "file is required", nil)
+		return
+	}
+
+	fileDiff := FileDiff{Path: info.Path + "/" + file}
+	read := func(commit string) ([]byte, bool, error) {
+		if commit == "" {
+			return nil, false, nil
+		}
+		output, err := runGitEnvContext(c.Request.Context(), nil, []byte(commit+":"+file+"\n"), "-C", dir, "cat-file", "--batch-check")
+		if err != nil {
+			return nil, false, err
+		}
+		fields := strings.Fields(string(output))
+		if len(fields) != 3 || fields[1] != "blob" {
+			return nil, false, nil
+		}
+		size, _ := strconv.ParseInt(fields[2], 10, 64)
+		if exceedsLimit(size, c.Query("force") == "true") {
+			fileDiff.TooLarge = true
+			return nil, true, nil
+		}
+		data, err := runGitContext(c.Request.Context(), "-C", dir, "cat-file", "blob", fields[0])
+		return data, true, err
+	}
+
+	oldData, oldFound, err := read(info.OldCommit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read old file version", err)
+		return
+	}
+	newData, newFound, err := read(info.NewCommit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read new file version", err)
+		return
+	}
+	fileDiff.OldExists, fileDiff.NewExists = oldFound, newFound
+
+	switch {
+	case fileDiff.TooLarge:
+	case isBinary(oldData) || isBinary(newData):
+		fileDiff.Binary = true
+	default:
+		fileDiff.OldContent, fileDiff.OldEncoding = decodeContent(oldData)
+		fileDiff.NewContent, fileDiff.NewEncoding = decodeContent(newData)
+	}
+	c.JSON(http.StatusOK, fileDiff)
+}
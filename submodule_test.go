@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSubmoduleNavigation(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	libDir := filepath.Join(repoDir, "lib")
+	git := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s\n%s", args, err, output)
+		}
+	}
+	commitLib := func(content, message string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(libDir, "lib.go"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write lib.go: %v", err)
+		}
+		git(libDir, "add", "lib.go")
+		git(libDir, "commit", "-m", message)
+		git(repoDir, "add", "lib")
+		git(repoDir, "commit", "-m", "Bump lib")
+	}
+
+	if err := os.Mkdir(libDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git(libDir, "init")
+	git(libDir, "config", "user.name", "Test User")
+	git(libDir, "config", "user.email", "test@example.com")
+	commitLib("package lib\n", "Add lib")
+	commitLib("package lib\n\nfunc Lib() {}\n", "Add Lib function")
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	oldRoot := gitRoot
+	gitRoot = repoDir
+	defer func() { gitRoot = oldRoot }()
+
+	r := gin.New()
+	r.GET("/api/diffs/:id/submodule", getSubmodule)
+	r.GET("/api/diffs/:id/submodule/file", getSubmoduleFileDiff)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/HEAD~1..HEAD/submodule?path=lib", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("submodule status = %d: %s", w.Code, w.Body.String())
+	}
+	var info SubmoduleInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if !info.CheckedOut || info.OldCommit == "" || info.NewCommit == "" {
+		t.Fatalf("info = %+v", info)
+	}
+	if len(info.Commits) != 1 || info.Commits[0].Message != "Add Lib function" {
+		t.Errorf("Commits = %+v, want the single bumped commit", info.Commits)
+	}
+	if len(info.Files) != 1 || info.Files[0].Path != "lib.go" || info.Files[0].Additions != 2 {
+		t.Errorf("Files = %+v", info.Files)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/HEAD~1..HEAD/submodule/file?path=lib&file=lib.go", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("submodule file status = %d: %s", w.Code, w.Body.String())
+	}
+	var diff FileDiff
+	if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil {
+		t.Fatal(err)
+	}
+	if diff.Path != "lib/lib.go" || diff.OldContent != "package lib\n" || diff.NewContent != "package lib\n\nfunc Lib() {}\n" {
+		t.Errorf("diff = %+v", diff)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/HEAD~1..HEAD/submodule?path=test1.go", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("non-submodule path status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errStaleSuggestion is returned when a suggestion's range no longer
+// holds the text it was made against
+var errStaleSuggestion = errors.New("the lines to replace have changed")
+
+// SuggestionRequest is the body of POST /api/apply-suggestion. StartLine
+// and EndLine are 1-based and inclusive; an EndLine of StartLine-1 inserts
+// before StartLine without replacing anything.
+type SuggestionRequest struct {
+	StartLine   int    `json:"startLine"`
+	EndLine     int    `json:"endLine"`
+	Replacement string `json:"replacement"`
+	// Original is the text the client saw in the range. The suggestion is
+	// refused if the file no longer has it there.
+	Original string `json:"original"`
+	// Version, when set, is the file's version from an earlier
+	// apply-suggestion, and the whole file must be unchanged since
+	Version string `json:"version,omitempty"`
+}
+
+// SuggestionResult locates the applied text in the updated file
+type SuggestionResult struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	Version   string `json:"version"`
+	// Secrets lists likely credentials the suggestion added
+	Secrets []SecretFinding `json:"secrets,omitempty"`
+}
+
+// splitLinesKeepEnds splits text after each newline, so joining the
+// lines gives back text exactly
+func splitLinesKeepEnds(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// applySuggestion replaces lines start through end of text, checking they
+// still hold original. It returns the new text and the last line of the
+// replacement.
+func applySuggestion(text string, req SuggestionRequest) (string, int, error) {
+	lines := splitLinesKeepEnds(text)
+	if req.StartLine < 1 || req.StartLine > len(lines)+1 || req.EndLine < req.StartLine-1 || req.EndLine > len(lines) {
+		return "", 0, fmt.Errorf("line range %d-%d is outside the file's %d lines", req.StartLine, req.EndLine, len(lines))
+	}
+	current := strings.Join(lines[req.StartLine-1:req.EndLine], "")
+	if strings.TrimSuffix(current, "\n") != strings.TrimSuffix(req.Original, "\n") {
+		return "", 0, errStaleSuggestion
+	}
+
+	replacement := req.Replacement
+	// Keep the lines after the range on lines of their own
+	if replacement != "" && !strings.HasSuffix(replacement, "\n") && (req.EndLine < len(lines) || strings.HasSuffix(current, "\n")) {
+		replacement += "\n"
+	}
+	before := strings.Join(lines[:req.StartLine-1], "")
+	after := strings.Join(lines[req.EndLine:], "")
+	return before + replacement + after, req.StartLine + len(splitLinesKeepEnds(replacement)) - 1, nil
+}
+
+// postApplySuggestion replaces a line range of a working tree file, so a
+// suggested change can be applied without saving the whole file
+func postApplySuggestion(c *gin.Context) {
+	filePath := filePathParam(c)
+	var req SuggestionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	if err := validateRepoPath(filePath); err != nil {
+		respondError(c, http.StatusForbidden, err.Error(), err)
+		return
+	}
+
+	existing, err := secureRoot.ReadFile(filePath)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read file", err)
+		return
+	}
+	if req.Version != "" && req.Version != contentHash(existing) {
+		respondError(c, http.StatusConflict, "The file has changed since it was read", nil)
+		return
+	}
+
+	// Edit the text as the diff view shows it: decoded and with LF endings
+	text, encoding := decodeContent(existing)
+	crlf := hasCRLF(existing)
+	if crlf {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	updated, endLine, err := applySuggestion(text, req)
+	switch {
+	case errors.Is(err, errStaleSuggestion):
+		respondError(c, http.StatusConflict, err.Error(), err)
+		return
+	case err != nil:
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	data, err := encodeContent(updated, encoding)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if crlf {
+		data = toCRLF(data)
+	}
+
+	var secrets []SecretFinding
+	if secretsMode() != secretsOff {
+		secrets = scanNewContent(filePath, text, updated)
+	}
+	if !secretsAllowed(c, secrets) {
+		return
+	}
+
+	file, err := secureRoot.OpenFile(filePath, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to open file", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to write file", err)
+		return
+	}
+
+	recordSave(filePath, existing, data)
+	lspFileSaved(filePath, updated)
+	emitEvent(eventFileSaved, map[string]string{"path": filePath})
+	c.JSON(http.StatusOK, SuggestionResult{
+		Path:      filePath,
+		StartLine: req.StartLine,
+		EndLine:   endLine,
+		Version:   contentHash(data),
+		Secrets:   secrets,
+	})
+}
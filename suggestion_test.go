@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestApplySuggestionText(t *testing.T) {
+	text := "a\nb\nc\n"
+	tests := []struct {
+		name    string
+		req     SuggestionRequest
+		want    string
+		wantEnd int
+		wantErr bool
+	}{
+		{"replace one", SuggestionRequest{StartLine: 2, EndLine: 2, Original: "b", Replacement: "B"}, "a\nB\nc\n", 2, false},
+		{"replace with two", SuggestionRequest{StartLine: 2, EndLine: 3, Original: "b\nc\n", Replacement: "x\ny\nz\n"}, "a\nx\ny\nz\n", 4, false},
+		{"delete", SuggestionRequest{StartLine: 1, EndLine: 1, Original: "a\n"}, "b\nc\n", 0, false},
+		{"insert", SuggestionRequest{StartLine: 4, EndLine: 3, Replacement: "d"}, "a\nb\nc\nd", 4, false},
+		{"stale", SuggestionRequest{StartLine: 2, EndLine: 2, Original: "old", Replacement: "B"}, "", 0, true},
+		{"out of range", SuggestionRequest{StartLine: 3, EndLine: 5, Original: "c"}, "", 0, true},
+	}
+	for _, tt := range tests {
+		got, end, err := applySuggestion(text, tt.req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v", tt.name, err)
+			continue
+		}
+		if got != tt.want || end != tt.wantEnd {
+			t.Errorf("%s: got %q ending at %d, want %q ending at %d", tt.name, got, end, tt.want, tt.wantEnd)
+		}
+	}
+}
+
+func TestApplySuggestion(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/apply-suggestion/*filepath", postApplySuggestion)
+	apply := func(path string, req SuggestionRequest) (int, SuggestionResult) {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		httpReq := httptest.NewRequest(http.MethodPost, "/api/apply-suggestion/"+path, strings.NewReader(string(body)))
+		httpReq.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, httpReq)
+		var result SuggestionResult
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result
+	}
+
+	// The working tree test2.ts is three lines returning 'world'
+	code, result := apply("test2.ts", SuggestionRequest{StartLine: 2, EndLine: 2, Original: "  return 'world';", Replacement: "  return 'planet';"})
+	if code != http.StatusOK {
+		t.Fatalf("apply = %d", code)
+	}
+	data, _ := os.ReadFile("test2.ts")
+	if string(data) != "export function world() {\n  return 'planet';\n}\n" {
+		t.Errorf("file = %q", data)
+	}
+	if result.StartLine != 2 || result.EndLine != 2 || result.Version != contentHash(data) {
+		t.Errorf("result = %+v", result)
+	}
+
+	// Applying the same suggestion again finds the lines changed
+	if code, _ := apply("test2.ts", SuggestionRequest{StartLine: 2, EndLine: 2, Original: "  return 'world';", Replacement: "x"}); code != http.StatusConflict {
+		t.Errorf("stale original = %d, want 409", code)
+	}
+
+	os.WriteFile("test2.ts", append(data, "// edited\n"...), 0644)
+	if code, _ := apply("test2.ts", SuggestionRequest{StartLine: 1, EndLine: 0, Replacement: "// header", Version: result.Version}); code != http.StatusConflict {
+		t.Errorf("stale version = %d, want 409", code)
+	}
+	if code, _ := apply("untracked.ts", SuggestionRequest{StartLine: 1, EndLine: 0, Replacement: "x"}); code != http.StatusForbidden {
+		t.Errorf("untracked file = %d, want 403", code)
+	}
+}
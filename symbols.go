@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Symbol is a function, type, or other definition in a file. Lines are
+// 1-based and inclusive; End is 0 when the source cannot tell.
+type Symbol struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Line    int    `json:"line"`
+	End     int    `json:"end,omitempty"`
+	Changed bool   `json:"changed"`
+}
+
+// LineRange is an inclusive range of 1-based lines
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// SymbolOutline is the response from GET /api/symbols/:id/*filepath
+type SymbolOutline struct {
+	Path    string      `json:"path"`
+	Symbols []Symbol    `json:"symbols"`
+	Changed []LineRange `json:"changed"`
+	// Source names the parser used: go, ctags, or "" when none applies
+	Source string `json:"source"`
+}
+
+// ctagsAvailable reports whether universal-ctags is installed; other
+// ctags implementations lack JSON output
+var ctagsAvailable = sync.OnceValue(func() bool {
+	output, err := toolCommand("ctags", "--version").Output()
+	return err == nil && bytes.Contains(output, []byte("Universal Ctags"))
+})
+
+// goSymbols lists the top-level functions, methods, and types in Go source
+func goSymbols(src []byte) ([]Symbol, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.SkipObjectResolution)
+	if err != nil && file == nil {
+		return nil, err
+	}
+	var symbols []Symbol
+	add := func(name, kind string, node ast.Node) {
+		symbols = append(symbols, Symbol{
+			Name: name,
+			Kind: kind,
+			Line: fset.Position(node.Pos()).Line,
+			End:  fset.Position(node.End()).Line,
+		})
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				add(receiverName(d.Recv.List[0].Type)+"."+d.Name.Name, "method", d)
+			} else {
+				add(d.Name.Name, "function", d)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					kind := "type"
+					switch ts.Type.(type) {
+					case *ast.StructType:
+						kind = "struct"
+					case *ast.InterfaceType:
+						kind = "interface"
+					}
+					add(ts.Name.Name, kind, ts)
+				}
+			}
+		}
+	}
+	return symbols, nil
+}
+
+// receiverName returns the type name of a method receiver expression
+func receiverName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(e.X)
+	case *ast.IndexExpr:
+		return receiverName(e.X)
+	case *ast.IndexListExpr:
+		return receiverName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// ctagsSymbols runs universal-ctags over src, written to a temporary file
+// named like path so ctags picks the right language
+func ctagsSymbols(path string, src []byte) ([]Symbol, error) {
+	dir, err := os.MkdirTemp("", "differing-ctags-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(tmp, src, 0600); err != nil {
+		return nil, err
+	}
+	output, err := toolCommand("ctags", "--output-format=json", "--fields=+neK", "-f", "-", tmp).Output()
+	if err != nil {
+		return nil, err
+	}
+	var symbols []Symbol
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var tag struct {
+			Type  string `json:"_type"`
+			Name  string `json:"name"`
+			Kind  string `json:"kind"`
+			Line  int    `json:"line"`
+			End   int    `json:"end"`
+			Scope string `json:"scope"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &tag) != nil || tag.Type != "tag" {
+			continue
+		}
+		name := tag.Name
+		if tag.Scope != "" {
+			name = tag.Scope + "." + name
+		}
+		symbols = append(symbols, Symbol{Name: name, Kind: tag.Kind, Line: tag.Line, End: tag.End})
+	}
+	return symbols, scanner.Err()
+}
+
+// newSideContent reads the new side of a file in a diff. found is false
+// when the diff deletes the file.
+func newSideContent(spec diffSpec, path string) (data []byte, found bool, err error) {
+	if spec.newSideInGit() {
+		sha, size, found, err := blobInfo(spec.Head, path)
+		if err != nil || !found {
+			return nil, false, err
+		}
+		if exceedsLimit(size, false) {
+			return nil, true, nil
+		}
+		data, err := runGit("cat-file", "blob", sha)
+		return data, true, err
+	}
+	if target, ok, err := workingLink(path); ok || err != nil {
+		return []byte(target), ok, err
+	}
+	file, err := secureRoot.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	if exceedsLimit(info.Size(), false) {
+		return nil, true, nil
+	}
+	data, err = io.ReadAll(file)
+	return data, true, err
+}
+
+// changedRanges converts hunks to line ranges. A deletion-only hunk
+// becomes the line before the deletion, so the symbol it was in is
+// still marked changed.
+func changedRanges(hunks []hunkRange) []LineRange {
+	ranges := []LineRange{}
+	for _, h := range hunks {
+		if h.count == 0 {
+			line := max(h.start, 1)
+			ranges = append(ranges, LineRange{line, line})
+		} else {
+			ranges = append(ranges, LineRange{h.start, h.start + h.count - 1})
+		}
+	}
+	return ranges
+}
+
+// markChanged flags symbols overlapping a changed range. Symbols without
+// an end line are taken to run until the next symbol starts.
+func markChanged(symbols []Symbol, changed []LineRange) {
+	sort.SliceStable(symbols, func(i, j int) bool { return symbols[i].Line < symbols[j].Line })
+	for i := range symbols {
+		end := symbols[i].End
+		if end == 0 {
+			end = int(^uint(0) >> 1)
+			if i+1 < len(symbols) {
+				end = symbols[i+1].Line - 1
+			}
+		}
+		for _, r := range changed {
+			if r.Start <= end && r.End >= symbols[i].Line {
+				symbols[i].Changed = true
+				break
+			}
+		}
+	}
+}
+
+// getSymbols outlines the new side of a file in a diff, marking which
+// definitions the diff touches
+func getSymbols(c *gin.Context) {
+	filePath := filePathParam(c)
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+	data, found, err := newSideContent(spec, filePath)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read file", err)
+		return
+	}
+	hunks, err := newSideHunks(spec, ":(literal)"+filePath)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to diff file", err)
+		return
+	}
+
+	outline := SymbolOutline{Path: filePath, Symbols: []Symbol{}, Changed: changedRanges(hunks[filePath])}
+	if found && data != nil && !isBinary(data) {
+		var symbols []Symbol
+		switch {
+		case strings.HasSuffix(filePath, ".go"):
+			symbols, err = goSymbols(data)
+			outline.Source = "go"
+		case ctagsAvailable():
+			symbols, err = ctagsSymbols(filePath, data)
+			outline.Source = "ctags"
+		}
+		if err != nil {
+			respondError(c, http.StatusUnprocessableEntity, "Failed to parse file", err)
+			return
+		}
+		if symbols != nil {
+			markChanged(symbols, outline.Changed)
+			outline.Symbols = symbols
+		}
+	}
+	c.JSON(http.StatusOK, outline)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGoSymbols(t *testing.T) {
+	src := []byte("package p\n\ntype T struct{}\n\nfunc (t *T) M() {\n}\n\nfunc F() {}\n")
+	symbols, err := goSymbols(src)
+	if err != nil {
+		t.Fatalf("goSymbols() error: %v", err)
+	}
+	want := []Symbol{
+		{Name: "T", Kind: "struct", Line: 3, End: 3},
+		{Name: "T.M", Kind: "method", Line: 5, End: 6},
+		{Name: "F", Kind: "function", Line: 8, End: 8},
+	}
+	if len(symbols) != len(want) {
+		t.Fatalf("goSymbols() = %+v", symbols)
+	}
+	for i := range want {
+		if symbols[i] != want[i] {
+			t.Errorf("symbol %d = %+v, want %+v", i, symbols[i], want[i])
+		}
+	}
+
+	markChanged(symbols, changedRanges([]hunkRange{{start: 6, count: 0}}))
+	if symbols[0].Changed || !symbols[1].Changed || symbols[2].Changed {
+		t.Errorf("a deletion inside M should mark only M: %+v", symbols)
+	}
+}
+
+func TestGetSymbols(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	src := "package main\n\nfunc hello() string {\n\treturn \"hello\"\n}\n\nfunc added() {}\n"
+	if err := os.WriteFile(filepath.Join(repoDir, "test1.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/api/symbols/:id/*filepath", getSymbols)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/symbols/working/test1.go", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var outline SymbolOutline
+	if err := json.Unmarshal(w.Body.Bytes(), &outline); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if outline.Source != "go" || len(outline.Symbols) != 2 {
+		t.Fatalf("outline = %+v", outline)
+	}
+	if outline.Symbols[0].Changed || !outline.Symbols[1].Changed {
+		t.Errorf("only added() should be changed: %+v", outline.Symbols)
+	}
+}
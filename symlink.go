@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// symlinkMode is the tree entry mode git uses for symbolic links, whose
+// blob holds the link target
+const symlinkMode = "120000"
+
+// errSymlink is returned by validateRepoPath for paths that are symbolic
+// links, which are never written through
+var errSymlink = errors.New("file is a symbolic link")
+
+// workingLink returns the target of a symbolic link in the working tree.
+// Diffs show a link's target, as git stores it, rather than following it
+// to a file that may be anywhere.
+func workingLink(path string) (target string, ok bool, err error) {
+	info, err := secureRoot.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		return "", false, err
+	}
+	target, err = secureRoot.Readlink(path)
+	return target, err == nil, err
+}
+
+// checkNotSymlink returns errSymlink when path in the working tree is a
+// symbolic link
+func checkNotSymlink(path string) error {
+	info, err := secureRoot.Lstat(path)
+	if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		return fmt.Errorf("%w: %s", errSymlink, path)
+	}
+	return nil
+}
+
+// caseRename finds a rename between path and a name differing from it
+// only in case, such as README.md to Readme.md, returning the file's name
+// on each side. Such renames are all that case-insensitive file systems
+// allow to happen without the old name disappearing, and a case-sensitive
+// lookup of the new name on the old side would find nothing.
+func caseRename(spec diffSpec, path string) (oldPath, newPath string, ok bool) {
+	spec.Reverse = false
+	args := append([]string{"diff", "--raw", "-z", "-M"}, spec.revArgs()...)
+	output, err := runGit(append(args, "--", ":(icase,literal)"+path)...)
+	if err != nil {
+		return "", "", false
+	}
+	for _, f := range parseRawDiff(string(output)) {
+		if f.OldPath != "" && f.OldPath != f.Path && strings.EqualFold(f.OldPath, f.Path) &&
+			(f.OldPath == path || f.Path == path) {
+			return f.OldPath, f.Path, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSymlinkDiffAndSave(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("outside\n"), 0644)
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	if err := os.Symlink("test1.go", "link"); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	exec.Command("git", "add", "link").Run()
+	exec.Command("git", "commit", "-m", "Add link").Run()
+	// Retarget the link outside the repository
+	os.Remove("link")
+	os.Symlink(filepath.Join(outside, "secret.txt"), "link")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/diffs/:id/files", getDiffFiles)
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+	r.POST("/api/file-save/:id/*filepath", saveFile)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/working/files", nil))
+	var files []FileInfo
+	json.Unmarshal(w.Body.Bytes(), &files)
+	found := false
+	for _, f := range files {
+		if f.Path == "link" {
+			found = f.Symlink
+		}
+	}
+	if !found {
+		t.Errorf("files = %+v, want link marked as a symlink", files)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/link", nil))
+	var diff FileDiff
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if diff.OldContent != "test1.go" || diff.NewContent != filepath.Join(outside, "secret.txt") {
+		t.Errorf("link diff = %q -> %q, want the targets", diff.OldContent, diff.NewContent)
+	}
+
+	if err := validateRepoPath("link"); !errors.Is(err, errSymlink) {
+		t.Errorf("validateRepoPath(link) = %v, want errSymlink", err)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/file-save/working/link", strings.NewReader(`{"content":"pwned\n"}`)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("save through link = %d, want 403", w.Code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(outside, "secret.txt")); string(data) != "outside\n" {
+		t.Errorf("file outside the repository was written: %q", data)
+	}
+}
+
+func TestCaseOnlyRename(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	if output, err := exec.Command("git", "mv", "test1.go", "Test1.go").CombinedOutput(); err != nil {
+		t.Fatalf("git mv failed: %v: %s", err, output)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/diffs/:id/files", getDiffFiles)
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/working/files", nil))
+	var files []FileInfo
+	json.Unmarshal(w.Body.Bytes(), &files)
+	var renamed *FileInfo
+	for i := range files {
+		if files[i].Path == "Test1.go" {
+			renamed = &files[i]
+		}
+	}
+	if renamed == nil || renamed.OldPath != "test1.go" {
+		t.Fatalf("files = %+v, want Test1.go renamed from test1.go", files)
+	}
+
+	// Neither side shows as missing, so the diff is empty rather than a
+	// whole-file add
+	for _, query := range []string{"", "?reverse=true"} {
+		path := "Test1.go"
+		if query != "" {
+			path = "test1.go"
+		}
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/"+path+query, nil))
+		var diff FileDiff
+		json.Unmarshal(w.Body.Bytes(), &diff)
+		if !diff.OldExists || !diff.NewExists || diff.OldContent != diff.NewContent {
+			t.Errorf("file-diff %s%s = %s", path, query, w.Body.String())
+		}
+	}
+}
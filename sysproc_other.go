@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// hideConsole is only needed on Windows
+func hideConsole(cmd *exec.Cmd) {}
+
+// setShellCommandLine is only needed on Windows, where cmd parses its
+// command line itself
+func setShellCommandLine(cmd *exec.Cmd, script string) {}
+
+// detach starts cmd in its own session so it outlives the terminal
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Process creation flags the syscall package lacks
+const (
+	detachedProcess = 0x00000008 // DETACHED_PROCESS
+	createNoWindow  = 0x08000000 // CREATE_NO_WINDOW
+)
+
+// hideConsole keeps cmd from flashing a console window, which every git
+// process would otherwise do when differing runs without one
+func hideConsole(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true, CreationFlags: createNoWindow}
+}
+
+// setShellCommandLine passes script to the cmd /S /C of shellCommand as
+// it is. Go would quote it as an argument with backslashes, which cmd
+// does not understand; /S has cmd strip only the outer quotes added here.
+func setShellCommandLine(cmd *exec.Cmd, script string) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CmdLine = `cmd /S /C "` + script + `"`
+}
+
+// detach starts cmd without a console so it outlives the terminal
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		HideWindow:    true,
+		CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// TableDiff compares two versions of a CSV or TSV file row by row. The
+// first record is the header. Rows are matched by the Key columns, and
+// cells by column name, so reordering rows or columns is not a change.
+type TableDiff struct {
+	Key            []string    `json:"key"`
+	Columns        []string    `json:"columns"`
+	AddedColumns   []string    `json:"addedColumns,omitempty"`
+	RemovedColumns []string    `json:"removedColumns,omitempty"`
+	Rows           []RowChange `json:"rows"`
+	// Unchanged counts the rows matched on both sides with equal cells
+	Unchanged int `json:"unchanged"`
+}
+
+// RowChange describes one added, removed or modified row. Indexes count
+// data rows from 0, after the header, and are -1 on the side where the
+// row does not exist. Old and New hold the whole row; Cells, for modified
+// rows, the cells that differ.
+type RowChange struct {
+	Key      string       `json:"key"`
+	Status   string       `json:"status"` // added, removed, modified
+	OldIndex int          `json:"oldIndex"`
+	NewIndex int          `json:"newIndex"`
+	Old      []string     `json:"old,omitempty"`
+	New      []string     `json:"new,omitempty"`
+	Cells    []CellChange `json:"cells,omitempty"`
+}
+
+// CellChange is a changed cell of a modified row. A column that exists
+// on only one side compares as empty on the other.
+type CellChange struct {
+	Column string `json:"column"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// table is a parsed CSV or TSV file
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// tableDelimiter returns the field separator for a tabular file, or 0
+// when path is not one
+func tableDelimiter(path string) rune {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ','
+	case ".tsv", ".tab":
+		return '\t'
+	}
+	return 0
+}
+
+func isTabular(path string) bool {
+	return tableDelimiter(path) != 0
+}
+
+func parseTable(path, content string) (table, error) {
+	if strings.TrimSpace(content) == "" {
+		return table{}, nil
+	}
+	r := csv.NewReader(strings.NewReader(content))
+	r.Comma = tableDelimiter(path)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return table{}, err
+	}
+	return table{header: records[0], rows: records[1:]}, nil
+}
+
+// column returns the index of the first column named name, or -1
+func (t table) column(name string) int {
+	return slices.Index(t.header, name)
+}
+
+// cell returns a row's value in a column, which short rows lack
+func cell(row []string, i int) string {
+	if i < 0 || i >= len(row) {
+		return ""
+	}
+	return row[i]
+}
+
+// rowKeys returns each row's key, its values in the key columns, for
+// matching rows and as a label to show. Rows are matched on the values
+// joined by NUL, which cells do not hold, so ("a,b", "c") and ("a", "b,c")
+// stay apart; labels join them by commas. Repeated keys are numbered so
+// that their nth occurrences pair up.
+func (t table) rowKeys(key []string) (keys, labels []string) {
+	cols := make([]int, len(key))
+	for i, name := range key {
+		cols[i] = t.column(name)
+	}
+	seen := make(map[string]int)
+	keys = make([]string, len(t.rows))
+	labels = make([]string, len(t.rows))
+	for i, row := range t.rows {
+		values := make([]string, len(cols))
+		for j, col := range cols {
+			values[j] = cell(row, col)
+		}
+		k := strings.Join(values, "\x00")
+		keys[i], labels[i] = k, strings.Join(values, ",")
+		if n := seen[k]; n > 0 {
+			keys[i] = fmt.Sprintf("%s\x00#%d", k, n+1)
+			labels[i] = fmt.Sprintf("%s#%d", labels[i], n+1)
+		}
+		seen[k]++
+	}
+	return keys, labels
+}
+
+// tableDiff parses both sides of a CSV or TSV file and compares their rows
+// by key. key names the key columns, comma-separated; it defaults to the
+// first column. An empty side (added or deleted file) has no rows.
+func tableDiff(path, oldContent, newContent, key string) (*TableDiff, error) {
+	oldTable, err := parseTable(path, oldContent)
+	if err != nil {
+		return nil, fmt.Errorf("old version: %w", err)
+	}
+	newTable, err := parseTable(path, newContent)
+	if err != nil {
+		return nil, fmt.Errorf("new version: %w", err)
+	}
+
+	diff := &TableDiff{Columns: newTable.header, Rows: []RowChange{}}
+	if newTable.header == nil {
+		diff.Columns = oldTable.header
+	}
+	if key != "" {
+		diff.Key = strings.Split(key, ",")
+	} else if len(diff.Columns) > 0 {
+		diff.Key = diff.Columns[:1]
+	}
+	for _, name := range diff.Key {
+		if (oldTable.header != nil && oldTable.column(name) < 0) || (newTable.header != nil && newTable.column(name) < 0) {
+			return nil, fmt.Errorf("no key column %q", name)
+		}
+	}
+	for _, name := range newTable.header {
+		if oldTable.header != nil && oldTable.column(name) < 0 {
+			diff.AddedColumns = append(diff.AddedColumns, name)
+		}
+	}
+	for _, name := range oldTable.header {
+		if newTable.header != nil && newTable.column(name) < 0 {
+			diff.RemovedColumns = append(diff.RemovedColumns, name)
+		}
+	}
+	// Cells are compared across every column either side has
+	columns := slices.Clone(oldTable.header)
+	for _, name := range newTable.header {
+		if !slices.Contains(columns, name) {
+			columns = append(columns, name)
+		}
+	}
+	oldCols := make([]int, len(columns))
+	newCols := make([]int, len(columns))
+	for i, name := range columns {
+		oldCols[i], newCols[i] = oldTable.column(name), newTable.column(name)
+	}
+
+	oldKeys, oldLabels := oldTable.rowKeys(diff.Key)
+	newKeys, newLabels := newTable.rowKeys(diff.Key)
+	oldByKey := make(map[string]int, len(oldKeys))
+	for i, k := range oldKeys {
+		oldByKey[k] = i
+	}
+	matched := make([]bool, len(oldKeys))
+	for _, k := range newKeys {
+		if i, ok := oldByKey[k]; ok {
+			matched[i] = true
+		}
+	}
+
+	// Changes follow the new file's order, with removed rows placed where
+	// they were in the old one
+	next := 0
+	removedBefore := func(end int) {
+		for ; next < end; next++ {
+			if !matched[next] {
+				diff.Rows = append(diff.Rows, RowChange{Key: oldLabels[next], Status: "removed",
+					OldIndex: next, NewIndex: -1, Old: oldTable.rows[next]})
+			}
+		}
+	}
+	for ni, k := range newKeys {
+		oi, ok := oldByKey[k]
+		if !ok {
+			diff.Rows = append(diff.Rows, RowChange{Key: newLabels[ni], Status: "added",
+				OldIndex: -1, NewIndex: ni, New: newTable.rows[ni]})
+			continue
+		}
+		removedBefore(oi)
+		var cells []CellChange
+		for i, name := range columns {
+			o := cell(oldTable.rows[oi], oldCols[i])
+			n := cell(newTable.rows[ni], newCols[i])
+			if o != n {
+				cells = append(cells, CellChange{Column: name, Old: o, New: n})
+			}
+		}
+		if cells == nil {
+			diff.Unchanged++
+			continue
+		}
+		diff.Rows = append(diff.Rows, RowChange{Key: newLabels[ni], Status: "modified", OldIndex: oi, NewIndex: ni,
+			Old: oldTable.rows[oi], New: newTable.rows[ni], Cells: cells})
+	}
+	removedBefore(len(oldKeys))
+	return diff, nil
+}
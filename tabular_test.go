@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTableDiff(t *testing.T) {
+	oldContent := "id,name,qty\n1,apple,3\n2,pear,5\n3,plum,1\n"
+	// Rows and columns reordered, pear changed, plum removed, fig added
+	newContent := "name,id,qty,price\npear,2,6,\nfig,4,2,1.50\napple,1,3,\n"
+
+	diff, err := tableDiff("fruit.csv", oldContent, newContent, "id")
+	if err != nil {
+		t.Fatalf("tableDiff() failed: %v", err)
+	}
+	if !reflect.DeepEqual(diff.AddedColumns, []string{"price"}) || diff.RemovedColumns != nil {
+		t.Errorf("columns added %v, removed %v", diff.AddedColumns, diff.RemovedColumns)
+	}
+	if diff.Unchanged != 1 {
+		t.Errorf("unchanged = %d, want 1", diff.Unchanged)
+	}
+	want := []struct {
+		key, status        string
+		oldIndex, newIndex int
+	}{
+		{"2", "modified", 1, 0},
+		{"4", "added", -1, 1},
+		{"3", "removed", 2, -1},
+	}
+	if len(diff.Rows) != len(want) {
+		t.Fatalf("rows = %+v, want %d", diff.Rows, len(want))
+	}
+	for i, w := range want {
+		r := diff.Rows[i]
+		if r.Key != w.key || r.Status != w.status || r.OldIndex != w.oldIndex || r.NewIndex != w.newIndex {
+			t.Errorf("row %d = %s %s %d/%d, want %s %s %d/%d", i, r.Status, r.Key, r.OldIndex, r.NewIndex,
+				w.status, w.key, w.oldIndex, w.newIndex)
+		}
+	}
+	if cells := diff.Rows[0].Cells; !reflect.DeepEqual(cells, []CellChange{{Column: "qty", Old: "5", New: "6"}}) {
+		t.Errorf("modified cells = %+v", cells)
+	}
+
+	if _, err := tableDiff("fruit.csv", oldContent, newContent, "sku"); err == nil {
+		t.Error("tableDiff() with an unknown key column succeeded")
+	}
+}
+
+func TestTableDiffRepeatedKeys(t *testing.T) {
+	// Without a unique key, repeated values pair up in order
+	diff, err := tableDiff("log.tsv", "day\tn\nmon\t1\nmon\t2\n", "day\tn\nmon\t1\nmon\t3\nmon\t4\n", "")
+	if err != nil {
+		t.Fatalf("tableDiff() failed: %v", err)
+	}
+	if !reflect.DeepEqual(diff.Key, []string{"day"}) || len(diff.Rows) != 2 {
+		t.Fatalf("diff = %+v", diff)
+	}
+	if diff.Rows[0].Status != "modified" || diff.Rows[0].Key != "mon#2" || diff.Rows[1].Status != "added" {
+		t.Errorf("rows = %+v", diff.Rows)
+	}
+}
+
+func TestTableDiffCompositeKey(t *testing.T) {
+	// Key tuples that read the same once joined by commas stay apart
+	oldContent := "a,b,n\n\"x,y\",z,1\nx,\"y,z\",2\n"
+	newContent := "a,b,n\nx,\"y,z\",3\n\"x,y\",z,1\n"
+	diff, err := tableDiff("pairs.csv", oldContent, newContent, "a,b")
+	if err != nil {
+		t.Fatalf("tableDiff() failed: %v", err)
+	}
+	if diff.Unchanged != 1 || len(diff.Rows) != 1 {
+		t.Fatalf("diff = %+v", diff)
+	}
+	if r := diff.Rows[0]; r.Status != "modified" || r.OldIndex != 1 || r.NewIndex != 0 || r.Key != "x,y,z" {
+		t.Errorf("row = %+v", r)
+	}
+}
+
+func TestFileDiffTable(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	os.WriteFile("data.csv", []byte("id,sku,qty\n1,a,1\n2,b,2\n"), 0644)
+	exec.Command("git", "add", "data.csv").Run()
+	exec.Command("git", "commit", "-m", "Add data").Run()
+	os.WriteFile("data.csv", []byte("id,sku,qty\n2,b,2\n1,a,5\n"), 0644)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/data.csv?table=true&key=sku", nil))
+	var diff FileDiff
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if diff.Table == nil {
+		t.Fatalf("no table diff: %s", w.Body.String())
+	}
+	if len(diff.Table.Rows) != 1 || diff.Table.Rows[0].Key != "a" || diff.Table.Unchanged != 1 {
+		t.Errorf("table = %+v", diff.Table)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/data.csv?table=true&key=missing", nil))
+	diff = FileDiff{}
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if diff.Table != nil || diff.TableError == "" || diff.NewContent == "" {
+		t.Errorf("unknown key: table %+v, error %q", diff.Table, diff.TableError)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timelineRefPrefix holds the automatic snapshots of the working tree,
+// apart from the ones taken by hand
+const timelineRefPrefix = "refs/differing/timeline/"
+
+// timelineDiffPrefix marks a diff ID comparing a timeline entry to the
+// working tree, as in timeline:1760537412345
+const timelineDiffPrefix = "timeline:"
+
+// maxTimelineEntries is how many automatic snapshots are kept; the
+// oldest are deleted as new ones are recorded
+const maxTimelineEntries = 200
+
+// timelineNudge wakes the timeline recorder early, after a save. It is
+// nil unless the timeline is enabled with -timeline.
+var timelineNudge chan struct{}
+
+// describeChanges labels a timeline entry with the files that changed
+// since the previous one
+func describeChanges(from, to string) string {
+	output, err := runGit("diff", "--name-only", "-z", from, to)
+	if err != nil {
+		return "Working tree changes"
+	}
+	paths := strings.FieldsFunc(string(output), func(r rune) bool { return r == 0 })
+	const shown = 3
+	switch {
+	case len(paths) == 0:
+		return "Working tree changes"
+	case len(paths) > shown:
+		return fmt.Sprintf("%s and %d more", strings.Join(paths[:shown], ", "), len(paths)-shown)
+	default:
+		return strings.Join(paths, ", ")
+	}
+}
+
+// recordTimeline adds an entry to the timeline when the working tree
+// differs from the latest one, returning false when nothing changed
+func recordTimeline() (Snapshot, bool, error) {
+	tree, err := workingTreeObject()
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	entries, err := listSnapshotRefs(timelineRefPrefix)
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+
+	// The first entry is compared with HEAD, so a clean working tree is
+	// not recorded
+	previous := "HEAD"
+	if len(entries) > 0 {
+		previous = entries[0].Commit
+	}
+	if output, err := runGit("rev-parse", "--verify", "--quiet", previous+"^{tree}"); err == nil && strings.TrimSpace(string(output)) == tree {
+		return Snapshot{}, false, nil
+	}
+	if _, err := resolveRev(previous); err != nil {
+		previous = emptyTreeSHA
+	}
+
+	snapshot, err := takeSnapshot(timelineRefPrefix, tree, describeChanges(previous, tree))
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	for _, old := range entries[min(len(entries), maxTimelineEntries-1):] {
+		runGit("update-ref", "-d", timelineRefPrefix+old.ID)
+	}
+	return snapshot, true, nil
+}
+
+// nudgeTimeline asks the recorder to check the working tree now
+func nudgeTimeline() {
+	if timelineNudge == nil {
+		return
+	}
+	select {
+	case timelineNudge <- struct{}{}:
+	default:
+	}
+}
+
+// startTimeline records the working tree every interval, and after saves,
+// whenever it has changed. Read-only clones have no work to record.
+func startTimeline(interval time.Duration) {
+	if interval <= 0 || readOnly {
+		return
+	}
+	timelineNudge = make(chan struct{}, 1)
+	go runTimeline(interval)
+}
+
+func runTimeline(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-timelineNudge:
+		}
+		repoMu.RLock()
+		snapshot, recorded, err := recordTimeline()
+		repoMu.RUnlock()
+		switch {
+		case err != nil:
+			slog.Warn("failed to record timeline", "error", err)
+		case recorded:
+			slog.Debug("recorded timeline entry", "id", snapshot.ID, "label", snapshot.Label)
+		}
+	}
+}
+
+// getTimeline lists the automatic snapshots, newest first. Each can be
+// diffed against the working tree as timeline:<id>, or against another
+// entry by their commits.
+func getTimeline(c *gin.Context) {
+	entries, err := listSnapshotRefs(timelineRefPrefix)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list timeline", err)
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// postTimeline records a timeline entry now rather than waiting for the
+// next interval, responding with no content if nothing changed
+func postTimeline(c *gin.Context) {
+	snapshot, recorded, err := recordTimeline()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to record timeline", err)
+		return
+	}
+	if !recorded {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusCreated, snapshot)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTimeline(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/timeline", getTimeline)
+	r.POST("/api/timeline", postTimeline)
+	r.GET("/api/diffs/:id/files", getDiffFiles)
+	record := func() (int, Snapshot) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/timeline", nil))
+		var snapshot Snapshot
+		json.Unmarshal(w.Body.Bytes(), &snapshot)
+		return w.Code, snapshot
+	}
+
+	// The working tree has test2.ts modified
+	code, first := record()
+	if code != http.StatusCreated || first.Label != "test2.ts" {
+		t.Fatalf("first entry = %d %+v", code, first)
+	}
+	if code, _ := record(); code != http.StatusNoContent {
+		t.Errorf("unchanged working tree = %d, want 204", code)
+	}
+
+	os.WriteFile("test1.go", []byte("package main\n"), 0644)
+	code, second := record()
+	if code != http.StatusCreated || second.Label != "test1.go" {
+		t.Fatalf("second entry = %d %+v", code, second)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/timeline", nil))
+	var entries []Snapshot
+	json.Unmarshal(w.Body.Bytes(), &entries)
+	if len(entries) != 2 || entries[0].Commit != second.Commit || entries[1].Commit != first.Commit {
+		t.Errorf("timeline = %+v", entries)
+	}
+
+	// Changes since the first entry are the edit to test1.go
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diffs/timeline:"+first.ID+"/files", nil))
+	var files []FileInfo
+	json.Unmarshal(w.Body.Bytes(), &files)
+	if len(files) != 1 || files[0].Path != "test1.go" {
+		t.Errorf("changes since first entry = %+v", files)
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// toolDiffPrefix marks a diff ID showing a difftool or mergetool session's
+// local file against its remote one, as in tool:2
+const toolDiffPrefix = "tool:"
+
+// Tool session statuses. A mergetool exits successfully only once done.
+const (
+	toolPending = "pending"
+	toolDone    = "done"
+	toolFailed  = "failed"
+)
+
+// toolPollWait is how long differing tool waits on each request for the
+// session to be decided
+const toolPollWait = time.Minute
+
+// ToolFile is the content of one file passed to differing tool
+type ToolFile struct {
+	Content  string `json:"content"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// ToolRequest is the body of POST /api/tool-sessions. Absent sides, as
+// for a file added or deleted, are null.
+type ToolRequest struct {
+	// Name is the file's path, shown in place of the temporary copies
+	Name   string    `json:"name"`
+	Local  *ToolFile `json:"local"`
+	Remote *ToolFile `json:"remote"`
+	// Base and Merged are set for a mergetool: the merge base and the
+	// file as merged so far, conflict markers and all
+	Base   *ToolFile `json:"base,omitempty"`
+	Merged *ToolFile `json:"merged,omitempty"`
+}
+
+// ToolDecision is the body of POST /api/tool-sessions/:id/done. Result
+// replaces a mergetool's merged file, and is required to finish a merge
+// without failing it.
+type ToolDecision struct {
+	Failed bool      `json:"failed,omitempty"`
+	Result *ToolFile `json:"result,omitempty"`
+}
+
+// ToolSession is a file pair sent by git difftool or git mergetool,
+// waiting for the reviewer to finish with it
+type ToolSession struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Merge  bool   `json:"merge"`
+	Status string `json:"status"`
+	// Local, Remote, Base and Merged are commits holding each side as
+	// Name; Base and Merged are only set for a merge
+	Local   string    `json:"local"`
+	Remote  string    `json:"remote"`
+	Base    string    `json:"base,omitempty"`
+	Merged  string    `json:"merged,omitempty"`
+	Created time.Time `json:"created"`
+	Result  *ToolFile `json:"result,omitempty"`
+
+	repo string
+	done chan struct{}
+}
+
+var toolSessions = struct {
+	sync.Mutex
+	byID map[string]*ToolSession
+	next int
+}{byID: map[string]*ToolSession{}}
+
+// lookupToolSession returns the session with id made in the current
+// repository
+func lookupToolSession(id string) (*ToolSession, bool) {
+	toolSessions.Lock()
+	defer toolSessions.Unlock()
+	s, ok := toolSessions.byID[id]
+	if !ok || s.repo != gitRoot {
+		return nil, false
+	}
+	return s, true
+}
+
+// fileCommit writes a commit whose tree holds only data at path, or
+// nothing when f is nil
+func fileCommit(path string, f *ToolFile, message string) (string, error) {
+	tree := emptyTreeSHA
+	if f != nil {
+		data, err := encodeContent(f.Content, f.Encoding)
+		if err != nil {
+			return "", err
+		}
+		blob, err := runGitInput(data, "hash-object", "-w", "--stdin")
+		if err != nil {
+			return "", err
+		}
+		dir, err := os.MkdirTemp("", "differing-index-*")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(dir)
+		env := []string{"GIT_INDEX_FILE=" + filepath.Join(dir, "index")}
+		info := "100644," + strings.TrimSpace(string(blob)) + "," + path
+		if _, err := runGitEnv(env, nil, "update-index", "--add", "--cacheinfo", info); err != nil {
+			return "", err
+		}
+		output, err := runGitEnv(env, nil, "write-tree")
+		if err != nil {
+			return "", err
+		}
+		tree = strings.TrimSpace(string(output))
+	}
+	commit, err := runGit("commit-tree", tree, "-m", message)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(commit)), nil
+}
+
+// createToolSession stores each side of req as a commit so the pair can
+// be diffed like any other
+func createToolSession(req ToolRequest) (*ToolSession, error) {
+	s := &ToolSession{
+		Name:    req.Name,
+		Merge:   req.Merged != nil,
+		Status:  toolPending,
+		Created: time.Now(),
+		repo:    gitRoot,
+		done:    make(chan struct{}),
+	}
+	type side struct {
+		file *ToolFile
+		dst  *string
+		name string
+	}
+	sides := []side{{req.Local, &s.Local, "Local"}, {req.Remote, &s.Remote, "Remote"}}
+	if s.Merge {
+		sides = append(sides, side{req.Base, &s.Base, "Base"}, side{req.Merged, &s.Merged, "Merged"})
+	}
+	for _, side := range sides {
+		commit, err := fileCommit(s.Name, side.file, side.name)
+		if err != nil {
+			return nil, err
+		}
+		*side.dst = commit
+	}
+
+	toolSessions.Lock()
+	toolSessions.next++
+	s.ID = strconv.Itoa(toolSessions.next)
+	toolSessions.byID[s.ID] = s
+	toolSessions.Unlock()
+	return s, nil
+}
+
+// toolDiffInfos returns diff list entries for the pending tool sessions,
+// oldest first
+func toolDiffInfos() []DiffInfo {
+	toolSessions.Lock()
+	var pending []ToolSession
+	for _, s := range toolSessions.byID {
+		if s.repo == gitRoot && s.Status == toolPending {
+			pending = append(pending, *s)
+		}
+	}
+	toolSessions.Unlock()
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Created.Before(pending[j].Created) })
+
+	infos := make([]DiffInfo, 0, len(pending))
+	for _, s := range pending {
+		message := "Difftool: " + s.Name
+		if s.Merge {
+			message = "Mergetool: " + s.Name
+		}
+		info := DiffInfo{ID: toolDiffPrefix + s.ID, Message: message, Timestamp: s.Created}
+		output, _ := runGit("diff", "--numstat", "-z", s.Local, s.Remote)
+		info.Additions, info.Deletions, info.FilesCount = headlineDiffStat(string(output))
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// respondToolSession responds with s: 200 once done or failed, 202 while
+// pending
+func respondToolSession(c *gin.Context, s *ToolSession) {
+	toolSessions.Lock()
+	result := *s
+	toolSessions.Unlock()
+	if result.Status == toolPending {
+		c.JSON(http.StatusAccepted, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// postToolSession receives a file pair from differing tool. Like
+// postProposal it takes the repository only while recording.
+func postToolSession(c *gin.Context) {
+	var req ToolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	req.Name = repoPath(req.Name)
+	if req.Name == "" || escapesRepo(req.Name) {
+		respondError(c, http.StatusBadRequest, "invalid file name: "+req.Name, nil)
+		return
+	}
+	repoMu.RLock()
+	s, err := createToolSession(req)
+	repoMu.RUnlock()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to record files", err)
+		return
+	}
+	respondToolSession(c, s)
+}
+
+// getToolSession returns a session, waiting up to ?wait= milliseconds for
+// it to finish. Like getProposal it is outside the repository hold.
+func getToolSession(c *gin.Context) {
+	repoMu.RLock()
+	s, ok := lookupToolSession(c.Param("id"))
+	repoMu.RUnlock()
+	if !ok {
+		respondError(c, http.StatusNotFound, "No such tool session", nil)
+		return
+	}
+	if waitForDone(c, s.done) {
+		respondToolSession(c, s)
+	}
+}
+
+// getToolSessions lists the repository's tool sessions, newest first
+func getToolSessions(c *gin.Context) {
+	toolSessions.Lock()
+	list := []ToolSession{}
+	for _, s := range toolSessions.byID {
+		if s.repo == gitRoot {
+			list = append(list, *s)
+		}
+	}
+	toolSessions.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+	c.JSON(http.StatusOK, list)
+}
+
+// finishToolSession lets the waiting git difftool or mergetool exit,
+// unsuccessfully if failed is set. A mergetool exiting successfully tells
+// git the merged file is resolved, so it must be given the result.
+func finishToolSession(c *gin.Context) {
+	var req ToolDecision
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request", err)
+		return
+	}
+	s, ok := lookupToolSession(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, "No such tool session", nil)
+		return
+	}
+	if s.Merge && !req.Failed {
+		if req.Result == nil {
+			respondError(c, http.StatusBadRequest, "A merge needs a result, or failed to abandon it", nil)
+			return
+		}
+		if _, err := encodeContent(req.Result.Content, req.Result.Encoding); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+	toolSessions.Lock()
+	defer toolSessions.Unlock()
+	if s.Status != toolPending {
+		respondError(c, http.StatusConflict, "Tool session is already "+s.Status, nil)
+		return
+	}
+	s.Status = toolDone
+	if req.Failed {
+		s.Status = toolFailed
+	} else if s.Merge {
+		s.Result = req.Result
+	}
+	close(s.done)
+	c.JSON(http.StatusOK, *s)
+}
+
+// readToolFile reads a file passed by git, nil if it does not exist as
+// for the missing side of an added or deleted file
+func readToolFile(path string) (*ToolFile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := &ToolFile{}
+	f.Content, f.Encoding = decodeContent(data)
+	return f, nil
+}
+
+// runTool is differing tool, for git difftool and git mergetool:
+//
+//	differing tool <local> <remote> [base] [merged]
+//
+// It sends the files to the repository's server, starting one if needed,
+// and waits until the reviewer is done with them. A mergetool's result is
+// written to merged. The returned status is the process's exit code.
+func runTool(args []string, portSet bool, open bool) (int, error) {
+	if len(args) != 2 && len(args) != 4 {
+		return 2, errors.New("tool takes <local> <remote>, or <local> <remote> <base> <merged> to merge")
+	}
+	req := ToolRequest{Name: filepath.Base(args[1])}
+	var err error
+	if req.Local, err = readToolFile(args[0]); err != nil {
+		return 1, err
+	}
+	if req.Remote, err = readToolFile(args[1]); err != nil {
+		return 1, err
+	}
+	merged := ""
+	if len(args) == 4 {
+		merged = args[3]
+		if req.Base, err = readToolFile(args[2]); err != nil {
+			return 1, err
+		}
+		if req.Merged, err = readToolFile(merged); err != nil {
+			return 1, err
+		}
+		if req.Merged == nil {
+			req.Merged = &ToolFile{}
+		}
+	}
+	// The merged file, or a remote file in the worktree, is named by its
+	// path in the repository; git's temporary copies only by file name
+	named := args[1]
+	if merged != "" {
+		named = merged
+	}
+	if abs, err := filepath.Abs(named); err == nil {
+		if rel, err := filepath.Rel(gitRoot, abs); err == nil && !escapesRepo(filepath.ToSlash(rel)) {
+			req.Name = filepath.ToSlash(rel)
+		}
+	}
+
+	inst, ok := liveInstance(gitRoot)
+	if !ok {
+		if err := startDaemon(gitRoot, nil, portSet); err != nil {
+			return 1, err
+		}
+		if inst, ok = liveInstance(gitRoot); !ok {
+			return 1, errors.New("the server did not start")
+		}
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 1, err
+	}
+	resp, err := http.Post(inst.URL+"/api/tool-sessions", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 1, err
+	}
+	s, err := decodeToolSession(resp)
+	if err != nil {
+		return 1, err
+	}
+	link := inst.URL + Location{Commit: toolDiffPrefix + s.ID}.URL()
+	fmt.Printf("Reviewing %s at %s\n", s.Name, link)
+	if open {
+		openBrowser(link)
+	}
+
+	for s.Status == toolPending {
+		resp, err := http.Get(inst.URL + "/api/tool-sessions/" + s.ID + "?wait=" + strconv.FormatInt(toolPollWait.Milliseconds(), 10))
+		if err != nil {
+			return 1, err
+		}
+		if s, err = decodeToolSession(resp); err != nil {
+			return 1, err
+		}
+	}
+	if s.Status == toolFailed {
+		return 1, nil
+	}
+	if merged != "" && s.Result != nil {
+		data, err := encodeContent(s.Result.Content, s.Result.Encoding)
+		if err != nil {
+			return 1, err
+		}
+		if err := os.WriteFile(merged, data, 0644); err != nil {
+			return 1, err
+		}
+	}
+	return 0, nil
+}
+
+// decodeToolSession reads a tool session from a server response
+func decodeToolSession(resp *http.Response) (ToolSession, error) {
+	defer resp.Body.Close()
+	var s ToolSession
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return s, fmt.Errorf("server returned %s", resp.Status)
+	}
+	err := json.NewDecoder(resp.Body).Decode(&s)
+	return s, err
+}
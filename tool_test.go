@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTool(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+
+	oldPath, oldSelf := instancesPath, selfInstance
+	defer func() { instancesPath, selfInstance = oldPath, oldSelf }()
+	instancesPath = filepath.Join(t.TempDir(), "instances.json")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/repo-info", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"path": gitRoot})
+	})
+	r.POST("/api/tool-sessions", postToolSession)
+	r.GET("/api/tool-sessions/:id", getToolSession)
+	r.POST("/api/tool-sessions/:id/done", finishToolSession)
+	r.GET("/api/diffs/:id/files", getDiffFiles)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	registerSelf(gitRoot, srv.URL)
+
+	// git passes temporary copies of each side, and the worktree file to
+	// write the merge to
+	tmp := t.TempDir()
+	local, remote, base := filepath.Join(tmp, "LOCAL"), filepath.Join(tmp, "REMOTE"), filepath.Join(tmp, "BASE")
+	os.WriteFile(local, []byte("ours\n"), 0644)
+	os.WriteFile(remote, []byte("theirs\n"), 0644)
+	os.WriteFile(base, []byte("base\n"), 0644)
+	os.WriteFile("test1.go", []byte("<<<<<<< ours\n"), 0644)
+
+	// pending waits for the tool to send its files
+	pending := func() *ToolSession {
+		t.Helper()
+		for range 100 {
+			toolSessions.Lock()
+			for _, s := range toolSessions.byID {
+				if s.repo == gitRoot && s.Status == toolPending {
+					toolSessions.Unlock()
+					return s
+				}
+			}
+			toolSessions.Unlock()
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatal("tool never sent its files")
+		return nil
+	}
+	finish := func(id, body string) {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/api/tool-sessions/"+id+"/done", "application/json", strings.NewReader(body))
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("done = %v %v", resp, err)
+		}
+		resp.Body.Close()
+	}
+
+	type result struct {
+		code int
+		err  error
+	}
+	exited := make(chan result)
+	go func() {
+		code, err := runTool([]string{local, remote, base, "test1.go"}, false, false)
+		exited <- result{code, err}
+	}()
+	s := pending()
+	if s.Name != "test1.go" || !s.Merge {
+		t.Errorf("session = %+v, want a merge of test1.go", s)
+	}
+	resp, err := http.Get(srv.URL + "/api/diffs/tool:" + s.ID + "/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []FileInfo
+	json.NewDecoder(resp.Body).Decode(&files)
+	resp.Body.Close()
+	if len(files) != 1 || files[0].Path != "test1.go" || files[0].Status != "modified" {
+		t.Errorf("session files = %+v", files)
+	}
+
+	// A merge cannot be finished without its result
+	resp, err = http.Post(srv.URL+"/api/tool-sessions/"+s.ID+"/done", "application/json", strings.NewReader(`{}`))
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("merge done without a result = %v %v, want 400", resp, err)
+	}
+	resp.Body.Close()
+	finish(s.ID, `{"result":{"content":"merged\n"}}`)
+	if res := <-exited; res.code != 0 || res.err != nil {
+		t.Errorf("mergetool exited %d, %v", res.code, res.err)
+	}
+	if data, _ := os.ReadFile("test1.go"); string(data) != "merged\n" {
+		t.Errorf("merged file = %q", data)
+	}
+
+	// A difftool of an added file, abandoned in the UI, fails
+	go func() {
+		code, err := runTool([]string{filepath.Join(tmp, "missing"), remote}, false, false)
+		exited <- result{code, err}
+	}()
+	s = pending()
+	if s.Merge || s.Name != "REMOTE" {
+		t.Errorf("session = %+v, want a diff of REMOTE", s)
+	}
+	finish(s.ID, `{"failed":true}`)
+	if res := <-exited; res.code != 1 || res.err != nil {
+		t.Errorf("failed difftool exited %d, %v", res.code, res.err)
+	}
+}
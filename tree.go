@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TreeNode is a directory or file in the changed-file tree. Directories
+// aggregate the counts of everything beneath them.
+type TreeNode struct {
+	Name       string      `json:"name"`
+	Path       string      `json:"path"`
+	Type       string      `json:"type"` // dir or file
+	File       *FileInfo   `json:"file,omitempty"`
+	Children   []*TreeNode `json:"children,omitempty"`
+	FilesCount int         `json:"filesCount"`
+	Additions  int         `json:"additions"`
+	Deletions  int         `json:"deletions"`
+}
+
+func getDiffTree(c *gin.Context) {
+	diffID := c.Param("id")
+
+	opts, err := diffOptionsFromQuery(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	spec, ok := diffFromRequest(c)
+	if !ok {
+		return
+	}
+
+	files, err := listDiffFiles(c.Request.Context(), spec, opts, pathspecsFromQuery(c))
+	if err != nil {
+		slog.Error("git diff failed", "diff", diffID, "error", err)
+		respondError(c, http.StatusInternalServerError, "Failed to get diff files", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, buildFileTree(files))
+}
+
+// buildFileTree nests files under their directories. Chains of directories
+// with a single subdirectory and no files are compacted into one node
+// ("src/main/java") so deep package paths don't need several clicks.
+func buildFileTree(files []FileInfo) *TreeNode {
+	root := &TreeNode{Type: "dir"}
+	for i := range files {
+		file := &files[i]
+		node := root
+		parts := strings.Split(file.Path, "/")
+		for depth, part := range parts[:len(parts)-1] {
+			node = node.child(part, strings.Join(parts[:depth+1], "/"))
+		}
+		node.Children = append(node.Children, &TreeNode{
+			Name:       parts[len(parts)-1],
+			Path:       file.Path,
+			Type:       "file",
+			File:       file,
+			FilesCount: 1,
+			Additions:  file.Additions,
+			Deletions:  file.Deletions,
+		})
+	}
+	root.finish()
+	for i, child := range root.Children {
+		root.Children[i] = child.compact()
+	}
+	return root
+}
+
+// child returns the named subdirectory, creating it if needed
+func (n *TreeNode) child(name, path string) *TreeNode {
+	for _, c := range n.Children {
+		if c.Type == "dir" && c.Name == name {
+			return c
+		}
+	}
+	c := &TreeNode{Name: name, Path: path, Type: "dir"}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// finish sums counts up the tree and sorts directories before files
+func (n *TreeNode) finish() {
+	if n.Type != "dir" {
+		return
+	}
+	n.FilesCount, n.Additions, n.Deletions = 0, 0, 0
+	for _, c := range n.Children {
+		c.finish()
+		n.FilesCount += c.FilesCount
+		n.Additions += c.Additions
+		n.Deletions += c.Deletions
+	}
+	sort.Slice(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if a.Type != b.Type {
+			return a.Type == "dir"
+		}
+		return a.Name < b.Name
+	})
+}
+
+// compact merges a directory with its only child when that child is also a directory
+func (n *TreeNode) compact() *TreeNode {
+	for n.Type == "dir" && len(n.Children) == 1 && n.Children[0].Type == "dir" {
+		only := n.Children[0]
+		only.Name = n.Name + "/" + only.Name
+		n = only
+	}
+	for i, c := range n.Children {
+		n.Children[i] = c.compact()
+	}
+	return n
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestBuildFileTree(t *testing.T) {
+	files := []FileInfo{
+		{Path: "README.md", Status: "modified", Additions: 1, Deletions: 1},
+		{Path: "src/main/java/App.java", Status: "added", Additions: 10},
+		{Path: "src/main/java/Util.java", Status: "modified", Additions: 2, Deletions: 3},
+		{Path: "web/index.ts", Status: "deleted", Deletions: 5},
+		{Path: "web/lib/a.ts", Status: "modified", Additions: 4},
+	}
+
+	root := buildFileTree(files)
+	if root.FilesCount != 5 || root.Additions != 17 || root.Deletions != 9 {
+		t.Errorf("root counts = %d files +%d -%d", root.FilesCount, root.Additions, root.Deletions)
+	}
+
+	// Directories sort before files
+	names := []string{}
+	for _, c := range root.Children {
+		names = append(names, c.Name)
+	}
+	want := []string{"src/main/java", "web", "README.md"}
+	if len(names) != len(want) {
+		t.Fatalf("root children = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("root children = %v, want %v", names, want)
+			break
+		}
+	}
+
+	java := root.Children[0]
+	if java.Path != "src/main/java" || java.FilesCount != 2 || java.Additions != 12 || java.Deletions != 3 {
+		t.Errorf("compacted dir = %+v", java)
+	}
+
+	web := root.Children[1]
+	if len(web.Children) != 2 || web.Children[0].Name != "lib" || web.Children[1].File == nil {
+		t.Errorf("web children = %+v", web.Children)
+	}
+	if web.Children[1].File.Status != "deleted" {
+		t.Errorf("web/index.ts status = %q", web.Children[1].File.Status)
+	}
+}
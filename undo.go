@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUndo bounds how many actions are remembered for POST /api/undo
+const maxUndo = 50
+
+// maxUndoBytes bounds the file content save entries keep; the oldest
+// saves are forgotten first, leaving history changes undoable
+const maxUndoBytes = 64 << 20
+
+// undoEntry is the state from before one mutating action, enough to put
+// it back. A history entry moves the branch back to beforeHead; a save
+// entry writes before back over the file.
+type undoEntry struct {
+	repo   string
+	action string
+	// path and before/after content are set for file saves
+	path          string
+	before, after []byte
+	// beforeHead and afterHead are set for history changes
+	beforeHead, afterHead string
+}
+
+// UndoResult describes the action POST /api/undo reverted
+type UndoResult struct {
+	// Action is save, or the history action: drop, squash, autosquash,
+	// fixup, split, rebase, merge, or am
+	Action string `json:"action"`
+	Path   string `json:"path,omitempty"`
+	Head   string `json:"head,omitempty"`
+	// Remaining is how many earlier actions can still be undone
+	Remaining int `json:"remaining"`
+}
+
+// undoLog is the actions performed through differing, most recent last.
+// Entries are kept per repository so switching repositories does not undo
+// the wrong one.
+var undoLog struct {
+	mu      sync.Mutex
+	entries []undoEntry
+}
+
+func pushUndo(entry undoEntry) {
+	entry.repo = gitRoot
+	undoLog.mu.Lock()
+	defer undoLog.mu.Unlock()
+	undoLog.entries = append(undoLog.entries, entry)
+	trimUndo()
+}
+
+// trimUndo drops the oldest entries beyond maxUndo, then the oldest saves
+// until the content kept fits in maxUndoBytes. undoLog.mu must be held.
+func trimUndo() {
+	if len(undoLog.entries) > maxUndo {
+		undoLog.entries = undoLog.entries[len(undoLog.entries)-maxUndo:]
+	}
+	size := 0
+	for _, e := range undoLog.entries {
+		size += len(e.before) + len(e.after)
+	}
+	for i := 0; size > maxUndoBytes && i < len(undoLog.entries); {
+		if e := undoLog.entries[i]; e.action == "save" {
+			size -= len(e.before) + len(e.after)
+			undoLog.entries = append(undoLog.entries[:i], undoLog.entries[i+1:]...)
+			continue
+		}
+		i++
+	}
+}
+
+// recordSave remembers a file's content from before a save. The editor
+// saves as the user types, so a save continuing the repository's last
+// entry, a save of the same file, extends that entry instead: the run of
+// saves is undone together, back to the content before the first.
+func recordSave(path string, before, after []byte) {
+	undoLog.mu.Lock()
+	for i := len(undoLog.entries) - 1; i >= 0; i-- {
+		last := &undoLog.entries[i]
+		if last.repo != gitRoot {
+			continue
+		}
+		if last.action == "save" && last.path == path && bytes.Equal(last.after, before) {
+			last.after = after
+			trimUndo()
+			undoLog.mu.Unlock()
+			return
+		}
+		break
+	}
+	undoLog.mu.Unlock()
+	pushUndo(undoEntry{action: "save", path: path, before: before, after: after})
+}
+
+// recordHistory remembers where the branch was before action rewrote or
+// extended it. before is usually previousHead(), read once the action has
+// finished; nothing is recorded if it is unknown.
+func recordHistory(action, before string) {
+	after := currentHead()
+	if before == "" || after == "" || before == after {
+		return
+	}
+	pushUndo(undoEntry{action: action, beforeHead: before, afterHead: after})
+}
+
+// previousHead returns where the current branch pointed before its last
+// update, from the reflog. A rebase or split updates the branch once when
+// it finishes, however many commits it replays. With HEAD detached,
+// ORIG_HEAD is the best record git keeps.
+func previousHead() string {
+	if sha, err := resolveRev("@{1}"); err == nil {
+		return sha
+	}
+	sha, _ := resolveRev("ORIG_HEAD")
+	return sha
+}
+
+// popUndo removes and returns the most recent entry for the current
+// repository, with how many remain
+func popUndo() (undoEntry, int, bool) {
+	undoLog.mu.Lock()
+	defer undoLog.mu.Unlock()
+	remaining := 0
+	for i := len(undoLog.entries) - 1; i >= 0; i-- {
+		if undoLog.entries[i].repo != gitRoot {
+			continue
+		}
+		entry := undoLog.entries[i]
+		undoLog.entries = append(undoLog.entries[:i], undoLog.entries[i+1:]...)
+		for _, e := range undoLog.entries {
+			if e.repo == gitRoot {
+				remaining++
+			}
+		}
+		return entry, remaining, true
+	}
+	return undoEntry{}, 0, false
+}
+
+// undoEntryBack restores the entry it was popped from, when undoing it
+// failed and it may be retried
+func undoEntryBack(entry undoEntry) {
+	undoLog.mu.Lock()
+	defer undoLog.mu.Unlock()
+	undoLog.entries = append(undoLog.entries, entry)
+}
+
+// postUndo reverts the most recent action performed through differing.
+// It refuses when the file or branch has changed since, rather than
+// discarding work done elsewhere.
+func postUndo(c *gin.Context) {
+	entry, remaining, ok := popUndo()
+	if !ok {
+		respondError(c, http.StatusNotFound, "Nothing to undo", nil)
+		return
+	}
+	result := UndoResult{Action: entry.action, Remaining: remaining}
+	if entry.path != "" {
+		status, err := undoSave(entry)
+		if err != nil {
+			undoEntryBack(entry)
+			respondError(c, status, err.Error(), err)
+			return
+		}
+		result.Path = entry.path
+		emitEvent(eventFileSaved, map[string]string{"path": entry.path})
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	if op := operationInProgress(); op != "" {
+		undoEntryBack(entry)
+		respondError(c, http.StatusConflict, "Finish or abort the "+op+" first", nil)
+		return
+	}
+	if head := currentHead(); head != entry.afterHead {
+		undoEntryBack(entry)
+		respondError(c, http.StatusConflict, "HEAD has moved since the "+entry.action+"; undo it with git reset", nil)
+		return
+	}
+	// --keep carries uncommitted changes across, refusing if they touch
+	// files the reset would change
+	if _, err := runGitContext(c.Request.Context(), "reset", "--quiet", "--keep", entry.beforeHead); err != nil {
+		undoEntryBack(entry)
+		respondError(c, http.StatusConflict, "Failed to reset the branch", err)
+		return
+	}
+	result.Head = currentHead()
+	emitEvent(eventHistoryRewritten, map[string]string{"commit": entry.afterHead, "action": "undo " + entry.action})
+	c.JSON(http.StatusOK, result)
+}
+
+// undoSave writes a file's content from before a save back, if nothing
+// else has written to it since
+func undoSave(entry undoEntry) (int, error) {
+	if err := validateRepoPath(entry.path); err != nil {
+		return http.StatusForbidden, err
+	}
+	current, err := secureRoot.ReadFile(entry.path)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !bytes.Equal(current, entry.after) {
+		return http.StatusConflict, fmt.Errorf("%s has changed since it was saved", entry.path)
+	}
+	file, err := secureRoot.OpenFile(entry.path, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer file.Close()
+	if _, err := file.Write(entry.before); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	lspFileSaved(entry.path, string(entry.before))
+	return http.StatusOK, nil
+}
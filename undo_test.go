@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUndo(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	oldRoot := gitRoot
+	defer func() { gitRoot = oldRoot }()
+	gitRoot = repoDir
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { undoLog.entries = nil }()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/file-save/:id/*filepath", saveFile)
+	r.POST("/api/commits/:commit/drop", dropCommit)
+	r.POST("/api/undo", postUndo)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+	undo := func() (int, UndoResult) {
+		t.Helper()
+		w := post("/api/undo", "")
+		var result UndoResult
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result
+	}
+
+	if code, _ := undo(); code != http.StatusNotFound {
+		t.Errorf("undo with nothing done = %d, want 404", code)
+	}
+
+	// Dropping a commit is undone by moving the branch back
+	runGit("checkout", "--", ".")
+	head := currentHead()
+	if w := post("/api/commits/HEAD/drop", ""); w.Code != http.StatusOK {
+		t.Fatalf("drop = %d: %s", w.Code, w.Body)
+	}
+
+	// A save after it is undone first, with the saves made while typing
+	// undone together
+	path := filepath.Join(repoDir, "test1.go")
+	original, _ := os.ReadFile(path)
+	for _, content := range []string{"package main\n// s\n", "package main\n// saved\n"} {
+		if w := post("/api/file-save/working/test1.go", `{"content":"`+strings.ReplaceAll(content, "\n", `\n`)+`"}`); w.Code != http.StatusOK {
+			t.Fatalf("save = %d: %s", w.Code, w.Body)
+		}
+	}
+	code, result := undo()
+	if code != http.StatusOK || result.Action != "save" || result.Path != "test1.go" || result.Remaining != 1 {
+		t.Fatalf("undo save = %d %+v", code, result)
+	}
+	if content, _ := os.ReadFile(path); string(content) != string(original) {
+		t.Errorf("content after undo = %q, want %q", content, original)
+	}
+
+	code, result = undo()
+	if code != http.StatusOK || result.Action != "drop" || result.Head != head {
+		t.Fatalf("undo drop = %d %+v, want head %s", code, result, head)
+	}
+
+	// A save overwritten since is left alone
+	post("/api/file-save/working/test1.go", `{"content":"package main\n// saved\n"}`)
+	os.WriteFile(path, []byte("package main\n// edited elsewhere\n"), 0644)
+	if code, _ := undo(); code != http.StatusConflict {
+		t.Errorf("undo of an overwritten save = %d, want 409", code)
+	}
+
+	// So is a branch that has moved on
+	undoLog.entries = nil
+	runGit("checkout", "--", ".")
+	post("/api/commits/HEAD/drop", "")
+	runGit("commit", "-q", "--allow-empty", "-m", "Later")
+	if code, _ := undo(); code != http.StatusConflict {
+		t.Errorf("undo after HEAD moved = %d, want 409", code)
+	}
+}
+
+func TestUndoLimits(t *testing.T) {
+	defer func() { undoLog.entries = nil }()
+	undoLog.entries = nil
+
+	// Saves are forgotten to stay within maxUndoBytes, history changes
+	// are kept
+	big := make([]byte, maxUndoBytes/4)
+	pushUndo(undoEntry{action: "drop", beforeHead: "a", afterHead: "b"})
+	for _, path := range []string{"a.bin", "b.bin", "c.bin"} {
+		recordSave(path, big, big)
+	}
+	if len(undoLog.entries) != 3 || undoLog.entries[0].action != "drop" || undoLog.entries[1].path != "b.bin" {
+		t.Errorf("entries after large saves = %d, first %q", len(undoLog.entries), undoLog.entries[0].action)
+	}
+}
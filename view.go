@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// devNull is the path unified diffs give the missing side of an added or
+// deleted file
+const devNull = "/dev/null"
+
+// readPatchFile reads the patch named on the command line, with "-"
+// meaning stdin
+func readPatchFile(name string) (*staticDiff, error) {
+	in := io.Reader(os.Stdin)
+	label := "stdin"
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in, label = f, name
+	}
+	files, err := parseUnifiedDiff(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no file changes found in the patch")
+	}
+	return newStaticDiff(label, files), nil
+}
+
+// patchFile collects one file's section of a patch while it is parsed
+type patchFile struct {
+	oldPath, newPath string
+	// git is set for sections that start with a diff --git header, whose
+	// paths always carry a/ and b/ prefixes
+	git              bool
+	added, deleted   bool
+	binary           bool
+	hunks            []Hunk
+	oldLeft, newLeft int // lines still expected in the current hunk
+}
+
+// parseUnifiedDiff parses the output of git diff, git log -p, git
+// format-patch, or diff -u. Lines outside file sections, like commit
+// headers, are ignored. Only the lines the hunks show are known, so each
+// file's old and new content is those lines alone.
+func parseUnifiedDiff(r io.Reader) ([]staticFile, error) {
+	var files []staticFile
+	var cur *patchFile
+	flush := func() {
+		if cur != nil {
+			if f, ok := cur.staticFile(); ok {
+				files = append(files, f)
+			}
+		}
+		cur = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if cur != nil && (cur.oldLeft > 0 || cur.newLeft > 0) {
+			cur.hunkLine(line)
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			cur = &patchFile{git: true}
+			cur.oldPath, cur.newPath = splitGitHeader(strings.TrimPrefix(line, "diff --git "))
+		case strings.HasPrefix(line, "--- "):
+			// Plain diff -u output has no header line before each file
+			if cur == nil || len(cur.hunks) > 0 {
+				flush()
+				cur = &patchFile{}
+			}
+			cur.oldPath = patchPath(strings.TrimPrefix(line, "--- "))
+		case cur == nil:
+			// Commit headers and other text between files
+		case strings.HasPrefix(line, "+++ "):
+			cur.newPath = patchPath(strings.TrimPrefix(line, "+++ "))
+		case strings.HasPrefix(line, "@@ "):
+			m := fullHunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, errors.New("malformed hunk header: " + line)
+			}
+			h := Hunk{OldStart: atoiDefault(m[1]), OldLines: atoiDefault(m[2]), NewStart: atoiDefault(m[3]), NewLines: atoiDefault(m[4]), Header: m[5]}
+			cur.hunks = append(cur.hunks, h)
+			cur.oldLeft, cur.newLeft = h.OldLines, h.NewLines
+		case strings.HasPrefix(line, `\`) && len(cur.hunks) > 0:
+			// "\ No newline at end of file" after a hunk's last line
+			h := &cur.hunks[len(cur.hunks)-1]
+			h.Lines = append(h.Lines, line)
+		case strings.HasPrefix(line, "new file mode"):
+			cur.added = true
+		case strings.HasPrefix(line, "deleted file mode"):
+			cur.deleted = true
+		case strings.HasPrefix(line, "rename from "), strings.HasPrefix(line, "copy from "):
+			_, from, _ := strings.Cut(line, " from ")
+			cur.oldPath = "a/" + unquotePath(from)
+		case strings.HasPrefix(line, "rename to "), strings.HasPrefix(line, "copy to "):
+			_, to, _ := strings.Cut(line, " to ")
+			cur.newPath = "b/" + unquotePath(to)
+		case strings.HasPrefix(line, "Binary files "), line == "GIT binary patch":
+			cur.binary = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return files, nil
+}
+
+// hunkLine adds a line to the current hunk. Some tools strip the
+// trailing space from empty context lines, so an empty line is context.
+func (p *patchFile) hunkLine(line string) {
+	if line == "" {
+		line = " "
+	}
+	h := &p.hunks[len(p.hunks)-1]
+	h.Lines = append(h.Lines, line)
+	switch line[0] {
+	case ' ':
+		p.oldLeft--
+		p.newLeft--
+	case '-':
+		p.oldLeft--
+	case '+':
+		p.newLeft--
+	}
+}
+
+// staticFile converts the section into a diff entry, reporting false when
+// it named no file
+func (p *patchFile) staticFile() (staticFile, bool) {
+	oldPath, newPath := p.oldPath, p.newPath
+	// Strip the a/ and b/ prefixes git adds, and that diff -u output made
+	// from such trees has too
+	strip := p.git || (hasPatchPrefix(oldPath, "a/") && hasPatchPrefix(newPath, "b/"))
+	if strip {
+		oldPath = strings.TrimPrefix(oldPath, "a/")
+		newPath = strings.TrimPrefix(newPath, "b/")
+	}
+
+	f := staticFile{hunks: p.hunks, binary: p.binary}
+	switch {
+	case p.added || oldPath == devNull:
+		f.Path, f.Status = newPath, "added"
+	case p.deleted || newPath == devNull:
+		f.Path, f.Status = oldPath, "deleted"
+	default:
+		f.Path, f.Status = newPath, "modified"
+	}
+	if f.Path == "" || f.Path == devNull {
+		return f, false
+	}
+	f.oldExists = f.Status != "added"
+	f.newExists = f.Status != "deleted"
+
+	var oldText, newText strings.Builder
+	for _, h := range p.hunks {
+		// last records which sides the previous line went to, for the
+		// no-newline marker
+		var last byte
+		for _, line := range h.Lines {
+			text := line[1:] + "\n"
+			switch line[0] {
+			case ' ':
+				oldText.WriteString(text)
+				newText.WriteString(text)
+			case '-':
+				oldText.WriteString(text)
+				f.Deletions++
+			case '+':
+				newText.WriteString(text)
+				f.Additions++
+			case '\\':
+				if last != '+' {
+					trimNewline(&oldText)
+				}
+				if last != '-' {
+					trimNewline(&newText)
+				}
+			}
+			last = line[0]
+		}
+	}
+	f.old, f.new = []byte(oldText.String()), []byte(newText.String())
+	return f, true
+}
+
+// hasPatchPrefix reports whether a patch path has prefix, counting
+// /dev/null as having any prefix
+func hasPatchPrefix(path, prefix string) bool {
+	return path == devNull || strings.HasPrefix(path, prefix)
+}
+
+func trimNewline(b *strings.Builder) {
+	s := strings.TrimSuffix(b.String(), "\n")
+	b.Reset()
+	b.WriteString(s)
+}
+
+// splitGitHeader splits the paths of a "diff --git a/x b/x" line. Paths
+// with spaces are ambiguous there; the ---, +++, and rename lines that
+// follow take precedence when present.
+func splitGitHeader(paths string) (oldPath, newPath string) {
+	if strings.HasPrefix(paths, `"`) {
+		if old, rest, err := unquotePrefix(paths); err == nil {
+			return old, unquotePath(strings.TrimPrefix(rest, " "))
+		}
+	}
+	if i := strings.LastIndex(paths, " b/"); i >= 0 {
+		return paths[:i], unquotePath(paths[i+1:])
+	}
+	return "", ""
+}
+
+// patchPath returns the path of a ---/+++ line, dropping the timestamp
+// diff -u appends after a tab
+func patchPath(s string) string {
+	s, _, _ = strings.Cut(s, "\t")
+	return unquotePath(s)
+}
+
+// unquotePath decodes a path git quoted because it has special characters
+func unquotePath(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		if unquoted, err := strconv.Unquote(s); err == nil {
+			return unquoted
+		}
+	}
+	return s
+}
+
+// unquotePrefix decodes the quoted string at the start of s and returns
+// it with the rest of s
+func unquotePrefix(s string) (string, string, error) {
+	prefix, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", err
+	}
+	unquoted, err := strconv.Unquote(prefix)
+	return unquoted, s[len(prefix):], err
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseUnifiedDiff(t *testing.T) {
+	patch := `commit 0123456789abcdef
+Author: A U Thor <author@example.com>
+
+    Change things
+
+diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,4 @@ package main
+ package main
+
+--- old comment
++// new comment
+ func main() {}
+diff --git a/added.txt b/added.txt
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/added.txt
+@@ -0,0 +1 @@
++no newline
+\ No newline at end of file
+diff --git a/old name.txt b/new name.txt
+similarity index 100%
+rename from old name.txt
+rename to new name.txt
+diff --git a/gone.bin b/gone.bin
+deleted file mode 100644
+index 4444444..0000000
+Binary files a/gone.bin and /dev/null differ
+`
+	files, err := parseUnifiedDiff(strings.NewReader(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileInfo{
+		{Path: "main.go", Status: "modified", Additions: 1, Deletions: 1},
+		{Path: "added.txt", Status: "added", Additions: 1},
+		{Path: "new name.txt", Status: "modified"},
+		{Path: "gone.bin", Status: "deleted"},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("got %d files, want %d: %+v", len(files), len(want), files)
+	}
+	for i, f := range files {
+		if f.FileInfo != want[i] {
+			t.Errorf("file %d = %+v, want %+v", i, f.FileInfo, want[i])
+		}
+	}
+
+	// The deletion of "-- old comment" must not be taken for a file header
+	if got, want := string(files[0].old), "package main\n\n-- old comment\nfunc main() {}\n"; got != want {
+		t.Errorf("old = %q, want %q", got, want)
+	}
+	if got, want := string(files[0].new), "package main\n\n// new comment\nfunc main() {}\n"; got != want {
+		t.Errorf("new = %q, want %q", got, want)
+	}
+	if got := string(files[1].new); got != "no newline" {
+		t.Errorf("added content = %q", got)
+	}
+	if files[1].oldExists || !files[1].newExists {
+		t.Errorf("added file exists = %v/%v", files[1].oldExists, files[1].newExists)
+	}
+	if fd := files[3].fileDiff(false, false); !fd.Binary || fd.NewExists {
+		t.Errorf("binary deletion = %+v", fd)
+	}
+	if fd := files[0].fileDiff(false, false); fd.Hunks == nil || len(fd.Hunks.Hunks) != 1 || fd.Hunks.Hunks[0].Header != "package main" {
+		t.Errorf("hunks = %+v", fd.Hunks)
+	}
+}
+
+func TestParseUnifiedDiffPlain(t *testing.T) {
+	patch := "--- dir1/x.txt\t2024-01-01 00:00:00.000000000 +0000\n" +
+		"+++ dir2/x.txt\t2024-01-02 00:00:00.000000000 +0000\n" +
+		"@@ -1 +1 @@\n-a\n+b\n" +
+		"--- dir1/y.txt\t2024-01-01 00:00:00.000000000 +0000\n" +
+		"+++ dir2/y.txt\t2024-01-02 00:00:00.000000000 +0000\n" +
+		"@@ -1,2 +1 @@\n-c\n d\n"
+	files, err := parseUnifiedDiff(strings.NewReader(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Path != "dir2/x.txt" || files[1].Path != "dir2/y.txt" || files[1].Deletions != 1 {
+		t.Fatalf("files = %+v", files)
+	}
+}
+
+func TestParseUnifiedDiffGitOutput(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) []byte {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		return out
+	}
+	git("init", "-q")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"), 0644)
+	git("add", ".")
+	git("commit", "-qm", "first")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n"), 0644)
+
+	files, err := parseUnifiedDiff(strings.NewReader(string(git("diff"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Additions != 2 || files[0].Deletions != 2 || len(files[0].hunks) != 2 {
+		t.Fatalf("files = %+v", files)
+	}
+}
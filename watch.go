@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// watcher reports changes to the repository as links into a running
+// server: each new commit, and each change to the working tree. With the
+// timeline on, a change is a timeline entry diffed against the one before
+// it; otherwise it is the working changes, kept only in memory.
+type watcher struct {
+	url string
+	out io.Writer
+	// open opens the browser at the first change reported
+	open bool
+	// timeline records each change in the timeline, as -timeline does
+	timeline bool
+	// head and entry are the last commit and timeline entry reported, and
+	// tree the last working tree seen with the timeline off
+	head, entry, tree string
+}
+
+// newWatcher starts watching from the repository's current state, so only
+// later changes are reported
+func newWatcher(url string, out io.Writer, open, timeline bool) *watcher {
+	w := &watcher{url: url, out: out, open: open, timeline: timeline, head: currentHead()}
+	if entries, err := listSnapshotRefs(timelineRefPrefix); err == nil && len(entries) > 0 {
+		w.entry = entries[0].ID
+	}
+	return w
+}
+
+// check reports whatever changed since the last check, recording the
+// working tree in the timeline when it is on
+func (w *watcher) check() error {
+	var links []string
+	head := currentHead()
+	if head != w.head {
+		commits, err := w.newCommits(head)
+		if err != nil {
+			return err
+		}
+		links = append(links, commits...)
+		w.head = head
+	}
+
+	var changes []string
+	var err error
+	if w.timeline {
+		if _, _, err := recordTimeline(); err != nil {
+			return err
+		}
+		changes, err = w.newEntries()
+	} else {
+		changes, err = w.newWorkingChanges()
+	}
+	if err != nil {
+		return err
+	}
+	links = append(links, changes...)
+
+	if w.open && len(links) > 0 {
+		w.open = false
+		go openBrowser(links[len(links)-1])
+	}
+	return nil
+}
+
+// newCommits prints the commits between the last head seen and head,
+// returning their links oldest first. When history was rewritten only
+// the new head is reported.
+func (w *watcher) newCommits(head string) ([]string, error) {
+	if head == "" {
+		return nil, nil
+	}
+	shas := []string{head}
+	if w.head != "" {
+		if _, err := runGit("merge-base", "--is-ancestor", w.head, head); err == nil {
+			output, err := runGit("rev-list", "--reverse", w.head+".."+head)
+			if err != nil {
+				return nil, err
+			}
+			shas = strings.Fields(string(output))
+		}
+	}
+	var links []string
+	for _, sha := range shas {
+		subject, err := runGit("log", "-1", "--format=%s", sha)
+		if err != nil {
+			return nil, err
+		}
+		link := w.url + Location{Commit: sha}.URL()
+		w.printf("commit %s %s\n  %s\n", sha[:min(len(sha), 7)], strings.TrimSpace(string(subject)), link)
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// newEntries prints the timeline entries recorded since the last check,
+// whoever recorded them, returning their links oldest first. Each links
+// to its own step: the entry diffed against the one before it, opened at
+// the first file changed.
+func (w *watcher) newEntries() ([]string, error) {
+	entries, err := listSnapshotRefs(timelineRefPrefix)
+	if err != nil {
+		return nil, err
+	}
+	last, _ := strconv.ParseInt(w.entry, 10, 64)
+	var links []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if id, _ := strconv.ParseInt(entry.ID, 10, 64); id <= last {
+			continue
+		}
+		w.entry = entry.ID
+		previous := entry.Head
+		if i+1 < len(entries) {
+			previous = entries[i+1].Commit
+		}
+		if previous == "" {
+			previous = emptyTreeSHA
+		}
+		// A working tree that matches a new commit leaves nothing to show
+		// beyond the commit itself
+		if entry.Head != "" {
+			if _, err := runGit("diff", "--quiet", entry.Head, entry.Commit); err == nil {
+				continue
+			}
+		}
+		output, err := runGit("diff", "--name-only", "-z", previous, entry.Commit)
+		if err != nil {
+			return nil, err
+		}
+		paths := strings.FieldsFunc(string(output), func(r rune) bool { return r == 0 })
+		if len(paths) == 0 {
+			continue
+		}
+		emitEvent(eventFilesChanged, map[string]string{
+			"entry": entry.ID, "path": paths[0], "count": strconv.Itoa(len(paths)),
+		})
+		link := w.url + Location{Commit: previous + ".." + entry.Commit, Path: paths[0]}.URL()
+		w.printf("%s %s\n  %s\n", entry.Created.Format(time.TimeOnly), entry.Label, link)
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// newWorkingChanges prints the working tree's change since the last
+// check, returning its link to the working changes at the first file
+// changed. The trees compared are written as objects nothing refers to,
+// so no refs are left behind.
+func (w *watcher) newWorkingChanges() ([]string, error) {
+	tree, err := workingTreeObject()
+	if err != nil || tree == w.tree {
+		return nil, err
+	}
+	// The first check is compared with HEAD, as the timeline's first
+	// entry is
+	previous := w.tree
+	if previous == "" {
+		previous = emptyTreeSHA
+		if output, err := runGit("rev-parse", "--verify", "--quiet", "HEAD^{tree}"); err == nil {
+			previous = strings.TrimSpace(string(output))
+		}
+	}
+	w.tree = tree
+	// A working tree that matches a new commit leaves nothing to show
+	// beyond the commit itself
+	if _, err := runGit("diff", "--quiet", "HEAD", tree); err == nil {
+		return nil, nil
+	}
+	output, err := runGit("diff", "--name-only", "-z", previous, tree)
+	if err != nil {
+		return nil, err
+	}
+	paths := strings.FieldsFunc(string(output), func(r rune) bool { return r == 0 })
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	emitEvent(eventFilesChanged, map[string]string{"path": paths[0], "count": strconv.Itoa(len(paths))})
+	link := w.url + Location{Commit: "working", Path: paths[0]}.URL()
+	w.printf("%s %s\n  %s\n", time.Now().Format(time.TimeOnly), describeChanges(previous, tree), link)
+	return []string{link}, nil
+}
+
+func (w *watcher) printf(format string, args ...any) {
+	fmt.Fprintf(w.out, format, args...)
+}
+
+// watchRepo checks for changes every interval until the process exits
+func watchRepo(w *watcher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		repoMu.RLock()
+		err := w.check()
+		repoMu.RUnlock()
+		if err != nil {
+			slog.Warn("failed to check for changes", "error", err)
+		}
+	}
+}
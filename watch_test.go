@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestWatcher(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	// The first check reports working changes not yet in the timeline
+	var out strings.Builder
+	w := newWatcher("http://localhost:3844", &out, false, true)
+	if err := w.check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if !strings.Contains(out.String(), "/f/test2.ts") {
+		t.Errorf("first check = %q, want the working tree's test2.ts", out.String())
+	}
+
+	out.Reset()
+	if err := w.check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("unchanged check = %q, want nothing", out.String())
+	}
+
+	// Each edit links to its own step, not everything since HEAD
+	os.WriteFile("test1.go", []byte("package main\n\nfunc hello() {}\n"), 0644)
+	if err := w.check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if !strings.Contains(out.String(), "/f/test1.go") || strings.Contains(out.String(), "test2.ts") {
+		t.Errorf("edit = %q, want only test1.go", out.String())
+	}
+
+	// A commit of everything is reported as the commit alone
+	out.Reset()
+	for _, args := range [][]string{{"add", "-A"}, {"commit", "-m", "Agent step"}} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	if err := w.check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 ||
+		!strings.Contains(lines[0], "Agent step") || !strings.HasSuffix(lines[1], "/c/"+currentHead()) {
+		t.Errorf("commit = %q", out.String())
+	}
+}
+
+func TestWatcherWithoutTimeline(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	// Changes are reported against the working tree seen last, without
+	// recording timeline entries
+	var out strings.Builder
+	w := newWatcher("http://localhost:3844", &out, false, false)
+	if err := w.check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if !strings.Contains(out.String(), "/c/working/f/test2.ts") {
+		t.Errorf("first check = %q, want the working tree's test2.ts", out.String())
+	}
+
+	out.Reset()
+	os.WriteFile("test1.go", []byte("package main\n\nfunc hello() {}\n"), 0644)
+	if err := w.check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if !strings.Contains(out.String(), "/f/test1.go") || strings.Contains(out.String(), "test2.ts") {
+		t.Errorf("edit = %q, want only test1.go", out.String())
+	}
+	if entries, err := listSnapshotRefs(timelineRefPrefix); err != nil || len(entries) != 0 {
+		t.Errorf("timeline = %+v, %v; want no entries", entries, err)
+	}
+}
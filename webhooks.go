@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Event names passed to emitEvent
+const (
+	eventFileSaved      = "file.saved"
+	eventNoteUpdated    = "note.updated"
+	eventNoteDeleted    = "note.deleted"
+	eventCommitApproved = "commit.approved"
+	// eventHistoryRewritten data names the commit and the action taken
+	eventHistoryRewritten = "history.rewritten"
+	// eventProposalCreated and eventProposalDecided data name the proposal
+	eventProposalCreated = "proposal.created"
+	eventProposalDecided = "proposal.decided"
+	// eventCommitCreated and eventCommitAmended data name the commit and
+	// the action that made it
+	eventCommitCreated = "commit.created"
+	eventCommitAmended = "commit.amended"
+	// eventFilesChanged data names the first path changed and how many
+	// paths changed, and the timeline entry recorded for the change when
+	// the timeline is on
+	eventFilesChanged = "files.changed"
+)
+
+// webhookTimeout bounds each delivery so a slow receiver cannot pile up
+// goroutines
+const webhookTimeout = 10 * time.Second
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// Event is the JSON payload posted to webhooks
+type Event struct {
+	Event string    `json:"event"`
+	Repo  string    `json:"repo"`
+	Time  time.Time `json:"time"`
+	Data  any       `json:"data,omitempty"`
+}
+
+// webhookURLs returns the URLs configured with
+// `git config --add differing.webhook <url>`
+func webhookURLs() []string {
+	output, err := runGit("config", "--get-all", "differing.webhook")
+	if err != nil {
+		// git config exits 1 when the key is unset
+		return nil
+	}
+	var urls []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			urls = append(urls, line)
+		}
+	}
+	return urls
+}
+
+// notificationsEnabled reports whether `git config differing.notify true`
+// asks for desktop notifications
+func notificationsEnabled() bool {
+	output, err := runGit("config", "--type=bool", "--get", "differing.notify")
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// emitEvent delivers an event to the configured webhooks and desktop
+// notifications in the background. Failures are logged, never returned.
+func emitEvent(name string, data any) {
+	if name == eventFileSaved {
+		nudgeTimeline()
+	}
+	event := Event{Event: name, Repo: gitRoot, Time: time.Now(), Data: data}
+	urls := webhookURLs()
+	notify := notificationsEnabled()
+	if len(urls) == 0 && !notify {
+		return
+	}
+	go func() {
+		for _, url := range urls {
+			if err := deliverWebhook(url, event); err != nil {
+				slog.Warn("webhook delivery failed", "url", url, "event", name, "error", err)
+			}
+		}
+		if notify {
+			if err := notifyDesktop("differing", describeEvent(event)); err != nil {
+				slog.Debug("desktop notification failed", "error", err)
+			}
+		}
+	}()
+}
+
+// deliverWebhook posts event to url as JSON
+func deliverWebhook(url string, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "differing")
+	req.Header.Set("X-Differing-Event", event.Event)
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return nil
+}
+
+// describeEvent summarizes an event for a desktop notification
+func describeEvent(event Event) string {
+	if data, ok := event.Data.(map[string]string); ok {
+		if path := data["path"]; path != "" {
+			return event.Event + ": " + path
+		}
+		if commit := data["commit"]; commit != "" {
+			return event.Event + ": " + commit
+		}
+	}
+	return event.Event
+}
+
+// notifyDesktop shows a desktop notification using the platform's tool
+func notifyDesktop(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", message, title)
+		cmd = toolCommand("osascript", "-e", script)
+	case "linux", "freebsd", "openbsd":
+		cmd = toolCommand("notify-send", title, message)
+	default:
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEmitEvent(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Differing-Event") != eventFileSaved {
+			t.Errorf("X-Differing-Event = %q", r.Header.Get("X-Differing-Event"))
+		}
+		var event Event
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer server.Close()
+
+	runGit("config", "--add", "differing.webhook", server.URL)
+	emitEvent(eventFileSaved, map[string]string{"path": "test2.ts"})
+
+	select {
+	case event := <-received:
+		data, _ := event.Data.(map[string]any)
+		if event.Event != eventFileSaved || data["path"] != "test2.ts" {
+			t.Errorf("event = %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+}
+
+func TestCommitCreatedEvent(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer server.Close()
+	runGit("config", "--add", "differing.webhook", server.URL)
+
+	r := gin.New()
+	r.POST("/api/commit/:id/fixup", createFixup)
+	os.WriteFile(filepath.Join(repoDir, "test1.go"), []byte("package main\n\n// fixed\n"), 0644)
+	runGit("add", "test1.go")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/commit/HEAD~1/fixup", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("fixup = %d: %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case event := <-received:
+		data, _ := event.Data.(map[string]any)
+		if event.Event != eventCommitCreated || data["commit"] != currentHead() || data["action"] != "fixup" {
+			t.Errorf("event = %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+}
+
+func TestDeliverWebhookError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := deliverWebhook(server.URL, Event{Event: eventNoteUpdated}); err == nil {
+		t.Error("deliverWebhook() should fail on a 500 response")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Kinds of whitespace issue reported on added lines
+const (
+	wsTrailing    = "trailing-whitespace"
+	wsNoFinalNL   = "missing-final-newline"
+	wsMixedIndent = "mixed-indentation"
+)
+
+// WhitespaceIssue is a whitespace problem a diff introduces on a new-side line
+type WhitespaceIssue struct {
+	Line int    `json:"line"`
+	Kind string `json:"kind"`
+}
+
+// WhitespaceFix reports what POST /api/fix-whitespace changed
+type WhitespaceFix struct {
+	Path string `json:"path"`
+	// Lines are the new-side lines that were cleaned
+	Lines   []int  `json:"lines"`
+	Version string `json:"version"`
+}
+
+// addedLineNumbers returns the 1-based lines of newText that a line diff
+// against oldText marks as inserted
+func addedLineNumbers(oldText, newText string) map[int]bool {
+	dmp := diffmatchpatch.New()
+	a, b, lines := dmp.DiffLinesToRunes(oldText, newText)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMainRunes(a, b, false), lines)
+
+	added := make(map[int]bool)
+	line := 1
+	for _, d := range diffs {
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			line += len(splitLines(d.Text))
+		case diffmatchpatch.DiffInsert:
+			for range splitLines(d.Text) {
+				added[line] = true
+				line++
+			}
+		}
+	}
+	return added
+}
+
+// indentStyle returns '\t' or ' ' for the character most lines of text
+// are indented with, or 0 when no line is indented
+func indentStyle(lines []string) byte {
+	tabs, spaces := 0, 0
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			tabs++
+		case strings.HasPrefix(line, " "):
+			spaces++
+		}
+	}
+	switch {
+	case tabs == 0 && spaces == 0:
+		return 0
+	case tabs >= spaces:
+		return '\t'
+	default:
+		return ' '
+	}
+}
+
+// mixedIndent reports whether line's indentation has a space before a tab,
+// as git's space-before-tab check does, or starts with a different
+// character from the file's usual style
+func mixedIndent(line string, style byte) bool {
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	if indent == "" || indent == line {
+		return false
+	}
+	return strings.Contains(indent, " \t") || (style != 0 && indent[0] != style)
+}
+
+// whitespaceIssues lists the whitespace problems on the lines newText adds
+// to oldText. A missing final newline is only reported when the old
+// version ended with one, or did not exist.
+func whitespaceIssues(oldText, newText string, oldExists bool) []WhitespaceIssue {
+	if newText == "" {
+		return nil
+	}
+	lines := splitLines(newText)
+	added := addedLineNumbers(oldText, newText)
+	style := indentStyle(lines)
+
+	var issues []WhitespaceIssue
+	for i, line := range lines {
+		n := i + 1
+		if !added[n] {
+			continue
+		}
+		if strings.TrimRight(line, " \t") != line {
+			issues = append(issues, WhitespaceIssue{Line: n, Kind: wsTrailing})
+		}
+		if mixedIndent(line, style) {
+			issues = append(issues, WhitespaceIssue{Line: n, Kind: wsMixedIndent})
+		}
+	}
+	if !strings.HasSuffix(newText, "\n") && (!oldExists || oldText == "" || strings.HasSuffix(oldText, "\n")) {
+		issues = append(issues, WhitespaceIssue{Line: len(lines), Kind: wsNoFinalNL})
+	}
+	return issues
+}
+
+// fixWhitespace strips trailing whitespace from the lines newText adds and
+// restores a final newline the change removed, returning the cleaned text
+// and the lines changed. Indentation is left alone, since converting it
+// needs a tab width the file does not record.
+func fixWhitespace(oldText, newText string, oldExists bool) (string, []int) {
+	var fixed []int
+	for _, issue := range whitespaceIssues(oldText, newText, oldExists) {
+		if issue.Kind != wsMixedIndent && (len(fixed) == 0 || fixed[len(fixed)-1] != issue.Line) {
+			fixed = append(fixed, issue.Line)
+		}
+	}
+	if len(fixed) == 0 {
+		return newText, nil
+	}
+
+	lines := splitLinesKeepEnds(newText)
+	for _, n := range fixed {
+		line := lines[n-1]
+		body := strings.TrimSuffix(line, "\n")
+		ending := line[len(body):]
+		if strings.HasSuffix(body, "\r") {
+			body, ending = strings.TrimSuffix(body, "\r"), "\r"+ending
+		}
+		if ending == "" {
+			ending = "\n"
+		}
+		lines[n-1] = strings.TrimRight(body, " \t") + ending
+	}
+	return strings.Join(lines, ""), fixed
+}
+
+// postFixWhitespace cleans the whitespace a working tree change introduces
+// to a file, touching only the lines the diff adds. The diff is chosen with
+// ?id=, which defaults to working and must end at the working tree.
+func postFixWhitespace(c *gin.Context) {
+	filePath := filePathParam(c)
+	spec, err := resolveDiff(c.DefaultQuery("id", "working"), c.Query("mode"))
+	switch {
+	case errors.Is(err, errUnknownRevision):
+		respondError(c, http.StatusNotFound, err.Error(), err)
+		return
+	case err != nil:
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if spec.Head != "" || spec.Index {
+		respondError(c, http.StatusBadRequest, "Only diffs against the working tree can be fixed", nil)
+		return
+	}
+	if err := validateRepoPath(filePath); err != nil {
+		respondError(c, http.StatusForbidden, err.Error(), err)
+		return
+	}
+
+	var oldText string
+	oldExists := false
+	if spec.Base != "" {
+		sha, _, found, err := blobInfo(spec.Base, filePath)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to read old file version", err)
+			return
+		}
+		if found {
+			data, err := readBlob(sha)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, "Failed to read old file version", err)
+				return
+			}
+			oldText, _ = decodeContent(data)
+			oldExists = true
+		}
+	}
+
+	existing, err := secureRoot.ReadFile(filePath)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read file", err)
+		return
+	}
+	if isBinary(existing) {
+		respondError(c, http.StatusBadRequest, "Binary files cannot be fixed", nil)
+		return
+	}
+
+	// Compare as the diff view does, with the working tree's CRLF endings
+	// converted to git's LF
+	text, encoding := decodeContent(existing)
+	crlf := hasCRLF(existing)
+	if crlf {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	updated, fixed := fixWhitespace(oldText, text, oldExists)
+	result := WhitespaceFix{Path: filePath, Lines: fixed, Version: contentHash(existing)}
+	if len(fixed) == 0 {
+		result.Lines = []int{}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	data, err := encodeContent(updated, encoding)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if crlf {
+		data = toCRLF(data)
+	}
+	file, err := secureRoot.OpenFile(filePath, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to open file", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to write file", err)
+		return
+	}
+
+	recordSave(filePath, existing, data)
+	lspFileSaved(filePath, updated)
+	emitEvent(eventFileSaved, map[string]string{"path": filePath})
+	result.Version = contentHash(data)
+	c.JSON(http.StatusOK, result)
+}
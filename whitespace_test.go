@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWhitespaceIssues(t *testing.T) {
+	tests := []struct {
+		name      string
+		old, new  string
+		oldExists bool
+		want      []WhitespaceIssue
+	}{
+		{"clean", "a\n", "a\nb\n", true, nil},
+		{"existing trailing space is not flagged", "a \n", "a \nb \n", true, []WhitespaceIssue{{2, wsTrailing}}},
+		{"final newline removed", "a\n", "a\nb", true, []WhitespaceIssue{{2, wsNoFinalNL}}},
+		{"final newline already missing", "a", "a\nb", true, nil},
+		{"new file without final newline", "", "a", false, []WhitespaceIssue{{1, wsNoFinalNL}}},
+		{"space before tab", "", "x\n \tb\n", false, []WhitespaceIssue{{2, wsMixedIndent}}},
+		{"spaces in a tab file", "\ta\n\tb\n", "\ta\n\tb\n  c\n", true, []WhitespaceIssue{{3, wsMixedIndent}}},
+	}
+	for _, tt := range tests {
+		if got := whitespaceIssues(tt.old, tt.new, tt.oldExists); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFixWhitespace(t *testing.T) {
+	repoDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("Failed to change to test repo: %v", err)
+	}
+	gitRoot, err = getGitRoot()
+	if err != nil {
+		t.Fatalf("Failed to get git root: %v", err)
+	}
+	secureRoot, err = os.OpenRoot(gitRoot)
+	if err != nil {
+		t.Fatalf("Failed to create secure root: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/file-diff/:id/*filepath", getFileDiff)
+	r.POST("/api/fix-whitespace/*filepath", postFixWhitespace)
+
+	// Every line replaces the committed one-line test2.ts
+	os.WriteFile("test2.ts", []byte("export function world() {\n  return 'world';  \n}"), 0644)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/file-diff/working/test2.ts?whitespaceCheck=true", nil))
+	var diff FileDiff
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	want := []WhitespaceIssue{{2, wsTrailing}, {3, wsNoFinalNL}}
+	if !reflect.DeepEqual(diff.Whitespace, want) {
+		t.Errorf("whitespace = %+v, want %+v", diff.Whitespace, want)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fix-whitespace/test2.ts", nil))
+	var fix WhitespaceFix
+	json.Unmarshal(w.Body.Bytes(), &fix)
+	if w.Code != http.StatusOK || !reflect.DeepEqual(fix.Lines, []int{2, 3}) {
+		t.Errorf("fix = %d %+v", w.Code, fix)
+	}
+	data, _ := os.ReadFile("test2.ts")
+	if string(data) != "export function world() {\n  return 'world';\n}\n" || fix.Version != contentHash(data) {
+		t.Errorf("file = %q", data)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fix-whitespace/test2.ts?id=HEAD~1..HEAD", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("fix on a commit range = %d, want 400", w.Code)
+	}
+}